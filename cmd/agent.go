@@ -0,0 +1,395 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/exporter"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+const (
+	// defaultAgentAddress is the address the agent listens on unless
+	// "--listen" is set.
+	defaultAgentAddress = "127.0.0.1:8787"
+	// agentPprofKey is the configuration key exposing the profiles of the
+	// agent under /debug/pprof, for performance triage.
+	agentPprofKey = "agent_pprof"
+	// agentShutdownTimeout bounds how long the agent waits for requests in
+	// progress when it stops.
+	agentShutdownTimeout = 5 * time.Second
+)
+
+func init() {
+	rootCmd.AddCommand(agentCmd)
+	agentCmd.Flags().Bool("sidecar", false, "serve the environment over HTTP to the containers of the pod")
+	agentCmd.Flags().String("listen", defaultAgentAddress, "address to listen on")
+	agentCmd.Flags().Duration("interval", stacksenv.DefaultWatchInterval, "interval between environment refreshes without subscription")
+	agentCmd.Flags().Bool("allow-remote", false, "allow listening on an address reachable from other hosts")
+}
+
+var agentCmd = &cobra.Command{
+	Use:   "agent --sidecar",
+	Short: "Serve the environment to other containers",
+	Long: `Run stacksenv as a long-lived agent holding the credentials of the
+environment, so the application doesn't need them.
+
+With "--sidecar", the agent runs next to the application, e.g. as a sidecar
+container of a Kubernetes pod, and serves the environment over HTTP on the
+loopback interface, shared by the containers of the pod:
+
+  GET /env        the variables, as a JSON object, or in any format of
+                  "stacksenv env export" with "?format=" (e.g. ?format=shell)
+  GET /healthz    200 once the environment is fetched, 503 before
+
+The application fetches its environment at startup, so its image never
+contains stacksenv credentials:
+
+  eval "$(curl -fsS 'http://127.0.0.1:8787/env?format=shell')" && exec node server.js
+
+Like "stacksenv run --watch", the agent sends heartbeats to the server while
+it serves the environment if the remote opted in to them with "stacksenv
+remote heartbeat".
+
+The agent subscribes to the changes of the environment, so rotated values are
+picked up by the next application start. Servers without subscriptions are
+polled every "--interval" (default 30s) instead, as are servers whose
+subscription ends. If a refresh fails, the
+last environment keeps being served; if the credentials are revoked, the agent
+stops serving it and exits. The include and exclude patterns of the
+configuration apply.
+
+Only loopback addresses are accepted by "--listen", unless "--allow-remote" is
+set: the endpoint is not authenticated. Requests from web pages, with an
+Origin header, are rejected, as are requests for other hosts than localhost,
+the host of "--listen" and, with "--allow-remote", IP addresses. With "agent_pprof": true in the
+configuration, the profiles of the agent are served under /debug/pprof.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		sidecar, err := cmd.Flags().GetBool("sidecar")
+		if err != nil {
+			return err
+		}
+		listen, err := cmd.Flags().GetString("listen")
+		if err != nil {
+			return err
+		}
+		interval, err := cmd.Flags().GetDuration("interval")
+		if err != nil {
+			return err
+		}
+		allowRemote, err := cmd.Flags().GetBool("allow-remote")
+		if err != nil {
+			return err
+		}
+
+		if !sidecar {
+			return errors.New("only the sidecar mode is supported: pass --sidecar")
+		}
+		if interval <= 0 {
+			return fmt.Errorf("invalid interval %s: expected a positive duration", interval)
+		}
+		if !allowRemote && !isLoopbackAddress(listen) {
+			return fmt.Errorf("refusing to serve the environment on %s without authentication: listen on a loopback address or pass --allow-remote", listen)
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+		config, err := resolveStacksenvConfig(v)
+		if err != nil {
+			return err
+		}
+		if err := checkMinServerVersion(v, config); err != nil {
+			return err
+		}
+		service, err := newInjectingClientService(v)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signalContext()
+		defer stop()
+		return runSidecar(ctx, v, listen, allowRemote, &environmentSource{service: service, config: config}, interval)
+	},
+}
+
+// environmentSource holds the last environment fetched by the agent.
+type environmentSource struct {
+	service stacksenv.ClientService
+	config  *stacksenv.Config
+
+	mu     sync.RWMutex
+	values map[string]string // nil until the first successful fetch
+}
+
+// refresh fetches the environment and keeps it if the fetch succeeds. It
+// reports whether the environment changed.
+func (s *environmentSource) refresh(ctx context.Context) (bool, error) {
+	return s.update(stacksenv.FetchWithContext(ctx, s.service, s.config))
+}
+
+// update keeps the fetched environment, unless the fetch failed, and drops it
+// if the credentials are revoked. It reports whether the environment changed.
+func (s *environmentSource) update(properties []stacksenv.ContextData[any], err error) (bool, error) {
+	if err != nil {
+		if errors.Is(err, stacksenv.ErrRevoked) {
+			s.mu.Lock()
+			s.values = nil
+			s.mu.Unlock()
+		}
+		return false, err
+	}
+	values := contextDataToMap(properties)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := s.values == nil || !maps.Equal(s.values, values)
+	s.values = values
+	return changed, nil
+}
+
+// variables returns the last environment fetched, or nil if none was.
+func (s *environmentSource) variables() []exporter.Variable {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.values == nil {
+		return nil
+	}
+	return exporter.FromMap(s.values)
+}
+
+// runSidecar serves the environment of source on listen, refreshing it every
+// interval, until ctx is done or the credentials are revoked. With
+// allowRemote, requests for any IP address of the host are served, see
+// sidecarHostAllowed. If the remote opted in to heartbeats, they are sent
+// while the environment is served, like by "stacksenv run --watch".
+func runSidecar(ctx context.Context, v *viper.Viper, listen string, allowRemote bool, source *environmentSource, interval time.Duration) error {
+	var heartbeatEvery time.Duration
+	var httpClient stacksenv.HTTPClient
+	if heartbeatEnabled(v) {
+		var err error
+		if heartbeatEvery, err = heartbeatInterval(v); err != nil {
+			return err
+		}
+		if httpClient, err = newHTTPClient(v); err != nil {
+			return err
+		}
+	}
+
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", listen, err)
+	}
+	handler := sidecarGuard(sidecarHandler(source, v.GetBool(agentPprofKey)), listen, allowRemote)
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+	fmt.Fprintf(os.Stderr, "stacksenv: serving the environment on http://%s/env\n", listener.Addr())
+
+	refreshErr := make(chan error, 1)
+	go func() {
+		refreshErr <- refreshEnvironment(ctx, source, interval)
+	}()
+
+	// The heartbeats stop with the sidecar, also when the credentials are
+	// revoked
+	heartbeatCtx, stopHeartbeats := context.WithCancel(ctx)
+	var heartbeats sync.WaitGroup
+	defer heartbeats.Wait()
+	defer stopHeartbeats()
+	if httpClient != nil {
+		heartbeats.Go(func() {
+			sendHeartbeats(heartbeatCtx, httpClient, *source.config, heartbeatEvery)
+		})
+	}
+
+	select {
+	case err = <-serveErr:
+		return fmt.Errorf("failed to serve the environment: %w", err)
+	case err = <-refreshErr:
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), agentShutdownTimeout)
+	defer cancel()
+	if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+		debugLog("Failed to shut down the agent: %v", shutdownErr)
+	}
+	return err
+}
+
+// refreshEnvironment keeps the environment of source up to date until ctx is
+// done: it subscribes to its changes, or fetches it every interval if the
+// server doesn't support subscriptions or the subscription ends. Failed
+// fetches are logged and retried, except revocations, which are returned.
+func refreshEnvironment(ctx context.Context, source *environmentSource, interval time.Duration) error {
+	// report logs the outcome of a fetch and returns the revocation error
+	report := func(changed bool, err error) error {
+		switch {
+		case errors.Is(err, stacksenv.ErrRevoked):
+			return handleRevoked(logRequestID(fmt.Errorf("unable to retrieve environment context data: %w", err)))
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "stacksenv: failed to refresh the environment: %v\n", err)
+		case changed:
+			fmt.Fprintf(os.Stderr, "stacksenv: environment updated (%d variables)\n", len(source.variables()))
+		}
+		return nil
+	}
+
+	events, err := stacksenv.SubscribeWithContext(ctx, source.service, source.config)
+	if err == nil {
+		for event := range events {
+			if err := report(source.update(event.Variables, event.Err)); err != nil {
+				return err
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "stacksenv: subscription to environment changes ended, refreshing every %s\n", interval)
+	} else {
+		debugLog("Refreshing the environment every %s: %v", interval, err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		changed, err := source.refresh(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := report(changed, err); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// sidecarHandler returns the handler of the sidecar endpoints serving the
+// environment of source, and the profiling endpoints with pprof.
+func sidecarHandler(source *environmentSource, withPprof bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /env", func(w http.ResponseWriter, r *http.Request) {
+		vars := source.variables()
+		if vars == nil {
+			http.Error(w, "environment not fetched yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "json"
+		}
+		e, err := exporter.Get(format)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var buf bytes.Buffer
+		if err := e.Export(&buf, vars); err != nil {
+			http.Error(w, fmt.Sprintf("failed to export variables as %s", e.Name()), http.StatusInternalServerError)
+			return
+		}
+
+		contentType := "text/plain; charset=utf-8"
+		if e.Name() == "json" {
+			contentType = "application/json"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		// Responses hold secrets
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(buf.Bytes()) //nolint:errcheck
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		if source.variables() == nil {
+			http.Error(w, "environment not fetched yet", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+
+	if withPprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return mux
+}
+
+// sidecarGuard rejects the requests to handler that may come from a web
+// page: those with an Origin header, sent by browsers, and those for a Host
+// not allowed by sidecarHostAllowed, e.g. a domain rebound to the loopback
+// interface by its owner to read the environment.
+func sidecarGuard(handler http.Handler, listen string, allowRemote bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" {
+			http.Error(w, "requests from web pages are not allowed", http.StatusForbidden)
+			return
+		}
+		if !sidecarHostAllowed(r.Host, listen, allowRemote) {
+			http.Error(w, fmt.Sprintf("host %q is not allowed", r.Host), http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// sidecarHostAllowed reports whether the sidecar listening on listen serves
+// requests for host: a loopback address or localhost, the host of listen, or
+// with allowRemote any IP address. Domain names are never allowed otherwise,
+// as their owners can point them at any address.
+func sidecarHostAllowed(host, listen string, allowRemote bool) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	if listenHost, _, err := net.SplitHostPort(listen); err == nil && listenHost != "" && strings.EqualFold(host, listenHost) {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || allowRemote)
+}
+
+// isLoopbackAddress reports whether a listen address only accepts
+// connections from the local host.
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+	"go.uber.org/goleak"
+)
+
+// staticClientService serves the same environment on every fetch, and
+// subscriptions staying open until their context is done if subscribe is
+// set.
+type staticClientService struct {
+	subscribe bool
+}
+
+func (s *staticClientService) GetContextDecryptedData(*stacksenv.Config) ([]stacksenv.ContextData[any], error) {
+	return []stacksenv.ContextData[any]{{Property: "X", Value: "1"}}, nil
+}
+
+func (s *staticClientService) Subscribe(ctx context.Context, config *stacksenv.Config) (<-chan stacksenv.EnvironmentEvent, error) {
+	if !s.subscribe {
+		return nil, stacksenv.ErrServerUnreachable
+	}
+	events := make(chan stacksenv.EnvironmentEvent)
+	go func() {
+		defer close(events)
+		variables, err := s.GetContextDecryptedData(config)
+		select {
+		case events <- stacksenv.EnvironmentEvent{Variables: variables, Err: err}:
+		case <-ctx.Done():
+			return
+		}
+		<-ctx.Done()
+	}()
+	return events, nil
+}
+
+// freeAddress returns a loopback address nothing listens on.
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// sidecarUntilCancel runs the sidecar with service, cancels it once it
+// serves the environment, and checks that it returns and stops serving.
+func sidecarUntilCancel(t *testing.T, service stacksenv.ClientService, interval time.Duration) {
+	t.Helper()
+	address := freeAddress(t)
+	source := &environmentSource{service: service, config: &stacksenv.Config{ID: "env", Branch: "main"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- runSidecar(ctx, viper.New(), address, false, source, interval)
+	}()
+
+	httpClient := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: time.Second}
+	url := fmt.Sprintf("http://%s/env", address)
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		resp, err := httpClient.Get(url)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body) //nolint:errcheck
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the sidecar didn't serve the environment: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("the sidecar returned %v after the cancellation, want nil", err)
+		}
+	case <-time.After(agentShutdownTimeout):
+		t.Fatal("the sidecar didn't return after the cancellation")
+	}
+	if _, err := httpClient.Get(url); err == nil {
+		t.Fatal("the sidecar still serves after it returned")
+	}
+}
+
+func TestRunSidecarStopsOnCancel(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	sidecarUntilCancel(t, &staticClientService{subscribe: true}, time.Hour)
+}
+
+func TestRunSidecarStopsOnCancelWhilePolling(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	sidecarUntilCancel(t, &staticClientService{}, 10*time.Millisecond)
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/stacksenv/cli/pkg/configstore"
+)
+
+// Actions recorded in the audit log.
+const (
+	auditActionReveal  = "reveal"
+	auditActionSet     = "set"
+	auditActionUnset   = "unset"
+	auditActionRestore = "restore"
+)
+
+// auditEvent is an entry of the local audit log. It never holds values.
+type auditEvent struct {
+	Time        time.Time `json:"time"`
+	Action      string    `json:"action"`
+	User        string    `json:"user,omitempty"`
+	Server      string    `json:"server,omitempty"`
+	Environment string    `json:"environment,omitempty"`
+	Branch      string    `json:"branch,omitempty"`
+	Key         string    `json:"key,omitempty"`
+}
+
+// auditLogName is the name of the audit log files.
+const auditLogName = "audit.log"
+
+func init() {
+	operations.subscribe("audit", auditOperation, eventWritten, eventRevealed)
+	operations.subscribe("audit", func(event *operationEvent) error {
+		return purgeLegacyAuditEvents(event.Server, event.Environment)
+	}, eventTenantPurged)
+}
+
+// auditOperation records every variable written or revealed by an operation
+// in the audit log, and stops at the first failure.
+func auditOperation(event *operationEvent) error {
+	for _, key := range event.Keys {
+		err := recordAudit(auditEvent{
+			Action:      event.Action,
+			Server:      event.Server,
+			Environment: event.Environment,
+			Branch:      event.Branch,
+			Key:         key,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record the %s of %s in the audit log: %w", event.Action, key, err)
+		}
+	}
+	return nil
+}
+
+// getAuditLogPath returns the path to the local audit log of a tenant.
+func getAuditLogPath(server, environment string) (string, error) {
+	tenantDir, err := getTenantDir(server, environment)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(tenantDir, auditLogName), nil
+}
+
+// recordAudit appends an event to the local audit log of the tenant of its
+// server and environment, one JSON object per line. The time and the user are
+// filled in if they are unset.
+func recordAudit(event auditEvent) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.User == "" {
+		if u, err := user.Current(); err == nil {
+			event.User = u.Username
+		}
+	}
+
+	path, err := getAuditLogPath(event.Server, event.Environment)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	debugLog("Recorded %s in the audit log", event.Action)
+	return nil
+}
+
+// purgeLegacyAuditEvents removes the events of a tenant from the audit log
+// shared by all tenants in earlier versions.
+func purgeLegacyAuditEvents(server, environment string) error {
+	dataDir, err := getDataDir()
+	if err != nil {
+		return err
+	}
+	_, err = filterAuditLog(filepath.Join(dataDir, auditLogName), func(event auditEvent) bool {
+		return sameTenant(event.Server, event.Environment, server, environment)
+	}, false)
+	return err
+}
+
+// filterAuditLog removes the events of an audit log for which drop returns
+// true, and returns how many. Lines that can't be decoded are kept. With
+// dryRun, the events are only counted.
+func filterAuditLog(path string, drop func(event auditEvent) bool, dryRun bool) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	var kept bytes.Buffer
+	dropped := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		var event auditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err == nil && drop(event) {
+			dropped++
+			continue
+		}
+		kept.Write(scanner.Bytes())
+		kept.WriteByte('\n')
+	}
+	if dropped == 0 || dryRun {
+		return dropped, nil
+	}
+	if kept.Len() == 0 {
+		if err := os.Remove(path); err != nil {
+			return 0, fmt.Errorf("failed to remove audit log: %w", err)
+		}
+		return dropped, nil
+	}
+	return dropped, configstore.WriteFileAtomic(path, kept.Bytes(), 0600)
+}
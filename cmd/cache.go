@@ -0,0 +1,589 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+const (
+	// offlineCacheKey is the configuration key enabling the offline cache.
+	offlineCacheKey = "offline_cache"
+	// cacheMaxSizeKey is the configuration key limiting the size of the
+	// offline cache, e.g. "10MB".
+	cacheMaxSizeKey = "cache_max_size"
+	// cacheMaxAgeKey is the configuration key limiting how old a cached
+	// environment may be to be used, e.g. "72h".
+	cacheMaxAgeKey = "cache_max_age"
+	// noCacheFlag is the flag bypassing the offline cache for one command.
+	noCacheFlag = "no-cache"
+)
+
+const (
+	// defaultCacheMaxSize is the size limit of the offline cache unless
+	// configured otherwise.
+	defaultCacheMaxSize = 10 << 20
+	// defaultCacheMaxAge is the age limit of cached environments unless
+	// configured otherwise.
+	defaultCacheMaxAge = 7 * 24 * time.Hour
+)
+
+// cacheEntry is an environment stored in the offline cache. The variables
+// are stored encrypted the way the server sends them.
+type cacheEntry struct {
+	Remote      string    `json:"remote,omitempty"`
+	Server      string    `json:"server"`
+	Environment string    `json:"environment"`
+	Branch      string    `json:"branch"`
+	FetchedAt   time.Time `json:"fetched_at"`
+	Data        string    `json:"data"`
+
+	path     string    // file of the entry
+	size     int64     // size of the file
+	lastUsed time.Time // modification time of the file, updated on use
+}
+
+// cachingClientService is a stacksenv.ClientService storing every fetched
+// environment in the offline cache and falling back to it when the server
+// can't be reached.
+type cachingClientService struct {
+	stacksenv.ClientService
+	remote  string
+	maxSize int64
+	maxAge  time.Duration
+}
+
+func init() {
+	// Nothing fetched with credentials outlives them
+	operations.subscribe("cache", func(*operationEvent) error {
+		return purgeCache()
+	}, eventRevoked, eventLoggedOut)
+	operations.subscribe("cache", func(event *operationEvent) error {
+		return purgeLegacyCacheEntries(event.Server, event.Environment)
+	}, eventTenantPurged)
+
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheStatusCmd)
+	cacheCmd.AddCommand(cachePurgeCmd)
+	addTableFlags(cacheStatusCmd)
+	cachePurgeCmd.Flags().String("remote", "", "only purge the environments fetched through this remote")
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the offline cache",
+	Long: `Manage the offline cache.
+
+With "offline_cache": true in the configuration, every environment fetched
+from the server is stored in ~/.stacksenv/tenants (or
+$XDG_DATA_HOME/stacksenv/tenants in the XDG layout, see "stacksenv --help"),
+in a directory of its server and environment ID, encrypted with the secret
+key of its credentials. When the server can't be reached, commands fall back to
+the cached environment and say so on stderr. Revoked credentials are never
+served from the cache: a revocation purges it.
+
+The cache is limited by "cache_max_size" (default 10MB): the least recently
+used environments are evicted first. Environments older than "cache_max_age"
+(default 168h) are not used and are evicted.
+
+"--no-cache" bypasses the cache for one command: the environment is fetched
+from the server, not stored, and the command fails if the server can't be
+reached.`,
+}
+
+var cacheStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the cached environments",
+	Long:  `Show the cached environments with their remote, server, environment ID, branch, age and size.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+		maxSize, maxAge, err := cacheLimits(v)
+		if err != nil {
+			return err
+		}
+		entries, err := readCacheEntries()
+		if err != nil {
+			return err
+		}
+
+		sw, err := newTableWriter(cmd, os.Stdout, "REMOTE", "SERVER", "ENVIRONMENT", "BRANCH", "AGE", "SIZE")
+		if err != nil {
+			return err
+		}
+		var total int64
+		for _, entry := range entries {
+			total += entry.size
+			remote := entry.Remote
+			if remote == "" {
+				remote = "-"
+			}
+			age := time.Since(entry.FetchedAt).Round(time.Second).String()
+			if time.Since(entry.FetchedAt) > maxAge {
+				age += " (expired)"
+			}
+			if err := sw.Write(remote, entry.Server, entry.Environment, entry.Branch, age, formatByteSize(entry.size)); err != nil {
+				return err
+			}
+		}
+		if err := sw.Flush(); err != nil {
+			return err
+		}
+
+		state := "disabled"
+		if v.GetBool(offlineCacheKey) {
+			state = "enabled"
+		}
+		fmt.Fprintf(os.Stderr, "%d entries, %s of %s (offline cache %s)\n", len(entries), formatByteSize(total), formatByteSize(maxSize), state)
+		return nil
+	},
+}
+
+var cachePurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Remove cached environments",
+	Long:  `Remove all cached environments, or with "--remote" only those fetched through that remote.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		remote, err := cmd.Flags().GetString("remote")
+		if err != nil {
+			return err
+		}
+
+		if remote == "" {
+			if err := purgeCache(); err != nil {
+				return err
+			}
+			fmt.Println("Purged the offline cache")
+			return nil
+		}
+
+		entries, err := readCacheEntries()
+		if err != nil {
+			return err
+		}
+		purged := 0
+		for _, entry := range entries {
+			if !strings.EqualFold(entry.Remote, remote) {
+				continue
+			}
+			if err := os.Remove(entry.path); err != nil {
+				return fmt.Errorf("failed to remove cache entry: %w", err)
+			}
+			purged++
+		}
+		fmt.Printf("Purged %d cached environments of remote %s\n", purged, strings.ToLower(remote))
+		return nil
+	},
+}
+
+// purgeLegacyCacheEntries removes the cached environments of a tenant from
+// the cache directory shared by all tenants in earlier versions.
+func purgeLegacyCacheEntries(server, environment string) error {
+	dataDir, err := getDataDir()
+	if err != nil {
+		return err
+	}
+	entries, err := readCacheEntries()
+	if err != nil {
+		return err
+	}
+	legacyCacheDir := filepath.Join(dataDir, "cache")
+	for _, entry := range entries {
+		if filepath.Dir(entry.path) == legacyCacheDir && sameTenant(entry.Server, entry.Environment, server, environment) {
+			if err := os.Remove(entry.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to remove cache entry: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// newClientService returns the client service commands fetch environments
+// with: the default one with the configured codec, wrapped by the offline
+// cache if it is enabled and not bypassed with --no-cache.
+func newClientService(v *viper.Viper) (stacksenv.ClientService, error) {
+	service, err := newServerClientService(v)
+	if err != nil {
+		return nil, err
+	}
+	if !v.GetBool(offlineCacheKey) || v.GetBool(noCacheFlag) {
+		return service, nil
+	}
+
+	maxSize, maxAge, err := cacheLimits(v)
+	if err != nil {
+		return nil, err
+	}
+	return &cachingClientService{ClientService: service, remote: usedRemote(v), maxSize: maxSize, maxAge: maxAge}, nil
+}
+
+// newServerClientService returns the default client service with the
+// configured codec and transport, always talking to the server. It writes
+// environments as well: writes must never be based on a cached environment.
+func newServerClientService(v *viper.Viper) (stacksenv.ClientService, error) {
+	codec, err := configuredCodec(v)
+	if err != nil {
+		return nil, err
+	}
+	options, err := httpOptions(v)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := configuredTransport(v)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := stacksenv.NewHTTPClientWithOptions(options)
+	// Event streams last as long as their subscription
+	options.Timeout = 0
+	streamClient := stacksenv.NewHTTPClientWithOptions(options)
+	return stacksenv.NewClientServiceWithOptions(httpClient, stacksenv.NewCryptoService(), stacksenv.ClientServiceOptions{
+		Codec:        codec,
+		Logger:       newLogger(),
+		Transport:    transport,
+		StreamClient: streamClient,
+	}), nil
+}
+
+// configuredTransport returns the transport selected by "transport", nil
+// for the default HTTP transport of the client service.
+func configuredTransport(v *viper.Viper) (stacksenv.Transport, error) {
+	switch name := v.GetString(transportKey); name {
+	case "", "http":
+		return nil, nil
+	case "grpc":
+		options, err := httpOptions(v)
+		if err != nil {
+			return nil, err
+		}
+		return stacksenv.NewGRPCTransport(options), nil
+	default:
+		return nil, fmt.Errorf("invalid %s %q: expected one of %s", transportKey, name, strings.Join(transportNames, ", "))
+	}
+}
+
+// GetContextDecryptedData fetches the environment from the server and caches
+// it, or returns the cached environment if the server can't be reached.
+func (s *cachingClientService) GetContextDecryptedData(config *stacksenv.Config) ([]stacksenv.ContextData[any], error) {
+	return s.GetContextDecryptedDataContext(context.Background(), config)
+}
+
+// GetContextDecryptedDataContext is like GetContextDecryptedData but aborts the
+// fetch when ctx is done. An aborted fetch doesn't fall back to the cache.
+func (s *cachingClientService) GetContextDecryptedDataContext(ctx context.Context, config *stacksenv.Config) ([]stacksenv.ContextData[any], error) {
+	properties, err := stacksenv.FetchWithContext(ctx, s.ClientService, config)
+	// Tombstones are only fetched on request and don't belong in the cache
+	if config.IncludeDeleted {
+		return properties, err
+	}
+
+	if err == nil {
+		if err := s.store(config, properties); err != nil {
+			debugLog("Failed to cache the environment: %v", err)
+		}
+		return properties, nil
+	}
+
+	if !errors.Is(err, stacksenv.ErrServerUnreachable) || ctx.Err() != nil {
+		return nil, err
+	}
+	entry, cacheErr := s.load(config)
+	if cacheErr != nil {
+		debugLog("No usable cached environment: %v", cacheErr)
+		return nil, err
+	}
+	cached, cacheErr := stacksenv.Decrypt(entry.Data, config.SecretKey, cacheAAD(config))
+	if cacheErr != nil {
+		debugLog("Failed to decrypt the cached environment: %v", cacheErr)
+		return nil, err
+	}
+
+	fmt.Fprintf(os.Stderr, "stacksenv: server unreachable - using the environment cached %s ago\n", time.Since(entry.FetchedAt).Round(time.Second))
+	return cached, nil
+}
+
+// Subscribe subscribes to the changes of the environment on the server and
+// caches every changed environment. Subscriptions don't fall back to the
+// cache: the events of an unreachable server are errors.
+func (s *cachingClientService) Subscribe(ctx context.Context, config *stacksenv.Config) (<-chan stacksenv.EnvironmentEvent, error) {
+	events, err := stacksenv.SubscribeWithContext(ctx, s.ClientService, config)
+	if err != nil || config.IncludeDeleted {
+		return events, err
+	}
+	return relayEvents(ctx, events, func(event *stacksenv.EnvironmentEvent) {
+		if event.Err != nil {
+			return
+		}
+		if err := s.store(config, event.Variables); err != nil {
+			debugLog("Failed to cache the environment: %v", err)
+		}
+	}), nil
+}
+
+// store writes the environment to the cache and evicts the least recently
+// used entries beyond the size limit.
+func (s *cachingClientService) store(config *stacksenv.Config, properties []stacksenv.ContextData[any]) error {
+	data, err := stacksenv.Encrypt(properties, config.SecretKey, cacheAAD(config))
+	if err != nil {
+		return err
+	}
+	entry := cacheEntry{
+		Remote:      s.remote,
+		Server:      config.ServerURL,
+		Environment: config.ID,
+		Branch:      config.Branch,
+		FetchedAt:   time.Now().UTC(),
+		Data:        data,
+	}
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	path, err := cacheEntryPath(config)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		return err
+	}
+	return evictCacheEntries(s.maxSize, s.maxAge)
+}
+
+// load returns the cached environment of config if it isn't too old, and
+// marks it as used.
+func (s *cachingClientService) load(config *stacksenv.Config) (*cacheEntry, error) {
+	path, err := cacheEntryPath(config)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := readCacheEntry(path)
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(entry.FetchedAt) > s.maxAge {
+		return nil, fmt.Errorf("cached environment is older than %s", s.maxAge)
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return entry, nil
+}
+
+// cacheAAD returns the additional authenticated data cached environments of
+// config are encrypted with, binding them to its credentials.
+func cacheAAD(config *stacksenv.Config) string {
+	return config.Secret + "|" + config.SecretKey
+}
+
+// cacheEntryPath returns the file caching the environment of config, in the
+// directory of its tenant. The name is derived from the server, environment
+// ID, branch and personal overlay setting, so it doesn't reveal them.
+func cacheEntryPath(config *stacksenv.Config) (string, error) {
+	tenantDir, err := getTenantDir(config.ServerURL, config.ID)
+	if err != nil {
+		return "", err
+	}
+	cacheDir := filepath.Join(tenantDir, "cache")
+	sum := sha256.Sum256([]byte(strings.Join([]string{config.ServerURL, config.ID, config.Branch, strconv.FormatBool(config.NoPersonal)}, "\x00")))
+	return filepath.Join(cacheDir, hex.EncodeToString(sum[:16])+".json"), nil
+}
+
+// readCacheEntry reads a cache entry file.
+func readCacheEntry(path string) (*cacheEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(content, &entry); err != nil {
+		return nil, fmt.Errorf("invalid cache entry %s: %w", path, err)
+	}
+	entry.path, entry.size, entry.lastUsed = path, info.Size(), info.ModTime()
+	return &entry, nil
+}
+
+// readCacheEntries returns the entries of the offline cache of every tenant,
+// most recently used first. Unreadable entries are skipped.
+func readCacheEntries() ([]*cacheEntry, error) {
+	cacheDirs, err := getCacheDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*cacheEntry
+	for _, cacheDir := range cacheDirs {
+		files, err := os.ReadDir(cacheDir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cache: %w", err)
+		}
+		for _, file := range files {
+			if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+				continue
+			}
+			entry, err := readCacheEntry(filepath.Join(cacheDir, file.Name()))
+			if err != nil {
+				debugLog("Skipping cache entry: %v", err)
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+	slices.SortFunc(entries, func(a, b *cacheEntry) int {
+		return b.lastUsed.Compare(a.lastUsed)
+	})
+	return entries, nil
+}
+
+// evictCacheEntries removes the entries older than maxAge and then the least
+// recently used ones until the cache fits in maxSize.
+func evictCacheEntries(maxSize int64, maxAge time.Duration) error {
+	evicted, err := cacheEvictions(maxSize, maxAge)
+	if err != nil {
+		return err
+	}
+	for _, entry := range evicted {
+		if err := os.Remove(entry.path); err != nil {
+			return err
+		}
+		debugLog("Evicted cached environment %s/%s", entry.Environment, entry.Branch)
+	}
+	return nil
+}
+
+// cacheEvictions returns the entries evictCacheEntries removes: the entries
+// older than maxAge and the least recently used ones beyond maxSize.
+func cacheEvictions(maxSize int64, maxAge time.Duration) ([]*cacheEntry, error) {
+	entries, err := readCacheEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, entry := range entries {
+		total += entry.size
+	}
+	var evicted []*cacheEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if total <= maxSize && time.Since(entry.FetchedAt) <= maxAge {
+			continue
+		}
+		evicted = append(evicted, entry)
+		total -= entry.size
+	}
+	return evicted, nil
+}
+
+// cacheLimits returns the configured size and age limits of the offline
+// cache.
+func cacheLimits(v *viper.Viper) (int64, time.Duration, error) {
+	maxSize := int64(defaultCacheMaxSize)
+	if configured := v.Get(cacheMaxSizeKey); configured != nil {
+		size, err := configByteSize(configured)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid %s: %w", cacheMaxSizeKey, err)
+		}
+		maxSize = size
+	}
+
+	maxAge := defaultCacheMaxAge
+	if configured := v.GetString(cacheMaxAgeKey); configured != "" {
+		age, err := time.ParseDuration(configured)
+		if err != nil || age <= 0 {
+			return 0, 0, fmt.Errorf("invalid %s %q: expected a positive duration like \"72h\"", cacheMaxAgeKey, configured)
+		}
+		maxAge = age
+	}
+	return maxSize, maxAge, nil
+}
+
+// byteSizeUnits are the suffixes accepted by parseByteSize.
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// parseByteSize parses a size in bytes, optionally followed by B, KB, MB or
+// GB (powers of 1024).
+func parseByteSize(s string) (int64, error) {
+	number, unit := strings.ToUpper(strings.TrimSpace(s)), int64(1)
+	for _, u := range byteSizeUnits {
+		if trimmed, ok := strings.CutSuffix(number, u.suffix); ok {
+			number, unit = strings.TrimSpace(trimmed), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: expected e.g. 512KB or 10MB", s)
+	}
+	return n * unit, nil
+}
+
+// configByteSize converts a configuration value to a size in bytes: a number
+// of bytes or a string accepted by parseByteSize.
+func configByteSize(value interface{}) (int64, error) {
+	switch value := value.(type) {
+	case int:
+		return configByteSize(int64(value))
+	case int64:
+		if value < 0 {
+			return 0, fmt.Errorf("invalid size %d: must not be negative", value)
+		}
+		return value, nil
+	case uint64:
+		return configByteSize(int64(value))
+	case float64:
+		if value != math.Trunc(value) {
+			return 0, fmt.Errorf("invalid size %v: expected a whole number of bytes", value)
+		}
+		return configByteSize(int64(value))
+	case string:
+		return parseByteSize(value)
+	}
+	return 0, fmt.Errorf("invalid size %v: expected a number of bytes or e.g. \"10MB\"", value)
+}
+
+// formatByteSize formats a size in bytes for display.
+func formatByteSize(n int64) string {
+	for _, u := range byteSizeUnits {
+		if n >= u.size && u.size > 1 {
+			return strconv.FormatFloat(float64(n)/float64(u.size), 'f', 1, 64) + u.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
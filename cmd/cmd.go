@@ -2,27 +2,47 @@ package cmd
 
 import (
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
+
+	"github.com/spf13/cobra"
 )
 
 // Execute executes the commands.
 func Execute() error {
+	// Docker runs its credential helpers as docker-credential-<name>
+	if name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe"); name == dockerHelperName {
+		rootCmd.SetArgs(append([]string{"credential-helper", "docker"}, os.Args[1:]...))
+		return rootCmd.Execute()
+	}
+
 	// Disable flag parsing if args should be passed to system commands
 	if len(os.Args) > 1 {
 		firstArg := os.Args[1]
 
-		// List of known stacksenv commands
-		knownCommands := []string{"set", "init", "update", "remote", "version"}
-
 		// If first arg starts with stacksenv://, disable flag parsing
 		if strings.HasPrefix(firstArg, "stacksenv://") {
 			rootCmd.DisableFlagParsing = true
-		} else if !slices.Contains(knownCommands, firstArg) && !strings.HasPrefix(firstArg, "-") {
+		} else if !slices.Contains(knownCommands(), firstArg) && !strings.HasPrefix(firstArg, "-") {
 			// If it's not a known command, disable flag parsing to pass args to system commands
 			rootCmd.DisableFlagParsing = true
 		}
 	}
 
+	// Profiles must be flushed even when the command fails
+	defer func() { stopProfiling() }()
+
 	return rootCmd.Execute()
 }
+
+// knownCommands returns the names and aliases of the stacksenv commands, with
+// the hidden commands cobra adds when executing to serve completions.
+func knownCommands() []string {
+	names := []string{cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd}
+	for _, cmd := range rootCmd.Commands() {
+		names = append(names, cmd.Name())
+		names = append(names, cmd.Aliases...)
+	}
+	return names
+}
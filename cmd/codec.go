@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+// codecKey is the configuration key selecting the codec decoding the
+// responses of the server, for servers with a different response envelope.
+const codecKey = "codec"
+
+// configuredCodec returns the codec selected by the configuration,
+// stacksenv.DefaultCodec unless configured otherwise.
+func configuredCodec(v *viper.Viper) (stacksenv.Codec, error) {
+	return stacksenv.GetCodec(v.GetString(codecKey))
+}
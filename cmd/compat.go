@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(compatCmd)
+	compatCmd.AddCommand(compatDopplerCmd)
+	compatCmd.AddCommand(compatEnvkeySourceCmd)
+	compatCmd.AddCommand(compatDotenvVaultCmd)
+
+	compatDopplerCmd.AddCommand(compatDopplerRunCmd)
+	compatDopplerCmd.AddCommand(compatDopplerSecretsCmd)
+	compatDopplerSecretsCmd.AddCommand(compatDopplerDownloadCmd)
+	// Doppler's --config/-c names an environment and shadows the --config of
+	// stacksenv, which the adapter takes as --stacksenv-config
+	compatDopplerCmd.PersistentFlags().StringP("config", "c", "", "Doppler config (environment) to use, mapped to the stacksenv branch")
+	compatDopplerCmd.PersistentFlags().String("stacksenv-config", "", "stacksenv config file path, passed as --config to the stacksenv command")
+	compatDopplerCmd.PersistentFlags().StringP("project", "p", "", "project to use (ignored: the configured stacksenv environment is used)")
+	compatDopplerRunCmd.Flags().String("command", "", "command to run with the shell")
+	compatDopplerRunCmd.Flags().Bool("watch", false, "restart the command when the secrets change")
+	compatDopplerDownloadCmd.Flags().Bool("no-file", false, "print the secrets instead of writing them to a file")
+	compatDopplerDownloadCmd.Flags().String("format", "json", "output format: json, env or yaml")
+
+	compatDotenvVaultCmd.AddCommand(compatDotenvVaultPullCmd)
+}
+
+var compatCmd = &cobra.Command{
+	Use:   "compat",
+	Short: "Run stacksenv with the command lines of other secret managers",
+	Long: `Adapters accepting the common command lines of other secret managers, so
+scripts, Makefiles and CI pipelines keep working while a team moves to
+stacksenv:
+
+  stacksenv compat doppler run [-c <config>] -- <command>
+  stacksenv compat doppler secrets [download --no-file --format env]
+  stacksenv compat envkey-source [-- <command>]
+  stacksenv compat dotenv-vault pull [<environment>] [<file>]
+
+Each adapter translates its arguments to the equivalent stacksenv command,
+prints that command to stderr unless "--quiet" is given, and runs it with
+the stacksenv configuration. Environments of the other tools map to stacksenv
+branches. Flags without an equivalent are rejected rather than ignored,
+except where noted.`,
+}
+
+var compatDopplerCmd = &cobra.Command{
+	Use:   "doppler",
+	Short: "Adapter for the Doppler CLI",
+	Long: `Adapter for the Doppler CLI. "--config" (-c) names a Doppler config, as with
+the Doppler CLI, and maps to the stacksenv branch, so the path of the stacksenv
+configuration file is given with "--stacksenv-config" instead. "--project" is
+accepted but ignored, as the configured stacksenv environment is used.`,
+}
+
+var compatDopplerRunCmd = &cobra.Command{
+	Use:   "run [flags] -- <command> [args...]",
+	Short: `Translate "doppler run" to "stacksenv run"`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if command, _ := cmd.Flags().GetString("command"); command != "" {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		command, err := cmd.Flags().GetString("command")
+		if err != nil {
+			return err
+		}
+		watch, err := cmd.Flags().GetBool("watch")
+		if err != nil {
+			return err
+		}
+
+		translated := append([]string{"run"}, dopplerFlags(cmd)...)
+		if watch {
+			translated = append(translated, "--watch")
+		}
+		if command != "" {
+			args = shellCommand(command)
+		}
+		return runCompat(cmd, append(append(translated, "--"), args...))
+	},
+}
+
+var compatDopplerSecretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: `Translate "doppler secrets" to "stacksenv env list"`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return runCompat(cmd, append([]string{"env", "list"}, dopplerFlags(cmd)...))
+	},
+}
+
+var compatDopplerDownloadCmd = &cobra.Command{
+	Use:   "download [file]",
+	Short: `Translate "doppler secrets download" to "stacksenv env export"`,
+	Long: `Translate "doppler secrets download" to "stacksenv env export". Without
+"--no-file", the secrets are written to the given file, doppler.json by default.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		noFile, err := cmd.Flags().GetBool("no-file")
+		if err != nil {
+			return err
+		}
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+
+		formats := map[string]string{"json": "json", "env": "dotenv", "yaml": "yaml"}
+		exportFormat, ok := formats[format]
+		if !ok {
+			return fmt.Errorf("unsupported format %q: expected json, env or yaml", format)
+		}
+
+		translated := append([]string{"env", "export", "--format", exportFormat}, dopplerFlags(cmd)...)
+		if !noFile {
+			file := "doppler.json"
+			if len(args) > 0 {
+				file = args[0]
+			}
+			translated = append(translated, "--output", file)
+		} else if len(args) > 0 {
+			return fmt.Errorf("a file can't be given with --no-file")
+		}
+		return runCompat(cmd, translated)
+	},
+}
+
+var compatEnvkeySourceCmd = &cobra.Command{
+	Use:   "envkey-source [-- <command> [args...]]",
+	Short: `Translate "envkey-source" to "stacksenv run" or "stacksenv env export"`,
+	Long: `Translate "envkey-source". With a command, it is run with the environment
+loaded; without one, export statements are printed for
+eval "$(stacksenv compat envkey-source)".`,
+	Args: cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return runCompat(cmd, []string{"env", "export", "--format", "shell"})
+		}
+		return runCompat(cmd, append([]string{"run", "--"}, args...))
+	},
+}
+
+var compatDotenvVaultCmd = &cobra.Command{
+	Use:   "dotenv-vault",
+	Short: "Adapter for the dotenv-vault CLI",
+}
+
+var compatDotenvVaultPullCmd = &cobra.Command{
+	Use:   "pull [environment] [file]",
+	Short: `Translate "dotenv-vault pull" to "stacksenv env export"`,
+	Long: `Translate "dotenv-vault pull": the variables of the environment, a stacksenv
+branch (the configured one by default), are written to a dotenv file, .env
+by default.`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		translated := []string{"env", "export", "--format", "dotenv", "--output", ".env"}
+		if len(args) > 1 {
+			translated[len(translated)-1] = args[1]
+		}
+		if len(args) > 0 {
+			translated = append(translated, "--branch", args[0])
+		}
+		return runCompat(cmd, translated)
+	},
+}
+
+// dopplerFlags translates the flags shared by the Doppler commands.
+func dopplerFlags(cmd *cobra.Command) []string {
+	var flags []string
+	if config, _ := cmd.Flags().GetString("config"); config != "" {
+		flags = append(flags, "--branch", config)
+	}
+	if path, _ := cmd.Flags().GetString("stacksenv-config"); path != "" {
+		flags = append(flags, "--config", path)
+	}
+	return flags
+}
+
+// shellCommand returns the command line running command with the shell.
+func shellCommand(command string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", command}
+	}
+	return []string{"sh", "-c", command}
+}
+
+// runCompat runs the stacksenv command translated by an adapter, dispatching
+// it directly to the target command rather than executing rootCmd again.
+// The global flags given to the adapter, like --debug, are shared with the
+// target command and still apply.
+func runCompat(cmd *cobra.Command, args []string) error {
+	if quiet, _ := cmd.Flags().GetBool("quiet"); !quiet {
+		fmt.Fprintf(os.Stderr, "stacksenv: running \"stacksenv %s\"\n", strings.Join(args, " "))
+	}
+	target, flags, err := rootCmd.Find(args)
+	if err != nil {
+		return err
+	}
+	if target.RunE == nil {
+		return fmt.Errorf("no stacksenv command for %q", strings.Join(args, " "))
+	}
+	if err := target.ParseFlags(flags); err != nil {
+		return err
+	}
+	if err := target.ValidateArgs(target.Flags().Args()); err != nil {
+		return err
+	}
+	if err := target.ValidateRequiredFlags(); err != nil {
+		return err
+	}
+	target.SetContext(cmd.Context())
+	return target.RunE(target, target.Flags().Args())
+}
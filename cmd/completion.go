@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/homedir"
+)
+
+// completionShell describes how completions are generated and installed for a shell.
+type completionShell struct {
+	// generate writes the completion script.
+	generate func(w io.Writer) error
+	// file returns where the completion script is installed, given the home
+	// and data directories.
+	file func(home, dataDir string) string
+	// profile returns the startup file the sourcing line is appended to, or an
+	// empty string if the shell loads the completion file by itself.
+	profile func(home string) string
+	// sourceLine returns the line sourcing the completion file from the profile.
+	sourceLine func(file string) string
+	// verify returns the command checking that the completion file loads.
+	verify func(file string) *exec.Cmd
+}
+
+// completionShells lists the supported shells by name.
+var completionShells = map[string]completionShell{
+	"bash": {
+		generate: func(w io.Writer) error { return rootCmd.GenBashCompletionV2(w, true) },
+		file:     func(_, dataDir string) string { return filepath.Join(dataDir, "completions", "stacksenv.bash") },
+		profile:  func(home string) string { return filepath.Join(home, ".bashrc") },
+		sourceLine: func(file string) string {
+			return fmt.Sprintf("[ -f '%s' ] && . '%s'", file, file)
+		},
+		verify: func(file string) *exec.Cmd {
+			return exec.Command("bash", "--norc", "-c", fmt.Sprintf(". '%s' && complete -p stacksenv", file))
+		},
+	},
+	"zsh": {
+		generate: func(w io.Writer) error { return rootCmd.GenZshCompletion(w) },
+		file:     func(_, dataDir string) string { return filepath.Join(dataDir, "completions", "_stacksenv") },
+		profile:  func(home string) string { return filepath.Join(home, ".zshrc") },
+		sourceLine: func(file string) string {
+			// compdef is only available once the completion system is initialized
+			return fmt.Sprintf("(( $+functions[compdef] )) || { autoload -U compinit && compinit; }; [ -f '%s' ] && source '%s'", file, file)
+		},
+		verify: func(file string) *exec.Cmd {
+			return exec.Command("zsh", "-f", "-c", fmt.Sprintf("autoload -U compinit && compinit -u && source '%s' && (( $+functions[_stacksenv] ))", file))
+		},
+	},
+	"fish": {
+		generate: func(w io.Writer) error { return rootCmd.GenFishCompletion(w, true) },
+		// Files in this directory are loaded by fish on demand
+		file: func(home, _ string) string {
+			return filepath.Join(home, ".config", "fish", "completions", "stacksenv.fish")
+		},
+		profile: func(string) string { return "" },
+		verify: func(file string) *exec.Cmd {
+			return exec.Command("fish", "--no-config", "-c", fmt.Sprintf("source '%s'", file))
+		},
+	},
+	"powershell": {
+		generate: func(w io.Writer) error { return rootCmd.GenPowerShellCompletionWithDesc(w) },
+		file:     func(_, dataDir string) string { return filepath.Join(dataDir, "completions", "stacksenv.ps1") },
+		profile: func(home string) string {
+			if runtime.GOOS == "windows" {
+				return filepath.Join(home, "Documents", "PowerShell", "Microsoft.PowerShell_profile.ps1")
+			}
+			return filepath.Join(home, ".config", "powershell", "Microsoft.PowerShell_profile.ps1")
+		},
+		sourceLine: func(file string) string {
+			return fmt.Sprintf(". '%s'", file)
+		},
+		verify: func(file string) *exec.Cmd {
+			return exec.Command("pwsh", "-NoProfile", "-Command", fmt.Sprintf(". '%s'", file))
+		},
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+	completionCmd.AddCommand(completionInstallCmd)
+	completionInstallCmd.Flags().Bool("no-verify", false, "don't check that the installed completions load")
+}
+
+var completionCmd = &cobra.Command{
+	Use:   "completion <bash|zsh|fish|powershell>",
+	Short: "Generate shell completion scripts",
+	Long: `Generate the completion script for the given shell and print it to stdout.
+
+Run "stacksenv completion install" to install the completions into your
+shell profile instead.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	RunE: func(_ *cobra.Command, args []string) error {
+		shell, ok := completionShells[args[0]]
+		if !ok {
+			return fmt.Errorf("unsupported shell %q (supported: bash, zsh, fish, powershell)", args[0])
+		}
+		return shell.generate(os.Stdout)
+	},
+}
+
+var completionInstallCmd = &cobra.Command{
+	Use:   "install [bash|zsh|fish|powershell]",
+	Short: "Install shell completions",
+	Long: `Install the completions for your shell.
+
+The shell is detected from $SHELL unless given. The completion script is
+written to:
+
+  bash        ~/.stacksenv/completions/stacksenv.bash, sourced from ~/.bashrc
+  zsh         ~/.stacksenv/completions/_stacksenv, sourced from ~/.zshrc
+  fish        ~/.config/fish/completions/stacksenv.fish
+  powershell  ~/.stacksenv/completions/stacksenv.ps1, sourced from the PowerShell profile
+
+In the XDG layout (see "stacksenv --help"), $XDG_DATA_HOME/stacksenv takes the
+place of ~/.stacksenv.
+
+The sourcing line is only added once. Afterwards, the script is loaded in the
+shell to verify it works. Open a new shell to use the completions.`,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		noVerify, err := cmd.Flags().GetBool("no-verify")
+		if err != nil {
+			return err
+		}
+
+		name := detectShell()
+		if len(args) > 0 {
+			name = args[0]
+		}
+		if name == "" {
+			return errors.New("unable to detect your shell: pass it as an argument, e.g. 'stacksenv completion install bash'")
+		}
+		shell, ok := completionShells[name]
+		if !ok {
+			return fmt.Errorf("unsupported shell %q (supported: bash, zsh, fish, powershell)", name)
+		}
+
+		home, err := homedir.Dir()
+		if err != nil {
+			return fmt.Errorf("failed to get home directory: %w", err)
+		}
+
+		var script bytes.Buffer
+		if err := shell.generate(&script); err != nil {
+			return fmt.Errorf("failed to generate %s completions: %w", name, err)
+		}
+
+		dataDir, err := getDataDir()
+		if err != nil {
+			return err
+		}
+		file := shell.file(home, dataDir)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return fmt.Errorf("failed to create completion directory: %w", err)
+		}
+		if err := os.WriteFile(file, script.Bytes(), 0644); err != nil {
+			return fmt.Errorf("failed to write completion file: %w", err)
+		}
+		fmt.Printf("Wrote %s completions to %s\n", name, file)
+
+		if profile := shell.profile(home); profile != "" {
+			added, err := appendLineOnce(profile, shell.sourceLine(file))
+			if err != nil {
+				return err
+			}
+			if added {
+				fmt.Printf("Added completions to %s\n", profile)
+			} else {
+				fmt.Printf("Completions are already sourced from %s\n", profile)
+			}
+		}
+
+		if !noVerify {
+			verify := shell.verify(file)
+			if verify.Err != nil {
+				fmt.Printf("Skipped verification: %s not found\n", verify.Args[0])
+			} else if output, err := verify.CombinedOutput(); err != nil {
+				return fmt.Errorf("installed completions failed to load in %s: %w\n%s", name, err, output)
+			} else {
+				fmt.Println("Verified that the completions load")
+			}
+		}
+
+		fmt.Println("Open a new shell to use the completions.")
+		return nil
+	},
+}
+
+// detectShell returns the name of the user's shell, or an empty string if it
+// can't be detected.
+func detectShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		name := strings.TrimSuffix(filepath.Base(shell), ".exe")
+		if name == "pwsh" {
+			return "powershell"
+		}
+		return name
+	}
+	if runtime.GOOS == "windows" {
+		return "powershell"
+	}
+	return ""
+}
+
+// appendLineOnce appends line to the file unless the file already contains it.
+// It reports whether the line was added.
+func appendLineOnce(path, line string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if strings.Contains(string(data), line) {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, fmt.Errorf("failed to create directory of %s: %w", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	prefix := ""
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		prefix = "\n"
+	}
+	if _, err := fmt.Fprintf(f, "%s\n# stacksenv shell completions\n%s\n", prefix, line); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,304 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/configstore"
+)
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configGetCmd)
+	configGetCmd.Flags().Bool("source", false, "also print which file or environment variable provided the value")
+	configCmd.AddCommand(configUnsetCmd)
+	configUnsetCmd.Flags().Bool("local", false, "remove the key from the local project configuration instead of the global one")
+	configCmd.AddCommand(configEditCmd)
+	configEditCmd.Flags().Bool("global", false, "edit the global configuration")
+	configEditCmd.Flags().Bool("local", false, "edit the local project configuration")
+	configEditCmd.MarkFlagsMutuallyExclusive("global", "local")
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and edit the configuration",
+	Long:  `Inspect and edit the global and local project configuration.`,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print a configuration value",
+	Long: `Print the resolved value of a configuration key, e.g. "stacksenv config get serverurl".
+
+Nested keys are addressed with dots (e.g. "remotes.origin"). Strings are
+printed as-is and other values as JSON. With "--source", a second line tells
+which file or environment variable provided the value.`,
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{inspectsConfigAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		showSource, err := cmd.Flags().GetBool("source")
+		if err != nil {
+			return err
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+
+		key := strings.ToLower(args[0])
+		if !v.IsSet(key) {
+			return fmt.Errorf("configuration key %q is not set", key)
+		}
+
+		value, err := formatConfigValue(v.Get(key))
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+
+		if showSource {
+			fmt.Printf("source: %s\n", configValueSource(cmd, key))
+		}
+		return nil
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Remove a configuration key",
+	Long: `Remove a key from the global configuration, or from the local project
+configuration with "--local", e.g. "stacksenv config unset serverurl".
+
+Nested keys are addressed with dots (e.g. "remotes.origin"). The file keeps
+its format (JSON, YAML or TOML).`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		local, err := cmd.Flags().GetBool("local")
+		if err != nil {
+			return err
+		}
+
+		configPath, err := getGlobalConfigPath()
+		if local {
+			configPath, err = getLocalConfigPath()
+		}
+		if err != nil {
+			return err
+		}
+
+		unlock, err := configStore.Lock(configPath)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		configData, format, err := configStore.Read(configPath)
+		if err != nil {
+			return err
+		}
+
+		key := strings.ToLower(args[0])
+		if !configstore.Delete(configData, key) {
+			return fmt.Errorf("configuration key %q is not set in %s", key, configPath)
+		}
+
+		if err := configStore.Write(configPath, configData, format); err != nil {
+			return err
+		}
+
+		fmt.Printf("Removed %s from %s\n", key, configPath)
+		return nil
+	},
+}
+
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Open the configuration in your editor",
+	Long: `Open the active configuration file in $VISUAL or $EDITOR.
+
+The local project configuration is edited if it exists, the global
+configuration otherwise; use "--global" or "--local" to choose.
+
+A copy of the file is edited. After the editor exits, the copy is parsed and
+validated. If it is broken, you can edit it again or discard the changes; the
+configuration file is only replaced by a valid copy.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		global, err := cmd.Flags().GetBool("global")
+		if err != nil {
+			return err
+		}
+		local, err := cmd.Flags().GetBool("local")
+		if err != nil {
+			return err
+		}
+
+		configPath, err := editedConfigPath(global, local)
+		if err != nil {
+			return err
+		}
+
+		original, err := os.ReadFile(configPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		if len(original) == 0 && filepath.Ext(configPath) == ".json" {
+			original = []byte("{}\n")
+		}
+
+		// Keep the extension so editors pick the right syntax highlighting
+		tmp, err := os.CreateTemp("", configTempPrefix+"*"+filepath.Ext(configPath))
+		if err != nil {
+			return fmt.Errorf("failed to create temporary file: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+		_, err = tmp.Write(original)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write temporary file: %w", err)
+		}
+
+		for {
+			if err := runEditor(tmp.Name()); err != nil {
+				return err
+			}
+
+			edited, err := os.ReadFile(tmp.Name())
+			if err != nil {
+				return fmt.Errorf("failed to read edited file: %w", err)
+			}
+			if bytes.Equal(edited, original) {
+				fmt.Println("No changes")
+				return nil
+			}
+
+			validationErr := validateConfigFile(tmp.Name())
+			if validationErr == nil {
+				if err := configstore.WritePrivateFileAtomic(configPath, edited); err != nil {
+					return fmt.Errorf("failed to write config file: %w", err)
+				}
+				fmt.Printf("Saved %s\n", configPath)
+				return nil
+			}
+
+			fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", validationErr)
+			answer, err := promptLine("Edit again? Otherwise the changes are discarded (y/n)", "y")
+			if err != nil {
+				return err
+			}
+			if answer = strings.ToLower(answer); answer != "y" && answer != "yes" {
+				return errors.New("changes discarded: the configuration was left unchanged")
+			}
+		}
+	},
+}
+
+// editedConfigPath returns the configuration file "config edit" opens.
+func editedConfigPath(global, local bool) (string, error) {
+	if global {
+		return getGlobalConfigPath()
+	}
+
+	localPath, err := getLocalConfigPath()
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(localPath); local || err == nil {
+		return localPath, nil
+	}
+	return getGlobalConfigPath()
+}
+
+// runEditor opens path in the user's editor and waits for it to exit.
+// The editor is taken from $VISUAL or $EDITOR and may include arguments.
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	words, err := splitCommandLine(editor)
+	if err != nil || len(words) == 0 {
+		return fmt.Errorf("invalid editor %q", editor)
+	}
+
+	editorCmd := exec.Command(words[0], append(words[1:], path)...)
+	editorCmd.Stdin = os.Stdin
+	editorCmd.Stdout = os.Stdout
+	editorCmd.Stderr = os.Stderr
+	if err := editorCmd.Run(); err != nil {
+		return fmt.Errorf("editor %q failed: %w", editor, err)
+	}
+	return nil
+}
+
+// validateConfigFile parses a configuration file and checks the values of the
+// keys the CLI interprets.
+func validateConfigFile(path string) error {
+	configData, err := parseConfigFile(path)
+	if err != nil {
+		return err
+	}
+	return validateConfigData(configData)
+}
+
+// parseConfigFile parses a configuration file. Files with a .json, .yaml,
+// .yml or .toml extension must be in that format; others may be JSON, YAML or
+// TOML.
+func parseConfigFile(path string) (map[string]interface{}, error) {
+	format, ok := configstore.FormatFromExt(path)
+	if !ok {
+		configData, _, err := configStore.Read(path)
+		return configData, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return configstore.Unmarshal(data, format)
+}
+
+// formatConfigValue formats a configuration value for printing: strings as-is,
+// everything else as JSON.
+func formatConfigValue(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to format value: %w", err)
+	}
+	return string(data), nil
+}
+
+// configValueSource describes where the resolved value of key comes from,
+// following the precedence of initViper: flags, environment variables, then
+// the merged configuration files from last to first.
+func configValueSource(cmd *cobra.Command, key string) string {
+	layers := configLayers(cmd)
+	for i := len(layers) - 1; i >= 0; i-- {
+		if _, ok := layers[i].Lookup(key); ok {
+			return layers[i].sourceOf(key)
+		}
+	}
+	return "default"
+}
@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// bundleFormat identifies configuration bundles.
+	bundleFormat = "stacksenv-config-bundle"
+	// bundleVersion is the version of the bundle format written.
+	bundleVersion = 1
+	// bundlePassphraseEnvVar names the environment variable holding the
+	// passphrase of a configuration bundle.
+	bundlePassphraseEnvVar = "STACKSENV_BUNDLE_PASSPHRASE"
+	// bundleAAD authenticates the encrypted data as a configuration bundle.
+	bundleAAD = "stacksenv-config-bundle"
+)
+
+// machineConfigKeys lists the configuration keys that only apply to the
+// machine they are set on and are neither exported nor imported.
+var machineConfigKeys = []string{configEncryptionKey, credentialStoreKey}
+
+// configBundle is an exported configuration, encrypted with a key derived
+// from a passphrase.
+type configBundle struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	Salt    string `json:"salt"` // base64 PBKDF2 salt
+	Data    string `json:"data"` // base64 nonce and AES-256-GCM ciphertext of the JSON configuration
+}
+
+func init() {
+	configCmd.AddCommand(configExportCmd)
+	configCmd.AddCommand(configImportCmd)
+	configExportCmd.Flags().Bool("no-secrets", false, "leave out tokens, secrets, secret keys and remotes")
+	configImportCmd.Flags().Bool("replace", false, "replace the global configuration instead of merging the bundle into it")
+}
+
+var configExportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "Export the global configuration to an encrypted bundle",
+	Long: `Export the global configuration, with its remotes, profiles and sessions, to
+a single file encrypted with a passphrase, e.g. to move it to a new machine
+with "stacksenv config import".
+
+The passphrase is read from the ` + bundlePassphraseEnvVar + ` environment
+variable or prompted for. Credentials are exported in plain text inside the
+bundle, even if they are encrypted or stored in the OS keyring on this
+machine; with "--no-secrets", tokens, secrets, secret keys and remotes (whose
+URLs hold credentials) are left out.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		noSecrets, err := cmd.Flags().GetBool("no-secrets")
+		if err != nil {
+			return err
+		}
+
+		configData, _, err := readGlobalConfig()
+		if err != nil {
+			return err
+		}
+		for _, key := range machineConfigKeys {
+			delete(configData, key)
+		}
+		if noSecrets {
+			removeCredentials(configData)
+		}
+
+		plaintext, err := json.Marshal(configData)
+		if err != nil {
+			return fmt.Errorf("failed to marshal config: %w", err)
+		}
+		passphrase, err := newPassphrase(bundlePassphraseEnvVar)
+		if err != nil {
+			return err
+		}
+		bundle, err := sealBundle(plaintext, passphrase)
+		if err != nil {
+			return err
+		}
+
+		data, err := json.MarshalIndent(bundle, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal bundle: %w", err)
+		}
+		if err := os.WriteFile(args[0], append(data, '\n'), 0600); err != nil {
+			return fmt.Errorf("failed to write bundle: %w", err)
+		}
+
+		fmt.Printf("Exported the global configuration to %s\n", args[0])
+		return nil
+	},
+}
+
+var configImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import the global configuration from an encrypted bundle",
+	Long: `Import a bundle written by "stacksenv config export" into the global
+configuration.
+
+The bundle is merged into the existing configuration: its remotes and
+profiles are added, replacing those with the same names, its sessions
+replace sessions with the same names and its other settings override the
+existing ones. With "--replace", the global configuration is replaced by the
+bundle instead. Whether credentials are encrypted or kept in the OS keyring
+stays as configured on this machine.
+
+The passphrase is read from the ` + bundlePassphraseEnvVar + ` environment
+variable or prompted for.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		replace, err := cmd.Flags().GetBool("replace")
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read bundle: %w", err)
+		}
+		var bundle configBundle
+		if err := json.Unmarshal(data, &bundle); err != nil || bundle.Format != bundleFormat {
+			return fmt.Errorf("%s is not a stacksenv configuration bundle", args[0])
+		}
+		if bundle.Version > bundleVersion {
+			return fmt.Errorf("bundle version %d is newer than this version of stacksenv supports (%d): please upgrade stacksenv", bundle.Version, bundleVersion)
+		}
+		passphrase, err := readPassphrase("Bundle passphrase", bundlePassphraseEnvVar)
+		if err != nil {
+			return err
+		}
+		plaintext, err := openBundle(&bundle, passphrase)
+		if err != nil {
+			return err
+		}
+		imported := make(map[string]interface{})
+		if err := json.Unmarshal(plaintext, &imported); err != nil {
+			return fmt.Errorf("invalid bundle contents: %w", err)
+		}
+		for _, key := range machineConfigKeys {
+			delete(imported, key)
+		}
+
+		unlock, err := lockGlobalConfig()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		configData, format, err := readGlobalConfig()
+		if err != nil {
+			return err
+		}
+		if replace {
+			for key := range configData {
+				if !slices.Contains(machineConfigKeys, key) {
+					delete(configData, key)
+				}
+			}
+		}
+		mergeConfigBundle(configData, imported)
+
+		if err := writeGlobalConfig(configData, format); err != nil {
+			return err
+		}
+		configPath, err := getGlobalConfigPath()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Imported %s into %s\n", args[0], configPath)
+		return nil
+	},
+}
+
+// sealBundle encrypts an exported configuration with a passphrase.
+func sealBundle(plaintext []byte, passphrase string) (*configBundle, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key, err := derivePassphraseKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newSealCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return &configBundle{
+		Format:  bundleFormat,
+		Version: bundleVersion,
+		Salt:    base64.StdEncoding.EncodeToString(salt),
+		Data:    base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, []byte(bundleAAD))),
+	}, nil
+}
+
+// openBundle decrypts the configuration of a bundle.
+func openBundle(bundle *configBundle, passphrase string) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(bundle.Salt)
+	if err != nil || len(salt) == 0 {
+		return nil, errors.New("invalid bundle salt")
+	}
+	data, err := base64.StdEncoding.DecodeString(bundle.Data)
+	if err != nil {
+		return nil, errors.New("invalid bundle data")
+	}
+	key, err := derivePassphraseKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newSealCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("invalid bundle data")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(bundleAAD))
+	if err != nil {
+		return nil, errors.New("failed to decrypt bundle: wrong passphrase or corrupted file")
+	}
+	return plaintext, nil
+}
+
+// removeCredentials removes the credentials from configuration data in place,
+// including remotes, whose URLs hold credentials.
+func removeCredentials(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			lower := strings.ToLower(key)
+			if lower == remotesKey || slices.Contains(sealedConfigKeys, lower) {
+				delete(v, key)
+				continue
+			}
+			removeCredentials(item)
+		}
+	case []interface{}:
+		for _, item := range v {
+			removeCredentials(item)
+		}
+	}
+}
+
+// mergeConfigBundle merges imported configuration data into configData:
+// mappings like remotes and profiles are merged by name, sessions by their
+// "name", and other values are replaced.
+func mergeConfigBundle(configData, imported map[string]interface{}) {
+	for key, value := range imported {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			if existing, ok := configData[key].(map[string]interface{}); ok {
+				for name, item := range value {
+					existing[name] = item
+				}
+				continue
+			}
+		case []interface{}:
+			if existing, ok := configData[key].([]interface{}); ok && key == sessionsKey {
+				for _, session := range value {
+					fields, _ := session.(map[string]interface{})
+					name, _ := fields["name"].(string)
+					if i := sessionIndex(existing, name); name != "" && i >= 0 {
+						existing[i] = session
+					} else {
+						existing = append(existing, session)
+					}
+				}
+				configData[key] = existing
+				continue
+			}
+		}
+		configData[key] = value
+	}
+}
@@ -0,0 +1,488 @@
+package cmd
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/term"
+)
+
+const (
+	// configEncryptionKey is the configuration key describing how the
+	// credentials of a configuration file are sealed.
+	configEncryptionKey = "encryption"
+	// sealedValuePrefix marks a sealed credential value.
+	sealedValuePrefix = "sealed:"
+	// passphraseEnvVar names the environment variable holding the passphrase
+	// of a configuration file sealed with one.
+	passphraseEnvVar = "STACKSENV_PASSPHRASE"
+
+	// Encryption methods.
+	encryptionMethodMachine    = "machine"
+	encryptionMethodPassphrase = "passphrase"
+
+	// passphraseIterations is the number of PBKDF2 iterations deriving a key
+	// from a passphrase.
+	passphraseIterations = 600000
+	// sealAAD authenticates sealed values as configuration credentials.
+	sealAAD = "stacksenv-config"
+)
+
+// sealedConfigKeys lists the keys whose string values are sealed, wherever
+// they appear; all values of "remotes" are sealed as well.
+var sealedConfigKeys = []string{"token", "stacksenv_url", "stacksenv_secret", "stacksenv_key", "_stacksenv_secret", "_stacksenv_key", proxyKey}
+
+// sealKeys caches the keys of the current process by method and salt, so a
+// passphrase is asked for at most once.
+var sealKeys = map[string][]byte{}
+
+func init() {
+	configCmd.AddCommand(configEncryptCmd)
+	configCmd.AddCommand(configDecryptCmd)
+	configEncryptCmd.Flags().Bool("passphrase", false, "seal with a passphrase instead of a key stored on this machine")
+}
+
+var configEncryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt the credentials in the global configuration",
+	Long: `Encrypt the credentials stored in the global configuration: tokens,
+secrets, secret keys and the stacksenv URLs of remotes, including those in
+profiles and sessions. The rest of the file stays readable.
+
+By default, the credentials are sealed with a random key stored in
+config.key next to the global configuration file, readable only by you, so
+copying the configuration to another machine doesn't disclose them. With "--passphrase", they are
+sealed with a key derived from a passphrase instead, read from the
+` + passphraseEnvVar + ` environment variable or prompted for whenever a
+command needs the credentials.
+
+Commands decrypt the credentials transparently, and credentials added later
+are encrypted too. Running the command again re-encrypts the credentials
+with a new key; "stacksenv config decrypt" stores them in plain text again.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		usePassphrase, err := cmd.Flags().GetBool("passphrase")
+		if err != nil {
+			return err
+		}
+
+		unlock, err := lockGlobalConfig()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		configData, format, err := readGlobalConfig()
+		if err != nil {
+			return err
+		}
+
+		encryption := map[string]interface{}{"method": encryptionMethodMachine}
+		var stagedKey string
+		if usePassphrase {
+			salt := make([]byte, 16)
+			if _, err := rand.Read(salt); err != nil {
+				return fmt.Errorf("failed to generate salt: %w", err)
+			}
+			encryption = map[string]interface{}{
+				"method": encryptionMethodPassphrase,
+				"salt":   base64.StdEncoding.EncodeToString(salt),
+			}
+			passphrase, err := newPassphrase(passphraseEnvVar)
+			if err != nil {
+				return err
+			}
+			key, err := derivePassphraseKey(passphrase, salt)
+			if err != nil {
+				return err
+			}
+			sealKeys[encryptionMethodPassphrase+":"+encryption["salt"].(string)] = key
+		} else {
+			// The configuration is written sealed with the new key before
+			// the key replaces the current one, which still opens the
+			// configuration on disk if the write fails.
+			key := make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return fmt.Errorf("failed to generate key: %w", err)
+			}
+			if stagedKey, err = stageMachineKey(key); err != nil {
+				return err
+			}
+			previous, cached := sealKeys[encryptionMethodMachine]
+			sealKeys[encryptionMethodMachine] = key
+			defer func() {
+				if stagedKey != "" {
+					os.Remove(stagedKey)
+					if cached {
+						sealKeys[encryptionMethodMachine] = previous
+					} else {
+						delete(sealKeys, encryptionMethodMachine)
+					}
+				}
+			}()
+		}
+		configData[configEncryptionKey] = encryption
+
+		if err := writeGlobalConfig(configData, format); err != nil {
+			return err
+		}
+		if staged := stagedKey; staged != "" {
+			// The configuration is sealed with the staged key now: keep it
+			stagedKey = ""
+			if err := commitMachineKey(staged); err != nil {
+				return err
+			}
+		}
+		configPath, err := getGlobalConfigPath()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Encrypted the credentials in %s with a %s key\n", configPath, encryption["method"])
+		return nil
+	},
+}
+
+var configDecryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Store the credentials in the global configuration in plain text",
+	Long:  `Decrypt the credentials sealed by "stacksenv config encrypt" and store them in plain text again.`,
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		unlock, err := lockGlobalConfig()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		configData, format, err := readGlobalConfig()
+		if err != nil {
+			return err
+		}
+		configPath, err := getGlobalConfigPath()
+		if err != nil {
+			return err
+		}
+		if _, ok := configData[configEncryptionKey]; !ok {
+			fmt.Printf("The credentials in %s are not encrypted\n", configPath)
+			return nil
+		}
+
+		delete(configData, configEncryptionKey)
+		if err := writeGlobalConfig(configData, format); err != nil {
+			return err
+		}
+		fmt.Printf("Decrypted the credentials in %s\n", configPath)
+		return nil
+	},
+}
+
+// getMachineKeyPath returns the path of the key sealing configuration files
+// with the machine method.
+func getMachineKeyPath() (string, error) {
+	configDir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "config.key"), nil
+}
+
+// stageMachineKey writes a new machine key to a temporary file next to the
+// current one, which commitMachineKey replaces it with, and returns the path
+// of the temporary file.
+func stageMachineKey(key []byte) (string, error) {
+	keyPath, err := getMachineKeyPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return "", fmt.Errorf("failed to create config directory: %w", err)
+	}
+	// CreateTemp creates the file readable by its owner only
+	file, err := os.CreateTemp(filepath.Dir(keyPath), filepath.Base(keyPath)+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to write machine key: %w", err)
+	}
+	_, err = file.WriteString(base64.StdEncoding.EncodeToString(key) + "\n")
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write machine key: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// commitMachineKey atomically replaces the machine key with the one staged
+// by stageMachineKey at path.
+func commitMachineKey(path string) error {
+	keyPath, err := getMachineKeyPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(path, keyPath); err != nil {
+		return fmt.Errorf("failed to replace the machine key: %w (the credentials are sealed with the key in %s: move it to %s)", err, path, keyPath)
+	}
+	return nil
+}
+
+// newPassphrase returns the passphrase set in the environment variable
+// envVar, or asks for a new one twice.
+func newPassphrase(envVar string) (string, error) {
+	if passphrase := os.Getenv(envVar); passphrase != "" {
+		return passphrase, nil
+	}
+	passphrase, err := readPassphrase("New passphrase", envVar)
+	if err != nil {
+		return "", err
+	}
+	confirmation, err := readPassphrase("Repeat the passphrase", envVar)
+	if err != nil {
+		return "", err
+	}
+	if passphrase != confirmation {
+		return "", errors.New("the passphrases don't match")
+	}
+	if passphrase == "" {
+		return "", errors.New("the passphrase must not be empty")
+	}
+	return passphrase, nil
+}
+
+// readPassphrase returns the passphrase set in the environment variable
+// envVar, or prompts for it on the terminal. The prompt goes to stderr, so it
+// doesn't mix with the output of the command.
+func readPassphrase(label, envVar string) (string, error) {
+	if passphrase := os.Getenv(envVar); passphrase != "" {
+		return passphrase, nil
+	}
+	if !term.IsTerminal(os.Stdin) {
+		return "", fmt.Errorf("a passphrase is required: set %s", envVar)
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", label)
+	passphrase, err := term.ReadPassword(os.Stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return strings.TrimSpace(passphrase), nil
+}
+
+// derivePassphraseKey derives an AES-256 key from a passphrase.
+func derivePassphraseKey(passphrase string, salt []byte) ([]byte, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, passphraseIterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	return key, nil
+}
+
+// configSealKey returns the key sealing the credentials of configuration
+// data, or nil if they aren't sealed.
+func configSealKey(configData map[string]interface{}) ([]byte, error) {
+	value, ok := configData[configEncryptionKey]
+	if !ok {
+		return nil, nil
+	}
+	encryption, _ := value.(map[string]interface{})
+	method, _ := encryption["method"].(string)
+
+	switch method {
+	case encryptionMethodMachine:
+		if key, ok := sealKeys[method]; ok {
+			return key, nil
+		}
+		keyPath, err := getMachineKeyPath()
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(keyPath)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("the credentials are encrypted with a machine key, but %s doesn't exist: they can't be decrypted on this machine", keyPath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read machine key: %w", err)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid machine key in %s", keyPath)
+		}
+		sealKeys[method] = key
+		return key, nil
+
+	case encryptionMethodPassphrase:
+		saltValue, _ := encryption["salt"].(string)
+		salt, err := base64.StdEncoding.DecodeString(saltValue)
+		if err != nil || len(salt) == 0 {
+			return nil, errors.New("invalid encryption salt")
+		}
+		cacheKey := method + ":" + saltValue
+		if key, ok := sealKeys[cacheKey]; ok {
+			return key, nil
+		}
+		passphrase, err := readPassphrase("Configuration passphrase", passphraseEnvVar)
+		if err != nil {
+			return nil, err
+		}
+		key, err := derivePassphraseKey(passphrase, salt)
+		if err != nil {
+			return nil, err
+		}
+		sealKeys[cacheKey] = key
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported encryption method %q", method)
+}
+
+// unsealConfig decrypts the sealed credentials of configuration data in place.
+// Values that aren't sealed are left as they are.
+func unsealConfig(configData map[string]interface{}) error {
+	key, err := configSealKey(configData)
+	if err != nil || key == nil {
+		return err
+	}
+	_, err = transformCredentials(configData, "", "", func(_, value string) (string, error) {
+		sealed, ok := strings.CutPrefix(value, sealedValuePrefix)
+		if !ok {
+			return value, nil
+		}
+		return openValue(key, sealed)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to decrypt credentials: %w", err)
+	}
+	return nil
+}
+
+// sealConfig returns a copy of configuration data with its credentials
+// sealed, if its encryption section asks for it.
+func sealConfig(configData map[string]interface{}) (map[string]interface{}, error) {
+	key, err := configSealKey(configData)
+	if err != nil || key == nil {
+		return configData, err
+	}
+	sealed, err := transformCredentials(copyConfigValue(configData), "", "", func(_, value string) (string, error) {
+		// References to the keyring hold no secret
+		if strings.HasPrefix(value, sealedValuePrefix) || strings.HasPrefix(value, keyringRefPrefix) {
+			return value, nil
+		}
+		return sealValue(key, value)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+	return sealed.(map[string]interface{}), nil
+}
+
+// transformCredentials applies fn to the credential values in value, in
+// place. parent is the key value is stored under and path its dotted path,
+// with the indexes of list items as segments; fn receives the path of each
+// credential.
+func transformCredentials(value interface{}, parent, path string, fn func(path, value string) (string, error)) (interface{}, error) {
+	var err error
+	switch v := value.(type) {
+	case string:
+		if parent == remotesKey || slices.Contains(sealedConfigKeys, parent) {
+			return fn(path, v)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			child := strings.ToLower(key)
+			// The values of remotes are credentials, not their names
+			if parent == remotesKey {
+				child = remotesKey
+			}
+			if v[key], err = transformCredentials(item, child, joinConfigPath(path, key), fn); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if v[i], err = transformCredentials(item, "", joinConfigPath(path, strconv.Itoa(i)), fn); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return value, nil
+}
+
+// joinConfigPath appends a segment to a dotted configuration path.
+func joinConfigPath(path, segment string) string {
+	if path == "" {
+		return segment
+	}
+	return path + "." + segment
+}
+
+// copyConfigValue returns a deep copy of a configuration value.
+func copyConfigValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = copyConfigValue(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyConfigValue(item)
+		}
+		return copied
+	}
+	return value
+}
+
+// sealValue encrypts a credential with AES-256-GCM.
+func sealValue(key []byte, value string) (string, error) {
+	gcm, err := newSealCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), []byte(sealAAD))
+	return sealedValuePrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openValue decrypts a credential sealed by sealValue, without its prefix.
+func openValue(key []byte, sealed string) (string, error) {
+	gcm, err := newSealCipher(key)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errors.New("malformed sealed value")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(sealAAD))
+	if err != nil {
+		return "", errors.New("wrong key or passphrase")
+	}
+	return string(plaintext), nil
+}
+
+func newSealCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"os"
+	"slices"
+	"strings"
+)
+
+// unexpandedConfigKeys lists the configuration keys whose values are used as
+// they are written. "default_command" runs with the fetched environment, so
+// references in it must not be resolved against the local one.
+var unexpandedConfigKeys = []string{"default_command"}
+
+// expandConfigValues returns a copy of configuration data with the ${VAR} and
+// ${VAR:-default} references to environment variables in its string values
+// replaced. "$${" stands for a literal "${". It also returns the sorted names
+// of the referenced variables that are unset and have no default; they expand
+// to the empty string.
+func expandConfigValues(configData map[string]interface{}) (map[string]interface{}, []string) {
+	var unset []string
+	expanded := expandConfigMap(configData, &unset)
+	slices.Sort(unset)
+	return expanded, slices.Compact(unset)
+}
+
+// expandConfigMap applies expandConfigValues to a mapping.
+func expandConfigMap(configData map[string]interface{}, unset *[]string) map[string]interface{} {
+	expanded := make(map[string]interface{}, len(configData))
+	for key, value := range configData {
+		if slices.Contains(unexpandedConfigKeys, strings.ToLower(key)) {
+			expanded[key] = value
+			continue
+		}
+		expanded[key] = expandConfigValue(value, unset)
+	}
+	return expanded
+}
+
+// expandConfigValue returns a copy of a configuration value with the
+// references in it and in the values nested in it expanded.
+func expandConfigValue(value interface{}, unset *[]string) interface{} {
+	switch value := value.(type) {
+	case string:
+		return expandEnvReferences(value, unset)
+	case map[string]interface{}:
+		return expandConfigMap(value, unset)
+	case []interface{}:
+		expanded := make([]interface{}, len(value))
+		for i, item := range value {
+			expanded[i] = expandConfigValue(item, unset)
+		}
+		return expanded
+	}
+	return value
+}
+
+// expandEnvReferences expands the environment variable references in s. A
+// "${" without a closing brace is kept as it is.
+func expandEnvReferences(s string, unset *[]string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			break
+		}
+		// "$${" escapes a literal "${"
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			break
+		}
+
+		b.WriteString(s[:i])
+		name, fallback, hasFallback := strings.Cut(s[i+2:i+end], ":-")
+		if value, ok := os.LookupEnv(name); ok && (value != "" || !hasFallback) {
+			b.WriteString(value)
+		} else if hasFallback {
+			b.WriteString(fallback)
+		} else {
+			*unset = append(*unset, name)
+		}
+		s = s[i+end+1:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/configstore"
+)
+
+// configMigrations lists the schema migrations in order. The version of the
+// last one is the current schema version; add new migrations at the end.
+var configMigrations = []configstore.Migration{
+	{Version: 1, Description: "normalize keys to lower case", Migrate: lowercaseConfigKeys},
+}
+
+// currentConfigVersion returns the schema version written by this CLI.
+func currentConfigVersion() int {
+	return configstore.CurrentVersion(configMigrations)
+}
+
+func init() {
+	configCmd.AddCommand(configMigrateCmd)
+	configMigrateCmd.Flags().Bool("dry-run", false, "only show the migrations that would be applied")
+}
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the configuration files to the current schema",
+	Long: fmt.Sprintf(`Upgrade the configuration files to the current schema version (%d).
+
+Each configuration file records its schema version under "version". Pending
+migrations are applied automatically in memory whenever a file is loaded;
+this command applies them to the files themselves. The original of each
+migrated file is kept next to it as <file>.v<version>.bak.
+
+The checked files are the ones merged by the current command line plus the
+global and local configuration files.`, currentConfigVersion()),
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{inspectsConfigAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+
+		if _, err := initViper(cmd); err != nil {
+			return err
+		}
+		files, err := validatedConfigFiles()
+		if err != nil {
+			return err
+		}
+
+		for _, path := range files {
+			if err := migrateConfigFile(path, dryRun); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		return nil
+	},
+}
+
+// migrateConfigFile applies the pending migrations to a configuration file,
+// keeping a backup of the original.
+func migrateConfigFile(path string, dryRun bool) error {
+	unlock, err := configStore.Lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	configData, format, err := configStore.Read(path)
+	if err != nil {
+		return err
+	}
+	from, err := configstore.Version(configData)
+	if err != nil {
+		return err
+	}
+
+	applied, err := configstore.Migrate(configData, configMigrations)
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Printf("%s is up to date (version %d)\n", path, from)
+		return nil
+	}
+
+	for _, description := range applied {
+		fmt.Printf("%s: %s\n", path, description)
+	}
+	if dryRun {
+		return nil
+	}
+
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	backup := fmt.Sprintf("%s.v%d.bak", path, from)
+	// The backup may contain credentials, like the file itself
+	if err := os.WriteFile(backup, original, 0600); err != nil {
+		return fmt.Errorf("failed to back up config file: %w", err)
+	}
+	if err := configStore.Write(path, configData, format); err != nil {
+		return err
+	}
+
+	fmt.Printf("Migrated %s from version %d to %d (backup: %s)\n", path, from, currentConfigVersion(), backup)
+	return nil
+}
+
+// lowercaseConfigKeys renames all keys of configuration data to lower case,
+// as viper reads them, so the CLI doesn't write duplicates of keys spelled
+// differently. If two keys only differ in case, the lower-case one is kept.
+func lowercaseConfigKeys(configData map[string]interface{}) {
+	// Sorted, so the first of several mixed-case spellings wins deterministically
+	keys := make([]string, 0, len(configData))
+	for key := range configData {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		value := configData[key]
+		lowercaseConfigValue(value)
+
+		lower := strings.ToLower(key)
+		if lower == key {
+			continue
+		}
+		delete(configData, key)
+		if _, exists := configData[lower]; !exists {
+			configData[lower] = value
+		}
+	}
+}
+
+// lowercaseConfigValue applies lowercaseConfigKeys to the mappings nested in a
+// configuration value.
+func lowercaseConfigValue(value interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		lowercaseConfigKeys(value)
+	case []interface{}:
+		for _, item := range value {
+			lowercaseConfigValue(item)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+	"github.com/stacksenv/cli/pkg/term"
+)
+
+// branchListTimeout bounds the request listing the branches offered by
+// promptStacksenvURL, so a slow server doesn't delay the question.
+const branchListTimeout = 5 * time.Second
+
+// canPromptForConfig reports whether missing configuration can be asked for
+// interactively: only if stdin is a terminal, so scripts and CI get the error.
+func canPromptForConfig() bool {
+	return term.IsTerminal(os.Stdin)
+}
+
+// promptStacksenvURL asks which environment to use when resolveStacksenvURL
+// found none, or failed with cause: one of the configured remotes, or a
+// pasted stacksenv:// URL, and then the branch. It returns the URL with the
+// branch and the options of resolveStacksenvURL applied.
+func promptStacksenvURL(v *viper.Viper, cause error) (string, error) {
+	if cause != nil {
+		fmt.Fprintf(os.Stderr, "stacksenv: %v\n", cause)
+	} else {
+		fmt.Fprintln(os.Stderr, "stacksenv: no environment is configured for this directory.")
+	}
+
+	url, err := promptRemoteURL(v)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(url, "stacksenv://") {
+		url = "stacksenv://" + url
+	}
+	// Parse errors quote the URL, which contains secrets
+	config, err := stacksenv.ParseURL(strings.TrimPrefix(url, "stacksenv://"))
+	if err != nil {
+		return "", errors.New("invalid stacksenv URL: expected stacksenv://ID:SECRET:SECRET_KEY@SERVER_URL/BRANCH")
+	}
+
+	branch := resolveBranch(v)
+	if branch == "" {
+		branch = config.Branch
+	}
+	if branches := listBranches(v, &config); len(branches) > 0 {
+		fmt.Fprintf(os.Stderr, "Branches: %s\n", strings.Join(branches, ", "))
+	}
+	if branch, err = promptLine("Branch", branch); err != nil {
+		return "", err
+	}
+	if branch != "" {
+		url = withURLBranch(url, branch)
+	}
+
+	fmt.Fprintln(os.Stderr, `Tip: run "stacksenv init" or "stacksenv remote add origin <url>" to skip this question.`)
+	return withURLOptions(v, url)
+}
+
+// promptRemoteURL asks the user to pick one of the configured remotes or to
+// paste a stacksenv:// URL, and returns the URL.
+func promptRemoteURL(v *viper.Viper) (string, error) {
+	remotes := v.GetStringMapString(remotesKey)
+	names := slices.Sorted(maps.Keys(remotes))
+	if len(names) == 0 {
+		return promptPastedURL()
+	}
+
+	fmt.Fprintln(os.Stderr, "Select the environment to use:")
+	for i, name := range names {
+		description := "(invalid URL)"
+		if config, err := stacksenv.ParseURL(strings.TrimPrefix(remotes[name], "stacksenv://")); err == nil {
+			description = fmt.Sprintf("%s on %s", config.ID, config.ServerURL)
+			if config.Branch != "" {
+				description += ", branch " + config.Branch
+			}
+		}
+		fmt.Fprintf(os.Stderr, "  %d) %s: %s\n", i+1, name, description)
+	}
+	fmt.Fprintf(os.Stderr, "  %d) paste a stacksenv:// URL\n", len(names)+1)
+
+	answer, err := promptLine("Environment", "1")
+	if err != nil {
+		return "", err
+	}
+	if slices.Contains(names, strings.ToLower(answer)) {
+		return remotes[strings.ToLower(answer)], nil
+	}
+	choice, err := strconv.Atoi(answer)
+	switch {
+	case err != nil || choice < 1 || choice > len(names)+1:
+		return "", fmt.Errorf("invalid choice %q: expected a number between 1 and %d or the name of a remote", answer, len(names)+1)
+	case choice == len(names)+1:
+		return promptPastedURL()
+	}
+	return remotes[names[choice-1]], nil
+}
+
+// promptPastedURL asks for a stacksenv:// URL without echoing it.
+func promptPastedURL() (string, error) {
+	url, err := promptSecret("stacksenv:// URL")
+	if err != nil {
+		return "", err
+	}
+	if url == "" {
+		return "", errNoCredentials
+	}
+	return url, nil
+}
+
+// listBranches returns the branches the credentials of config grant access
+// to, as reported by the server, or nil if they can't be retrieved.
+func listBranches(v *viper.Viper, config *stacksenv.Config) []string {
+	httpClient, err := newHTTPClient(v)
+	if err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), branchListTimeout)
+	defer cancel()
+
+	identity, err := stacksenv.WhoAmI(ctx, config, httpClient)
+	if err != nil {
+		debugLog("Failed to list the branches: %v", err)
+		return nil
+	}
+	return identity.Branches
+}
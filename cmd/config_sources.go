@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/configstore"
+	"github.com/stacksenv/cli/pkg/table"
+)
+
+// sensitiveConfigKeys lists the key segments whose values hold credentials.
+// Values under them are masked unless shown explicitly.
+var sensitiveConfigKeys = []string{
+	"token", "stacksenv_url", "stacksenv_secret", "stacksenv_key", "_stacksenv_secret", "_stacksenv_key",
+	remotesKey, sessionsKey,
+}
+
+// configLayer is a source of configuration values merged by initViper.
+type configLayer struct {
+	Source string                               // e.g. "global config /home/me/.stacksenv/config"
+	Lookup func(key string) (interface{}, bool) // returns the value the source sets for a dotted key
+
+	// describe names the source of a single key, if it is more specific
+	// than Source
+	describe func(key string) string
+}
+
+// sourceOf names the source of a single key.
+func (l configLayer) sourceOf(key string) string {
+	if l.describe != nil {
+		return l.describe(key)
+	}
+	return l.Source
+}
+
+func init() {
+	configCmd.AddCommand(configSourcesCmd)
+	configSourcesCmd.Flags().Bool("show-values", false, "show credentials instead of masking them")
+	addForceFlag(configSourcesCmd)
+	addTableFlags(configSourcesCmd)
+}
+
+var configSourcesCmd = &cobra.Command{
+	Use:   "sources",
+	Short: "Show where each configuration value comes from",
+	Long: `Show the configuration sources in merge order, then each configuration key
+with its resolved value, the source it was resolved from and the values of
+lower-precedence sources it shadows.
+
+Sources are merged in this order, later ones overriding earlier ones: the
+standard or "--config" file (or the global configuration), the selected
+profile, the active session, the local project configuration, FB_*
+environment variables and flags. Keys only set by flag defaults are omitted.
+
+Credentials ("token", "stacksenv_secret", "remotes", "sessions", ...) are
+masked unless "--show-values" is set.`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{inspectsConfigAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		showValues, err := cmd.Flags().GetBool("show-values")
+		if err != nil {
+			return err
+		}
+		var recording bool
+		if showValues {
+			if recording, err = checkRecording(cmd); err != nil {
+				return err
+			}
+		}
+		format, _, err := tableOptions(cmd)
+		if err != nil {
+			return err
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+
+		endRedacted := startRedacted(recording)
+		defer endRedacted()
+		layers := configLayers(cmd)
+		if format == table.FormatTable {
+			fmt.Println("Merge order (later sources override earlier ones):")
+			for i, layer := range layers {
+				fmt.Printf("  %d. %s\n", i+1, layer.Source)
+			}
+			fmt.Println()
+		}
+
+		keys := v.AllKeys()
+		slices.Sort(keys)
+
+		sw, err := newTableWriter(cmd, os.Stdout, "KEY", "VALUE", "SOURCE", "SHADOWED")
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			// Flags bound under another configuration key are shown there
+			if _, ok := flagConfigKeys[key]; ok {
+				continue
+			}
+			var sources, values []string
+			for _, layer := range layers {
+				value, ok := layer.Lookup(key)
+				if !ok {
+					continue
+				}
+				formatted, err := formatSourceValue(key, value, showValues)
+				if err != nil {
+					return err
+				}
+				sources = append(sources, layer.sourceOf(key))
+				values = append(values, formatted)
+			}
+			if len(sources) == 0 {
+				continue
+			}
+
+			last := len(sources) - 1
+			shadowed := make([]string, 0, last)
+			for i := last - 1; i >= 0; i-- {
+				shadowed = append(shadowed, fmt.Sprintf("%s (%s)", values[i], sources[i]))
+			}
+			if err := sw.Write(key, values[last], sources[last], strings.Join(shadowed, "; ")); err != nil {
+				return err
+			}
+		}
+		return sw.Flush()
+	},
+}
+
+// configLayers returns the sources of configuration values merged by the last
+// call to initViper, in order of increasing precedence: the configuration
+// files (including profile and session sections), the FB_* environment
+// variables and the flags of cmd.
+func configLayers(cmd *cobra.Command) []configLayer {
+	layers := make([]configLayer, 0, len(loadedConfigSources)+2)
+	for _, source := range loadedConfigSources {
+		configData, _, err := configStore.Read(source.Path)
+		if err != nil {
+			continue
+		}
+		// Show the values as they were loaded
+		configData, _ = expandConfigValues(configData)
+
+		switch {
+		case source.Session != "":
+			session, ok := lookupSession(configData, source.Profile, source.Session)
+			if !ok {
+				continue
+			}
+			layers = append(layers, configLayer{
+				Source: fmt.Sprintf("session %s in %s", source.Session, source.Path),
+				Lookup: func(key string) (interface{}, bool) {
+					if strings.EqualFold(key, "name") {
+						return nil, false
+					}
+					return configstore.Lookup(session, key)
+				},
+			})
+		case source.Profile != "":
+			profile := source.Profile
+			layers = append(layers, configLayer{
+				Source: fmt.Sprintf("profile %s in %s", profile, source.Path),
+				Lookup: func(key string) (interface{}, bool) {
+					return configstore.Lookup(configData, "profiles."+profile+"."+key)
+				},
+			})
+		default:
+			layers = append(layers, configLayer{
+				Source: fmt.Sprintf("%s config %s", source.Scope, source.Path),
+				Lookup: func(key string) (interface{}, bool) {
+					return configstore.Lookup(configData, key)
+				},
+			})
+		}
+	}
+
+	layers = append(layers, configLayer{
+		Source: "environment variables (FB_*)",
+		Lookup: func(key string) (interface{}, bool) {
+			value, ok := os.LookupEnv(configEnvVar(key))
+			return value, ok
+		},
+		describe: func(key string) string {
+			return "environment variable " + configEnvVar(key)
+		},
+	})
+	layers = append(layers, configLayer{
+		Source: "flags",
+		Lookup: func(key string) (interface{}, bool) {
+			if flag := cmd.Flags().Lookup(configKeyFlag(key)); flag != nil && flag.Changed {
+				return flag.Value.String(), true
+			}
+			return nil, false
+		},
+		describe: func(key string) string {
+			return "flag --" + configKeyFlag(key)
+		},
+	})
+	return layers
+}
+
+// configEnvVar returns the environment variable overriding a configuration
+// key.
+func configEnvVar(key string) string {
+	return "FB_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// formatSourceValue formats a configuration value for "config sources",
+// masking credentials unless showValues is set.
+func formatSourceValue(key string, value interface{}, showValues bool) (string, error) {
+	if !showValues && isSensitiveConfigKey(key) {
+		return "***", nil
+	}
+	return formatConfigValue(value)
+}
+
+// isSensitiveConfigKey reports whether a dotted configuration key holds
+// credentials.
+func isSensitiveConfigKey(key string) bool {
+	for _, segment := range strings.Split(strings.ToLower(key), ".") {
+		if slices.Contains(sensitiveConfigKeys, segment) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// strictKey is the configuration key and flag rejecting configuration files
+// with unknown keys.
+const strictKey = "strict"
+
+// inspectsConfigAnnotation marks commands that inspect or repair the
+// configuration, so strict mode doesn't stop them on unknown keys.
+const inspectsConfigAnnotation = "stacksenv_inspects_config"
+
+// checkStrictConfig returns an error listing the unknown keys of the
+// configuration files merged by initViper, with suggestions for likely typos.
+func checkStrictConfig() error {
+	var paths, unknown []string
+	for _, source := range loadedConfigSources {
+		if slices.Contains(paths, source.Path) {
+			continue
+		}
+		paths = append(paths, source.Path)
+
+		configData, err := parseConfigFile(source.Path)
+		if err != nil {
+			// Broken files are reported by the commands reading them
+			continue
+		}
+		for _, issue := range checkConfigData(configData) {
+			if issue.unknownKey {
+				unknown = append(unknown, fmt.Sprintf("%s: %s: %s", source.Path, issue.Key, issue.Message))
+			}
+		}
+	}
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown configuration keys (strict mode):\n  %s\nRemove or correct them, or run \"stacksenv config validate\" for details", strings.Join(unknown, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,581 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/stacksenv/cli/pkg/configstore"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+	"github.com/stacksenv/cli/pkg/term"
+)
+
+// Severities of configuration issues.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// knownConfigKeys lists the top-level configuration keys the CLI interprets,
+// besides the names of the persistent flags.
+var knownConfigKeys = []string{
+	schemaKey, "serverurl", "sessions", "remotes", "token", "default_command", "profiles", "default_profile", "active_session", configstore.VersionKey, configEncryptionKey, credentialStoreKey,
+	"reveal_timeout", includeKey, excludeKey, heartbeatRemotesKey, heartbeatIntervalKey, offlineCacheKey, cacheMaxSizeKey, cacheMaxAgeKey, auditMaxAgeKey, backupMaxAgeKey, codecKey, credentialHelperBranchKey, validatorsKey,
+	caCertKey, clientCertKey, clientKeyKey, insecureSkipVerifyKey, proxyKey, agentPprofKey, pageSizeKey, signRequestsKey, advisoriesURLKey, releaseKeyKey, publicVariablesKey, protectedBranchesKey, protectedShellKey, transportKey,
+	"stacksenv_url", "stacksenv_id", "stacksenv_secret", "stacksenv_key", "stacksenv_branch", "stacksenv_disable_https",
+	// Written by "stacksenv init"
+	"_stacksenv_id", "_stacksenv_secret", "_stacksenv_key", "_stacksenv_branch", "_stacksenv_disable_https",
+}
+
+// stringConfigKeys lists the configuration keys whose values must be strings.
+var stringConfigKeys = []string{
+	schemaKey, "serverurl", "token", "default_command", credentialStoreKey, "default_profile", "active_session", "reveal_timeout", heartbeatIntervalKey, cacheMaxAgeKey, auditMaxAgeKey, backupMaxAgeKey, codecKey, credentialHelperBranchKey, colorKey, protectedShellKey, transportKey,
+	caCertKey, clientCertKey, clientKeyKey, proxyKey, advisoriesURLKey, releaseKeyKey,
+	"stacksenv_url", "stacksenv_id", "stacksenv_secret", "stacksenv_key", "stacksenv_branch",
+}
+
+// durationConfigKeys lists the configuration keys whose values must be
+// positive durations.
+var durationConfigKeys = []string{"reveal_timeout", heartbeatIntervalKey, cacheMaxAgeKey, auditMaxAgeKey, backupMaxAgeKey}
+
+// boolConfigKeys lists the configuration keys whose values must be true or
+// false.
+var boolConfigKeys = []string{"stacksenv_disable_https", offlineCacheKey, strictKey, insecureSkipVerifyKey, agentPprofKey, signRequestsKey}
+
+// configIssue is a problem found in the configuration.
+type configIssue struct {
+	Severity string `json:"severity"`
+	File     string `json:"file,omitempty"`
+	Key      string `json:"key,omitempty"`
+	Message  string `json:"message"`
+
+	unknownKey bool // the issue is an unknown key, rejected in strict mode
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+	configValidateCmd.Flags().StringP("output", "o", "text", "output format: text or json")
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the configuration",
+	Long: `Validate the configuration files and the merged configuration.
+
+Each file is checked for syntax errors, unknown keys, values of the wrong
+type, malformed "sessions" entries, a malformed "serverurl" and invalid
+stacksenv URLs in "remotes". Values are checked with their environment
+variable references expanded, and references to unset variables without a
+default are reported. The merged configuration is checked for credentials.
+
+Unknown keys are reported as warnings, or as errors in strict mode (see
+"stacksenv --help"), everything else as errors. The command
+exits with a non-zero status if there are errors. Use "--output json" for a
+machine-readable report, e.g. in CI.`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{inspectsConfigAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if output != "text" && output != "json" {
+			return fmt.Errorf("unsupported output format %q (supported: text, json)", output)
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+
+		var issues []configIssue
+		files, err := validatedConfigFiles()
+		if err != nil {
+			return err
+		}
+		for _, path := range files {
+			issues = append(issues, checkConfigFile(path)...)
+		}
+
+		// Credentials may be spread over several files, so check the merged result
+		if url, err := resolveStacksenvURL(v); err != nil {
+			issues = append(issues, configIssue{Severity: severityError, Message: err.Error()})
+		} else if url == "" {
+			issues = append(issues, configIssue{Severity: severityError, Message: "no credentials configured: set stacksenv_url, a remote named origin, or stacksenv_id, stacksenv_secret and stacksenv_key"})
+		} else if _, err := stacksenv.ParseURL(strings.TrimPrefix(url, "stacksenv://")); err != nil {
+			// Parse errors quote the URL, which contains secrets
+			issues = append(issues, configIssue{Severity: severityError, Message: "the resolved stacksenv URL is malformed: check serverurl, stacksenv_url and the credentials"})
+		}
+
+		errorCount := 0
+		strict := v.GetBool(strictKey)
+		for i := range issues {
+			if strict && issues[i].unknownKey {
+				issues[i].Severity = severityError
+			}
+			if issues[i].Severity == severityError {
+				errorCount++
+			}
+		}
+
+		if output == "json" {
+			report := struct {
+				Valid  bool          `json:"valid"`
+				Files  []string      `json:"files"`
+				Issues []configIssue `json:"issues"`
+			}{errorCount == 0, files, issues}
+			if report.Issues == nil {
+				report.Issues = []configIssue{}
+			}
+
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+		} else {
+			// A bad color mode is one of the reported issues
+			out, err := newColorWriter(os.Stdout, v.GetString(colorKey))
+			if err != nil {
+				out = term.NewWriter(os.Stdout, term.ColorAuto)
+			}
+			severityColors := map[string]term.Color{severityError: term.Red, severityWarning: term.Yellow}
+			for _, issue := range issues {
+				location := issue.File
+				if issue.Key != "" {
+					location = strings.TrimPrefix(location+": "+issue.Key, ": ")
+				}
+				if location == "" {
+					location = "(merged)"
+				}
+				severity := out.Paint(fmt.Sprintf("%-8s", issue.Severity), severityColors[issue.Severity])
+				out.Printf("%s %s: %s\n", severity, location, issue.Message)
+			}
+			out.Printf("%d files checked, %d errors, %d warnings\n", len(files), errorCount, len(issues)-errorCount)
+		}
+
+		if errorCount > 0 {
+			return errors.New("configuration is invalid")
+		}
+		return nil
+	},
+}
+
+// validatedConfigFiles returns the configuration files "config validate"
+// checks: the files merged by initViper plus the global and local
+// configuration files, which initViper skips silently if they are broken.
+func validatedConfigFiles() ([]string, error) {
+	var files []string
+	for _, source := range loadedConfigSources {
+		files = append(files, source.Path)
+	}
+
+	globalPath, err := getGlobalConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	localPath, err := getLocalConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range []string{globalPath, localPath} {
+		if _, err := os.Stat(path); err == nil && !slices.Contains(files, path) {
+			files = append(files, path)
+		}
+	}
+
+	return files, nil
+}
+
+// checkConfigFile parses a configuration file and returns the issues found in it.
+func checkConfigFile(path string) []configIssue {
+	configData, err := parseConfigFile(path)
+	if err != nil {
+		return []configIssue{{Severity: severityError, File: path, Message: fmt.Sprintf("syntax error: %v", err)}}
+	}
+
+	configData, unset := expandConfigValues(configData)
+	var issues []configIssue
+	for _, name := range unset {
+		issues = append(issues, configIssue{Severity: severityWarning, Message: fmt.Sprintf("environment variable %s is unset and has no default", name)})
+	}
+	issues = append(issues, checkConfigData(configData)...)
+	// The schema version applies to whole files, not to profile sections
+	if version, err := configstore.Version(configData); err != nil {
+		issues = append(issues, configIssue{Severity: severityError, Key: configstore.VersionKey, Message: err.Error()})
+	} else if version > currentConfigVersion() {
+		issues = append(issues, configIssue{Severity: severityError, Key: configstore.VersionKey, Message: fmt.Sprintf("version %d is newer than this version of stacksenv supports (%d)", version, currentConfigVersion())})
+	} else if version < currentConfigVersion() {
+		issues = append(issues, configIssue{Severity: severityWarning, Key: configstore.VersionKey, Message: fmt.Sprintf("outdated schema version %d: run \"stacksenv config migrate\"", version)})
+	}
+	for i := range issues {
+		issues[i].File = path
+	}
+	return issues
+}
+
+// checkConfigData returns the issues found in the values of a configuration file.
+func checkConfigData(configData map[string]interface{}) []configIssue {
+	var issues []configIssue
+	addError := func(key, format string, args ...interface{}) {
+		issues = append(issues, configIssue{Severity: severityError, Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var flagNames []string
+	persistentFlags.VisitAll(func(f *pflag.Flag) {
+		flagNames = append(flagNames, flagConfigKey(f.Name))
+	})
+
+	keys := make([]string, 0, len(configData))
+	for key := range configData {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		lower := strings.ToLower(key)
+		if !slices.Contains(knownConfigKeys, lower) && !slices.Contains(flagNames, lower) {
+			issues = append(issues, unknownKeyIssue(key, key, slices.Concat(knownConfigKeys, flagNames)))
+		}
+	}
+
+	for _, key := range stringConfigKeys {
+		if value, ok := configstore.Lookup(configData, key); ok && value != nil {
+			if _, isString := value.(string); !isString {
+				addError(key, "expected a string, got %T", value)
+			}
+		}
+	}
+
+	for _, key := range boolConfigKeys {
+		if value, ok := configstore.Lookup(configData, key); ok && value != nil {
+			if _, isBool := value.(bool); !isBool {
+				addError(key, "expected true or false, got %T", value)
+			}
+		}
+	}
+
+	if value, ok := configstore.Lookup(configData, cacheMaxSizeKey); ok && value != nil {
+		if _, err := configByteSize(value); err != nil {
+			addError(cacheMaxSizeKey, "%v", err)
+		}
+	}
+
+	if value, ok := configstore.Lookup(configData, pageSizeKey); ok && value != nil {
+		if _, err := configPageSize(value); err != nil {
+			addError(pageSizeKey, "%v", err)
+		}
+	}
+
+	for _, key := range durationConfigKeys {
+		if value, ok := configstore.Lookup(configData, key); ok {
+			if duration, isString := value.(string); isString {
+				if d, err := time.ParseDuration(duration); err != nil || d <= 0 {
+					addError(key, "invalid duration %q: expected a positive duration like \"30s\"", duration)
+				}
+			}
+		}
+	}
+
+	if value, ok := configstore.Lookup(configData, heartbeatRemotesKey); ok && value != nil {
+		list, isList := value.([]interface{})
+		if !isList {
+			addError(heartbeatRemotesKey, "expected a list of remote names, got %T", value)
+		}
+		for i, item := range list {
+			if _, isString := item.(string); !isString {
+				addError(fmt.Sprintf("%s[%d]", heartbeatRemotesKey, i), "expected a remote name, got %T", item)
+			}
+		}
+	}
+
+	if value, ok := configstore.Lookup(configData, codecKey); ok {
+		if codec, isString := value.(string); isString {
+			if _, err := stacksenv.GetCodec(codec); err != nil {
+				addError(codecKey, "%v", err)
+			}
+		}
+	}
+
+	if value, ok := configstore.Lookup(configData, colorKey); ok {
+		if mode, isString := value.(string); isString {
+			if _, err := term.ParseColorMode(mode); err != nil {
+				addError(colorKey, "%v", err)
+			}
+		}
+	}
+
+	for _, key := range []string{httpTimeoutKey, httpRetryBackoffKey} {
+		if value, ok := configstore.Lookup(configData, key); ok && value != nil {
+			if d, err := time.ParseDuration(fmt.Sprint(value)); err != nil || d < 0 {
+				addError(key, "invalid duration %q: expected a duration like \"30s\"", fmt.Sprint(value))
+			}
+		}
+	}
+
+	if value, ok := configstore.Lookup(configData, httpRetriesKey); ok && value != nil {
+		if retries, err := strconv.Atoi(fmt.Sprint(value)); err != nil || retries < 0 {
+			addError(httpRetriesKey, "invalid number of retries %q: expected a number like 2", fmt.Sprint(value))
+		}
+	}
+
+	for _, key := range []string{caCertKey, clientCertKey, clientKeyKey, releaseKeyKey} {
+		if path, ok := configstore.Lookup(configData, key); ok {
+			if path, isString := path.(string); isString && path != "" {
+				if _, err := os.Stat(expandHome(path)); err != nil {
+					addError(key, "%v", err)
+				}
+			}
+		}
+	}
+	if proxy, ok := configstore.String(configData, proxyKey); ok && proxy != "" {
+		if _, err := stacksenv.ParseProxyURL(proxy); err != nil {
+			addError(proxyKey, "%v", err)
+		}
+	}
+	if skip, _ := configstore.Bool(configData, insecureSkipVerifyKey); skip {
+		issues = append(issues, configIssue{Severity: severityWarning, Key: insecureSkipVerifyKey, Message: "the certificate of the server is not verified"})
+	}
+
+	for _, key := range []string{includeKey, excludeKey, publicVariablesKey} {
+		value, ok := configstore.Lookup(configData, key)
+		if !ok || value == nil {
+			continue
+		}
+		list, isList := value.([]interface{})
+		if !isList {
+			addError(key, "expected a list of variable patterns, got %T", value)
+		}
+		for i, item := range list {
+			pattern, isString := item.(string)
+			if !isString {
+				addError(fmt.Sprintf("%s[%d]", key, i), "expected a variable pattern, got %T", item)
+			} else if err := checkVariablePattern(pattern); err != nil {
+				addError(fmt.Sprintf("%s[%d]", key, i), "%v", err)
+			}
+		}
+	}
+
+	if value, ok := configstore.Lookup(configData, protectedBranchesKey); ok && value != nil {
+		list, isList := value.([]interface{})
+		if !isList {
+			addError(protectedBranchesKey, "expected a list of branch patterns, got %T", value)
+		}
+		for i, item := range list {
+			pattern, isString := item.(string)
+			if !isString {
+				addError(fmt.Sprintf("%s[%d]", protectedBranchesKey, i), "expected a branch pattern, got %T", item)
+			} else if _, err := path.Match(pattern, ""); err != nil {
+				addError(fmt.Sprintf("%s[%d]", protectedBranchesKey, i), "invalid branch pattern %q: %v", pattern, err)
+			}
+		}
+	}
+
+	if name, ok := configstore.String(configData, transportKey); ok && !slices.Contains(transportNames, name) {
+		addError(transportKey, "invalid transport %q: expected one of %s", name, strings.Join(transportNames, ", "))
+	}
+	if mode, ok := configstore.String(configData, protectedShellKey); ok && !slices.Contains(protectedShellModes, mode) {
+		addError(protectedShellKey, "invalid mode %q: expected one of %s", mode, strings.Join(protectedShellModes, ", "))
+	}
+
+	if value, ok := configstore.Lookup(configData, validatorsKey); ok && value != nil {
+		validators, isMap := value.(map[string]interface{})
+		if !isMap {
+			addError(validatorsKey, "expected a mapping of validator names to commands, got %T", value)
+		}
+		names := make([]string, 0, len(validators))
+		for name := range validators {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			key := validatorsKey + "." + name
+			if command, isString := validators[name].(string); !isString {
+				addError(key, "expected a command, got %T", validators[name])
+			} else if words, err := splitCommandLine(command); err != nil {
+				addError(key, "invalid command: %v", err)
+			} else if len(words) == 0 {
+				addError(key, "invalid command: command is empty")
+			}
+		}
+	}
+
+	if value, ok := configstore.Lookup(configData, "serverurl"); ok {
+		if serverURL, isString := value.(string); isString {
+			if err := checkServerURL(serverURL); err != nil {
+				addError("serverurl", "%v", err)
+			}
+		}
+	}
+
+	if value, ok := configstore.Lookup(configData, "sessions"); ok && value != nil {
+		sessions, isList := value.([]interface{})
+		if !isList {
+			addError("sessions", "expected a list, got %T", value)
+		}
+		for i, session := range sessions {
+			key := fmt.Sprintf("sessions[%d]", i)
+			settings, isMap := session.(map[string]interface{})
+			if !isMap {
+				addError(key, "expected a mapping, got %T", session)
+				continue
+			}
+			if _, isString := settings["name"].(string); !isString {
+				addError(key, "session has no name")
+			}
+			for name := range settings {
+				if name != "name" && !slices.Contains(sessionKeys, strings.ToLower(name)) {
+					issues = append(issues, unknownKeyIssue(key+"."+name, name, append([]string{"name"}, sessionKeys...)))
+				}
+			}
+		}
+	}
+
+	if value, ok := configstore.Lookup(configData, remotesKey); ok && value != nil {
+		remotes, isMap := value.(map[string]interface{})
+		if !isMap {
+			addError(remotesKey, "expected a mapping of remote names to URLs, got %T", value)
+		}
+
+		names := make([]string, 0, len(remotes))
+		for name := range remotes {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			key := remotesKey + "." + name
+			url, isString := remotes[name].(string)
+			if !isString || !strings.HasPrefix(url, "stacksenv://") {
+				addError(key, "expected a stacksenv:// URL")
+				continue
+			}
+			if _, err := stacksenv.ParseURL(strings.TrimPrefix(url, "stacksenv://")); err != nil {
+				// Parse errors quote the URL, which contains secrets
+				addError(key, "malformed stacksenv URL: expected stacksenv://ID:SECRET:SECRET_KEY@SERVER_URL/BRANCH")
+			}
+		}
+	}
+
+	if value, ok := configstore.Lookup(configData, "profiles"); ok && value != nil {
+		profiles, isMap := value.(map[string]interface{})
+		if !isMap {
+			addError("profiles", "expected a mapping of profile names to settings, got %T", value)
+		}
+
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			key := "profiles." + name
+			settings, isMap := profiles[name].(map[string]interface{})
+			if !isMap {
+				addError(key, "expected a mapping of settings, got %T", profiles[name])
+				continue
+			}
+			if strings.Contains(name, ".") {
+				addError(key, "profile names must not contain dots")
+			}
+			for _, issue := range checkConfigData(settings) {
+				issue.Key = key + "." + issue.Key
+				issues = append(issues, issue)
+			}
+		}
+	}
+
+	return issues
+}
+
+// unknownKeyIssue returns the warning about an unknown key, suggesting the
+// closest of the known keys if one is close enough to be a typo.
+func unknownKeyIssue(key, name string, known []string) configIssue {
+	issue := configIssue{Severity: severityWarning, Key: key, Message: "unknown key", unknownKey: true}
+	if suggestion := suggestConfigKey(name, known); suggestion != "" {
+		issue.Message += fmt.Sprintf(" (did you mean %q?)", suggestion)
+	}
+	return issue
+}
+
+// suggestConfigKey returns the known key closest to name, or an empty string
+// if none is within a few typos of it.
+func suggestConfigKey(name string, known []string) string {
+	name = strings.ToLower(name)
+	maxDistance := 2
+	if len(name) < 5 {
+		maxDistance = 1
+	}
+
+	suggestion, best := "", maxDistance+1
+	for _, key := range known {
+		if d := editDistance(name, key); d < best {
+			suggestion, best = key, d
+		}
+	}
+	return suggestion
+}
+
+// editDistance returns the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+// checkServerURL checks that a server URL is a host with an optional port,
+// path prefix and http:// or https:// scheme.
+func checkServerURL(serverURL string) error {
+	if serverURL == "" {
+		return errors.New("server URL is empty")
+	}
+
+	host, _ := splitServerURL(serverURL)
+	u, err := neturl.Parse("https://" + host)
+	if err != nil {
+		return fmt.Errorf("malformed server URL: %w", err)
+	}
+	if u.Hostname() == "" || strings.ContainsAny(host, " \t") {
+		return fmt.Errorf("malformed server URL %q: expected HOST[:PORT][/PATH]", serverURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("malformed server URL %q: queries, fragments and credentials are not supported", serverURL)
+	}
+	return nil
+}
+
+// validateConfigData checks the values of a configuration file and returns the
+// first error found. Warnings are ignored.
+func validateConfigData(configData map[string]interface{}) error {
+	for _, issue := range checkConfigData(configData) {
+		if issue.Severity == severityError {
+			if issue.Key != "" {
+				return fmt.Errorf("%s: %s", issue.Key, issue.Message)
+			}
+			return errors.New(issue.Message)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,482 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+	"github.com/stacksenv/cli/version"
+)
+
+// conformanceEventsTimeout bounds how long the events check waits for the
+// first event of a subscription.
+const conformanceEventsTimeout = 10 * time.Second
+
+// conformanceCheck is a check run by "stacksenv conformance".
+type conformanceCheck struct {
+	Name        string
+	Description string
+	// Write is set for the checks changing data on the server, only run with
+	// "--write".
+	Write bool
+	// Run returns what the check found, or an error if it fails: a
+	// skippedError if it can't run, an unsupportedError if the server lacks
+	// the optional feature.
+	Run func(s *conformanceSuite) (string, error)
+}
+
+// unsupportedError is returned by checks of features the server doesn't
+// support without claiming to.
+type unsupportedError struct {
+	reason error
+}
+
+func (e *unsupportedError) Error() string {
+	return "unsupported: " + e.reason.Error()
+}
+
+// conformanceChecks are the checks run by "stacksenv conformance", in order.
+var conformanceChecks = []conformanceCheck{
+	{"version", "version endpoint", false, checkServerVersion},
+	{"fetch", "fetching and decrypting the branch", false, checkFetch},
+	{"scheme", "payload and connection scheme", false, checkScheme},
+	{"watch", "stable environment between polls", false, checkWatch},
+	{"events", "subscription to environment changes", false, checkEvents},
+	{"pages", "pagination", false, checkPages},
+	{"grpc", "gRPC transport", false, checkGRPC},
+	{"token", "token login, whoami and logout", false, checkToken},
+	{"push", "writing and deleting a branch", true, checkPush},
+	{"heartbeat", "heartbeats", true, checkHeartbeat},
+}
+
+// conformanceSuite is the state shared by the checks of a run.
+type conformanceSuite struct {
+	ctx        context.Context
+	v          *viper.Viper
+	config     stacksenv.Config
+	httpClient stacksenv.HTTPClient
+	codec      stacksenv.Codec
+	service    stacksenv.ClientService
+	// info is the answer of the version endpoint, nil if it failed
+	info *stacksenv.ServerInfo
+	// variables are the fetched variables, nil if the fetch failed
+	variables []stacksenv.ContextData[any]
+}
+
+func init() {
+	rootCmd.AddCommand(conformanceCmd)
+	conformanceCmd.Flags().Bool("write", false, "also run the checks writing to a scratch branch and sending a heartbeat")
+	conformanceCmd.Flags().StringP("output", "o", "text", "output format: text or json")
+}
+
+var conformanceCmd = &cobra.Command{
+	Use:   "conformance [stacksenv-url]",
+	Short: "Check which protocol features a server supports",
+	Long: `Run a suite of requests against a server and report which features of the
+stacksenv protocol it supports, e.g. to test a third-party server
+implementation or a server upgrade. The server of the given stacksenv:// URL
+is checked, or the configured one:
+
+  version    GET /cli/version, the server version and capabilities
+  fetch      GET /cli, fetching and decrypting the branch
+  scheme     the payload header version and key usage, and HTTPS
+  watch      two polls returning the same environment, as watch mode needs
+  events     GET /cli/events, subscribing to the changes of the branch
+  pages      pagination with "page_size" and cursors
+  grpc       the gRPC transport, see "transport" in the configuration
+  token      logging in, whoami and logging out again
+  push       writing a scratch branch, reading it back and deleting it
+  heartbeat  sending a heartbeat
+
+By default, the checks are read-only, except for the token issued by the
+token check, which is revoked at once. The push and heartbeat checks change
+data on the server and are only run with "--write": the scratch branch is
+named conformance-<random> and deleted at the end.
+
+An optional feature the server doesn't support is reported as "n/a"; it
+only fails the run if the server claims it, in its capabilities or version.
+The command exits with a non-zero status if a check fails. Use
+"--output json" for a machine-readable report.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		write, err := cmd.Flags().GetBool("write")
+		if err != nil {
+			return err
+		}
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if output != "text" && output != "json" {
+			return fmt.Errorf("unsupported output format %q (supported: text, json)", output)
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+		var config *stacksenv.Config
+		if len(args) > 0 {
+			parsed, err := stacksenv.ParseURL(strings.TrimPrefix(args[0], "stacksenv://"))
+			if err != nil {
+				return fmt.Errorf("unable to parse stacksenv URL: %w", err)
+			}
+			config = &parsed
+		} else if config, err = resolveStacksenvConfig(v); err != nil {
+			return err
+		}
+		httpClient, err := newHTTPClient(v)
+		if err != nil {
+			return err
+		}
+		codec, err := configuredCodec(v)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signalContext()
+		defer stop()
+		suite := &conformanceSuite{
+			ctx:        ctx,
+			v:          v,
+			config:     *config,
+			httpClient: httpClient,
+			codec:      codec,
+			service:    stacksenv.NewClientServiceWithOptions(httpClient, stacksenv.NewCryptoService(), stacksenv.ClientServiceOptions{Codec: codec, Logger: newLogger()}),
+		}
+
+		results := make([]selftestResult, 0, len(conformanceChecks))
+		failed := 0
+		for _, check := range conformanceChecks {
+			// Interrupted
+			if ctx.Err() != nil {
+				break
+			}
+			result := selftestResult{Check: check.Name, Status: checkPassed, Message: check.Description}
+			var message string
+			var err error
+			if check.Write && !write {
+				err = &skippedError{errors.New("changes data on the server, run with --write")}
+			} else {
+				message, err = check.Run(suite)
+			}
+			var skipped *skippedError
+			var unsupported *unsupportedError
+			switch {
+			case errors.As(err, &skipped):
+				result.Status, result.Message = checkSkipped, fmt.Sprintf("%s: %v", check.Description, skipped.reason)
+			case errors.As(err, &unsupported):
+				result.Status, result.Message = checkUnsupported, fmt.Sprintf("%s: %v", check.Description, unsupported.reason)
+			case err != nil:
+				result.Status, result.Message = checkFailed, fmt.Sprintf("%s: %v", check.Description, err)
+				failed++
+			case message != "":
+				result.Message = fmt.Sprintf("%s: %s", check.Description, message)
+			}
+			results = append(results, result)
+		}
+
+		if output == "json" {
+			report := struct {
+				Server  string           `json:"server"`
+				Passed  bool             `json:"passed"`
+				Results []selftestResult `json:"results"`
+			}{config.ServerURL, failed == 0, results}
+
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+		} else {
+			out, err := newColorWriter(os.Stdout, v.GetString(colorKey))
+			if err != nil {
+				return err
+			}
+			out.Printf("Server %s\n", config.ServerURL)
+			for _, result := range results {
+				out.Printf("%s %-9s %s\n", formatCheckStatus(out, result.Status), result.Check, result.Message)
+			}
+			out.Printf("%d checks, %d failed\n", len(results), failed)
+		}
+
+		if failed > 0 {
+			return errors.New("the server failed the conformance checks")
+		}
+		return ctx.Err()
+	},
+}
+
+// featureError returns the error of a check of feature that failed with
+// err: an unsupportedError if the server doesn't support it without claiming
+// to, err otherwise.
+func (s *conformanceSuite) featureError(feature stacksenv.Feature, err error) error {
+	if !isUnsupported(err) {
+		return err
+	}
+	return s.unsupported(feature, err)
+}
+
+// unsupported returns the error of a check finding that the server lacks
+// feature, as told by reason: an unsupportedError, unless the server claims
+// the feature.
+func (s *conformanceSuite) unsupported(feature stacksenv.Feature, reason error) error {
+	if s.info != nil && s.info.Supports(feature) {
+		return fmt.Errorf("the server claims the %s feature, but: %w", feature, reason)
+	}
+	return &unsupportedError{reason}
+}
+
+// isUnsupported reports whether err tells that the server lacks an endpoint:
+// it is too old for it, or answered HTTP 404, 405 or 501.
+func isUnsupported(err error) bool {
+	var incompatible *stacksenv.IncompatibleServerError
+	if errors.As(err, &incompatible) {
+		return true
+	}
+	var classified *stacksenv.ClassifiedError
+	return errors.As(err, &classified) && slices.Contains([]int{http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented}, classified.StatusCode)
+}
+
+// requireVariables returns a skippedError if the branch couldn't be fetched.
+func (s *conformanceSuite) requireVariables() error {
+	if s.variables == nil {
+		return &skippedError{errors.New("the branch couldn't be fetched")}
+	}
+	return nil
+}
+
+// checkServerVersion asks the server for its version and capabilities.
+func checkServerVersion(s *conformanceSuite) (string, error) {
+	info, err := stacksenv.GetServerInfo(s.ctx, &s.config, s.httpClient)
+	if err != nil {
+		return "", err
+	}
+	s.info = info
+	if info.Version == "" {
+		return fmt.Sprintf("not served, the server predates version %s", stacksenv.VersionEndpointVersion), nil
+	}
+	capabilities := "none"
+	if len(info.Capabilities) > 0 {
+		capabilities = strings.Join(info.Capabilities, ", ")
+	}
+	return fmt.Sprintf("version %s, capabilities: %s", info.Version, capabilities), nil
+}
+
+// checkFetch fetches and decrypts the branch.
+func checkFetch(s *conformanceSuite) (string, error) {
+	variables, err := stacksenv.FetchWithContext(s.ctx, s.service, &s.config)
+	if err != nil {
+		return "", err
+	}
+	if variables == nil {
+		variables = []stacksenv.ContextData[any]{}
+	}
+	s.variables = variables
+	return fmt.Sprintf("%d variables on branch %s", len(variables), s.config.Branch), nil
+}
+
+// checkScheme reports the payload header of the first page and whether the
+// connection is encrypted.
+func checkScheme(s *conformanceSuite) (string, error) {
+	if err := s.requireVariables(); err != nil {
+		return "", err
+	}
+	payload, _, err := stacksenv.NewHTTPTransport(s.httpClient, s.codec).FetchPage(s.ctx, &s.config, stacksenv.NewRequestID(), "")
+	if err != nil {
+		return "", err
+	}
+	header, _, err := stacksenv.ParsePayload(payload)
+	if err != nil {
+		return "", err
+	}
+
+	scheme := "legacy payload without header"
+	if header != nil {
+		scheme = fmt.Sprintf("payload header version %d, key usage %s", header.Version, header.KeyUsage)
+		if header.KeyID != "" {
+			scheme += ", key " + header.KeyID
+		}
+		if header.Deprecated {
+			scheme += " (deprecated)"
+		}
+	}
+	if s.config.DisableHTTPS {
+		return scheme + ", over plain HTTP", nil
+	}
+	return scheme + ", over HTTPS", nil
+}
+
+// checkWatch fetches the branch again and checks that the environment
+// didn't change, or watch mode would restart commands on every poll.
+func checkWatch(s *conformanceSuite) (string, error) {
+	if err := s.requireVariables(); err != nil {
+		return "", err
+	}
+	variables, err := stacksenv.FetchWithContext(s.ctx, s.service, &s.config)
+	if err != nil {
+		return "", err
+	}
+	if stacksenv.Hash(variables) != stacksenv.Hash(s.variables) {
+		return "", errors.New("two fetches returned different environments: watch mode would restart commands on every poll, unless the branch was changed meanwhile")
+	}
+	return "two fetches returned the same environment", nil
+}
+
+// checkEvents subscribes to the changes of the branch and checks that the
+// first event holds the fetched environment.
+func checkEvents(s *conformanceSuite) (string, error) {
+	if err := s.requireVariables(); err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, conformanceEventsTimeout)
+	defer cancel()
+	events, err := stacksenv.SubscribeWithContext(ctx, s.service, &s.config)
+	if err != nil {
+		return "", s.featureError(stacksenv.FeatureEvents, err)
+	}
+
+	event, ok := <-events
+	switch {
+	case !ok && s.ctx.Err() != nil:
+		return "", s.ctx.Err()
+	case !ok:
+		return "", fmt.Errorf("no event within %s of subscribing", conformanceEventsTimeout)
+	case event.Err != nil:
+		return "", event.Err
+	case stacksenv.Hash(event.Variables) != stacksenv.Hash(s.variables):
+		return "", errors.New("the first event holds another environment than the fetch, unless the branch was changed meanwhile")
+	}
+	return "subscribed, the first event holds the fetched environment", nil
+}
+
+// checkPages fetches the branch in two pages and checks that they add up to
+// the whole environment.
+func checkPages(s *conformanceSuite) (string, error) {
+	if err := s.requireVariables(); err != nil {
+		return "", err
+	}
+	if len(s.variables) < 2 {
+		return "", &skippedError{errors.New("the branch has fewer than 2 variables")}
+	}
+	paged := s.config
+	paged.PageSize = (len(s.variables) + 1) / 2
+	_, next, err := stacksenv.NewHTTPTransport(s.httpClient, s.codec).FetchPage(s.ctx, &paged, stacksenv.NewRequestID(), "")
+	if err != nil {
+		return "", err
+	}
+	if next == "" {
+		return "", s.unsupported(stacksenv.FeaturePages, fmt.Errorf("page_size=%d was ignored", paged.PageSize))
+	}
+
+	variables, err := stacksenv.FetchWithContext(s.ctx, s.service, &paged)
+	if err != nil {
+		return "", err
+	}
+	if stacksenv.Hash(variables) != stacksenv.Hash(s.variables) {
+		return "", fmt.Errorf("the pages of %d variables hold %d variables instead of the %d of the whole environment", paged.PageSize, len(variables), len(s.variables))
+	}
+	return fmt.Sprintf("pages of %d variables add up to the environment", paged.PageSize), nil
+}
+
+// checkGRPC fetches the branch with the gRPC transport.
+func checkGRPC(s *conformanceSuite) (string, error) {
+	if err := s.requireVariables(); err != nil {
+		return "", err
+	}
+	options, err := httpOptions(s.v)
+	if err != nil {
+		return "", err
+	}
+	options.Retries = 0
+	transport := stacksenv.NewGRPCTransport(options)
+	defer transport.(io.Closer).Close()
+	service := stacksenv.NewClientServiceWithOptions(s.httpClient, stacksenv.NewCryptoService(), stacksenv.ClientServiceOptions{
+		Transport: transport,
+	})
+	variables, err := stacksenv.FetchWithContext(s.ctx, service, &s.config)
+	if err != nil {
+		return "", s.unsupported(stacksenv.FeatureGRPC, err)
+	}
+	if stacksenv.Hash(variables) != stacksenv.Hash(s.variables) {
+		return "", errors.New("the gRPC transport returned a different environment than GET /cli")
+	}
+	return "the gRPC transport returned the same environment", nil
+}
+
+// checkToken logs in, asks who the token belongs to and logs out again.
+func checkToken(s *conformanceSuite) (string, error) {
+	token, err := stacksenv.Login(s.ctx, &s.config, s.httpClient)
+	if err != nil {
+		return "", s.featureError(stacksenv.FeatureLogin, err)
+	}
+	authenticated := s.config
+	authenticated.Token = token
+
+	notes := []string{"logged in"}
+	identity, whoAmIErr := stacksenv.WhoAmI(s.ctx, &authenticated, s.httpClient)
+	if whoAmIErr == nil {
+		notes = append(notes, "token of "+identity.Subject)
+	} else if whoAmIErr = s.featureError(stacksenv.FeatureWhoAmI, whoAmIErr); isUnsupportedError(whoAmIErr) {
+		notes, whoAmIErr = append(notes, "whoami unsupported"), nil
+	}
+
+	// The token is revoked even if whoami failed
+	if err := stacksenv.Logout(s.ctx, &authenticated, s.httpClient); err != nil {
+		if err = s.featureError(stacksenv.FeatureLogout, err); !isUnsupportedError(err) {
+			return "", err
+		}
+		notes = append(notes, "logout unsupported, the token stays valid until it expires")
+	}
+	if whoAmIErr != nil {
+		return "", whoAmIErr
+	}
+	return strings.Join(notes, ", "), nil
+}
+
+// isUnsupportedError reports whether err is an unsupportedError.
+func isUnsupportedError(err error) bool {
+	var unsupported *unsupportedError
+	return errors.As(err, &unsupported)
+}
+
+// checkPush writes a scratch branch, reads it back and deletes it.
+func checkPush(s *conformanceSuite) (string, error) {
+	scratch := s.config
+	scratch.Branch = "conformance-" + strings.ToLower(randomToken()[:8])
+	written := []stacksenv.ContextData[any]{{Property: "STACKSENV_CONFORMANCE", Value: randomToken()}}
+	if err := stacksenv.PutWithContext(s.ctx, s.service, &scratch, written); err != nil {
+		return "", s.featureError(stacksenv.FeatureWrite, err)
+	}
+
+	variables, err := stacksenv.FetchWithContext(s.ctx, s.service, &scratch)
+	if err == nil && stacksenv.Hash(variables) != stacksenv.Hash(written) {
+		err = fmt.Errorf("branch %s holds other variables than the ones written", scratch.Branch)
+	}
+	if deleteErr := stacksenv.DeleteWithContext(s.ctx, s.service, &scratch); deleteErr != nil {
+		return "", fmt.Errorf("failed to delete the scratch branch %s: %w", scratch.Branch, deleteErr)
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("wrote, read back and deleted branch %s", scratch.Branch), nil
+}
+
+// checkHeartbeat sends a heartbeat for the branch.
+func checkHeartbeat(s *conformanceSuite) (string, error) {
+	heartbeat := stacksenv.NewHeartbeat(version.Version, s.config.Branch)
+	if err := stacksenv.SendHeartbeat(s.ctx, &s.config, s.httpClient, heartbeat); err != nil {
+		return "", s.featureError(stacksenv.FeatureHeartbeat, err)
+	}
+	return "accepted", nil
+}
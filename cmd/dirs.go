@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/stacksenv/cli/pkg/homedir"
+)
+
+// The files of stacksenv live either in ~/.stacksenv (the legacy layout) or,
+// following the XDG Base Directory specification, in
+// $XDG_CONFIG_HOME/stacksenv for the configuration and $XDG_DATA_HOME/stacksenv
+// for the cache, the audit log and completions.
+//
+// An existing install keeps its layout: the XDG layout is used if
+// $XDG_CONFIG_HOME/stacksenv/config exists, the legacy one if
+// ~/.stacksenv/config exists. New installs use the XDG layout if
+// $XDG_CONFIG_HOME or $XDG_DATA_HOME is set, and the legacy one otherwise.
+
+// getConfigDir returns the directory of the global configuration.
+func getConfigDir() (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	if !usesXDGLayout(home) {
+		return filepath.Join(home, ".stacksenv"), nil
+	}
+	return filepath.Join(xdgDir("XDG_CONFIG_HOME", home, ".config"), "stacksenv"), nil
+}
+
+// getDataDir returns the directory of the files stacksenv maintains itself,
+// like the cache and the audit log.
+func getDataDir() (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	if !usesXDGLayout(home) {
+		return filepath.Join(home, ".stacksenv"), nil
+	}
+	return filepath.Join(xdgDir("XDG_DATA_HOME", home, ".local", "share"), "stacksenv"), nil
+}
+
+// usesXDGLayout reports whether the files of stacksenv follow the XDG layout.
+func usesXDGLayout(home string) bool {
+	if fileExists(filepath.Join(xdgDir("XDG_CONFIG_HOME", home, ".config"), "stacksenv", "config")) {
+		return true
+	}
+	if fileExists(filepath.Join(home, ".stacksenv", "config")) {
+		return false
+	}
+	return xdgDirSet("XDG_CONFIG_HOME") || xdgDirSet("XDG_DATA_HOME")
+}
+
+// xdgDir returns the directory named by an XDG environment variable, or its
+// default under the home directory.
+func xdgDir(envVar, home string, defaultPath ...string) string {
+	if xdgDirSet(envVar) {
+		return os.Getenv(envVar)
+	}
+	return filepath.Join(append([]string{home}, defaultPath...)...)
+}
+
+// xdgDirSet reports whether an XDG environment variable is set to a valid,
+// absolute path; the specification says to ignore relative ones.
+func xdgDirSet(envVar string) bool {
+	return filepath.IsAbs(os.Getenv(envVar))
+}
+
+// fileExists reports whether a file exists.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
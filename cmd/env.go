@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+	envCmd.AddCommand(envListCmd)
+
+	envListCmd.Flags().Bool("show-values", false, "show decrypted values instead of masking them")
+	envListCmd.Flags().Int("limit", 0, "maximum number of variables to show (0 for no limit); the whole branch is still fetched")
+	envListCmd.Flags().Int("offset", 0, "number of variables to skip in the output; the whole branch is still fetched")
+	envListCmd.Flags().Bool("deleted", false, "list the soft-deleted variables the server keeps tombstones of")
+	addForceFlag(envListCmd)
+	addTableFlags(envListCmd)
+	addPagerFlag(envListCmd)
+}
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage environment variables",
+	Long: `Inspect and manage the environment variables of the configured branch.
+
+Commands showing decrypted values refuse to do so while the terminal session
+is being recorded, unless "--force" is set. A recording is detected through
+ASCIINEMA_REC (asciinema), SCRIPT (BSD and macOS script) or
+STACKSENV_RECORDING, which can be set for other recorders. Values shown with
+"--force" are written between the markers "ESC ] 7777 ; stacksenv ;
+redact-begin BEL" and "ESC ] 7777 ; stacksenv ; redact-end BEL", so the
+recording can be redacted afterwards.`,
+}
+
+var envListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List environment variables",
+	Long: `List the environment variables of the configured branch. Values are masked unless "--show-values" is set.
+
+While the terminal session is being recorded, "--show-values" is refused
+unless "--force" is set as well.
+
+With "--deleted", the soft-deleted variables are listed instead, with the
+time they were deleted and the time the server purges them.
+
+"--limit" and "--offset" only select the variables shown, sorted by name:
+the whole branch is still fetched and decrypted, as pages of the server
+aren't sorted by name. Use "page_size" in the configuration to fetch the
+branch in smaller pages.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		showValues, err := cmd.Flags().GetBool("show-values")
+		if err != nil {
+			return err
+		}
+		limit, err := cmd.Flags().GetInt("limit")
+		if err != nil {
+			return err
+		}
+		offset, err := cmd.Flags().GetInt("offset")
+		if err != nil {
+			return err
+		}
+		if limit < 0 || offset < 0 {
+			return errors.New("--limit and --offset must not be negative")
+		}
+		deleted, err := cmd.Flags().GetBool("deleted")
+		if err != nil {
+			return err
+		}
+
+		var recording bool
+		if showValues {
+			if recording, err = checkRecording(cmd); err != nil {
+				return err
+			}
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+
+		if deleted {
+			return listDeletedVariables(cmd, v, showValues, recording, limit, offset)
+		}
+
+		properties, err := fetchContextData(v)
+		if err != nil {
+			return err
+		}
+		values := contextDataToMap(properties)
+
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		// Select the variables shown, once the whole branch is fetched
+		names = names[min(offset, len(names)):]
+		if limit > 0 {
+			names = names[:min(limit, len(names))]
+		}
+
+		endRedacted := startRedacted(recording)
+		defer endRedacted()
+		out, waitPager := startPager(cmd)
+		defer waitPager() //nolint:errcheck
+
+		sw, err := newTableWriter(cmd, out, "NAME", "VALUE")
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			value := "***"
+			if showValues {
+				value = values[name]
+			}
+			if err := sw.Write(name, value); err != nil {
+				return err
+			}
+		}
+
+		return sw.Flush()
+	},
+}
+
+// listDeletedVariables lists the tombstones of the soft-deleted variables of
+// the configured branch, sorted by name.
+func listDeletedVariables(cmd *cobra.Command, v *viper.Viper, showValues, recording bool, limit, offset int) error {
+	properties, err := fetchContextDataWith(v, func(config *stacksenv.Config) {
+		config.IncludeDeleted = true
+	})
+	if err != nil {
+		return err
+	}
+
+	tombstones := stacksenv.Tombstones(properties)
+	slices.SortStableFunc(tombstones, func(a, b stacksenv.ContextData[any]) int {
+		return strings.Compare(a.Property, b.Property)
+	})
+
+	// Select the tombstones shown, once the whole branch is fetched
+	tombstones = tombstones[min(offset, len(tombstones)):]
+	if limit > 0 {
+		tombstones = tombstones[:min(limit, len(tombstones))]
+	}
+
+	endRedacted := startRedacted(recording)
+	defer endRedacted()
+	out, waitPager := startPager(cmd)
+	defer waitPager() //nolint:errcheck
+
+	sw, err := newTableWriter(cmd, out, "NAME", "VALUE", "DELETED", "PURGED")
+	if err != nil {
+		return err
+	}
+	for _, tombstone := range tombstones {
+		value := "***"
+		if showValues {
+			value = fmt.Sprint(tombstone.Value)
+		}
+		if err := sw.Write(tombstone.Property, value, tombstone.DeletedAt, tombstone.PurgeAt); err != nil {
+			return err
+		}
+	}
+	return sw.Flush()
+}
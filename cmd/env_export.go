@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/exporter"
+)
+
+func init() {
+	envCmd.AddCommand(envExportCmd)
+	envExportCmd.Flags().StringP("format", "f", "dotenv", "export format (see --list-formats)")
+	envExportCmd.Flags().StringP("output", "o", "", "write the export to this path instead of stdout")
+	envExportCmd.Flags().Bool("list-formats", false, "list the supported export formats and exit")
+	addForceFlag(envExportCmd)
+}
+
+var envExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export environment variables to a file format",
+	Long: `Export the environment variables of the configured branch in a format
+understood by other tools, e.g. "stacksenv env export --format k8s -o secret.yaml".
+
+Run with "--list-formats" to see the supported formats.
+
+Without "--output", the export is refused on a terminal whose session is
+being recorded, unless "--force" is set, like "stacksenv env list
+--show-values".`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		listFormats, err := cmd.Flags().GetBool("list-formats")
+		if err != nil {
+			return err
+		}
+		if listFormats {
+			for _, e := range exporter.List() {
+				fmt.Printf("%-10s %s\n", e.Name(), e.Description())
+			}
+			return nil
+		}
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+
+		e, err := exporter.Get(format)
+		if err != nil {
+			return err
+		}
+		var recording bool
+		if output == "" {
+			if recording, err = checkRecording(cmd); err != nil {
+				return err
+			}
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+
+		properties, err := fetchContextData(v)
+		if err != nil {
+			return err
+		}
+
+		return writeExport(e, exporter.FromMap(contextDataToMap(properties)), output, recording)
+	},
+}
+
+// writeExport exports variables with e to the output path, or to stdout if
+// output is empty. If recording is set, the export written to stdout is
+// wrapped in redaction markers.
+func writeExport(e exporter.Exporter, vars []exporter.Variable, output string, recording bool) error {
+	var buf bytes.Buffer
+	if err := e.Export(&buf, vars); err != nil {
+		return fmt.Errorf("failed to export variables as %s: %w", e.Name(), err)
+	}
+
+	if output == "" {
+		endRedacted := startRedacted(recording)
+		defer endRedacted()
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	// Exports contain secrets, so keep them private to the user
+	if err := os.WriteFile(output, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+const (
+	// publicVariablesKey is the configuration key listing the patterns of the
+	// variables whose values aren't secret, the only ones "stacksenv env
+	// freeze" writes into images.
+	publicVariablesKey = "public_variables"
+
+	// defaultLabelPrefix is the prefix of the labels of frozen variables.
+	defaultLabelPrefix = "io.stacksenv.env."
+	// frozenHashLabel is the label holding the hash of the frozen variables.
+	frozenHashLabel = "io.stacksenv.hash"
+	// frozenBranchLabel is the label holding the branch of the frozen
+	// variables.
+	frozenBranchLabel = "io.stacksenv.branch"
+)
+
+func init() {
+	envCmd.AddCommand(envFreezeCmd)
+	envFreezeCmd.Flags().String("image", "", "add the labels to this image with docker instead of printing them")
+	envFreezeCmd.Flags().String("tag", "", "tag the labeled image with this name instead of replacing --image")
+	envFreezeCmd.Flags().String("label-prefix", defaultLabelPrefix, "prefix of the labels of the variables")
+}
+
+var envFreezeCmd = &cobra.Command{
+	Use:   "freeze [pattern...]",
+	Short: "Bake non-secret variables into image labels",
+	Long: `Write the non-secret variables of the configured branch as OCI image labels, so
+tools inspecting an image at runtime can see the configuration it was built
+with, while secrets stay on the server.
+
+Only variables matching a pattern of "public_variables" in the configuration
+are written, e.g. ["APP_*", "LOG_LEVEL"]: naming any other variable is an
+error. The patterns given as arguments select some of them; all of them are
+written by default.
+
+Each variable becomes the label io.stacksenv.env.<NAME> (see
+"--label-prefix"), next to io.stacksenv.branch and io.stacksenv.hash, a
+hash of the frozen variables that changes whenever one of them does.
+
+Without "--image", the labels are printed as a JSON object, e.g. to pass them
+to "docker build --label". With "--image", docker adds them to the image,
+which is replaced by the labeled one, or tagged as "--tag".`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		image, err := cmd.Flags().GetString("image")
+		if err != nil {
+			return err
+		}
+		tag, err := cmd.Flags().GetString("tag")
+		if err != nil {
+			return err
+		}
+		prefix, err := cmd.Flags().GetString("label-prefix")
+		if err != nil {
+			return err
+		}
+		if tag != "" && image == "" {
+			return errors.New("--tag requires --image")
+		}
+		for _, pattern := range args {
+			if err := checkVariablePattern(pattern); err != nil {
+				return err
+			}
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+		public := v.GetStringSlice(publicVariablesKey)
+		if len(public) == 0 {
+			return fmt.Errorf("no variable is marked as non-secret: list their patterns in %q", publicVariablesKey)
+		}
+		for _, pattern := range public {
+			if err := checkVariablePattern(pattern); err != nil {
+				return fmt.Errorf("invalid %s: %w", publicVariablesKey, err)
+			}
+		}
+
+		properties, err := fetchContextData(v)
+		if err != nil {
+			return err
+		}
+		frozen, err := frozenVariables(stacksenv.FilterCurrentPlatform(properties), public, args)
+		if err != nil {
+			return err
+		}
+		labels := freezeLabels(frozen, prefix, resolveBranch(v))
+
+		if image == "" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(labels)
+		}
+		if tag == "" {
+			tag = image
+		}
+		if err := labelImage(image, tag, labels); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Froze %d variables into %s\n", len(frozen), tag)
+		return nil
+	},
+}
+
+// frozenVariables returns the variables matching the public patterns and,
+// if there are any, one of the selected patterns. A selected pattern matching
+// only secret variables is an error, so secrets are never frozen by mistake.
+func frozenVariables(properties []stacksenv.ContextData[any], public, selected []string) ([]stacksenv.ContextData[any], error) {
+	var frozen []stacksenv.ContextData[any]
+	for _, pattern := range selected {
+		matched := false
+		for _, contextData := range properties {
+			// The patterns were checked by the command
+			if ok, _ := path.Match(pattern, contextData.Property); !ok {
+				continue
+			}
+			if !matchesAny(public, contextData.Property) {
+				return nil, fmt.Errorf("%s is not marked as non-secret in %q", contextData.Property, publicVariablesKey)
+			}
+			matched = true
+		}
+		if !matched {
+			return nil, fmt.Errorf("no variable matches %q", pattern)
+		}
+	}
+
+	for _, contextData := range properties {
+		if !matchesAny(public, contextData.Property) {
+			continue
+		}
+		if len(selected) > 0 && !matchesAny(selected, contextData.Property) {
+			continue
+		}
+		frozen = append(frozen, contextData)
+	}
+	if len(frozen) == 0 {
+		return nil, fmt.Errorf("no variable matches the patterns of %q", publicVariablesKey)
+	}
+	return frozen, nil
+}
+
+// freezeLabels returns the labels of frozen variables.
+func freezeLabels(frozen []stacksenv.ContextData[any], prefix, branch string) map[string]string {
+	labels := map[string]string{frozenHashLabel: stacksenv.Hash(frozen)}
+	if branch != "" {
+		labels[frozenBranchLabel] = branch
+	}
+	for name, value := range contextDataToMap(frozen) {
+		labels[prefix+name] = value
+	}
+	return labels
+}
+
+// labelImage adds labels to image with docker, building an image from it
+// tagged as tag.
+func labelImage(image, tag string, labels map[string]string) error {
+	args := []string{"build", "--quiet", "--tag", tag}
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		// Passed as arguments rather than LABEL instructions, so values are
+		// taken verbatim
+		args = append(args, "--label", key+"="+labels[key])
+	}
+	docker := exec.Command("docker", append(args, "-")...)
+	docker.Stdin = strings.NewReader("FROM " + image + "\n")
+	docker.Stdout = os.Stderr
+	docker.Stderr = os.Stderr
+	if err := docker.Run(); err != nil {
+		return fmt.Errorf("failed to label %s with docker: %w", image, err)
+	}
+	return nil
+}
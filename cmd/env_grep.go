@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/table"
+)
+
+func init() {
+	envCmd.AddCommand(envGrepCmd)
+
+	envGrepCmd.Flags().Bool("values", false, "also search decrypted values (matches are shown by position, never in clear text)")
+	envGrepCmd.Flags().BoolP("names-only", "l", false, "only print the names of matching variables, one per line")
+	envGrepCmd.Flags().BoolP("ignore-case", "i", false, "match case-insensitively")
+	addForceFlag(envGrepCmd)
+	addTableFlags(envGrepCmd)
+}
+
+var envGrepCmd = &cobra.Command{
+	Use:   "grep <regex>",
+	Short: "Search environment variables",
+	Long: `Search the environment variables of the configured branch with a regular
+expression. Only variable names are searched unless "--values" is set.
+
+Value matches never reveal any part of the value: only the positions of the
+matches are shown, as character offsets such as "value 4-9". Use "stacksenv env
+reveal" to see a value. As the positions still tell about the values, the
+search of values is refused on a terminal whose session is being recorded,
+unless "--force" is set.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		searchValues, err := cmd.Flags().GetBool("values")
+		if err != nil {
+			return err
+		}
+		namesOnly, err := cmd.Flags().GetBool("names-only")
+		if err != nil {
+			return err
+		}
+		ignoreCase, err := cmd.Flags().GetBool("ignore-case")
+		if err != nil {
+			return err
+		}
+
+		expr := args[0]
+		if ignoreCase {
+			expr = "(?i)" + expr
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression: %w", err)
+		}
+		var recording bool
+		if searchValues {
+			if recording, err = checkRecording(cmd); err != nil {
+				return err
+			}
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+
+		properties, err := fetchContextData(v)
+		if err != nil {
+			return err
+		}
+		values := contextDataToMap(properties)
+
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		endRedacted := startRedacted(recording)
+		defer endRedacted()
+		var sw *table.Writer
+		if !namesOnly {
+			sw, err = newTableWriter(cmd, os.Stdout, "NAME", "MATCH")
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, name := range names {
+			var match string
+			switch {
+			case pattern.MatchString(name):
+				match = "name"
+			case searchValues && pattern.MatchString(values[name]):
+				match = matchPositions(pattern, values[name])
+			default:
+				continue
+			}
+
+			if namesOnly {
+				fmt.Println(name)
+				continue
+			}
+			if err := sw.Write(name, match); err != nil {
+				return err
+			}
+		}
+
+		if sw != nil {
+			return sw.Flush()
+		}
+		return nil
+	},
+}
+
+// maxGrepPositions is the number of matches in a value whose positions are
+// listed, the others are counted.
+const maxGrepPositions = 5
+
+// matchPositions describes the matches of pattern in value by their
+// character offsets, e.g. "value 4-9, 12-15", without any of the matched
+// text: a pattern such as "." matches the whole value.
+func matchPositions(pattern *regexp.Regexp, value string) string {
+	matches := pattern.FindAllStringIndex(value, -1)
+	var positions []string
+	for _, loc := range matches[:min(len(matches), maxGrepPositions)] {
+		start := utf8.RuneCountInString(value[:loc[0]])
+		end := start + utf8.RuneCountInString(value[loc[0]:loc[1]])
+		positions = append(positions, fmt.Sprintf("%d-%d", start, end))
+	}
+	if len(matches) > maxGrepPositions {
+		positions = append(positions, fmt.Sprintf("%d more", len(matches)-maxGrepPositions))
+	}
+	return "value " + strings.Join(positions, ", ")
+}
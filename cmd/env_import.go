@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/importer"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+func init() {
+	envCmd.AddCommand(envImportCmd)
+	envImportCmd.Flags().StringP("format", "f", "", "input format (detected from the content if not set, see --list-formats)")
+	envImportCmd.Flags().Bool("list-formats", false, "list the supported import formats and exit")
+	envImportCmd.Flags().Bool("show-values", false, "show values instead of masking them")
+	addForceFlag(envImportCmd)
+	envImportCmd.Flags().Bool("push", false, "upload the variables to the configured branch on the server")
+	envImportCmd.Flags().Bool("strict", false, "report irregularities such as duplicate keys or CRLF line endings as errors (dotenv only)")
+	addTableFlags(envImportCmd)
+}
+
+var envImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import environment variables from a file",
+	Long: `Read environment variables from a file and list them, or upload them to
+the configured branch on the server with "--push".
+
+The format is detected from the content unless "--format" is given. Supported
+inputs include dotenv files, JSON and YAML documents, TOML documents and shell
+scripts with "export KEY=value" statements; lines of shell scripts that are
+not assignments are skipped.
+
+Dotenv files are parsed leniently: byte order marks, CRLF line endings,
+whitespace around "=", unquoted values with spaces, comments after values and
+duplicate keys (the last one wins) are accepted. With "--strict", each of
+these is reported with its line and column instead.
+
+The variables are checked with the validators of the configuration, if any
+(see "stacksenv env validate"); the command fails if they report errors.
+
+Values are masked unless "--show-values" is set, which is refused while the
+terminal session is being recorded unless "--force" is set as well.
+
+With "--push", the variables are set in the branch like "stacksenv env set"
+does: the other variables of the branch are kept, and the validators check
+the variables of the branch once imported.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if listFormats, _ := cmd.Flags().GetBool("list-formats"); listFormats {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listFormats, err := cmd.Flags().GetBool("list-formats")
+		if err != nil {
+			return err
+		}
+		if listFormats {
+			for _, i := range importer.List() {
+				fmt.Printf("%-10s %s\n", i.Name(), i.Description())
+			}
+			return nil
+		}
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+		showValues, err := cmd.Flags().GetBool("show-values")
+		if err != nil {
+			return err
+		}
+		strict, err := cmd.Flags().GetBool("strict")
+		if err != nil {
+			return err
+		}
+		push, err := cmd.Flags().GetBool("push")
+		if err != nil {
+			return err
+		}
+		var recording bool
+		if showValues {
+			if recording, err = checkRecording(cmd); err != nil {
+				return err
+			}
+		}
+
+		vars, imp, err := readImportFile(args[0], format, strict)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Read %d variables from %s (%s)\n", len(vars), args[0], imp.Name())
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+		candidates := make(map[string]string, len(vars))
+		for _, variable := range vars {
+			candidates[variable.Key] = variable.Value
+		}
+		if push {
+			return pushImportedVariables(v, candidates)
+		}
+		if err := checkValidators(v, validatorInput{Source: args[0], Variables: candidates}); err != nil {
+			return err
+		}
+
+		endRedacted := startRedacted(recording)
+		defer endRedacted()
+
+		sw, err := newTableWriter(cmd, os.Stdout, "NAME", "VALUE")
+		if err != nil {
+			return err
+		}
+		for _, v := range vars {
+			value := "***"
+			if showValues {
+				value = v.Value
+			}
+			if err := sw.Write(v.Key, value); err != nil {
+				return err
+			}
+		}
+		return sw.Flush()
+	},
+}
+
+// pushImportedVariables sets imported variables in the configured branch on
+// the server.
+func pushImportedVariables(v *viper.Viper, values map[string]string) error {
+	if len(values) == 0 {
+		return errors.New("no variables to upload")
+	}
+	for name := range values {
+		if err := checkVariableName(name); err != nil {
+			return err
+		}
+	}
+	config, err := updateBranch(v, nil, func(properties []stacksenv.ContextData[any]) ([]stacksenv.ContextData[any], error) {
+		return setVariables(properties, values), nil
+	})
+	if err != nil {
+		return err
+	}
+	publishWrites(config, auditActionSet, slices.Sorted(maps.Keys(values)))
+	fmt.Fprintf(os.Stderr, "Uploaded %d variables to branch %s\n", len(values), config.Branch)
+	return nil
+}
+
+// readImportFile reads the variables of a file in the given import format, or
+// in the format detected from its content if format is empty.
+func readImportFile(path, format string, strict bool) ([]importer.Variable, importer.Importer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read input file: %w", err)
+	}
+
+	var imp importer.Importer
+	if format != "" {
+		imp, err = importer.Get(format)
+	} else {
+		imp, err = importer.Detect(data)
+		if errors.Is(err, importer.ErrUnknownFormat) {
+			err = fmt.Errorf("%w of %s: pass it with --format", err, path)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var vars []importer.Variable
+	if strict {
+		strictImp, ok := imp.(importer.StrictImporter)
+		if !ok {
+			return nil, nil, fmt.Errorf("the %s format has no strict mode", imp.Name())
+		}
+		vars, err = strictImp.ImportStrict(data)
+	} else {
+		vars, err = imp.Import(data)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s as %s: %w", path, imp.Name(), err)
+	}
+	return vars, imp, nil
+}
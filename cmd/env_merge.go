@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/exporter"
+	"github.com/stacksenv/cli/pkg/importer"
+)
+
+func init() {
+	envCmd.AddCommand(envMergeCmd)
+	envMergeCmd.Flags().StringP("format", "f", "dotenv", "output format (see \"env export --list-formats\")")
+	envMergeCmd.Flags().StringP("output", "o", "", "write the result to this path instead of stdout")
+	envMergeCmd.Flags().String("input-format", "", "format of the input files (detected per file if not set)")
+	envMergeCmd.Flags().Bool("fail-on-conflict", false, "fail instead of overriding when sources set a variable to different values")
+	addForceFlag(envMergeCmd)
+}
+
+var envMergeCmd = &cobra.Command{
+	Use:   "merge <source>...",
+	Short: "Merge files and branches into one set of variables",
+	Long: `Merge environment variables from files and branches into one output,
+e.g. "stacksenv env merge base.env @dev @staging --format dotenv".
+
+A source is one of:
+
+  @<branch>   the variables of a branch of the configured environment
+  @           the variables of the configured branch
+  -           variables read from stdin
+  <path>      variables read from a file, in any format of "env import"
+
+Sources are merged from left to right: a variable set by a later source
+overrides the value of an earlier one. Each override with a different value
+is reported on stderr as a conflict, without the values; with
+"--fail-on-conflict", conflicts are an error and nothing is written.
+
+Without "--output", the result is refused on a terminal whose session is
+being recorded, unless "--force" is set.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		inputFormat, err := cmd.Flags().GetString("input-format")
+		if err != nil {
+			return err
+		}
+		failOnConflict, err := cmd.Flags().GetBool("fail-on-conflict")
+		if err != nil {
+			return err
+		}
+
+		e, err := exporter.Get(format)
+		if err != nil {
+			return err
+		}
+		var recording bool
+		if output == "" {
+			if recording, err = checkRecording(cmd); err != nil {
+				return err
+			}
+		}
+
+		var v *viper.Viper
+		merged := newVariableMerge()
+		for _, source := range args {
+			var vars []exporter.Variable
+			if branch, ok := strings.CutPrefix(source, "@"); ok {
+				if v == nil {
+					if v, err = initViper(cmd); err != nil {
+						return err
+					}
+				}
+				properties, err := fetchBranchContextData(v, branch)
+				if err != nil {
+					return fmt.Errorf("failed to fetch %s: %w", source, err)
+				}
+				vars = exporter.FromMap(contextDataToMap(properties))
+			} else {
+				vars, err = readMergeFile(source, inputFormat)
+				if err != nil {
+					return err
+				}
+			}
+			merged.add(source, vars)
+		}
+
+		for _, c := range merged.conflicts {
+			fmt.Fprintf(os.Stderr, "Conflict: %s from %s is overridden by %s\n", c.key, c.previous, c.source)
+		}
+		if failOnConflict && len(merged.conflicts) > 0 {
+			return fmt.Errorf("%d conflicting variables", len(merged.conflicts))
+		}
+		fmt.Fprintf(os.Stderr, "Merged %d variables from %d sources\n", len(merged.vars), len(args))
+
+		return writeExport(e, merged.vars, output, recording)
+	},
+}
+
+// readMergeFile reads the variables of a file source of "env merge", or of
+// stdin if path is "-". The format is detected unless given.
+func readMergeFile(path, format string) ([]exporter.Variable, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var imp importer.Importer
+	if format != "" {
+		imp, err = importer.Get(format)
+	} else {
+		imp, err = importer.Detect(data)
+		if errors.Is(err, importer.ErrUnknownFormat) {
+			err = fmt.Errorf("%w of %s: pass it with --input-format", err, path)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	vars, err := imp.Import(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s as %s: %w", path, imp.Name(), err)
+	}
+	return vars, nil
+}
+
+// mergeConflict is a variable set to different values by two sources.
+type mergeConflict struct {
+	key      string
+	previous string // source of the overridden value
+	source   string // source of the new value
+}
+
+// variableMerge merges variables from several sources, keeping the position
+// of the first definition of each variable.
+type variableMerge struct {
+	vars      []exporter.Variable
+	index     map[string]int    // key -> index in vars
+	sources   map[string]string // key -> source of the current value
+	conflicts []mergeConflict
+}
+
+func newVariableMerge() *variableMerge {
+	return &variableMerge{
+		index:   make(map[string]int),
+		sources: make(map[string]string),
+	}
+}
+
+// add merges the variables of a source over the current ones.
+func (m *variableMerge) add(source string, vars []exporter.Variable) {
+	for _, variable := range vars {
+		n, ok := m.index[variable.Key]
+		if !ok {
+			m.index[variable.Key] = len(m.vars)
+			m.vars = append(m.vars, variable)
+			m.sources[variable.Key] = source
+			continue
+		}
+
+		if m.vars[n].Value != variable.Value {
+			m.conflicts = append(m.conflicts, mergeConflict{
+				key:      variable.Key,
+				previous: m.sources[variable.Key],
+				source:   source,
+			})
+		}
+		m.vars[n].Value = variable.Value
+		m.sources[variable.Key] = source
+	}
+}
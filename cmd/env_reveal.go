@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+	"github.com/stacksenv/cli/pkg/term"
+)
+
+// defaultRevealTimeout is how long "env reveal" shows a value unless
+// configured otherwise.
+const defaultRevealTimeout = 10 * time.Second
+
+// Escape sequences switching to the alternate screen and back. Text written
+// to the alternate screen doesn't end up in the scrollback.
+const (
+	enterAltScreen = "\x1b[?1049h\x1b[H"
+	leaveAltScreen = "\x1b[?1049l"
+)
+
+func init() {
+	envCmd.AddCommand(envRevealCmd)
+
+	addForceFlag(envRevealCmd)
+	envRevealCmd.Flags().Duration("timeout", defaultRevealTimeout, `how long to show the value (overrides "reveal_timeout" from the configuration)`)
+}
+
+var envRevealCmd = &cobra.Command{
+	Use:   "reveal <key>",
+	Short: "Show the value of a variable on the terminal",
+	Long: `Show the decrypted value of a single variable on the terminal, without
+copying it to the clipboard or leaving it in the scrollback.
+
+The value is shown on the alternate screen until a key is pressed or the
+timeout elapses, then the screen is restored. The timeout defaults to the
+"reveal_timeout" configuration setting (e.g. "30s"), or 10s.
+
+The command refuses to run if its output is not a terminal, so the value can't
+be piped or redirected, or if the terminal session is being recorded (e.g. by
+asciinema), unless "--force" is set. Each reveal is recorded, without the value, in the
+local audit log of the server and environment, in ~/.stacksenv/tenants (or
+$XDG_DATA_HOME/stacksenv/tenants in the XDG layout, see "stacksenv purge").`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := args[0]
+
+		if !term.IsTerminal(os.Stdout) {
+			return errors.New("refusing to reveal a value: the output is not a terminal")
+		}
+		recording, err := checkRecording(cmd)
+		if err != nil {
+			return err
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			return err
+		}
+		if configured := v.GetString("reveal_timeout"); configured != "" && !cmd.Flags().Changed("timeout") {
+			if timeout, err = time.ParseDuration(configured); err != nil {
+				return fmt.Errorf("invalid reveal_timeout %q: %w", configured, err)
+			}
+		}
+		if timeout <= 0 {
+			return errors.New("the reveal timeout must be positive")
+		}
+
+		var config stacksenv.Config
+		properties, err := fetchContextDataWith(v, func(c *stacksenv.Config) {
+			config = *c
+		})
+		if err != nil {
+			return err
+		}
+		value, err := stacksenv.NewEnvSet(stacksenv.FilterCurrentPlatform(properties)).GetString(key)
+		if err != nil {
+			return fmt.Errorf("variable %s not found", key)
+		}
+
+		// Only reveal what has been recorded
+		event := tenantEvent(eventRevealed, &config)
+		event.Action, event.Keys = auditActionReveal, []string{key}
+		if err := operations.publish(event); err != nil {
+			return fmt.Errorf("refusing to reveal a value without recording it: %w", err)
+		}
+
+		return revealValue(key, value, timeout, recording)
+	},
+}
+
+// revealValue shows a value on the alternate screen of the terminal until a
+// key is pressed, the timeout elapses or the process is interrupted. If
+// recording is set, the value is wrapped in redaction markers.
+func revealValue(key, value string, timeout time.Duration, recording bool) error {
+	ctx, stop := signalContext()
+	defer stop()
+
+	endRedacted := startRedacted(recording)
+	fmt.Fprint(os.Stdout, enterAltScreen)
+	fmt.Fprintf(os.Stdout, "%s (hidden in %s or on any key):\n\n%s\n", key, timeout, value)
+	_, err := term.WaitForKey(ctx, os.Stdin, timeout)
+	fmt.Fprint(os.Stdout, leaveAltScreen)
+	endRedacted()
+	if err != nil {
+		return fmt.Errorf("failed to wait for a key: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Value of %s hidden\n", key)
+	return nil
+}
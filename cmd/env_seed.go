@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/exporter"
+	"github.com/stacksenv/cli/pkg/fake"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+func init() {
+	envCmd.AddCommand(envSeedCmd)
+	envSeedCmd.Flags().Bool("fake", false, "generate fake values from the names of the variables")
+	envSeedCmd.Flags().String("from", "", "read the variable names from this file instead of the configured branch")
+	envSeedCmd.Flags().StringP("format", "f", "dotenv", "output format (see \"stacksenv env export --list-formats\")")
+	envSeedCmd.Flags().StringP("output", "o", "", "write the variables to this path instead of stdout")
+	envSeedCmd.Flags().Bool("force", false, "overwrite the output file if it exists")
+	envSeedCmd.Flags().Uint64("seed", 0, "seed of the generated values, to generate the same values again (random if 0)")
+	envSeedCmd.Flags().Bool("push", false, "add the variables missing from the configured branch on the server")
+	envSeedCmd.MarkFlagsMutuallyExclusive("push", "output")
+}
+
+var envSeedCmd = &cobra.Command{
+	Use:   "seed --fake",
+	Short: "Generate fake variables for local development",
+	Long: `Generate fake values for the variables of a project, so new developers can
+run it locally without access to real secrets.
+
+The variable names are read from a file in any format "stacksenv env import"
+reads, typically a .env.example file, with "--from", or else from the
+configured branch. The kind of each value is guessed from the name of the
+variable: email addresses for ADMIN_EMAIL, local URLs for DATABASE_URL or
+REDIS_URL, UUIDs for TENANT_ID, ports for HTTP_PORT, random tokens for
+API_SECRET, and so on. If the name gives no clue, the example value, or the
+value of the branch, selects the kind of value (boolean, number, UUID, email
+address or URL). Values are never copied, except booleans.
+
+Write the variables to a local override file and run the project with it:
+
+  stacksenv env seed --fake --from .env.example -o .env.local
+  stacksenv run --env-file .env.local -- npm start
+
+Use "--seed" to generate the same values again.
+
+With "--push", the variables of the "--from" file are seeded in the configured
+branch on the server instead, e.g. a shared development branch: the variables
+missing from the branch are added with fake values, and the existing ones are
+left untouched. The validators of the configuration, if any, check the
+variables of the branch before they are written.
+
+  stacksenv env seed --fake --from .env.example --push --branch dev`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		generateFake, err := cmd.Flags().GetBool("fake")
+		if err != nil {
+			return err
+		}
+		from, err := cmd.Flags().GetString("from")
+		if err != nil {
+			return err
+		}
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			return err
+		}
+		seed, err := cmd.Flags().GetUint64("seed")
+		if err != nil {
+			return err
+		}
+
+		push, err := cmd.Flags().GetBool("push")
+		if err != nil {
+			return err
+		}
+
+		if !generateFake {
+			return errors.New("only fake values can be seeded: pass --fake")
+		}
+		if push {
+			if from == "" {
+				return errors.New("seeding a branch requires the variable names: pass --from")
+			}
+			template, _, err := readImportFile(from, "", false)
+			if err != nil {
+				return err
+			}
+			v, err := initViper(cmd)
+			if err != nil {
+				return err
+			}
+			return seedBranch(v, template, fake.New(seed))
+		}
+		e, err := exporter.Get(format)
+		if err != nil {
+			return err
+		}
+		if output != "" && !force {
+			if _, err := os.Stat(output); err == nil {
+				return fmt.Errorf("%s already exists: pass --force to overwrite it", output)
+			}
+		}
+
+		var template []exporter.Variable
+		if from != "" {
+			if template, _, err = readImportFile(from, "", false); err != nil {
+				return err
+			}
+		} else {
+			v, err := initViper(cmd)
+			if err != nil {
+				return err
+			}
+			properties, err := fetchContextData(v)
+			if err != nil {
+				return err
+			}
+			template = exporter.FromMap(contextDataToMap(properties))
+		}
+		if len(template) == 0 {
+			return errors.New("no variables to seed")
+		}
+
+		generator := fake.New(seed)
+		vars := make([]exporter.Variable, len(template))
+		for i, variable := range template {
+			vars[i] = exporter.Variable{Key: variable.Key, Value: generator.Value(variable.Key, variable.Value)}
+		}
+		// The values are fake, so they may be shown on recorded terminals
+		if err := writeExport(e, vars, output, false); err != nil {
+			return err
+		}
+		if output != "" {
+			fmt.Fprintf(os.Stderr, "Seeded %d variables in %s\n", len(vars), output)
+		}
+		return nil
+	},
+}
+
+// seedBranch adds the variables of template missing from the configured
+// branch on the server, with fake values generated by generator.
+func seedBranch(v *viper.Viper, template []exporter.Variable, generator *fake.Generator) error {
+	var added []string
+	config, err := updateBranch(v, nil, func(properties []stacksenv.ContextData[any]) ([]stacksenv.ContextData[any], error) {
+		existing := stacksenv.NewEnvSet(properties)
+		values := make(map[string]string)
+		for _, variable := range template {
+			if existing.Has(variable.Key) {
+				continue
+			}
+			if err := checkVariableName(variable.Key); err != nil {
+				return nil, err
+			}
+			values[variable.Key] = generator.Value(variable.Key, variable.Value)
+		}
+		if len(values) == 0 {
+			return nil, errors.New("nothing to seed: the branch has all the variables")
+		}
+		added = slices.Sorted(maps.Keys(values))
+		return setVariables(properties, values), nil
+	})
+	if err != nil {
+		return err
+	}
+	publishWrites(config, auditActionSet, added)
+	fmt.Fprintf(os.Stderr, "Seeded %d variables in branch %s: %s\n", len(added), config.Branch, strings.Join(added, ", "))
+	return nil
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+	"github.com/stacksenv/cli/pkg/term"
+)
+
+func init() {
+	envCmd.AddCommand(envSetCmd)
+}
+
+var envSetCmd = &cobra.Command{
+	Use:   "set <key>=<value>... | <key>",
+	Short: "Set variables of the branch on the server",
+	Long: `Set the values of variables in the configured branch on the server, e.g.
+"stacksenv env set LOG_LEVEL=debug PORT=8080". Variables that don't exist are
+added, soft-deleted variables are replaced.
+
+Values given as arguments end up in the shell history. To avoid it, give the
+name alone: the value is then asked for without echo, or read from the first
+line of stdin if it is not a terminal:
+
+  stacksenv env set API_TOKEN
+  vault read -field=token secret/api | stacksenv env set API_TOKEN
+
+A variable restricted to some platforms keeps its restrictions; variants of a
+variable for several platforms are replaced by one variable for every
+platform.
+
+The branch is fetched from the server, updated and written back. The
+variables are checked with the validators of the configuration, if any, and
+are not written if they report errors. Every variable set is recorded in the
+local audit log. Writing requires a server supporting it (version 1.6.0 or
+later).`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		values := make(map[string]string, len(args))
+		var prompted string
+		for _, arg := range args {
+			name, value, ok := strings.Cut(arg, "=")
+			if err := checkVariableName(name); err != nil {
+				return err
+			}
+			if _, dup := values[name]; dup {
+				return fmt.Errorf("variable %s is given twice", name)
+			}
+			if !ok {
+				if prompted != "" {
+					return errors.New("only one value can be read from stdin: give the others as <key>=<value>")
+				}
+				prompted = name
+			}
+			values[name] = value
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+		if prompted != "" {
+			if values[prompted], err = readVariableValue(prompted); err != nil {
+				return err
+			}
+		}
+
+		config, err := updateBranch(v, nil, func(properties []stacksenv.ContextData[any]) ([]stacksenv.ContextData[any], error) {
+			return setVariables(properties, values), nil
+		})
+		if err != nil {
+			return err
+		}
+		names := slices.Sorted(maps.Keys(values))
+		publishWrites(config, auditActionSet, names)
+		fmt.Fprintf(os.Stderr, "Set %s in branch %s\n", strings.Join(names, ", "), config.Branch)
+		return nil
+	},
+}
+
+// readVariableValue reads the value of a variable from stdin, asking for it
+// without echo if stdin is a terminal.
+func readVariableValue(name string) (string, error) {
+	if term.IsTerminal(os.Stdin) {
+		fmt.Fprintf(os.Stderr, "Value of %s: ", name)
+	}
+	value, err := term.ReadPassword(os.Stdin)
+	if term.IsTerminal(os.Stdin) {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the value of %s: %w", name, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+// defaultSoftDeleteRetention is how long the server keeps the tombstones of
+// soft-deleted variables unless "--purge-after" is set.
+const defaultSoftDeleteRetention = 30 * 24 * time.Hour
+
+func init() {
+	envCmd.AddCommand(envUnsetCmd)
+	envCmd.AddCommand(envRestoreCmd)
+	envUnsetCmd.Flags().Bool("soft", false, "keep a tombstone of the variables, so they can be restored")
+	envUnsetCmd.Flags().Duration("purge-after", defaultSoftDeleteRetention, "how long the server keeps the tombstones of soft-deleted variables")
+}
+
+var envUnsetCmd = &cobra.Command{
+	Use:   "unset <key>...",
+	Short: "Remove variables from the branch on the server",
+	Long: `Remove variables, with all their platform variants, from the configured
+branch on the server.
+
+With "--soft", the variables are soft-deleted instead: they are no longer
+injected, but the server keeps a tombstone of them, with their values, for
+"--purge-after" (default 720h), so they can be restored with "stacksenv env
+restore". "stacksenv env list --deleted" lists the tombstones. Removing a
+soft-deleted variable without "--soft" removes its tombstone.
+
+The branch is fetched from the server, updated and written back, after the
+validators of the configuration, if any, checked the remaining variables.
+Every variable removed is recorded in the local audit log.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		soft, err := cmd.Flags().GetBool("soft")
+		if err != nil {
+			return err
+		}
+		purgeAfter, err := cmd.Flags().GetDuration("purge-after")
+		if err != nil {
+			return err
+		}
+		if purgeAfter <= 0 {
+			return fmt.Errorf("invalid --purge-after %s: expected a positive duration", purgeAfter)
+		}
+		names := slices.Compact(slices.Sorted(slices.Values(args)))
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+		config, err := updateBranch(v, nil, func(properties []stacksenv.ContextData[any]) ([]stacksenv.ContextData[any], error) {
+			if soft {
+				return softDeleteVariables(properties, names, time.Now().UTC(), purgeAfter)
+			}
+			return removeVariables(properties, names)
+		})
+		if err != nil {
+			return err
+		}
+		publishWrites(config, auditActionUnset, names)
+		verb := "Removed"
+		if soft {
+			verb = "Soft-deleted"
+		}
+		fmt.Fprintf(os.Stderr, "%s %s from branch %s\n", verb, strings.Join(names, ", "), config.Branch)
+		return nil
+	},
+}
+
+var envRestoreCmd = &cobra.Command{
+	Use:   "restore <key>...",
+	Short: "Restore soft-deleted variables of the branch on the server",
+	Long: `Restore variables soft-deleted with "stacksenv env unset --soft" in the
+configured branch on the server, with the values and platform restrictions
+they had, until the server purges their tombstones.
+
+A variable can't be restored if a variable with the same name was set since
+it was deleted. The branch is fetched from the server, updated and written
+back, after the validators of the configuration, if any, checked the
+variables. Every variable restored is recorded in the local audit log.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names := slices.Compact(slices.Sorted(slices.Values(args)))
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+		config, err := updateBranch(v, nil, func(properties []stacksenv.ContextData[any]) ([]stacksenv.ContextData[any], error) {
+			return restoreVariables(properties, names)
+		})
+		if err != nil {
+			return err
+		}
+		publishWrites(config, auditActionRestore, names)
+		fmt.Fprintf(os.Stderr, "Restored %s in branch %s\n", strings.Join(names, ", "), config.Branch)
+		return nil
+	},
+}
+
+// removeVariables removes the variables and tombstones with the given names
+// from properties. Every name must have a variable or a tombstone.
+func removeVariables(properties []stacksenv.ContextData[any], names []string) ([]stacksenv.ContextData[any], error) {
+	for _, name := range names {
+		if !slices.ContainsFunc(properties, func(c stacksenv.ContextData[any]) bool { return c.Property == name }) {
+			return nil, fmt.Errorf("variable %s not found", name)
+		}
+	}
+	return slices.DeleteFunc(slices.Clone(properties), func(c stacksenv.ContextData[any]) bool {
+		return slices.Contains(names, c.Property)
+	}), nil
+}
+
+// softDeleteVariables turns the variables with the given names into
+// tombstones deleted at now and purged after retention, replacing their
+// previous tombstones. Every name must have a variable.
+func softDeleteVariables(properties []stacksenv.ContextData[any], names []string, now time.Time, retention time.Duration) ([]stacksenv.ContextData[any], error) {
+	for _, name := range names {
+		if !slices.ContainsFunc(properties, func(c stacksenv.ContextData[any]) bool { return c.Property == name && !c.IsDeleted() }) {
+			return nil, fmt.Errorf("variable %s not found", name)
+		}
+	}
+
+	updated := make([]stacksenv.ContextData[any], 0, len(properties))
+	for _, contextData := range properties {
+		if !slices.Contains(names, contextData.Property) {
+			updated = append(updated, contextData)
+			continue
+		}
+		if contextData.IsDeleted() {
+			continue
+		}
+		contextData.DeletedAt = now.Format(time.RFC3339)
+		contextData.PurgeAt = now.Add(retention).Format(time.RFC3339)
+		updated = append(updated, contextData)
+	}
+	return updated, nil
+}
+
+// restoreVariables turns the tombstones with the given names back into
+// variables. Every name must have a tombstone and no variable.
+func restoreVariables(properties []stacksenv.ContextData[any], names []string) ([]stacksenv.ContextData[any], error) {
+	for _, name := range names {
+		var deleted, live bool
+		for _, contextData := range properties {
+			if contextData.Property == name {
+				deleted = deleted || contextData.IsDeleted()
+				live = live || !contextData.IsDeleted()
+			}
+		}
+		switch {
+		case live:
+			return nil, fmt.Errorf("can't restore %s: a variable with this name exists", name)
+		case !deleted:
+			return nil, fmt.Errorf("no soft-deleted variable %s: see \"stacksenv env list --deleted\"", name)
+		}
+	}
+
+	updated := slices.Clone(properties)
+	for i, contextData := range updated {
+		if slices.Contains(names, contextData.Property) {
+			updated[i].DeletedAt, updated[i].PurgeAt = "", ""
+		}
+	}
+	return updated, nil
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	envCmd.AddCommand(envValidateCmd)
+	envValidateCmd.Flags().StringP("format", "f", "", "input format of the file (detected from the content if not set)")
+	envValidateCmd.Flags().StringP("output", "o", "text", "output format: text or json")
+}
+
+var envValidateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Check variables with the configured validators",
+	Long: `Check the variables of the configured branch, or of a file in any format
+"stacksenv env import" reads, with the validators of the configuration.
+
+Validators are external commands registered under "validators", by name,
+e.g. to check the format of license keys or that URLs point to allowed hosts:
+
+  {
+    "validators": {
+      "license": "./scripts/check-license-keys",
+      "urls": "internal-url-allowlist --strict"
+    }
+  }
+
+Each validator is run from the current directory with, on stdin, a JSON
+document holding the candidate variables:
+
+  {"source": "server", "branch": "dev", "variables": {"KEY": "value"}}
+
+The source is "server" or the path of the checked file. A validator fails
+by exiting with a non-zero status. It reports issues by printing to stdout
+either {"issues": [{"key": "KEY", "message": "...", "severity": "error"}]}
+or plain lines, one per issue. Issues are errors if the validator failed
+and warnings otherwise, unless they give their severity.
+
+Validators also check the variables read by "stacksenv env import". Like
+"default_command", they run with your permissions: review the validators of
+project configurations you didn't write. The command exits with a non-zero
+status if there are errors. Use "--output json" for a machine-readable
+report.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if output != "text" && output != "json" {
+			return fmt.Errorf("unsupported output format %q (supported: text, json)", output)
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+		validators, err := configuredValidators(v)
+		if err != nil {
+			return err
+		}
+		if len(validators) == 0 {
+			return fmt.Errorf("no validators configured: register them under %q in the configuration", validatorsKey)
+		}
+
+		input := validatorInput{Source: "server"}
+		if len(args) == 1 {
+			vars, _, err := readImportFile(args[0], format, false)
+			if err != nil {
+				return err
+			}
+			input.Source, input.Variables = args[0], make(map[string]string, len(vars))
+			for _, variable := range vars {
+				input.Variables[variable.Key] = variable.Value
+			}
+		} else {
+			config, err := resolveStacksenvConfig(v)
+			if err != nil {
+				return err
+			}
+			properties, err := fetchContextData(v)
+			if err != nil {
+				return err
+			}
+			input.Branch, input.Variables = config.Branch, contextDataToMap(properties)
+		}
+
+		issues, err := runValidators(v, input)
+		if err != nil {
+			return err
+		}
+		errorCount := countValidatorErrors(issues)
+
+		if output == "json" {
+			report := struct {
+				Valid  bool             `json:"valid"`
+				Issues []validatorIssue `json:"issues"`
+			}{errorCount == 0, issues}
+			if report.Issues == nil {
+				report.Issues = []validatorIssue{}
+			}
+
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+		} else {
+			out, err := newColorWriter(os.Stdout, v.GetString(colorKey))
+			if err != nil {
+				return err
+			}
+			printValidatorIssues(out, issues)
+			out.Printf("%d validators run, %d errors, %d warnings\n", len(validators), errorCount, len(issues)-errorCount)
+		}
+
+		if errorCount > 0 {
+			return errors.New("variables are invalid")
+		}
+		return nil
+	},
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/stacksenv/cli/pkg/configstore"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+// Kinds of the operations published on the event bus.
+const (
+	eventFetched       = "fetched"        // an environment was fetched
+	eventWritten       = "written"        // variables of a branch were written
+	eventRevealed      = "revealed"       // a value is about to be revealed
+	eventStarted       = "started"        // a command was started with an environment
+	eventRevoked       = "revoked"        // the server revoked the credentials
+	eventLoggedOut     = "logged_out"     // the stored credentials were removed
+	eventTenantPurged  = "tenant_purged"  // the local data of a tenant was removed
+	eventConfigWritten = "config_written" // a configuration file was written
+)
+
+// operationEvent is an operation published on the event bus, for the
+// subsystems reacting to it. It never holds values.
+type operationEvent struct {
+	Kind string
+	// Server, Environment and Branch tell what the operation is about, if any.
+	Server      string
+	Environment string
+	Branch      string
+	// Action is the audit action of eventWritten and eventRevealed.
+	Action string
+	// Keys are the names of the variables written or revealed.
+	Keys []string
+	// Variables is the number of variables fetched or started with.
+	Variables int
+	// Path, ConfigData and Format are the configuration file written, for
+	// eventConfigWritten.
+	Path       string
+	ConfigData map[string]interface{}
+	Format     configstore.Format
+	// Err is the error of eventRevoked.
+	Err error
+}
+
+// eventHandler is a subscriber of the event bus. Its error is returned to the
+// publisher, which decides whether the operation goes on.
+type eventHandler func(event *operationEvent) error
+
+// eventSubscriber is a handler registered on the event bus.
+type eventSubscriber struct {
+	name    string
+	kinds   []string // nil for every kind
+	handler eventHandler
+}
+
+// eventBus dispatches the operations of commands to the subsystems reacting
+// to them, e.g. the audit log or the offline cache, so commands publish an
+// operation once instead of calling every subsystem.
+type eventBus struct {
+	mu          sync.RWMutex
+	subscribers []eventSubscriber
+}
+
+// operations is the event bus of the CLI. Subsystems subscribe to it in the
+// init function of their file.
+var operations = &eventBus{}
+
+// subscribe registers handler, named for the debug log, for the events of
+// the given kinds, or of every kind if none is given. Handlers are called in
+// the order they subscribed.
+func (b *eventBus) subscribe(name string, handler eventHandler, kinds ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, eventSubscriber{name: name, kinds: kinds, handler: handler})
+}
+
+// publish calls the handlers subscribed to the kind of event, all of them
+// even if some fail, and returns their joined errors.
+func (b *eventBus) publish(event operationEvent) error {
+	b.mu.RLock()
+	subscribers := slices.Clone(b.subscribers)
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, subscriber := range subscribers {
+		if subscriber.kinds != nil && !slices.Contains(subscriber.kinds, event.Kind) {
+			continue
+		}
+		if err := subscriber.handler(&event); err != nil {
+			debugLog("Subscriber %s failed to handle the %s event: %v", subscriber.name, event.Kind, err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// tenantEvent returns an event of kind about the branch of config.
+func tenantEvent(kind string, config *stacksenv.Config) operationEvent {
+	return operationEvent{Kind: kind, Server: config.ServerURL, Environment: config.ID, Branch: config.Branch}
+}
+
+// publishWrites publishes the variables written to the branch of config.
+// Failures are only reported: the variables are already written.
+func publishWrites(config *stacksenv.Config, action string, names []string) {
+	event := tenantEvent(eventWritten, config)
+	event.Action, event.Keys = action, names
+	if err := operations.publish(event); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// publishingStart returns an OnStart hook of a stacksenv.Handler publishing
+// the start of the command before calling onStart, if set.
+func publishingStart(onStart func(branch string, env []string)) func(branch string, env []string) {
+	return func(branch string, env []string) {
+		if err := operations.publish(operationEvent{Kind: eventStarted, Branch: branch, Variables: len(env)}); err != nil {
+			debugLog("Failed to publish the start of the command: %v", err)
+		}
+		if onStart != nil {
+			onStart(branch, env)
+		}
+	}
+}
+
+// publishConfigWritten publishes a configuration file written by
+// configStore.
+func publishConfigWritten(path string, configData map[string]interface{}, format configstore.Format) error {
+	return operations.publish(operationEvent{Kind: eventConfigWritten, Path: path, ConfigData: configData, Format: format})
+}
+
+func init() {
+	operations.subscribe("debug", func(event *operationEvent) error {
+		switch {
+		case event.Path != "":
+			debugLog("Event %s: %s", event.Kind, event.Path)
+		case event.Branch != "" && event.Server != "":
+			debugLog("Event %s: environment '%s' on branch '%s' of %s", event.Kind, event.Environment, event.Branch, event.Server)
+		case event.Server != "":
+			debugLog("Event %s: environment '%s' of %s", event.Kind, event.Environment, event.Server)
+		default:
+			debugLog("Event %s", event.Kind)
+		}
+		return nil
+	})
+}
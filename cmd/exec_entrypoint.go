@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+func init() {
+	rootCmd.AddCommand(execEntrypointCmd)
+	execEntrypointCmd.Flags().SetInterspersed(false)
+	execEntrypointCmd.Flags().Bool("keep-credentials", false, "pass the stacksenv credentials of the environment to the command")
+	addFilterFlags(execEntrypointCmd)
+}
+
+var execEntrypointCmd = &cobra.Command{
+	Use:   "exec-entrypoint [flags] -- <command> [args...]",
+	Short: "Fetch the environment and replace stacksenv with a command",
+	Long: `Fetch the environment and replace the stacksenv process with the command,
+for use as the ENTRYPOINT of containers built from scratch or distroless
+images, which have no shell:
+
+  FROM scratch
+  COPY stacksenv /stacksenv
+  COPY app /app
+  ENTRYPOINT ["/stacksenv", "exec-entrypoint", "--", "/app"]
+
+The credentials are given to the container through the environment, e.g.
+FB_STACKSENV_URL, or a mounted configuration file.
+
+Unlike "stacksenv run", the command isn't started as a child process: once
+the environment is fetched, stacksenv execs the command, which keeps its
+process ID. As PID 1 of the container, the command gets the signals sent to
+the container directly, and its exit status is the one of the container.
+Neither a shell nor /proc is needed. Build the static binary for the image
+with "make build-static".
+
+The variables fetched from the server are applied over the environment of the
+container. The stacksenv credentials given through the environment
+(FB_STACKSENV_URL, FB_STACKSENV_ID, FB_STACKSENV_SECRET, FB_STACKSENV_KEY and
+FB_TOKEN), the passphrases ` + passphraseEnvVar + ` and
+` + bundlePassphraseEnvVar + `, and FB_PROXY are removed from it, so the
+command can't read them, unless "--keep-credentials" is set. The include and exclude patterns apply like for
+"stacksenv run".
+
+Commands without a "/" are looked up in PATH. Flags after the command are
+passed to it; use "--" before the command if it starts with "-". Replacing
+the process is not supported on Windows.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keepCredentials, err := cmd.Flags().GetBool("keep-credentials")
+		if err != nil {
+			return err
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+		config, err := resolveStacksenvConfig(v)
+		if err != nil {
+			return err
+		}
+		if err := checkMinServerVersion(v, config); err != nil {
+			return err
+		}
+		service, err := newInjectingClientService(v)
+		if err != nil {
+			return err
+		}
+
+		// As PID 1, stacksenv is only stopped by the signals it handles
+		ctx, stop := signalContext()
+		properties, err := stacksenv.FetchWithContext(ctx, service, config)
+		interrupted := ctx.Err() != nil
+		stop()
+		if interrupted {
+			return errors.New("interrupted while fetching the environment")
+		}
+		if err != nil {
+			return handleRevoked(logRequestID(fmt.Errorf("unable to retrieve environment context data: %w", err)))
+		}
+
+		env := contextDataToEnv(properties)
+		if !v.GetBool("quiet") {
+			printEnvChecksum(config.Branch, env)
+		}
+		if !keepCredentials {
+			for _, name := range credentialEnvVars {
+				os.Unsetenv(name) //nolint:errcheck
+			}
+		}
+		return stacksenv.Exec(args[0], args[1:], env)
+	},
+}
+
+// credentialEnvVars are the environment variables stacksenv reads the
+// credentials of the environment from, the passphrases unsealing the
+// configuration and bundles, and the proxy, whose URL may hold credentials.
+var credentialEnvVars = []string{
+	"FB_STACKSENV_URL", "FB_STACKSENV_ID", "FB_STACKSENV_SECRET", "FB_STACKSENV_KEY", "FB_TOKEN",
+	passphraseEnvVar, bundlePassphraseEnvVar, "FB_PROXY",
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+const (
+	// includeKey is the configuration key and flag listing the patterns of
+	// the variables to inject.
+	includeKey = "include"
+	// excludeKey is the configuration key and flag listing the patterns of
+	// the variables not to inject.
+	excludeKey = "exclude"
+)
+
+// variableFilter selects the variables injected into commands by name.
+type variableFilter struct {
+	include []string
+	exclude []string
+}
+
+// addFilterFlags adds the --include and --exclude flags to a command
+// injecting variables.
+func addFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray(includeKey, nil, `only inject variables matching this pattern, e.g. "APP_*" (repeatable)`)
+	cmd.Flags().StringArray(excludeKey, nil, `don't inject variables matching this pattern, e.g. "*_DEBUG" (repeatable)`)
+}
+
+// newVariableFilter returns the filter configured by the include and exclude
+// flags or, if they aren't given, configuration keys. It returns nil if no
+// patterns are configured.
+func newVariableFilter(v *viper.Viper) (*variableFilter, error) {
+	filter := &variableFilter{include: v.GetStringSlice(includeKey), exclude: v.GetStringSlice(excludeKey)}
+	for _, pattern := range slices.Concat(filter.include, filter.exclude) {
+		if err := checkVariablePattern(pattern); err != nil {
+			return nil, err
+		}
+	}
+	if len(filter.include) == 0 && len(filter.exclude) == 0 {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// checkVariablePattern checks the syntax of a variable name pattern.
+func checkVariablePattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid variable pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+// matches reports whether a variable is injected: its name matches an
+// include pattern, if there are any, and no exclude pattern.
+func (f *variableFilter) matches(name string) bool {
+	if len(f.include) > 0 && !matchesAny(f.include, name) {
+		return false
+	}
+	return !matchesAny(f.exclude, name)
+}
+
+// apply returns the variables selected by the filter, preserving their order.
+func (f *variableFilter) apply(properties []stacksenv.ContextData[any]) []stacksenv.ContextData[any] {
+	filtered := make([]stacksenv.ContextData[any], 0, len(properties))
+	for _, contextData := range properties {
+		if f.matches(contextData.Property) {
+			filtered = append(filtered, contextData)
+		}
+	}
+	return filtered
+}
+
+// matchesAny reports whether name matches one of the patterns.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		// The patterns were checked by newVariableFilter
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filteringClientService drops the variables not selected by a filter from
+// the fetched environment.
+type filteringClientService struct {
+	stacksenv.ClientService
+	filter *variableFilter
+}
+
+// GetContextDecryptedData fetches the environment and applies the filter.
+func (s *filteringClientService) GetContextDecryptedData(config *stacksenv.Config) ([]stacksenv.ContextData[any], error) {
+	return s.GetContextDecryptedDataContext(context.Background(), config)
+}
+
+// GetContextDecryptedDataContext is like GetContextDecryptedData but aborts the
+// fetch when ctx is done.
+func (s *filteringClientService) GetContextDecryptedDataContext(ctx context.Context, config *stacksenv.Config) ([]stacksenv.ContextData[any], error) {
+	properties, err := stacksenv.FetchWithContext(ctx, s.ClientService, config)
+	if err != nil {
+		return nil, err
+	}
+	return s.filter.apply(properties), nil
+}
+
+// Subscribe subscribes to the changes of the environment and applies the
+// filter to every changed environment.
+func (s *filteringClientService) Subscribe(ctx context.Context, config *stacksenv.Config) (<-chan stacksenv.EnvironmentEvent, error) {
+	events, err := stacksenv.SubscribeWithContext(ctx, s.ClientService, config)
+	if err != nil {
+		return nil, err
+	}
+	return relayEvents(ctx, events, func(event *stacksenv.EnvironmentEvent) {
+		if event.Err == nil {
+			event.Variables = s.filter.apply(event.Variables)
+		}
+	}), nil
+}
+
+// relayEvents returns the channel of the events of a subscription, passed
+// through apply, for client services wrapping another one. It is closed with
+// events.
+func relayEvents(ctx context.Context, events <-chan stacksenv.EnvironmentEvent, apply func(*stacksenv.EnvironmentEvent)) <-chan stacksenv.EnvironmentEvent {
+	relayed := make(chan stacksenv.EnvironmentEvent)
+	go func() {
+		defer close(relayed)
+		for event := range events {
+			apply(&event)
+			select {
+			case relayed <- event:
+			case <-ctx.Done():
+				// The subscription closes events once it sees ctx done
+			}
+		}
+	}()
+	return relayed
+}
+
+// newInjectingClientService returns the client service fetching the
+// variables injected into commands: newClientService, filtered by the
+// include and exclude patterns.
+func newInjectingClientService(v *viper.Viper) (stacksenv.ClientService, error) {
+	service, err := newClientService(v)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := newVariableFilter(v)
+	if err != nil || filter == nil {
+		return service, err
+	}
+	return &filteringClientService{ClientService: service, filter: filter}, nil
+}
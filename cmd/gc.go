@@ -0,0 +1,355 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	// auditMaxAgeKey is the configuration key setting how long the events of
+	// the audit logs are kept by "stacksenv gc", e.g. "2160h".
+	auditMaxAgeKey = "audit_max_age"
+	// backupMaxAgeKey is the configuration key setting how long the backups
+	// of configuration files are kept by "stacksenv gc", e.g. "720h".
+	backupMaxAgeKey = "backup_max_age"
+)
+
+const (
+	// defaultAuditMaxAge is how long audit events are kept unless configured
+	// otherwise.
+	defaultAuditMaxAge = 90 * 24 * time.Hour
+	// defaultBackupMaxAge is how long configuration backups are kept unless
+	// configured otherwise.
+	defaultBackupMaxAge = 30 * 24 * time.Hour
+	// staleTempAge is the age from which temporary files are considered
+	// orphaned, left behind by a stacksenv process that didn't exit cleanly.
+	staleTempAge = 24 * time.Hour
+)
+
+// Prefixes of the temporary files and directories stacksenv creates in the
+// temporary directory, removed by "stacksenv gc" once stale.
+const (
+	// updateTempPrefix prefixes the directories downloaded releases are
+	// extracted to.
+	updateTempPrefix = "stacksenv-update-"
+	// verifyTempPrefix prefixes the directories archives are extracted to for
+	// verification.
+	verifyTempPrefix = "stacksenv-verify-"
+	// selftestTempPrefix prefixes the directories of "stacksenv selftest".
+	selftestTempPrefix = "stacksenv-selftest-"
+	// configTempPrefix prefixes the copies of configuration files being
+	// edited.
+	configTempPrefix = "stacksenv-config-"
+)
+
+// tempPrefixes are the prefixes of the temporary files and directories
+// stacksenv creates in the temporary directory.
+var tempPrefixes = []string{updateTempPrefix, verifyTempPrefix, selftestTempPrefix, configTempPrefix}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+	gcCmd.Flags().Bool("dry-run", false, "only list what would be removed")
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove stale local state",
+	Long: `Remove the local state stacksenv no longer needs:
+
+- cached environments older than "cache_max_age", and the least recently
+  used ones beyond "cache_max_size" (see "stacksenv cache")
+- audit events older than "audit_max_age" (default 2160h)
+- backups of the global and project configuration files, written by
+  "stacksenv config migrate", older than "backup_max_age" (default 720h)
+- temporary files and directories of interrupted updates, update
+  verifications, self-tests, config edits and configuration writes, older
+  than a day
+- empty tenant directories
+
+With "--dry-run", what would be removed is listed and nothing is removed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+
+		items, err := gcItems(v)
+		if err != nil {
+			return err
+		}
+
+		var freed int64
+		for _, item := range items {
+			if dryRun {
+				fmt.Printf("Would remove %s\n", item.what)
+				continue
+			}
+			if err := item.remove(); errors.Is(err, os.ErrPermission) {
+				// Temporary files of other users, which they clean up
+				debugLog("Skipping %s: %v", item.path, err)
+				continue
+			} else if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to remove %s: %v\n", item.path, err)
+				continue
+			}
+			freed += item.size
+			fmt.Printf("Removed %s\n", item.what)
+		}
+		if !dryRun {
+			removeEmptyTenantDirs()
+		}
+
+		switch {
+		case len(items) == 0:
+			fmt.Println("Nothing to clean up")
+		case !dryRun && freed > 0:
+			fmt.Printf("Freed %s\n", formatByteSize(freed))
+		}
+		return nil
+	},
+}
+
+// gcItem is something "stacksenv gc" removes.
+type gcItem struct {
+	what   string       // description of the item for the user
+	path   string       // file or directory of the item
+	size   int64        // bytes freed by the removal, if known
+	remove func() error // removes the item
+}
+
+// gcItems returns what "stacksenv gc" removes with the configuration of v.
+func gcItems(v *viper.Viper) ([]gcItem, error) {
+	var items []gcItem
+	for _, collect := range []func(*viper.Viper) ([]gcItem, error){gcCacheItems, gcAuditItems, gcBackupItems, gcTempItems} {
+		collected, err := collect(v)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, collected...)
+	}
+	return items, nil
+}
+
+// gcCacheItems returns the cached environments evicted by the limits of the
+// offline cache.
+func gcCacheItems(v *viper.Viper) ([]gcItem, error) {
+	maxSize, maxAge, err := cacheLimits(v)
+	if err != nil {
+		return nil, err
+	}
+	evicted, err := cacheEvictions(maxSize, maxAge)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]gcItem, 0, len(evicted))
+	for _, entry := range evicted {
+		what := fmt.Sprintf("cached environment %s/%s on %s (over %s)", entry.Environment, entry.Branch, entry.Server, cacheMaxSizeKey)
+		if time.Since(entry.FetchedAt) > maxAge {
+			what = fmt.Sprintf("cached environment %s/%s on %s (expired)", entry.Environment, entry.Branch, entry.Server)
+		}
+		items = append(items, gcItem{what: what, path: entry.path, size: entry.size, remove: removePath(entry.path)})
+	}
+	return items, nil
+}
+
+// gcAuditItems returns the audit logs holding events older than the
+// configured age.
+func gcAuditItems(v *viper.Viper) ([]gcItem, error) {
+	maxAge, err := configMaxAge(v, auditMaxAgeKey, defaultAuditMaxAge)
+	if err != nil {
+		return nil, err
+	}
+	dataDir, err := getDataDir()
+	if err != nil {
+		return nil, err
+	}
+	tenantLogs, err := filepath.Glob(filepath.Join(dataDir, tenantsDirName, "*", auditLogName))
+	if err != nil {
+		return nil, err
+	}
+
+	expired := func(event auditEvent) bool { return time.Since(event.Time) > maxAge }
+	var items []gcItem
+	for _, path := range append([]string{filepath.Join(dataDir, auditLogName)}, tenantLogs...) {
+		count, err := filterAuditLog(path, expired, true)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			continue
+		}
+		items = append(items, gcItem{
+			what: fmt.Sprintf("%d audit events older than %s from %s", count, auditMaxAgeKey, path),
+			path: path,
+			remove: func() error {
+				_, err := filterAuditLog(path, expired, false)
+				return err
+			},
+		})
+	}
+	return items, nil
+}
+
+// gcBackupItems returns the backups of the global and project configuration
+// files older than the configured age.
+func gcBackupItems(v *viper.Viper) ([]gcItem, error) {
+	maxAge, err := configMaxAge(v, backupMaxAgeKey, defaultBackupMaxAge)
+	if err != nil {
+		return nil, err
+	}
+	globalConfigPath, err := getGlobalConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	localConfigPath, err := getLocalConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []gcItem
+	for _, configPath := range []string{globalConfigPath, localConfigPath} {
+		backups, err := filepath.Glob(configPath + ".v*.bak")
+		if err != nil {
+			return nil, err
+		}
+		for _, backup := range backups {
+			if item, ok := staleItem(backup, maxAge, "configuration backup"); ok {
+				items = append(items, item)
+			}
+		}
+	}
+	return items, nil
+}
+
+// gcTempItems returns the temporary files left behind by stacksenv processes
+// that didn't exit cleanly: those of the temporary directory, and those of
+// the atomic writes of the configuration and data directories.
+func gcTempItems(*viper.Viper) ([]gcItem, error) {
+	var candidates []string
+	entries, err := os.ReadDir(os.TempDir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read temporary directory: %w", err)
+	}
+	for _, entry := range entries {
+		for _, prefix := range tempPrefixes {
+			if strings.HasPrefix(entry.Name(), prefix) {
+				candidates = append(candidates, filepath.Join(os.TempDir(), entry.Name()))
+				break
+			}
+		}
+	}
+
+	configDir, err := getConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	dataDir, err := getDataDir()
+	if err != nil {
+		return nil, err
+	}
+	localConfigPath, err := getLocalConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range []string{configDir, dataDir, filepath.Dir(localConfigPath)} {
+		leftovers, err := filepath.Glob(filepath.Join(dir, ".*.tmp"))
+		if err != nil {
+			return nil, err
+		}
+		for _, leftover := range leftovers {
+			if !slices.Contains(candidates, leftover) {
+				candidates = append(candidates, leftover)
+			}
+		}
+	}
+
+	var items []gcItem
+	for _, candidate := range candidates {
+		if item, ok := staleItem(candidate, staleTempAge, "orphaned temporary file"); ok {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// staleItem returns an item removing path, described by kind, if it was last
+// modified more than maxAge ago.
+func staleItem(path string, maxAge time.Duration, kind string) (gcItem, bool) {
+	info, err := os.Lstat(path)
+	if err != nil || time.Since(info.ModTime()) <= maxAge {
+		return gcItem{}, false
+	}
+	size := info.Size()
+	if info.IsDir() {
+		size = dirSize(path)
+	}
+	return gcItem{what: kind + " " + path, path: path, size: size, remove: removePath(path)}, true
+}
+
+// removePath returns a function removing path and everything it contains.
+func removePath(path string) func() error {
+	return func() error {
+		return os.RemoveAll(path)
+	}
+}
+
+// dirSize returns the total size of the files under dir.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(_ string, entry os.DirEntry, err error) error { //nolint:errcheck
+		if err != nil {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// removeEmptyTenantDirs removes the tenant directories, and their cache
+// directories, left empty.
+func removeEmptyTenantDirs() {
+	tenantsDir, err := getTenantsDir()
+	if err != nil {
+		return
+	}
+	tenantDirs, _ := filepath.Glob(filepath.Join(tenantsDir, "*"))
+	for _, tenantDir := range tenantDirs {
+		// Removing a directory fails unless it is empty
+		os.Remove(filepath.Join(tenantDir, "cache")) //nolint:errcheck
+		if os.Remove(tenantDir) == nil {
+			debugLog("Removed empty tenant directory %s", tenantDir)
+		}
+	}
+	os.Remove(tenantsDir) //nolint:errcheck
+}
+
+// configMaxAge returns the positive duration configured under key, or
+// defaultValue if it isn't set.
+func configMaxAge(v *viper.Viper, key string, defaultValue time.Duration) (time.Duration, error) {
+	configured := v.GetString(key)
+	if configured == "" {
+		return defaultValue, nil
+	}
+	age, err := time.ParseDuration(configured)
+	if err != nil || age <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: expected a positive duration like \"720h\"", key, configured)
+	}
+	return age, nil
+}
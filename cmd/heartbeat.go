@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+	"github.com/stacksenv/cli/version"
+)
+
+const (
+	// heartbeatRemotesKey is the configuration key listing the remotes that
+	// opted in to heartbeats.
+	heartbeatRemotesKey = "heartbeat_remotes"
+	// heartbeatIntervalKey is the configuration key holding the interval
+	// between heartbeats.
+	heartbeatIntervalKey = "heartbeat_interval"
+)
+
+// defaultHeartbeatInterval is the interval between heartbeats unless
+// configured otherwise.
+const defaultHeartbeatInterval = 5 * time.Minute
+
+func init() {
+	remoteCmd.AddCommand(remoteHeartbeatCmd)
+}
+
+var remoteHeartbeatCmd = &cobra.Command{
+	Use:   "heartbeat <name> on|off",
+	Short: "Opt a remote in to or out of heartbeats",
+	Long: `Opt a remote in to or out of heartbeats.
+
+While "stacksenv run --watch" or "stacksenv agent" uses a remote that opted
+in, it checks in with the server every "heartbeat_interval" (default 5m) with
+the hostname, the CLI version and the branch in use, so platform teams can
+see which machines consume which environments and which run outdated CLI
+versions. Variable names and values are never sent.
+
+The opted-in remotes are listed under "heartbeat_remotes" in the local
+project configuration, or in the global configuration with "--global".`,
+	Args:      cobra.ExactArgs(2),
+	ValidArgs: []string{"on", "off"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, state := strings.ToLower(args[0]), args[1]
+		if state != "on" && state != "off" {
+			return fmt.Errorf("invalid heartbeat state %q: expected on or off", state)
+		}
+
+		configPath, err := remoteConfigPath(cmd)
+		if err != nil {
+			return err
+		}
+		unlock, err := configStore.Lock(configPath)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		configData, _, format, err := readRemotes(configPath)
+		if err != nil {
+			return err
+		}
+
+		var names []string
+		if list, ok := configData[heartbeatRemotesKey].([]interface{}); ok {
+			for _, item := range list {
+				names = append(names, strings.ToLower(fmt.Sprint(item)))
+			}
+		}
+		names = slices.DeleteFunc(names, func(n string) bool { return n == name })
+		if state == "on" {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		if len(names) == 0 {
+			delete(configData, heartbeatRemotesKey)
+		} else {
+			list := make([]interface{}, len(names))
+			for i, n := range names {
+				list[i] = n
+			}
+			configData[heartbeatRemotesKey] = list
+		}
+
+		if err := configStore.Write(configPath, configData, format); err != nil {
+			return err
+		}
+
+		fmt.Printf("Heartbeats %s for remote %s in %s\n", state, name, configPath)
+		return nil
+	},
+}
+
+// heartbeatEnabled reports whether the remote used by the command line opted
+// in to heartbeats.
+func heartbeatEnabled(v *viper.Viper) bool {
+	name := usedRemote(v)
+	return name != "" && slices.ContainsFunc(v.GetStringSlice(heartbeatRemotesKey), func(n string) bool {
+		return strings.EqualFold(n, name)
+	})
+}
+
+// heartbeatInterval returns the configured interval between heartbeats.
+func heartbeatInterval(v *viper.Viper) (time.Duration, error) {
+	configured := v.GetString(heartbeatIntervalKey)
+	if configured == "" {
+		return defaultHeartbeatInterval, nil
+	}
+	interval, err := time.ParseDuration(configured)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: expected a positive duration like \"5m\"", heartbeatIntervalKey, configured)
+	}
+	return interval, nil
+}
+
+// sendHeartbeats checks in with the server of config every interval until ctx
+// is done. Failures are reported once until a heartbeat succeeds again; a
+// server without heartbeat support ends the loop.
+func sendHeartbeats(ctx context.Context, httpClient stacksenv.HTTPClient, config stacksenv.Config, interval time.Duration) {
+	heartbeat := stacksenv.NewHeartbeat(version.Version, config.Branch)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failing := false
+	for {
+		err := stacksenv.SendHeartbeat(ctx, &config, httpClient, heartbeat)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			var incompatible *stacksenv.IncompatibleServerError
+			if errors.As(err, &incompatible) {
+				fmt.Fprintf(os.Stderr, "stacksenv: heartbeats disabled: %v\n", err)
+				return
+			}
+			if !failing {
+				fmt.Fprintf(os.Stderr, "stacksenv: failed to send heartbeat: %v\n", err)
+			}
+			failing = true
+		default:
+			debugLog("Sent heartbeat to %s", config.ServerURL)
+			failing = false
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/homedir"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+const (
+	// httpTimeoutKey is the configuration key bounding each attempt of a
+	// request to the server, set by the httpTimeoutFlag flag.
+	httpTimeoutKey  = "http_timeout"
+	httpTimeoutFlag = "http-timeout"
+	// httpRetriesKey is the configuration key setting how many times a
+	// request failing with a transient error is retried, set by the
+	// httpRetriesFlag flag.
+	httpRetriesKey  = "http_retries"
+	httpRetriesFlag = "http-retries"
+	// httpRetryBackoffKey is the configuration key setting the delay before
+	// the first retry of a request, doubled for every further retry, set by
+	// the httpRetryBackoffFlag flag.
+	httpRetryBackoffKey  = "http_retry_backoff"
+	httpRetryBackoffFlag = "http-retry-backoff"
+)
+
+// flagConfigKeys maps the persistent flags whose configuration keys aren't
+// their names to those keys.
+var flagConfigKeys = map[string]string{
+	httpTimeoutFlag:      httpTimeoutKey,
+	httpRetriesFlag:      httpRetriesKey,
+	httpRetryBackoffFlag: httpRetryBackoffKey,
+}
+
+// flagConfigKey returns the configuration key set by the persistent flag
+// named name.
+func flagConfigKey(name string) string {
+	if key, ok := flagConfigKeys[name]; ok {
+		return key
+	}
+	return name
+}
+
+// configKeyFlag returns the name of the persistent flag setting the
+// configuration key key, the inverse of flagConfigKey.
+func configKeyFlag(key string) string {
+	for name, flagKey := range flagConfigKeys {
+		if flagKey == key {
+			return name
+		}
+	}
+	return key
+}
+
+const (
+	// caCertKey is the configuration key naming a PEM bundle of certificate
+	// authorities trusted for the server, besides the system ones.
+	caCertKey = "ca_cert"
+	// clientCertKey is the configuration key naming the PEM client
+	// certificate presented to servers requiring mutual TLS.
+	clientCertKey = "client_cert"
+	// clientKeyKey is the configuration key naming the PEM private key of the
+	// client certificate, if it isn't in the certificate file.
+	clientKeyKey = "client_key"
+	// insecureSkipVerifyKey is the configuration key disabling the
+	// verification of the certificate of the server.
+	insecureSkipVerifyKey = "insecure_skip_verify"
+	// proxyKey is the configuration key setting the proxy requests to the
+	// server go through, instead of the one of HTTP_PROXY and HTTPS_PROXY.
+	proxyKey = "proxy"
+	// transportKey is the configuration key selecting how environments are
+	// fetched: one of transportNames.
+	transportKey = "transport"
+)
+
+// transportNames are the valid values of transportKey: the GET /cli
+// endpoint, the default, or the gRPC API of the server.
+var transportNames = []string{"http", "grpc"}
+
+// newHTTPClient returns the HTTP client for requests to the server, with the
+// configured timeout, retries, TLS settings and proxy.
+func newHTTPClient(v *viper.Viper) (stacksenv.HTTPClient, error) {
+	options, err := httpOptions(v)
+	if err != nil {
+		return nil, err
+	}
+	return stacksenv.NewHTTPClientWithOptions(options), nil
+}
+
+// httpOptions returns the configured HTTP client options, with the defaults of
+// the stacksenv package for unset keys.
+func httpOptions(v *viper.Viper) (stacksenv.HTTPOptions, error) {
+	options := stacksenv.DefaultHTTPOptions()
+
+	var err error
+	if options.Timeout, err = nonNegativeDuration(v, httpTimeoutKey, options.Timeout); err != nil {
+		return options, err
+	}
+	if options.RetryBackoff, err = nonNegativeDuration(v, httpRetryBackoffKey, options.RetryBackoff); err != nil {
+		return options, err
+	}
+	if configured := v.GetString(httpRetriesKey); configured != "" {
+		retries, err := strconv.Atoi(configured)
+		if err != nil || retries < 0 {
+			return options, fmt.Errorf("invalid %s %q: expected a number of retries like 2", httpRetriesKey, configured)
+		}
+		options.Retries = retries
+	}
+
+	tlsConfig, err := stacksenv.LoadTLSConfig(stacksenv.TLSOptions{
+		CACert:             expandHome(v.GetString(caCertKey)),
+		ClientCert:         expandHome(v.GetString(clientCertKey)),
+		ClientKey:          expandHome(v.GetString(clientKeyKey)),
+		InsecureSkipVerify: v.GetBool(insecureSkipVerifyKey),
+	})
+	if err != nil {
+		return options, err
+	}
+	if tlsConfig != nil && tlsConfig.InsecureSkipVerify {
+		warnInsecure.Do(func() {
+			fmt.Fprintf(os.Stderr, "Warning: %s is set, the certificate of the server is not verified\n", insecureSkipVerifyKey)
+		})
+	}
+	options.TLS = tlsConfig
+
+	if configured := v.GetString(proxyKey); configured != "" {
+		if options.Proxy, err = stacksenv.ParseProxyURL(configured); err != nil {
+			return options, fmt.Errorf("invalid %s: %w", proxyKey, err)
+		}
+		debugLog("Using proxy %s", options.Proxy.Redacted())
+	}
+	return options, nil
+}
+
+// warnInsecure warns once per process that the certificate of the server is
+// not verified.
+var warnInsecure sync.Once
+
+// expandHome replaces a leading "~" of path with the home directory.
+func expandHome(path string) string {
+	expanded, err := homedir.Expand(path)
+	if err != nil {
+		return path
+	}
+	return expanded
+}
+
+// nonNegativeDuration returns the duration configured under key, or
+// defaultValue if it isn't set.
+func nonNegativeDuration(v *viper.Viper, key string, defaultValue time.Duration) (time.Duration, error) {
+	configured := v.GetString(key)
+	if configured == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(configured)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %q: expected a duration like \"30s\"", key, configured)
+	}
+	return d, nil
+}
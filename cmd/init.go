@@ -1,23 +1,57 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/config"
+	"github.com/stacksenv/cli/pkg/configstore"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+	"github.com/stacksenv/cli/pkg/term"
 )
 
+// defaultInitBranch is the branch the wizard proposes when the credentials
+// don't name one.
+const defaultInitBranch = "dev"
+
 func init() {
 	rootCmd.AddCommand(initCmd)
+	initCmd.Flags().Bool("non-interactive", false, "write a configuration with placeholders instead of running the setup wizard")
 }
 
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize new project",
-	Long:  `Initialize a new project by creating a .stacksenv/config.json file in the current directory.`,
-	RunE: func(_ *cobra.Command, _ []string) error {
-		if err := createLocalConfig(); err != nil {
+	Long: `Initialize a new project by creating a .stacksenv/config.json file in the current directory.
+
+In a terminal, a setup wizard asks for a stacksenv:// URL, or for the server
+URL and credentials to build one, and for the branch of the project. It then
+checks that the environment can be fetched and writes a complete
+configuration, with the credentials as the "origin" remote.
+
+With "--non-interactive", or when the input isn't a terminal, a configuration
+with placeholders for the credentials is written instead, to be filled in by
+hand. "--non-interactive" also fails instead of asking to recreate an
+existing configuration.
+
+With "--branch", the branch is recorded as the default branch of the project,
+so commands run in the project use it unless another one is selected.`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		branch, err := cmd.Flags().GetString("branch")
+		if err != nil {
+			return err
+		}
+		nonInteractive, err := cmd.Flags().GetBool("non-interactive")
+		if err != nil {
+			return err
+		}
+
+		configPath, err := newLocalConfigPath(!nonInteractive)
+		if err != nil {
 			// If user cancelled, don't return error, just exit silently
 			if err.Error() == "operation cancelled by user" {
 				return nil
@@ -25,9 +59,131 @@ var initCmd = &cobra.Command{
 			return err
 		}
 
-		cwd, _ := os.Getwd()
-		configPath := filepath.Join(cwd, ".stacksenv", "config.json")
+		configData := defaultLocalConfig(branch)
+		if !nonInteractive && term.IsTerminal(os.Stdin) {
+			if configData, err = runInitWizard(cmd, branch); err != nil {
+				return err
+			}
+			if configData == nil {
+				fmt.Println("Operation cancelled.")
+				return nil
+			}
+		}
+		if err := writeLocalConfig(configPath, configData); err != nil {
+			return err
+		}
+
 		fmt.Printf("Initialized project configuration at: %s\n", configPath)
 		return nil
 	},
 }
+
+// runInitWizard asks for the credentials and branch of the project, checks
+// that the environment can be fetched and returns the local configuration to
+// write, or nil if the user gave up after a failed check.
+func runInitWizard(cmd *cobra.Command, branch string) (map[string]interface{}, error) {
+	v, err := initViper(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := promptSecret("stacksenv:// URL (press Enter to enter the credentials instead)")
+	if err != nil {
+		return nil, err
+	}
+
+	var envConfig stacksenv.Config
+	if url != "" {
+		if !strings.HasPrefix(url, "stacksenv://") {
+			url = "stacksenv://" + url
+		}
+		// Parse errors quote the URL, which contains secrets
+		if envConfig, err = stacksenv.ParseURL(strings.TrimPrefix(url, "stacksenv://")); err != nil {
+			return nil, errors.New("invalid stacksenv URL: expected stacksenv://ID:SECRET:SECRET_KEY@SERVER_URL/BRANCH")
+		}
+	} else {
+		defaultServer := v.GetString("serverurl")
+		if defaultServer == "" {
+			defaultServer = config.DefaultServerURL
+		}
+		serverURL, err := promptLine("Server URL", defaultServer)
+		if err != nil {
+			return nil, err
+		}
+		id, err := promptLine("Environment ID", "")
+		if err != nil {
+			return nil, err
+		}
+		secret, err := promptSecret("Secret")
+		if err != nil {
+			return nil, err
+		}
+		secretKey, err := promptSecret("Secret key")
+		if err != nil {
+			return nil, err
+		}
+		if id == "" || secret == "" || secretKey == "" {
+			return nil, errors.New("environment ID, secret and secret key are required")
+		}
+
+		host, plainHTTP := splitServerURL(serverURL)
+		envConfig = stacksenv.Config{ID: id, Secret: secret, SecretKey: secretKey, ServerURL: host, DisableHTTPS: plainHTTP, SignRequests: v.GetBool(signRequestsKey)}
+		url = stacksenv.FormatURL(stacksenv.Config{ID: id, Secret: secret, SecretKey: secretKey, ServerURL: host, Branch: defaultInitBranch, DisableHTTPS: plainHTTP})
+	}
+
+	if branch == "" {
+		branch = envConfig.Branch
+	}
+	if branch == "" {
+		branch = defaultInitBranch
+	}
+	if branch, err = promptLine("Branch", branch); err != nil {
+		return nil, err
+	}
+	envConfig.Branch = branch
+	url = withURLBranch(url, branch)
+
+	fmt.Printf("Fetching branch %s from %s...\n", branch, envConfig.ServerURL)
+	if count, err := checkInitConfig(v, &envConfig); err != nil {
+		fmt.Printf("Failed to fetch the environment: %v\n", err)
+		answer, err := promptLine("Write the configuration anyway? (y/n)", "n")
+		if err != nil {
+			return nil, err
+		}
+		if answer = strings.ToLower(answer); answer != "y" && answer != "yes" {
+			return nil, nil
+		}
+	} else {
+		fmt.Printf("Connected: branch %s has %d variables\n", branch, count)
+	}
+
+	return map[string]interface{}{
+		schemaKey:              configSchemaRef,
+		configstore.VersionKey: currentConfigVersion(),
+		remotesKey:             map[string]interface{}{defaultRemote: url},
+		"stacksenv_branch":     branch,
+	}, nil
+}
+
+// checkInitConfig fetches the environment with the credentials entered in the
+// wizard and returns its number of variables.
+func checkInitConfig(v *viper.Viper, envConfig *stacksenv.Config) (int, error) {
+	if err := checkMinServerVersion(v, envConfig); err != nil {
+		return 0, err
+	}
+	codec, err := configuredCodec(v)
+	if err != nil {
+		return 0, err
+	}
+	// Bypass the offline cache, which would hide connection problems
+	httpClient, err := newHTTPClient(v)
+	if err != nil {
+		return 0, err
+	}
+	service := stacksenv.NewClientServiceWithCodec(httpClient, stacksenv.NewCryptoService(), codec)
+	properties, err := service.GetContextDecryptedData(envConfig)
+	if err != nil {
+		return 0, err
+	}
+	return len(properties), nil
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/configstore"
+)
+
+// npmScriptShellKey is the .npmrc setting naming the shell npm, pnpm and
+// yarn 1 run package.json scripts with.
+const npmScriptShellKey = "script-shell"
+
+// npmScriptShell is the wrapper run as the script shell on Unix-like systems.
+// Scripts run by a script already in the environment reuse it.
+const npmScriptShell = `#!/bin/sh
+# Generated by "stacksenv integrate npm": runs package.json scripts with the
+# stacksenv environment loaded.
+if [ -n "$` + activeEnvVar + `" ]; then
+  exec /bin/sh "$@"
+fi
+export ` + activeEnvVar + `=1
+exec stacksenv run -- /bin/sh "$@"
+`
+
+// npmScriptShellWindows is the wrapper run as the script shell on Windows.
+const npmScriptShellWindows = "@echo off\r\n" +
+	"rem Generated by \"stacksenv integrate npm\": runs package.json scripts with the\r\n" +
+	"rem stacksenv environment loaded.\r\n" +
+	"setlocal\r\n" +
+	"if defined " + activeEnvVar + " (\r\n" +
+	"  cmd.exe %*\r\n" +
+	") else (\r\n" +
+	"  set " + activeEnvVar + "=1\r\n" +
+	"  stacksenv run -- cmd.exe %*\r\n" +
+	")\r\n" +
+	"exit /b %errorlevel%\r\n"
+
+func init() {
+	rootCmd.AddCommand(integrateCmd)
+	integrateCmd.AddCommand(integrateNpmCmd)
+	integrateNpmCmd.Flags().Bool("remove", false, "remove the integration")
+}
+
+var integrateCmd = &cobra.Command{
+	Use:   "integrate",
+	Short: "Integrate stacksenv with other tools",
+}
+
+var integrateNpmCmd = &cobra.Command{
+	Use:   "npm",
+	Short: "Run every package.json script of the project through stacksenv",
+	Long: `Make npm, pnpm and yarn 1 run the package.json scripts of the project in the
+current directory with the environment loaded, however they are started:
+"npm run build", "npm test" or a script calling another one.
+
+A wrapper shell is written to .stacksenv/npm-script-shell (npm-script-shell.cmd
+on Windows) and set as the "script-shell" of the project's .npmrc. The wrapper
+runs each script with "stacksenv run" and sets STACKSENV_ACTIVE=1, so scripts
+started by a script reuse the loaded environment instead of fetching it again.
+
+The .npmrc setting is the absolute path of the wrapper: run the command on
+each machine rather than committing it. "--remove" removes the setting and
+the wrapper.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		remove, err := cmd.Flags().GetBool("remove")
+		if err != nil {
+			return err
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+		npmrcPath := filepath.Join(cwd, ".npmrc")
+		wrapperPath, wrapper := filepath.Join(cwd, ".stacksenv", "npm-script-shell"), npmScriptShell
+		if runtime.GOOS == "windows" {
+			wrapperPath, wrapper = wrapperPath+".cmd", npmScriptShellWindows
+		}
+
+		if remove {
+			if err := setNpmrcScriptShell(npmrcPath, ""); err != nil {
+				return err
+			}
+			if err := os.Remove(wrapperPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to remove %s: %w", wrapperPath, err)
+			}
+			fmt.Printf("Removed the npm integration from %s\n", npmrcPath)
+			return nil
+		}
+
+		if _, err := os.Stat(filepath.Join(cwd, "package.json")); err != nil {
+			return fmt.Errorf("no package.json in %s: run the command from the project root", cwd)
+		}
+		if err := os.MkdirAll(filepath.Dir(wrapperPath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := configstore.WriteFileAtomic(wrapperPath, []byte(wrapper), 0755); err != nil {
+			return fmt.Errorf("failed to write %s: %w", wrapperPath, err)
+		}
+		if err := setNpmrcScriptShell(npmrcPath, wrapperPath); err != nil {
+			return err
+		}
+
+		fmt.Printf("Wrote %s\n", wrapperPath)
+		fmt.Printf("Set %s in %s: package.json scripts now run with the environment loaded\n", npmScriptShellKey, npmrcPath)
+		return nil
+	},
+}
+
+// setNpmrcScriptShell sets the script-shell of an .npmrc file, creating it if
+// needed, or removes the setting if shell is empty. Other lines are kept.
+func setNpmrcScriptShell(path, shell string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var lines []string
+	if content := strings.TrimRight(string(data), "\r\n"); content != "" {
+		lines = strings.Split(content, "\n")
+	}
+	kept := lines[:0]
+	for _, line := range lines {
+		key, _, _ := strings.Cut(line, "=")
+		if strings.TrimSpace(key) != npmScriptShellKey {
+			kept = append(kept, line)
+		}
+	}
+	if shell != "" {
+		kept = append(kept, npmScriptShellKey+"="+shell)
+	}
+
+	if len(kept) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		return nil
+	}
+	if err := configstore.WriteFileAtomic(path, []byte(strings.Join(kept, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
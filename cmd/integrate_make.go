@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/configstore"
+)
+
+// makeSnippet is included from a Makefile. "make env/<target>" makes a
+// target under "stacksenv run", and $(STACKSENV_RUN) prefixes single
+// commands. Both reuse an environment already loaded.
+const makeSnippet = `# Generated by "stacksenv integrate make": makes targets with the stacksenv
+# environment loaded. Include it from the Makefile:
+#
+#   -include .stacksenv/stacksenv.mk
+#
+# then run "make env/<target>", e.g. "make env/test", or prefix the commands
+# of a recipe needing the environment with $(STACKSENV_RUN):
+#
+#   deploy:
+#   	$(STACKSENV_RUN) ./scripts/deploy.sh
+
+STACKSENV ?= stacksenv
+STACKSENV_RUN = $(if $(` + activeEnvVar + `),,` + activeEnvVar + `=1 $(STACKSENV) run --)
+
+env/%:
+	@$(STACKSENV_RUN) $(MAKE) --no-print-directory $*
+`
+
+// taskSnippet is included from a Taskfile under the "env" namespace, so
+// "task env:<task>" runs a task under "stacksenv run".
+const taskSnippet = `# Generated by "stacksenv integrate task": runs tasks with the stacksenv
+# environment loaded. Include it from the Taskfile:
+#
+#   includes:
+#     env: .stacksenv/Taskfile.yml
+#
+# then run "task env:<task>", e.g. "task env:test". Requires Task 3.35 or
+# later.
+version: '3'
+
+tasks:
+  '*':
+    desc: Run a task with the stacksenv environment loaded
+    dir: '{{.ROOT_DIR}}'
+    env:
+      ` + activeEnvVar + `: '1'
+    cmds:
+      - stacksenv run -- task --dir '{{.ROOT_DIR}}' '{{index .MATCH 0}}' -- {{.CLI_ARGS}}
+`
+
+// buildToolIntegration describes the snippet "stacksenv integrate" writes for
+// a build tool.
+type buildToolIntegration struct {
+	buildFile string // the file the snippet is included from
+	snippet   string // the path of the snippet, relative to the project
+	content   string
+	include   []string // the lines including the snippet
+}
+
+var (
+	makeIntegration = buildToolIntegration{
+		buildFile: "Makefile",
+		snippet:   filepath.Join(".stacksenv", "stacksenv.mk"),
+		content:   makeSnippet,
+		include:   []string{"-include .stacksenv/stacksenv.mk"},
+	}
+	taskIntegration = buildToolIntegration{
+		buildFile: "Taskfile.yml",
+		snippet:   filepath.Join(".stacksenv", "Taskfile.yml"),
+		content:   taskSnippet,
+		include:   []string{"includes:", "  env: .stacksenv/Taskfile.yml"},
+	}
+)
+
+func init() {
+	integrateCmd.AddCommand(integrateMakeCmd)
+	integrateCmd.AddCommand(integrateTaskCmd)
+	integrateMakeCmd.Flags().Bool("remove", false, "remove the snippet")
+	integrateTaskCmd.Flags().Bool("remove", false, "remove the snippet")
+}
+
+var integrateMakeCmd = &cobra.Command{
+	Use:   "make",
+	Short: "Write a Makefile snippet making targets through stacksenv",
+	Long: `Write .stacksenv/stacksenv.mk, a snippet to include from the Makefile of the
+project in the current directory:
+
+  -include .stacksenv/stacksenv.mk
+
+"make env/<target>" then makes a target, and the targets it depends on, in a
+single "stacksenv run", e.g. "make env/test". Commands of a recipe can also
+be prefixed with $(STACKSENV_RUN) to run them with the environment loaded.
+
+Both are no-ops when STACKSENV_ACTIVE is set, e.g. in a make started by
+"stacksenv npm", so the environment is fetched once. The snippet has no
+credentials or absolute paths and can be committed. "--remove" removes it.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return runBuildToolIntegration(cmd, makeIntegration)
+	},
+}
+
+var integrateTaskCmd = &cobra.Command{
+	Use:   "task",
+	Short: "Write a Taskfile snippet running tasks through stacksenv",
+	Long: `Write .stacksenv/Taskfile.yml, a Taskfile to include from the Taskfile.yml of
+the project in the current directory (Task 3.35 or later):
+
+  includes:
+    env: .stacksenv/Taskfile.yml
+
+"task env:<task>" then runs a task in a single "stacksenv run", e.g.
+"task env:test". Arguments after "--" are passed on to the task.
+
+STACKSENV_ACTIVE is set for the task, so "stacksenv npm" and the make
+snippet of "stacksenv integrate make" reuse the loaded environment. The
+snippet has no credentials or absolute paths and can be committed. "--remove"
+removes it.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return runBuildToolIntegration(cmd, taskIntegration)
+	},
+}
+
+// runBuildToolIntegration writes or, with --remove, removes the snippet of a
+// build tool in the project in the current directory.
+func runBuildToolIntegration(cmd *cobra.Command, integration buildToolIntegration) error {
+	remove, err := cmd.Flags().GetBool("remove")
+	if err != nil {
+		return err
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	snippetPath := filepath.Join(cwd, integration.snippet)
+
+	if remove {
+		if err := os.Remove(snippetPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", snippetPath, err)
+		}
+		fmt.Printf("Removed %s\n", snippetPath)
+		fmt.Printf("Remove its include from the %s too\n", integration.buildFile)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(snippetPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := configstore.WriteFileAtomic(snippetPath, []byte(integration.content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", snippetPath, err)
+	}
+
+	fmt.Printf("Wrote %s\n", snippetPath)
+	fmt.Printf("Include it from the %s of the project:\n\n", integration.buildFile)
+	for _, line := range integration.include {
+		fmt.Printf("  %s\n", line)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/configstore"
+	"github.com/stacksenv/cli/pkg/keyring"
+)
+
+const (
+	// credentialStoreKey is the configuration key naming where the
+	// credentials of a configuration file are stored.
+	credentialStoreKey = "credential_store"
+	// credentialStoreKeyring stores credentials in the OS keyring.
+	credentialStoreKeyring = "keyring"
+	// keyringRefPrefix marks a reference to a credential in the keyring.
+	keyringRefPrefix = "keyring:"
+	// keyringService is the service the credentials are stored under.
+	keyringService = "stacksenv"
+)
+
+// credentialStore stores credentials outside the configuration files, which
+// only hold references to them.
+type credentialStore interface {
+	// Get returns the credential stored for an account, or
+	// keyring.ErrNotFound.
+	Get(account string) (string, error)
+	// Set stores the credential of an account, replacing any existing one.
+	Set(account, secret string) error
+	// Delete removes the credential of an account.
+	Delete(account string) error
+}
+
+// osKeyring is the credentialStore backed by the keyring of the operating
+// system.
+type osKeyring struct{}
+
+func (osKeyring) Get(account string) (string, error) {
+	return keyring.Get(keyringService, account)
+}
+
+func (osKeyring) Set(account, secret string) error {
+	return keyring.Set(keyringService, account, secret)
+}
+
+func (osKeyring) Delete(account string) error {
+	return keyring.Delete(keyringService, account)
+}
+
+// credentials is the store resolving keyring references.
+var credentials credentialStore = osKeyring{}
+
+func init() {
+	rootCmd.AddCommand(keyringCmd)
+	keyringCmd.AddCommand(keyringStoreCmd)
+	keyringCmd.AddCommand(keyringRestoreCmd)
+}
+
+var keyringCmd = &cobra.Command{
+	Use:   "keyring",
+	Short: "Store credentials in the OS keyring",
+	Long: `Store the credentials of the global configuration in the keyring of the
+operating system instead of the configuration file: the Keychain on macOS,
+the Credential Manager on Windows and the Secret Service (via secret-tool,
+e.g. GNOME Keyring or KWallet) on Linux.
+
+The configuration file then holds references like "keyring:<account>" in
+place of tokens, secrets, secret keys and the stacksenv URLs of remotes;
+commands resolve them whenever they need the credentials.`,
+}
+
+var keyringStoreCmd = &cobra.Command{
+	Use:   "store",
+	Short: "Move the credentials of the global configuration to the keyring",
+	Long: `Move the credentials of the global configuration to the OS keyring and set
+"credential_store" to "keyring", so credentials added later, e.g. by
+"stacksenv session add", are stored in the keyring as well.`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		unlock, err := lockGlobalConfig()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		configData, format, err := readGlobalConfig()
+		if err != nil {
+			return err
+		}
+		configData[credentialStoreKey] = credentialStoreKeyring
+		if err := writeGlobalConfig(configData, format); err != nil {
+			return err
+		}
+
+		configPath, err := getGlobalConfigPath()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Moved the credentials in %s to the keyring\n", configPath)
+		return nil
+	},
+}
+
+var keyringRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Move the credentials of the global configuration back to the file",
+	Long:  `Write the credentials referenced by the global configuration back into the file and remove them from the OS keyring.`,
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		configPath, err := getGlobalConfigPath()
+		if err != nil {
+			return err
+		}
+		// Collect the references before readGlobalConfig resolves them
+		unlock, err := lockGlobalConfig()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		raw, _, err := configstore.ReadFile(configPath)
+		if err != nil {
+			return err
+		}
+		accounts := keyringAccounts(raw)
+
+		configData, format, err := readGlobalConfig()
+		if err != nil {
+			return err
+		}
+		delete(configData, credentialStoreKey)
+		if err := writeGlobalConfig(configData, format); err != nil {
+			return err
+		}
+
+		for _, account := range accounts {
+			if err := credentials.Delete(account); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+				fmt.Fprintf(os.Stderr, "Warning: failed to remove %s from the keyring: %v\n", account, err)
+			}
+		}
+		fmt.Printf("Moved the credentials in %s back from the keyring\n", configPath)
+		return nil
+	},
+}
+
+// keyringAccounts returns the accounts referenced by configuration data.
+func keyringAccounts(configData map[string]interface{}) []string {
+	var accounts []string
+	transformCredentials(copyConfigValue(configData), "", "", func(_, value string) (string, error) { //nolint:errcheck
+		if account, ok := strings.CutPrefix(value, keyringRefPrefix); ok {
+			accounts = append(accounts, account)
+		}
+		return value, nil
+	})
+	return accounts
+}
+
+// resolveKeyringRefs replaces the keyring references among the credentials of
+// configuration data with the credentials they reference, in place.
+func resolveKeyringRefs(configData map[string]interface{}) error {
+	_, err := transformCredentials(configData, "", "", func(_, value string) (string, error) {
+		account, ok := strings.CutPrefix(value, keyringRefPrefix)
+		if !ok {
+			return value, nil
+		}
+		secret, err := credentials.Get(account)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s from the keyring: %w", account, err)
+		}
+		return secret, nil
+	})
+	return err
+}
+
+// releaseKeyringCredentials removes from the keyring the credentials the
+// previous data of a file referenced and its written data no longer does,
+// e.g. after a logout or the removal of a session. Failures are only
+// reported: the file is already written.
+func releaseKeyringCredentials(_ string, previous, written map[string]interface{}) {
+	referenced := keyringAccounts(written)
+	for _, account := range keyringAccounts(previous) {
+		if slices.Contains(referenced, account) {
+			continue
+		}
+		if err := credentials.Delete(account); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove %s from the keyring: %v\n", account, err)
+			continue
+		}
+		debugLog("Removed %s from the keyring", account)
+	}
+}
+
+// storeKeyringCredentials returns a copy of the configuration data of a file
+// with its credentials moved to the keyring, if its "credential_store" asks
+// for it. The account of each credential is derived from the file path and
+// its key.
+func storeKeyringCredentials(configPath string, configData map[string]interface{}) (map[string]interface{}, error) {
+	if store, _ := configstore.String(configData, credentialStoreKey); store != credentialStoreKeyring {
+		return configData, nil
+	}
+	stored, err := transformCredentials(copyConfigValue(configData), "", "", func(path, value string) (string, error) {
+		if strings.HasPrefix(value, keyringRefPrefix) {
+			return value, nil
+		}
+		account := configPath + ":" + path
+		if err := credentials.Set(account, value); err != nil {
+			return "", fmt.Errorf("failed to store %s in the keyring: %w", path, err)
+		}
+		return keyringRefPrefix + account, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stored.(map[string]interface{}), nil
+}
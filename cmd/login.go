@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/config"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+func init() {
+	rootCmd.AddCommand(loginCmd)
+	loginCmd.Flags().Bool("token", false, "paste an existing access token instead of exchanging credentials")
+}
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in to a stacksenv server",
+	Long: `Log in to a stacksenv server without putting credentials on the command line.
+
+The environment ID and secret are exchanged with the server for an access
+token, which is stored in the global configuration together with the
+credentials needed to decrypt the environment locally. Like them, it is
+sealed after "stacksenv config encrypt" and kept in the OS keyring after
+"stacksenv keyring store". The token is sent as a bearer token on every
+request to that environment, but never put in the stacksenv URLs built from
+the configuration.
+
+With "--profile", everything is stored in that profile, which is created if
+needed.
+
+With "--token", an existing access token is pasted instead of being requested
+from the server.`,
+	Args: cobra.NoArgs,
+	// Logging in with "--profile" creates the profile
+	Annotations: map[string]string{createsProfileAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		pasteToken, err := cmd.Flags().GetBool("token")
+		if err != nil {
+			return err
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+
+		defaultServer := v.GetString("serverurl")
+		if defaultServer == "" {
+			defaultServer = config.DefaultServerURL
+		}
+
+		serverURL, err := promptLine("Server URL", defaultServer)
+		if err != nil {
+			return err
+		}
+		id, err := promptLine("Environment ID", v.GetString("stacksenv_id"))
+		if err != nil {
+			return err
+		}
+		secret, err := promptSecret("Secret")
+		if err != nil {
+			return err
+		}
+		secretKey, err := promptSecret("Secret key")
+		if err != nil {
+			return err
+		}
+		if id == "" || secret == "" || secretKey == "" {
+			return errors.New("environment ID, secret and secret key are required")
+		}
+
+		var token string
+		if pasteToken {
+			token, err = promptSecret("Access token")
+			if err != nil {
+				return err
+			}
+			if token == "" {
+				return errors.New("access token is required")
+			}
+		} else {
+			host, plainHTTP := splitServerURL(serverURL)
+			loginConfig := &stacksenv.Config{
+				ID:           id,
+				Secret:       secret,
+				ServerURL:    host,
+				DisableHTTPS: plainHTTP,
+				SignRequests: v.GetBool(signRequestsKey),
+			}
+
+			if err := checkMinServerVersion(v, loginConfig); err != nil {
+				return err
+			}
+
+			httpClient, err := newHTTPClient(v)
+			if err != nil {
+				return err
+			}
+			token, err = stacksenv.Login(context.Background(), loginConfig, httpClient)
+			if err != nil {
+				return logRequestID(err)
+			}
+		}
+
+		if err := updateGlobalConfigValues(map[string]interface{}{
+			"serverurl":        serverURL,
+			"stacksenv_id":     id,
+			"stacksenv_secret": secret,
+			"stacksenv_key":    secretKey,
+			"token":            token,
+		}); err != nil {
+			return err
+		}
+
+		fmt.Printf("Logged in to %s as environment %s\n", serverURL, id)
+		return nil
+	},
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+// credentialKeys are the global config keys holding secrets written by "stacksenv login".
+var credentialKeys = []string{"token", "stacksenv_secret", "stacksenv_key"}
+
+func init() {
+	rootCmd.AddCommand(logoutCmd)
+	logoutCmd.Flags().Bool("revoke", false, "also revoke the access token on the server")
+	logoutCmd.Flags().Bool("all-remotes", false, "also remove the remotes of the global configuration")
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Log out and remove stored credentials",
+	Long: `Remove the access token and secrets stored by "stacksenv login" from the
+global configuration, or from the selected profile, and wipe the local cache.
+
+With "--revoke", the access token is also revoked on the server first.
+
+With "--all-remotes", the remotes of the global configuration, whose URLs
+embed credentials, are removed as well (and their tokens revoked with
+"--revoke").`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		revoke, err := cmd.Flags().GetBool("revoke")
+		if err != nil {
+			return err
+		}
+		allRemotes, err := cmd.Flags().GetBool("all-remotes")
+		if err != nil {
+			return err
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+
+		if revoke {
+			config, err := resolveStacksenvConfig(v)
+			if err != nil {
+				return err
+			}
+			if config.Token == "" {
+				fmt.Println("No access token to revoke")
+			} else {
+				if err := checkMinServerVersion(v, config); err != nil {
+					return err
+				}
+				httpClient, err := newHTTPClient(v)
+				if err != nil {
+					return err
+				}
+				if err := stacksenv.Logout(context.Background(), config, httpClient); err != nil {
+					return logRequestID(err)
+				}
+				fmt.Println("Revoked access token on the server")
+			}
+		}
+
+		keys := slices.Clone(credentialKeys)
+		if allRemotes {
+			if revoke {
+				if err := revokeGlobalRemotes(v); err != nil {
+					return err
+				}
+			}
+			keys = append(keys, remotesKey)
+		}
+
+		removed, err := removeGlobalConfigKeys(keys...)
+		if err != nil {
+			return err
+		}
+
+		if err := operations.publish(operationEvent{Kind: eventLoggedOut}); err != nil {
+			return err
+		}
+
+		if len(removed) == 0 {
+			fmt.Println("No stored credentials found")
+		} else {
+			fmt.Println("Removed stored credentials from the global configuration")
+		}
+		return nil
+	},
+}
+
+// revokeGlobalRemotes revokes the access tokens embedded in the URLs of the
+// remotes of the global configuration.
+func revokeGlobalRemotes(v *viper.Viper) error {
+	configData, _, err := readGlobalConfig()
+	if err != nil {
+		return err
+	}
+	httpClient, err := newHTTPClient(v)
+	if err != nil {
+		return err
+	}
+	remotes, _ := globalConfigSection(configData, false)[remotesKey].(map[string]interface{})
+
+	for name, url := range remotes {
+		config, err := stacksenv.ParseURL(strings.TrimPrefix(fmt.Sprint(url), "stacksenv://"))
+		if err != nil || config.Token == "" {
+			continue
+		}
+		if err := stacksenv.Logout(context.Background(), &config, httpClient); err != nil {
+			return fmt.Errorf("failed to revoke the access token of remote %s: %w", name, logRequestID(err))
+		}
+		fmt.Printf("Revoked access token of remote %s on the server\n", name)
+	}
+	return nil
+}
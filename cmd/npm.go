@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// activeEnvVar is set in the environment of package manager runs started by
+// stacksenv, so nested invocations reuse the loaded variables instead of
+// fetching them again.
+const activeEnvVar = "STACKSENV_ACTIVE"
+
+func init() {
+	rootCmd.AddCommand(npmCmd)
+	addFilterFlags(npmCmd)
+}
+
+var npmCmd = &cobra.Command{
+	Use:     "npm [flags] -- <args...>",
+	Aliases: []string{"yarn", "pnpm"},
+	Short:   "Run npm, yarn or pnpm with the environment loaded",
+	Long: `Run a package manager with the environment variables fetched from the
+server, e.g. "stacksenv npm -- run build" or "stacksenv pnpm -- test". The
+package manager is the name the command is called by: npm, yarn or pnpm.
+
+STACKSENV_ACTIVE=1 and STACKSENV_BRANCH are set for the package manager and
+the scripts it runs. If STACKSENV_ACTIVE is already set, the environment is
+loaded and the package manager is started directly, so scripts calling
+"stacksenv npm" again don't fetch the variables twice. "--include",
+"--exclude" and the "include" and "exclude" configuration lists select the
+variables like for "stacksenv run".
+
+To run every package.json script through stacksenv, including scripts
+started with a plain "npm run", see "stacksenv integrate npm".`,
+	Args: cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := cmd.CalledAs()
+		if os.Getenv(activeEnvVar) != "" {
+			debugLog("%s is set, running %s with the loaded environment", activeEnvVar, client)
+			return executeInForeground(client, args, nil)
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+
+		config, err := resolveStacksenvConfig(v)
+		if err != nil {
+			return err
+		}
+		properties, err := fetchContextData(v)
+		if err != nil {
+			return err
+		}
+		filter, err := newVariableFilter(v)
+		if err != nil {
+			return err
+		}
+		if filter != nil {
+			properties = filter.apply(properties)
+		}
+
+		env := contextDataToEnv(properties)
+		env = append(env, activeEnvVar+"=1", branchEnvVar+"="+config.Branch)
+
+		return executeInForeground(client, args, env)
+	},
+}
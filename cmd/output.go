@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/table"
+	"github.com/stacksenv/cli/pkg/term"
+)
+
+// addTableFlags registers the flags controlling tabular output on cmd.
+func addTableFlags(cmd *cobra.Command) {
+	cmd.Flags().String("output", string(table.FormatTable), "output format: table, csv or tsv")
+	cmd.Flags().Bool("wide", false, "don't truncate columns to the terminal width")
+}
+
+// newTableWriter creates a streaming table writer on w according to the flags
+// registered by addTableFlags. Text output is truncated to the terminal width
+// unless "--wide" is set or stdout is not a terminal.
+func newTableWriter(cmd *cobra.Command, w io.Writer, headers ...string) (*table.Writer, error) {
+	format, maxWidth, err := tableOptions(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	sw := table.NewWriter(w, format, headers...)
+	sw.MaxWidth = maxWidth
+	return sw, nil
+}
+
+// tableOptions returns the output format and maximum text width selected by
+// the flags registered by addTableFlags.
+func tableOptions(cmd *cobra.Command) (table.Format, int, error) {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return "", 0, err
+	}
+	format, err := table.ParseFormat(output)
+	if err != nil {
+		return "", 0, err
+	}
+
+	wide, err := cmd.Flags().GetBool("wide")
+	if err != nil {
+		return "", 0, err
+	}
+	if wide || !term.IsTerminal(os.Stdout) {
+		return format, 0, nil
+	}
+	return format, term.Width(os.Stdout), nil
+}
+
+// colorKey is the configuration key and flag selecting when output is colored.
+const colorKey = "color"
+
+// newColorWriter returns a writer on f coloring output as selected by mode, the
+// value of the "color" flag or configuration key.
+func newColorWriter(f *os.File, mode string) (*term.Writer, error) {
+	colorMode, err := term.ParseColorMode(mode)
+	if err != nil {
+		return nil, err
+	}
+	return term.NewWriter(f, colorMode), nil
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/term"
+)
+
+// defaultPager is used when $PAGER is not set.
+const defaultPager = "less"
+
+// addPagerFlag registers the "--no-pager" flag on cmd.
+func addPagerFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("no-pager", false, "don't pipe output into $PAGER")
+}
+
+// startPager pipes stdout into $PAGER when stdout is an interactive terminal
+// and "--no-pager" is not set. It returns the writer to use for output and a
+// function that must be called once all output is written to wait for the pager.
+// If the pager cannot be started, output goes to stdout directly.
+func startPager(cmd *cobra.Command) (io.Writer, func() error) {
+	noop := func() error { return nil }
+
+	noPager, _ := cmd.Flags().GetBool("no-pager")
+	if noPager || !term.IsTerminal(os.Stdout) {
+		return os.Stdout, noop
+	}
+
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = defaultPager
+	}
+	fields := strings.Fields(pager)
+	if len(fields) == 0 || fields[0] == "cat" {
+		return os.Stdout, noop
+	}
+
+	pagerCmd := exec.Command(fields[0], fields[1:]...)
+	pagerCmd.Stdout = os.Stdout
+	pagerCmd.Stderr = os.Stderr
+	// Quit if the output fits on one screen, keep colors and don't clear the screen
+	if os.Getenv("LESS") == "" {
+		pagerCmd.Env = append(os.Environ(), "LESS=FRX")
+	}
+
+	stdin, err := pagerCmd.StdinPipe()
+	if err != nil {
+		return os.Stdout, noop
+	}
+	if err := pagerCmd.Start(); err != nil {
+		debugLog("Failed to start pager %q: %v", pager, err)
+		return os.Stdout, noop
+	}
+
+	return stdin, func() error {
+		stdin.Close()
+		return pagerCmd.Wait()
+	}
+}
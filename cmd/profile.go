@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+
+	"github.com/spf13/cobra"
+)
+
+// stopProfiling finishes any profiles started by startProfiling.
+// It is a no-op until profiling has been started.
+var stopProfiling = func() {}
+
+func init() {
+	persistent := rootCmd.PersistentFlags()
+	persistent.String("profile-cpu", "", "write a CPU profile to this file")
+	persistent.String("profile-mem", "", "write a heap profile to this file on exit")
+	_ = persistent.MarkHidden("profile-cpu")
+	_ = persistent.MarkHidden("profile-mem")
+
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, _ []string) error {
+		return startProfiling(cmd)
+	}
+}
+
+// startProfiling starts the CPU profile and arranges for the heap profile to be
+// written when stopProfiling is called, according to the hidden --profile-cpu
+// and --profile-mem flags.
+func startProfiling(cmd *cobra.Command) error {
+	cpuPath, _ := cmd.Flags().GetString("profile-cpu")
+	memPath, _ := cmd.Flags().GetString("profile-mem")
+	if cpuPath == "" && memPath == "" {
+		return nil
+	}
+
+	var cpuFile *os.File
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return fmt.Errorf("failed to create CPU profile: %w", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to start CPU profile: %w", err)
+		}
+		cpuFile = f
+	}
+
+	stopProfiling = func() {
+		stopProfiling = func() {}
+
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			cpuFile.Close()
+			debugLog("Wrote CPU profile to: %s", cpuPath)
+		}
+
+		if memPath != "" {
+			f, err := os.Create(memPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to create heap profile: %v\n", err)
+				return
+			}
+			defer f.Close()
+
+			// Get up-to-date statistics before writing the heap profile
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to write heap profile: %v\n", err)
+				return
+			}
+			debugLog("Wrote heap profile to: %s", memPath)
+		}
+	}
+
+	return nil
+}
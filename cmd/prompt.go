@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/stacksenv/cli/pkg/term"
+)
+
+// promptLine asks the user for a value on stdin. If the user enters nothing,
+// defaultValue is returned.
+func promptLine(label, defaultValue string) (string, error) {
+	if defaultValue != "" {
+		fmt.Fprintf(os.Stderr, "%s [%s]: ", label, defaultValue)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: ", label)
+	}
+
+	line, err := term.ReadLine(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read user input: %w", err)
+	}
+
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return defaultValue, nil
+	}
+	return line, nil
+}
+
+// promptSecret asks the user for a secret value on stdin without echoing it.
+func promptSecret(label string) (string, error) {
+	fmt.Fprintf(os.Stderr, "%s: ", label)
+
+	line, err := term.ReadPassword(os.Stdin)
+	if term.IsTerminal(os.Stdin) {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read user input: %w", err)
+	}
+
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,360 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/configstore"
+	"github.com/stacksenv/cli/pkg/homedir"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+const (
+	// promptCacheName is the file of the data dir caching the contexts shown
+	// by "stacksenv prompt".
+	promptCacheName = "prompt.json"
+
+	// maxPromptCacheEntries caps the number of contexts cached, e.g. one per
+	// project directory.
+	maxPromptCacheEntries = 64
+
+	// defaultPromptFormat is the default template of "stacksenv prompt".
+	defaultPromptFormat = "{{.Environment}}/{{.Branch}}"
+
+	// protectedBranchesKey is the configuration key listing the patterns of
+	// the protected branches, which "stacksenv prompt" flags, e.g. to show
+	// them in red, and which interactive shells are guarded against.
+	protectedBranchesKey = "protected_branches"
+)
+
+// defaultProtectedBranches are the protected branches unless configured
+// otherwise.
+var defaultProtectedBranches = []string{"prod", "production"}
+
+func init() {
+	operations.subscribe("prompt", func(event *operationEvent) error {
+		return forgetPromptContexts(event.Server, event.Environment)
+	}, eventTenantPurged)
+
+	rootCmd.AddCommand(promptCmd)
+	promptCmd.Flags().String("format", defaultPromptFormat, "Go template of the segment, see the fields above")
+	promptCmd.Flags().Bool("json", false, "print the context as a JSON object instead")
+}
+
+var promptCmd = &cobra.Command{
+	Use:   "prompt",
+	Short: "Print the active environment for a shell prompt",
+	Long: `Print the environment and branch commands run in the current directory
+would use, for inclusion in a shell prompt, e.g. in bash:
+
+  PS1='[$(stacksenv prompt)] \w \$ '
+
+or as a custom starship module:
+
+  [custom.stacksenv]
+  command = "stacksenv prompt"
+  when = true
+
+The segment is rendered with "--format", a Go template with the fields
+.Environment, .Branch, .Server, .Remote, .Profile and .Session, e.g.
+"{{.Profile}}:{{.Environment}}@{{.Branch}}", and:
+
+  .Protected  whether the branch matches a pattern of "protected_branches"
+              (default ["prod", "production"]), e.g. to show it in red
+  .Cache      the environment in the offline cache, if any, with .FetchedAt,
+              .Age and .Stale, set once it is older than "cache_max_age" and
+              can't be fallen back to anymore
+
+With "--json", the context is printed as a JSON object with the same fields
+instead, for prompt frameworks and plugins. The starship module and zsh
+plugin in contrib/ show protected branches in red and stale caches.
+
+Nothing is sent to the server: the context is resolved from the
+configuration, and cached until a configuration file, the directory, or a
+STACKSENV_* environment variable or flag selecting the context changes, so a
+prompt shows it in a few milliseconds. Nothing is printed when no environment
+is configured or the configuration can't be read without asking for input.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+		asJSON, err := cmd.Flags().GetBool("json")
+		if err != nil {
+			return err
+		}
+		tmpl, err := template.New("prompt").Option("missingkey=error").Parse(format)
+		if err != nil {
+			return fmt.Errorf("invalid --format: %w", err)
+		}
+
+		// A prompt must never wait for input, e.g. for the passphrase of
+		// encrypted credentials
+		if devNull, err := os.Open(os.DevNull); err == nil {
+			defer devNull.Close()
+			os.Stdin = devNull
+		}
+		context, ok := cachedPromptContext(cmd)
+		if !ok || context.Environment == "" {
+			if asJSON {
+				fmt.Println("{}")
+			}
+			return nil
+		}
+		if asJSON {
+			return json.NewEncoder(os.Stdout).Encode(context)
+		}
+		var segment strings.Builder
+		if err := tmpl.Execute(&segment, context); err != nil {
+			return fmt.Errorf("invalid --format: %w", err)
+		}
+		fmt.Println(segment.String())
+		return nil
+	},
+}
+
+// promptContext is the context shown by "stacksenv prompt".
+type promptContext struct {
+	Environment string             `json:"environment,omitempty"`
+	Branch      string             `json:"branch,omitempty"`
+	Server      string             `json:"server,omitempty"`
+	Remote      string             `json:"remote,omitempty"`
+	Profile     string             `json:"profile,omitempty"`
+	Session     string             `json:"session,omitempty"`
+	Protected   bool               `json:"protected"`
+	Cache       *promptCacheStatus `json:"cache,omitempty"`
+}
+
+// promptCacheStatus describes the environment of a prompt context in the
+// offline cache.
+type promptCacheStatus struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	Age       string    `json:"age"`
+	Stale     bool      `json:"stale"`
+}
+
+// promptCacheEntry is a context cached for a fingerprint, with the offline
+// cache entry of its environment, if the offline cache is enabled.
+type promptCacheEntry struct {
+	Context     promptContext `json:"context"`
+	Time        time.Time     `json:"time"`
+	CachePath   string        `json:"cache_path,omitempty"`
+	CacheMaxAge time.Duration `json:"cache_max_age,omitempty"`
+}
+
+// cachedPromptContext returns the context commands would use, from the prompt
+// cache if its fingerprint is there, resolving and caching it otherwise. ok is
+// false if the configuration can't be read.
+func cachedPromptContext(cmd *cobra.Command) (context promptContext, ok bool) {
+	cachePath, err := getPromptCachePath()
+	if err != nil {
+		debugLog("Failed to locate the prompt cache: %v", err)
+		entry, ok := resolvePromptContext(cmd)
+		return entry.withCacheStatus(), ok
+	}
+	fingerprint := promptFingerprint(cmd)
+	cache := readPromptCache(cachePath)
+	if entry, ok := cache[fingerprint]; ok {
+		return entry.withCacheStatus(), true
+	}
+
+	entry, ok := resolvePromptContext(cmd)
+	if !ok {
+		return entry.Context, false
+	}
+	cache[fingerprint] = entry
+	if err := writePromptCache(cachePath, cache); err != nil {
+		debugLog("Failed to write the prompt cache: %v", err)
+	}
+	return entry.withCacheStatus(), true
+}
+
+// withCacheStatus returns the context of the entry with the status of its
+// environment in the offline cache, which changes as time passes.
+func (e promptCacheEntry) withCacheStatus() promptContext {
+	context := e.Context
+	if e.CachePath == "" {
+		return context
+	}
+	entry, err := readCacheEntry(e.CachePath)
+	if err != nil {
+		return context
+	}
+	age := time.Since(entry.FetchedAt)
+	context.Cache = &promptCacheStatus{
+		FetchedAt: entry.FetchedAt,
+		Age:       age.Round(time.Second).String(),
+		Stale:     age > e.CacheMaxAge,
+	}
+	return context
+}
+
+// resolvePromptContext resolves the context commands would use from the
+// configuration, without contacting the server.
+func resolvePromptContext(cmd *cobra.Command) (promptCacheEntry, bool) {
+	entry := promptCacheEntry{Time: time.Now()}
+	v, err := initViper(cmd)
+	if err != nil {
+		debugLog("Failed to resolve the prompt context: %v", err)
+		return entry, false
+	}
+	entry.Context = promptContext{Profile: activeProfile, Session: activeSession, Remote: usedRemote(v)}
+	url, err := resolveStacksenvURL(v)
+	if err != nil || url == "" {
+		return entry, err == nil
+	}
+	config, err := stacksenv.ParseURL(strings.TrimPrefix(url, "stacksenv://"))
+	if err != nil {
+		debugLog("Failed to resolve the prompt context: %v", err)
+		return entry, false
+	}
+	context := &entry.Context
+	context.Environment, context.Branch, context.Server = config.ID, config.Branch, config.ServerURL
+
+	context.Protected = isProtectedBranch(v, config.Branch)
+
+	if v.GetBool(offlineCacheKey) {
+		_, maxAge, err := cacheLimits(v)
+		if err != nil {
+			debugLog("Failed to resolve the prompt context: %v", err)
+			return entry, false
+		}
+		if entry.CachePath, err = cacheEntryPath(&config); err != nil {
+			debugLog("Failed to locate the cached environment: %v", err)
+		}
+		entry.CacheMaxAge = maxAge
+	}
+	return entry, true
+}
+
+// promptFingerprint returns a hash of everything the context commands would
+// use depends on: the working directory, the flags and environment variables
+// selecting it, and the size and modification time of every configuration
+// file initViper may read.
+func promptFingerprint(cmd *cobra.Command) string {
+	var parts []string
+	cwd, _ := os.Getwd()
+	parts = append(parts, "cwd="+cwd)
+	for _, name := range []string{"config", "profile", "branch", "remote", "no-personal"} {
+		if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+			parts = append(parts, "flag:"+name+"="+flag.Value.String())
+		}
+	}
+	var env []string
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		if strings.HasPrefix(name, "STACKSENV_") || strings.HasPrefix(name, "FB_") || slices.Contains([]string{"HOME", "XDG_CONFIG_HOME", "XDG_DATA_HOME"}, name) {
+			env = append(env, variable)
+		}
+	}
+	slices.Sort(env)
+	parts = append(parts, env...)
+
+	var files []string
+	if cfgFile, _ := cmd.Flags().GetString("config"); cfgFile != "" {
+		files = append(files, cfgFile)
+	}
+	if home, err := homedir.Dir(); err == nil {
+		for _, dir := range []string{".", home, "/etc/stacksenv/"} {
+			for _, ext := range configstore.Extensions {
+				files = append(files, filepath.Join(dir, ".stacksenv."+ext))
+			}
+		}
+	}
+	if globalConfigPath, err := getGlobalConfigPath(); err == nil {
+		files = append(files, globalConfigPath)
+	}
+	for _, name := range localConfigFiles {
+		files = append(files, filepath.Join(".stacksenv", name))
+	}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			parts = append(parts, "file:"+file+"=-")
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("file:%s=%d/%d", file, info.Size(), info.ModTime().UnixNano()))
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// getPromptCachePath returns the path of the prompt cache.
+func getPromptCachePath() (string, error) {
+	dataDir, err := getDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, promptCacheName), nil
+}
+
+// readPromptCache reads the prompt cache. A missing or unreadable cache is
+// empty.
+func readPromptCache(path string) map[string]promptCacheEntry {
+	cache := make(map[string]promptCacheEntry)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		debugLog("Ignoring invalid prompt cache %s: %v", path, err)
+		return make(map[string]promptCacheEntry)
+	}
+	return cache
+}
+
+// writePromptCache writes the prompt cache, keeping the most recent entries
+// only.
+func writePromptCache(path string, cache map[string]promptCacheEntry) error {
+	if len(cache) > maxPromptCacheEntries {
+		fingerprints := slices.SortedFunc(maps.Keys(cache), func(a, b string) int {
+			return cache[b].Time.Compare(cache[a].Time)
+		})
+		for _, fingerprint := range fingerprints[maxPromptCacheEntries:] {
+			delete(cache, fingerprint)
+		}
+	}
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return configstore.WriteFileAtomic(path, data, 0600)
+}
+
+// forgetPromptContexts removes the contexts of a tenant from the prompt cache.
+func forgetPromptContexts(server, environment string) error {
+	path, err := getPromptCachePath()
+	if err != nil {
+		return err
+	}
+	cache := readPromptCache(path)
+	forgotten := false
+	for fingerprint, entry := range cache {
+		if sameTenant(entry.Context.Server, entry.Context.Environment, server, environment) {
+			delete(cache, fingerprint)
+			forgotten = true
+		}
+	}
+	if !forgotten {
+		return nil
+	}
+	if err := writePromptCache(path, cache); err != nil {
+		return fmt.Errorf("failed to update the prompt cache: %w", err)
+	}
+	return nil
+}
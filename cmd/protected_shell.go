@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+	"github.com/stacksenv/cli/pkg/term"
+)
+
+const (
+	// protectedShellKey is the configuration key telling what happens when
+	// the environment of a protected branch is loaded into an interactive
+	// shell: one of the protectedShell* modes.
+	protectedShellKey = "protected_shell"
+
+	protectedShellConfirm = "confirm" // ask to type the branch name (default)
+	protectedShellDeny    = "deny"    // always refuse
+	protectedShellAllow   = "allow"   // only mark the shell
+
+	// protectedEnvVar is set to the branch in interactive shells holding the
+	// environment of a protected branch, e.g. for prompts to show it.
+	protectedEnvVar = "STACKSENV_PROTECTED"
+)
+
+// protectedShellModes are the valid values of protectedShellKey.
+var protectedShellModes = []string{protectedShellConfirm, protectedShellDeny, protectedShellAllow}
+
+// interactiveShells are the names of the shells an interactive session is
+// guarded for, without extension.
+var interactiveShells = []string{"sh", "bash", "zsh", "dash", "ksh", "mksh", "fish", "tcsh", "csh", "nu", "elvish", "xonsh", "pwsh", "powershell", "cmd"}
+
+// shellCommandFlags are the flags making a shell run a command rather than
+// an interactive session.
+var shellCommandFlags = []string{"-c", "--command", "--commands", "/c", "/k", "-command", "-file", "-encodedcommand"}
+
+// isProtectedBranch reports whether branch matches a pattern of
+// "protected_branches", or of defaultProtectedBranches if it isn't set.
+func isProtectedBranch(v *viper.Viper, branch string) bool {
+	protected := defaultProtectedBranches
+	if v.IsSet(protectedBranchesKey) {
+		protected = v.GetStringSlice(protectedBranchesKey)
+	}
+	return matchesAny(protected, branch)
+}
+
+// isInteractiveShell reports whether args start an interactive shell: a known
+// shell with options only, none of them running a command or a script.
+func isInteractiveShell(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	shell := shellName(args[0])
+	if !slices.Contains(interactiveShells, shell) {
+		return false
+	}
+	posix := !slices.Contains([]string{"pwsh", "powershell", "cmd"}, shell)
+	for _, arg := range args[1:] {
+		// Options of cmd start with "/", paths of scripts elsewhere
+		if !strings.HasPrefix(arg, "-") && (shell != "cmd" || !strings.HasPrefix(arg, "/")) {
+			return false
+		}
+		if slices.Contains(shellCommandFlags, strings.ToLower(arg)) {
+			return false
+		}
+		// Grouped short options of POSIX shells, e.g. "-ec"
+		if posix && !strings.HasPrefix(arg, "--") && strings.Contains(arg, "c") {
+			return false
+		}
+	}
+	return true
+}
+
+// shellName returns the name of a shell executable, without directory, login
+// shell dash or extension, e.g. "bash" for "/bin/bash" and "cmd" for
+// "C:\Windows\System32\cmd.exe".
+func shellName(shell string) string {
+	name := filepath.Base(strings.ReplaceAll(shell, `\`, "/"))
+	name = strings.TrimPrefix(name, "-")
+	return strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+// guardProtectedURL guards args, if they start an interactive shell, against
+// loading the environment of url when its branch is protected. It returns the
+// variables marking the shell, if any.
+func guardProtectedURL(v *viper.Viper, url string, args []string) ([]string, error) {
+	if url == "" || !isInteractiveShell(args) {
+		return nil, nil
+	}
+	config, err := stacksenv.ParseURL(strings.TrimPrefix(url, "stacksenv://"))
+	if err != nil {
+		return nil, err
+	}
+	return guardProtectedShell(v, config.Branch, args[0])
+}
+
+// guardProtectedShell enforces "protected_shell" before the environment of
+// branch is loaded into the interactive shell: it is refused with "deny",
+// and, with "confirm", unless the user types the branch name on a terminal.
+// It returns the variables marking the shell, nil if branch isn't protected.
+func guardProtectedShell(v *viper.Viper, branch, shell string) ([]string, error) {
+	if !isProtectedBranch(v, branch) {
+		return nil, nil
+	}
+	mode := v.GetString(protectedShellKey)
+	if mode == "" {
+		mode = protectedShellConfirm
+	}
+	switch mode {
+	case protectedShellAllow:
+	case protectedShellDeny:
+		return nil, fmt.Errorf("refusing to load protected branch %s into an interactive shell (%s is %q): run the commands with \"stacksenv run\" instead", branch, protectedShellKey, mode)
+	case protectedShellConfirm:
+		if !term.IsTerminal(os.Stdin) {
+			return nil, fmt.Errorf("refusing to load protected branch %s into an interactive shell without confirmation: run it from a terminal, or set %q to %q", branch, protectedShellKey, protectedShellAllow)
+		}
+		fmt.Fprintf(os.Stderr, "stacksenv: %s is a protected branch: the shell will hold its variables.\n", branch)
+		answer, err := promptLine(fmt.Sprintf("Type the branch name (%s) to continue", branch), "")
+		if err != nil {
+			return nil, err
+		}
+		if answer != branch {
+			return nil, errors.New("aborted: the branch name didn't match")
+		}
+	default:
+		return nil, fmt.Errorf("invalid %s %q: expected one of %s", protectedShellKey, mode, strings.Join(protectedShellModes, ", "))
+	}
+
+	fmt.Fprintf(os.Stderr, "stacksenv: WARNING: this shell holds the variables of protected branch %s. Exit it when done.\n", branch)
+	env := []string{protectedEnvVar + "=" + branch}
+	if prompt := protectedPrompt(shellName(shell), branch); prompt != "" {
+		env = append(env, prompt)
+	}
+	return env, nil
+}
+
+// protectedPrompt returns the prompt variable marking a shell holding the
+// variables of a protected branch in the syntax of the shell, prefixed to the
+// exported prompt or the default one. Shells whose startup files set their
+// own prompt keep it; STACKSENV_PROTECTED is set for them to show it.
+func protectedPrompt(shell, branch string) string {
+	switch shell {
+	case "bash":
+		branch = strings.NewReplacer(`\`, `\\`, "$", `\$`, "`", "\\`").Replace(branch)
+		return "PS1=" + `\[\e[1;97;41m\] PROTECTED: ` + branch + ` \[\e[0m\] ` + exportedPrompt("PS1", `\w \$ `)
+	case "zsh":
+		branch = strings.ReplaceAll(branch, "%", "%%")
+		return "PS1=%B%K{red}%F{white} PROTECTED: " + branch + " %f%k%b " + exportedPrompt("PS1", "%~ %# ")
+	case "sh", "dash", "ksh", "mksh":
+		return "PS1=" + "\x1b[1;97;41m PROTECTED: " + branch + " \x1b[0m " + exportedPrompt("PS1", "$ ")
+	case "cmd":
+		return "PROMPT=$E[1;97;41m PROTECTED: " + strings.ReplaceAll(branch, "$", "$$") + " $E[0m " + exportedPrompt("PROMPT", "$P$G")
+	}
+	return ""
+}
+
+// exportedPrompt returns the value of the prompt variable name if it is
+// exported, fallback otherwise.
+func exportedPrompt(name, fallback string) string {
+	if prompt := os.Getenv(name); prompt != "" {
+		return prompt
+	}
+	return fallback
+}
@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/config"
+	"github.com/stacksenv/cli/pkg/configstore"
+	"github.com/stacksenv/cli/pkg/keyring"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+	"github.com/stacksenv/cli/pkg/term"
+)
+
+func init() {
+	rootCmd.AddCommand(purgeCmd)
+	purgeCmd.Flags().BoolP("yes", "y", false, "don't ask for confirmation")
+}
+
+var purgeCmd = &cobra.Command{
+	Use:   "purge --remote <name>",
+	Short: "Remove all local traces of the environment of a remote",
+	Long: `Remove everything stacksenv keeps about the environment of a remote: its
+offline cache and audit log in ~/.stacksenv/tenants (or
+$XDG_DATA_HOME/stacksenv/tenants in the XDG layout), and the remotes and
+sessions of the global configuration, in every profile, holding credentials of
+the environment, with their credentials in the keyring.
+
+The data is namespaced by tenant, the server and environment ID of the
+credentials, so the data of other environments is left untouched, even on the
+same server. The project configuration isn't modified: remove its remotes with
+"stacksenv remote remove".
+
+The remote must be named with "--remote". Unless "--yes" is set, the command
+asks for confirmation, and refuses to run without a terminal.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			return err
+		}
+		name, err := cmd.Flags().GetString("remote")
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			return errors.New("select the remote to purge with --remote")
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+		url := remoteURL(v, name)
+		if url == "" {
+			return fmt.Errorf("no such remote: %s", name)
+		}
+		tenant, err := stacksenv.ParseURL(strings.TrimPrefix(url, "stacksenv://"))
+		if err != nil {
+			return fmt.Errorf("invalid URL of remote %s: %w", name, err)
+		}
+
+		if !yes {
+			if !term.IsTerminal(os.Stdin) {
+				return errors.New("refusing to purge without confirmation: pass --yes")
+			}
+			answer, err := promptLine(fmt.Sprintf("Remove all local data of environment %s on %s? (y/n)", tenant.ID, tenant.ServerURL), "n")
+			if err != nil {
+				return err
+			}
+			if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+				return errors.New("purge cancelled")
+			}
+		}
+
+		if err := purgeTenantData(tenant.ServerURL, tenant.ID); err != nil {
+			return err
+		}
+		fmt.Printf("Removed the cache and audit log of environment %s on %s\n", tenant.ID, tenant.ServerURL)
+
+		remotes, sessions, err := forgetTenant(tenant.ServerURL, tenant.ID)
+		if err != nil {
+			return err
+		}
+		if len(remotes) > 0 {
+			fmt.Printf("Removed remotes from the global configuration: %s\n", strings.Join(remotes, ", "))
+		}
+		if len(sessions) > 0 {
+			fmt.Printf("Removed sessions from the global configuration: %s\n", strings.Join(sessions, ", "))
+		}
+
+		for _, remote := range localTenantRemotes(tenant.ServerURL, tenant.ID) {
+			fmt.Fprintf(os.Stderr, "Note: remote %s of the project configuration still holds credentials of the environment: remove it with \"stacksenv remote remove %s\"\n", remote, remote)
+		}
+		return nil
+	},
+}
+
+// purgeTenantData removes the directory of a tenant and publishes the purge,
+// so its data is removed from the locations shared by all tenants in earlier
+// versions.
+func purgeTenantData(server, environment string) error {
+	tenantDir, err := getTenantDir(server, environment)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(tenantDir); err != nil {
+		return fmt.Errorf("failed to remove tenant data: %w", err)
+	}
+	return operations.publish(operationEvent{Kind: eventTenantPurged, Server: server, Environment: environment})
+}
+
+// forgetTenant removes the remotes and sessions holding credentials of a
+// tenant from the global configuration and every profile of it, and the
+// credentials they stored in the keyring. It returns the names of the removed
+// remotes and sessions.
+func forgetTenant(server, environment string) (remotes, sessions []string, err error) {
+	unlock, err := lockGlobalConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	configPath, err := getGlobalConfigPath()
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, _, err := configstore.ReadFile(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	configData, format, err := readGlobalConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defaultServer, _ := configData["serverurl"].(string)
+	if defaultServer == "" {
+		defaultServer = config.DefaultServerURL
+	}
+	sections := []map[string]interface{}{configData}
+	profiles, _ := configData["profiles"].(map[string]interface{})
+	for _, section := range profiles {
+		if section, ok := section.(map[string]interface{}); ok {
+			sections = append(sections, section)
+		}
+	}
+	for _, section := range sections {
+		sectionServer, _ := section["serverurl"].(string)
+		if sectionServer == "" {
+			sectionServer = defaultServer
+		}
+		r, s := forgetTenantInSection(section, sectionServer, server, environment)
+		remotes = append(remotes, r...)
+		sessions = append(sessions, s...)
+	}
+	if len(remotes) == 0 && len(sessions) == 0 {
+		return nil, nil, nil
+	}
+	slices.Sort(remotes)
+	slices.Sort(sessions)
+	if err := writeGlobalConfig(configData, format); err != nil {
+		return nil, nil, err
+	}
+
+	// Credentials of the removed entries, and of the sessions renumbered
+	// after them, are no longer referenced
+	updated, _, err := configstore.ReadFile(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	referenced := keyringAccounts(updated)
+	for _, account := range keyringAccounts(raw) {
+		if slices.Contains(referenced, account) {
+			continue
+		}
+		if err := credentials.Delete(account); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove %s from the keyring: %v\n", account, err)
+		}
+	}
+	return remotes, sessions, nil
+}
+
+// forgetTenantInSection removes the remotes and sessions of a configuration
+// section holding credentials of a tenant. Sessions without a server use
+// defaultServer.
+func forgetTenantInSection(section map[string]interface{}, defaultServer, server, environment string) (remotes, sessions []string) {
+	if sectionRemotes, ok := section[remotesKey].(map[string]interface{}); ok {
+		for name, url := range sectionRemotes {
+			remote, err := stacksenv.ParseURL(strings.TrimPrefix(fmt.Sprint(url), "stacksenv://"))
+			if err == nil && sameTenant(remote.ServerURL, remote.ID, server, environment) {
+				delete(sectionRemotes, name)
+				remotes = append(remotes, name)
+			}
+		}
+		if len(sectionRemotes) == 0 {
+			delete(section, remotesKey)
+		}
+	}
+
+	sectionSessions, ok := section[sessionsKey].([]interface{})
+	if !ok {
+		return remotes, nil
+	}
+	kept := sectionSessions[:0]
+	for _, session := range sectionSessions {
+		s, ok := session.(map[string]interface{})
+		id, _ := s["stacksenv_id"].(string)
+		if !ok || id == "" {
+			kept = append(kept, session)
+			continue
+		}
+		sessionServer, _ := s["serverurl"].(string)
+		if sessionServer == "" {
+			sessionServer = defaultServer
+		}
+		host, _ := splitServerURL(sessionServer)
+		if !sameTenant(host, id, server, environment) {
+			kept = append(kept, session)
+			continue
+		}
+		name := sessionValue(s, "name")
+		sessions = append(sessions, name)
+		if active, _ := section[activeSessionKey].(string); strings.EqualFold(active, name) {
+			delete(section, activeSessionKey)
+		}
+	}
+	if len(kept) == 0 {
+		delete(section, sessionsKey)
+	} else {
+		section[sessionsKey] = kept
+	}
+	return remotes, sessions
+}
+
+// localTenantRemotes returns the names of the remotes of the project
+// configuration holding credentials of a tenant.
+func localTenantRemotes(server, environment string) []string {
+	localConfigPath, err := getLocalConfigPath()
+	if err != nil {
+		return nil
+	}
+	configData, _, err := configStore.Read(localConfigPath)
+	if err != nil {
+		debugLog("Skipping project configuration: %v", err)
+		return nil
+	}
+
+	var names []string
+	localRemotes, _ := configData[remotesKey].(map[string]interface{})
+	for name, url := range localRemotes {
+		remote, err := stacksenv.ParseURL(strings.TrimPrefix(fmt.Sprint(url), "stacksenv://"))
+		if err == nil && sameTenant(remote.ServerURL, remote.ID, server, environment) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
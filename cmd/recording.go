@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/term"
+)
+
+// recordingEnvVars lists the environment variables set inside recorded
+// terminal sessions, with the recorder setting them.
+var recordingEnvVars = []struct {
+	name     string
+	recorder string
+}{
+	{"ASCIINEMA_REC", "asciinema"},
+	{"SCRIPT", "script"}, // BSD and macOS script(1)
+	{"STACKSENV_RECORDING", "a session recorder"},
+}
+
+// Markers written around values shown while a recording is in progress, so
+// the recording can be redacted by dropping everything between them. They are
+// OSC sequences, which terminals ignore.
+const (
+	redactBeginMarker = "\x1b]7777;stacksenv;redact-begin\x07"
+	redactEndMarker   = "\x1b]7777;stacksenv;redact-end\x07"
+)
+
+// addForceFlag adds the --force flag allowing a command to show values while
+// the terminal session is recorded.
+func addForceFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("force", false, "show values even if the terminal session is being recorded")
+}
+
+// detectRecording returns the recorder of the terminal session, if it is
+// being recorded.
+func detectRecording() (string, bool) {
+	for _, envVar := range recordingEnvVars {
+		if os.Getenv(envVar.name) != "" {
+			return envVar.recorder, true
+		}
+	}
+	return "", false
+}
+
+// checkRecording refuses to show values on a recorded terminal unless --force
+// is set. It reports whether values are about to be shown on a recorded
+// terminal, so they should be wrapped in redaction markers.
+func checkRecording(cmd *cobra.Command) (bool, error) {
+	recorder, recording := detectRecording()
+	if !recording || !term.IsTerminal(os.Stdout) {
+		return false, nil
+	}
+	if force, _ := cmd.Flags().GetBool("force"); !force {
+		return false, fmt.Errorf("refusing to show values: the terminal session is being recorded by %s (use --force to show them anyway)", recorder)
+	}
+	debugLog("Showing values in a session recorded by %s", recorder)
+	return true, nil
+}
+
+// startRedacted writes the begin marker to the terminal if recording is set
+// and returns a function writing the end marker. The markers bypass the pager.
+func startRedacted(recording bool) func() {
+	if !recording {
+		return func() {}
+	}
+	fmt.Fprint(os.Stdout, redactBeginMarker)
+	return func() {
+		fmt.Fprint(os.Stdout, redactEndMarker)
+	}
+}
@@ -1,39 +1,321 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/configstore"
+	"github.com/stacksenv/cli/pkg/stacksenv"
 )
 
+// defaultRemote is the remote used by commands that fetch the environment.
+const defaultRemote = "origin"
+
+// remotesKey is the configuration key holding the map of remote names to URLs.
+const remotesKey = "remotes"
+
 func init() {
 	rootCmd.AddCommand(remoteCmd)
 	remoteCmd.AddCommand(remoteAddCmd)
 	remoteAddCmd.AddCommand(remoteAddOriginCmd)
+	remoteCmd.AddCommand(remoteListCmd)
+	remoteCmd.AddCommand(remoteRemoveCmd)
+	remoteCmd.AddCommand(remoteRenameCmd)
+	addTableFlags(remoteListCmd)
+	remoteCmd.PersistentFlags().Bool("global", false, "use the global configuration instead of the local project configuration")
 }
 
 var remoteCmd = &cobra.Command{
 	Use:   "remote",
 	Short: "Manage remote projects",
-	Long:  `Manage remote projects.`,
+	Long: `Manage remote projects.
+
+Remotes are stored under "remotes" in the local project configuration
+(.stacksenv/config.json), or in the global configuration with "--global".
+The "origin" remote is used by all commands that fetch the environment.`,
 	RunE: func(_ *cobra.Command, _ []string) error {
 		return nil
 	},
 }
 
 var remoteAddCmd = &cobra.Command{
-	Use:   "add",
+	Use:   "add <name> <url>",
 	Short: "Add a remote project",
-	Long:  `Add a remote project.`,
-	RunE: func(_ *cobra.Command, _ []string) error {
-		return nil
+	Long: `Add a remote project.
+
+The URL has the format stacksenv://ID:SECRET:SECRET_KEY@SERVER_URL/BRANCH.
+An existing remote with the same name is replaced.
+
+While the server rotates secret keys, the remote can hold several: name
+SECRET_KEY with "key_id" and add the others as "key.<ID>", e.g.
+stacksenv://ID:SECRET:NEW_KEY@SERVER_URL/BRANCH?key_id=2026-10&key.2026-04=OLD_KEY.
+The server encrypts the environment with one of them and tells which, and a
+warning is printed when it uses a deprecated key.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return addRemote(cmd, args[0], args[1])
 	},
 }
 
 var remoteAddOriginCmd = &cobra.Command{
-	Use:   "origin  <originurl>",
+	Use:   "origin <originurl>",
 	Short: "Add an origin remote project",
-	Long:  `Add an origin remote project.`,
-	Args:  cobra.MinimumNArgs(1),
-	RunE: func(_ *cobra.Command, _ []string) error {
+	Long: `Add an origin remote project.
+
+This is a shorthand for "stacksenv remote add origin <originurl>".`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return addRemote(cmd, defaultRemote, args[0])
+	},
+}
+
+// addRemote validates the remote URL and stores it in the local or global configuration.
+func addRemote(cmd *cobra.Command, name, url string) error {
+	if name == "" || strings.ContainsAny(name, ". \t") {
+		return fmt.Errorf("invalid remote name %q", name)
+	}
+	if !strings.HasPrefix(url, "stacksenv://") {
+		return errors.New("invalid remote URL: expected stacksenv://ID:SECRET:SECRET_KEY@SERVER_URL/BRANCH")
+	}
+	if _, err := stacksenv.ParseURL(strings.TrimPrefix(url, "stacksenv://")); err != nil {
+		return fmt.Errorf("invalid remote URL: %w", err)
+	}
+
+	configPath, err := remoteConfigPath(cmd)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := configStore.Lock(configPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	configData, remotes, format, err := readRemotes(configPath)
+	if err != nil {
+		return err
+	}
+
+	// Viper matches keys case-insensitively, so store names lowercased
+	remotes[strings.ToLower(name)] = url
+	configData[remotesKey] = remotes
+
+	if err := configStore.Write(configPath, configData, format); err != nil {
+		return err
+	}
+
+	fmt.Printf("Added remote %s to %s\n", strings.ToLower(name), configPath)
+	return nil
+}
+
+var remoteListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List remote projects",
+	Long: `List the remote projects with their environment ID, server URL and branch.
+Credentials are never shown.
+
+Without "--global", the remotes of both the global and the local project
+configuration are listed; a local remote hides a global one with the same name.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		global, err := cmd.Flags().GetBool("global")
+		if err != nil {
+			return err
+		}
+
+		scopes := []string{"global"}
+		if !global {
+			scopes = append(scopes, "local")
+		}
+
+		urls := make(map[string]string)
+		scopeOf := make(map[string]string)
+		for _, scope := range scopes {
+			configPath, err := getGlobalConfigPath()
+			if scope == "local" {
+				configPath, err = getLocalConfigPath()
+			}
+			if err != nil {
+				return err
+			}
+
+			_, remotes, _, err := readRemotes(configPath)
+			if err != nil {
+				return err
+			}
+			for name, url := range remotes {
+				urls[name] = fmt.Sprint(url)
+				scopeOf[name] = scope
+			}
+		}
+
+		names := make([]string, 0, len(urls))
+		for name := range urls {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		sw, err := newTableWriter(cmd, os.Stdout, "NAME", "ENVIRONMENT", "SERVER", "BRANCH", "SCOPE")
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			config, err := stacksenv.ParseURL(strings.TrimPrefix(urls[name], "stacksenv://"))
+			if err != nil {
+				if err := sw.Write(name, "(invalid URL)", "", "", scopeOf[name]); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := sw.Write(name, config.ID, config.ServerURL, config.Branch, scopeOf[name]); err != nil {
+				return err
+			}
+		}
+		return sw.Flush()
+	},
+}
+
+var remoteRemoveCmd = &cobra.Command{
+	Use:     "remove <name>",
+	Aliases: []string{"rm"},
+	Short:   "Remove a remote project",
+	Long:    `Remove a remote project from the local project configuration, or from the global configuration with "--global".`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := strings.ToLower(args[0])
+
+		configPath, err := remoteConfigPath(cmd)
+		if err != nil {
+			return err
+		}
+
+		unlock, err := configStore.Lock(configPath)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		configData, remotes, format, err := readRemotes(configPath)
+		if err != nil {
+			return err
+		}
+		if _, ok := remotes[name]; !ok {
+			return fmt.Errorf("no such remote %q in %s", name, configPath)
+		}
+
+		delete(remotes, name)
+		if len(remotes) == 0 {
+			delete(configData, remotesKey)
+		} else {
+			configData[remotesKey] = remotes
+		}
+
+		if err := configStore.Write(configPath, configData, format); err != nil {
+			return err
+		}
+
+		fmt.Printf("Removed remote %s from %s\n", name, configPath)
+		return nil
+	},
+}
+
+var remoteRenameCmd = &cobra.Command{
+	Use:   "rename <old> <new>",
+	Short: "Rename a remote project",
+	Long: `Rename a remote project in the local project configuration, or in the global configuration with "--global".
+
+Note that only the "origin" remote is used by commands that fetch the environment.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		oldName, newName := strings.ToLower(args[0]), strings.ToLower(args[1])
+		if newName == "" || strings.ContainsAny(newName, ". \t") {
+			return fmt.Errorf("invalid remote name %q", args[1])
+		}
+
+		configPath, err := remoteConfigPath(cmd)
+		if err != nil {
+			return err
+		}
+
+		unlock, err := configStore.Lock(configPath)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		configData, remotes, format, err := readRemotes(configPath)
+		if err != nil {
+			return err
+		}
+		url, ok := remotes[oldName]
+		if !ok {
+			return fmt.Errorf("no such remote %q in %s", oldName, configPath)
+		}
+		if _, exists := remotes[newName]; exists {
+			return fmt.Errorf("remote %q already exists in %s", newName, configPath)
+		}
+
+		delete(remotes, oldName)
+		remotes[newName] = url
+		configData[remotesKey] = remotes
+
+		if err := configStore.Write(configPath, configData, format); err != nil {
+			return err
+		}
+
+		fmt.Printf("Renamed remote %s to %s in %s\n", oldName, newName, configPath)
 		return nil
 	},
 }
+
+// readRemotes reads a configuration file and returns its contents, its remotes
+// map and its format. The remotes map is never nil.
+func readRemotes(configPath string) (map[string]interface{}, map[string]interface{}, configstore.Format, error) {
+	configData, format, err := configStore.Read(configPath)
+	if err != nil {
+		return nil, nil, configstore.JSON, err
+	}
+
+	remotes, _ := configData[remotesKey].(map[string]interface{})
+	if remotes == nil {
+		remotes = make(map[string]interface{})
+	}
+	return configData, remotes, format, nil
+}
+
+// remoteConfigPath returns the configuration file remotes are written to: the
+// global configuration with --global, the local project configuration otherwise.
+func remoteConfigPath(cmd *cobra.Command) (string, error) {
+	global, err := cmd.Flags().GetBool("global")
+	if err != nil {
+		return "", err
+	}
+	if global {
+		return getGlobalConfigPath()
+	}
+	return getLocalConfigPath()
+}
+
+// usedRemote returns the name of the remote resolveStacksenvURL takes the URL
+// from, or an empty string if it doesn't come from a remote.
+func usedRemote(v *viper.Viper) string {
+	if name := v.GetString("remote"); name != "" {
+		return strings.ToLower(name)
+	}
+	if v.GetString("stacksenv_url") == "" && remoteURL(v, defaultRemote) != "" {
+		return defaultRemote
+	}
+	return ""
+}
+
+// remoteURL returns the URL of the named remote configured through viper, or
+// an empty string if there is no such remote.
+func remoteURL(v *viper.Viper, name string) string {
+	return v.GetStringMapString(remotesKey)[strings.ToLower(name)]
+}
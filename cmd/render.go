@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/spf13/cobra"
+)
+
+// placeholderPattern matches ${VAR} placeholders. The bare $VAR form is left
+// alone on purpose, since it is common in nginx and shell configuration files.
+var placeholderPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+func init() {
+	rootCmd.AddCommand(renderCmd)
+	renderCmd.Flags().StringP("output", "o", "", "write the rendered file to this path instead of stdout")
+	renderCmd.Flags().Bool("strict", false, "fail if a placeholder references an unknown variable")
+	addForceFlag(renderCmd)
+}
+
+var renderCmd = &cobra.Command{
+	Use:   "render <template>",
+	Short: "Render a template file with environment values",
+	Long: `Render a template file by substituting values from the environment.
+
+Both ${VAR} placeholders and Go templates ({{ .VAR }}) are supported.
+Unknown ${VAR} placeholders are kept as-is unless "--strict" is set. Values are
+inserted verbatim: placeholders and actions within them are not expanded.
+
+Without "--output", rendering is refused on a terminal whose session is being
+recorded, unless "--force" is set.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		strict, err := cmd.Flags().GetBool("strict")
+		if err != nil {
+			return err
+		}
+
+		var recording bool
+		if output == "" {
+			if recording, err = checkRecording(cmd); err != nil {
+				return err
+			}
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+
+		source, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read template: %w", err)
+		}
+
+		properties, err := fetchContextData(v)
+		if err != nil {
+			return err
+		}
+
+		rendered, err := renderTemplate(args[0], source, contextDataToMap(properties), strict)
+		if err != nil {
+			return err
+		}
+
+		if output == "" {
+			endRedacted := startRedacted(recording)
+			defer endRedacted()
+			_, err = os.Stdout.Write(rendered)
+			return err
+		}
+
+		// Rendered files contain secrets, so keep them private to the user
+		if err := os.WriteFile(output, rendered, 0600); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+		return nil
+	},
+}
+
+// renderTemplate substitutes the ${VAR} placeholders of the text of source
+// and executes it as a Go template with values as its data. Placeholders are
+// only substituted in the text of the template, not in the values its actions
+// insert, and substituted values aren't parsed as template actions, so no value
+// is ever expanded twice. In strict mode, references to unknown variables are
+// reported as errors.
+func renderTemplate(name string, source []byte, values map[string]string, strict bool) ([]byte, error) {
+	tmpl := template.New(name).Option("missingkey=zero")
+	if strict {
+		tmpl = tmpl.Option("missingkey=error")
+	}
+	tmpl, err := tmpl.Parse(string(source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var missing []string
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			substitutePlaceholders(t.Tree.Root, values, &missing)
+		}
+	}
+	if strict && len(missing) > 0 {
+		return nil, fmt.Errorf("template references unknown variables: %v", missing)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// substitutePlaceholders substitutes the ${VAR} placeholders of the text
+// nodes under node with values, in place, and appends the names of unknown
+// variables to missing; their placeholders are kept.
+func substitutePlaceholders(node parse.Node, values map[string]string, missing *[]string) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			substitutePlaceholders(child, values, missing)
+		}
+	case *parse.TextNode:
+		node.Text = placeholderPattern.ReplaceAllFunc(node.Text, func(match []byte) []byte {
+			name := string(placeholderPattern.FindSubmatch(match)[1])
+			if value, ok := values[name]; ok {
+				return []byte(value)
+			}
+			*missing = append(*missing, name)
+			return match
+		})
+	case *parse.IfNode:
+		substitutePlaceholders(node.List, values, missing)
+		substitutePlaceholders(node.ElseList, values, missing)
+	case *parse.RangeNode:
+		substitutePlaceholders(node.List, values, missing)
+		substitutePlaceholders(node.ElseList, values, missing)
+	case *parse.WithNode:
+		substitutePlaceholders(node.List, values, missing)
+		substitutePlaceholders(node.ElseList, values, missing)
+	}
+}
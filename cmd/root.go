@@ -4,8 +4,10 @@ import (
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/stacksenv/cli/pkg/stacksenv"
+	"github.com/stacksenv/cli/pkg/term"
 )
 
 // var (
@@ -37,10 +39,29 @@ func init() {
 
 	// Flags available across the whole program
 	persistent := rootCmd.PersistentFlags()
+	persistentFlags = persistent
 	persistent.StringP("config", "c", "", "config file path")
 	persistent.BoolP("debug", "d", false, "enable debug logging")
+	persistent.BoolP("quiet", "q", false, "suppress progress indicators")
+	persistent.Bool("no-personal", false, "don't merge your personal overlay over the shared branch")
+	persistent.Bool(noCacheFlag, false, "don't use the offline cache, even if it is enabled")
+	persistent.String("remote", "", `remote to use instead of the default ("origin")`)
+	persistent.String("min-server-version", "", "fail unless the server runs at least this version (e.g. 1.4.0)")
+	persistent.String("branch", "", "branch to use instead of the configured one (default $"+branchEnvVar+")")
+	persistent.String("profile", "", "configuration profile to use (default $"+profileEnvVar+")")
+	persistent.Bool(strictKey, false, "fail if the configuration files contain unknown keys")
+	persistent.String(colorKey, string(term.ColorAuto), "when to color the output: auto, always or never (auto honors $NO_COLOR)")
+	persistent.Duration(httpTimeoutFlag, stacksenv.DefaultHTTPTimeout, "timeout of each request to the server (0 for none)")
+	persistent.Int(httpRetriesFlag, stacksenv.DefaultHTTPRetries, "number of times requests failing with a transient error are retried")
+	persistent.Duration(httpRetryBackoffFlag, stacksenv.DefaultHTTPRetryBackoff, "delay before the first retry of a request, doubled for every further retry")
 }
 
+// persistentFlags are the flags of rootCmd available to every command, which
+// may also be set in the configuration. Code run by the commands refers to
+// them through this variable, as referring to rootCmd would be an
+// initialization cycle.
+var persistentFlags *pflag.FlagSet
+
 var rootCmd = &cobra.Command{
 	Use:   "stacksenv",
 	Short: "Stacksenv is a CLI for managing your Environment Variables",
@@ -66,6 +87,58 @@ The precedence of the configuration values are as follows:
 - Environment variables
 - Defaults
 
+The global configuration lives in ~/.stacksenv/config, next to the offline
+cache and the audit log, kept in ~/.stacksenv/tenants in a directory per
+server and environment (see "stacksenv purge"). Following the XDG Base Directory specification, it
+lives in $XDG_CONFIG_HOME/stacksenv/config instead, with the other files in
+$XDG_DATA_HOME/stacksenv, if that configuration file exists or, for new
+installs, if $XDG_CONFIG_HOME or $XDG_DATA_HOME is set. An existing
+~/.stacksenv/config keeps being used.
+
+Named profiles (e.g. "work", "personal" or "ci") in the "profiles" section of
+the configuration hold their own server URL, credentials and defaults. A
+profile is selected with "--profile", the STACKSENV_PROFILE environment
+variable or the "default_profile" key, and its settings override the global
+configuration (but not the local project configuration):
+
+  {
+    "default_profile": "work",
+    "profiles": {
+      "work": {"serverurl": "stacksenv.example.com", "token": "..."},
+      "ci": {"stacksenv_url": "stacksenv://..."}
+    }
+  }
+
+The branch is taken from "--branch", the STACKSENV_BRANCH environment
+variable, the "stacksenv_branch" key of the local project configuration
+(recorded by "stacksenv init --branch") and the global configuration or
+credentials, in that order.
+
+String values in configuration files may reference environment variables as
+${VAR}, or ${VAR:-default} to fall back to a default if VAR is unset or empty,
+so the same committed configuration works on developer machines and in CI:
+
+  {"serverurl": "${STACKS_SERVER:-stacksenv.example.com}"}
+
+References are expanded when the file is loaded; "$${" stands for a literal
+"${". The "default_command" value is not expanded, as it runs with the
+fetched environment.
+
+With "strict": true in the configuration or "--strict", commands fail if the
+merged configuration files contain unknown keys, e.g. a misspelled
+"serveurl", instead of ignoring them; the error suggests the closest known
+keys. Commands inspecting or repairing the configuration still run.
+
+Servers answering with a different response envelope are supported with the
+"codec" key: "stacksenv" (the default) reads the encrypted payload from the
+"data" field of the JSON response, "raw" takes the whole response body as the
+payload. Library users can register their own codecs.
+
+Colors are used when the output is a terminal, unless the NO_COLOR
+environment variable is set or TERM is "dumb". "--color always" or "never"
+(or the "color" key) forces them on or off, e.g. to keep colors through a
+pipe or to get plain output in CI.
+
 Also, if the environment variables path doesn't exist, Stacksenv will enter into
 the quick setup mode and a new environment variables will be bootstrapped and a new
 user created with the credentials from options "username" and "password".`,
@@ -76,18 +149,37 @@ user created with the credentials from options "username" and "password".`,
 
 		if len(args) > 0 {
 			if strings.HasPrefix(args[0], "stacksenv://") {
-				return stacksenv.HandleStacksenvURLCLI(args[0], args[1:])
+				marker, err := guardProtectedURL(v, args[0], args[1:])
+				if err != nil {
+					return err
+				}
+				handler := stacksenv.NewHandlerWithLogger(nil, nil, nil, newLogger())
+				handler.ExtraEnv = marker
+				return handleRevoked(logRequestID(handleInForeground(handler, args[0], args[1:])))
 			}
-			if v.GetString("stacksenv_url") != "" {
-				return stacksenv.HandleStacksenvURLCLI(v.GetString("stacksenv_url"), args)
+			url, err := resolveStacksenvURL(v)
+			if err != nil {
+				return err
 			}
-			exists, url := checkSeperatedVariables(v)
-			if exists {
-				return stacksenv.HandleStacksenvURLCLI(url, args)
+			if url != "" {
+				if err := checkMinServerVersionURL(v, url); err != nil {
+					return err
+				}
+				marker, err := guardProtectedURL(v, url, args)
+				if err != nil {
+					return err
+				}
+				service, err := newInjectingClientService(v)
+				if err != nil {
+					return err
+				}
+				handler := stacksenv.NewHandlerWithLogger(loginTokenParser{v}, service, nil, newLogger())
+				handler.ExtraEnv = marker
+				return handleRevoked(logRequestID(handleInForeground(handler, url, args)))
 			}
 
 			// Execute args as system CLI commands (e.g., "node -v", "python -v")
-			return stacksenv.HandleStacksenvURLCLI("", args)
+			return handleInForeground(stacksenv.NewHandlerWithLogger(nil, nil, nil, newLogger()), "", args)
 		}
 		return nil
 	}, storeOptions{allowsNoDatabase: true}),
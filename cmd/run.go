@@ -0,0 +1,304 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/dotenv"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+	runCmd.Flags().BoolP("watch", "w", false, "restart the command when the environment changes")
+	runCmd.Flags().Bool("exec", false, "replace stacksenv with the command instead of running it as a child process")
+	runCmd.MarkFlagsMutuallyExclusive("exec", "watch")
+	runCmd.Flags().Duration("watch-interval", stacksenv.DefaultWatchInterval, "interval between environment checks in watch mode without subscription")
+	runCmd.Flags().StringArray("env-file", nil, "read additional variables from a dotenv file (repeatable)")
+	addFilterFlags(runCmd)
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run [flags] [-- <command> [args...]]",
+	Short: "Run a command with the environment loaded",
+	Long: `Run a command with the environment variables fetched from the server.
+
+If no command is given, the "default_command" configuration value is run
+(e.g. "default_command": "npm run dev" in .stacksenv/config.json). Arguments
+given after "--" are appended to it.
+
+With "--env-file", variables are also read from local dotenv files, e.g.
+"stacksenv run --env-file .env.test -- pytest". The flag can be repeated.
+Variables are applied in this order, later sources overriding earlier ones:
+
+  1. the current process environment
+  2. the variables fetched from the server
+  3. the env files, in the order they are given
+
+With "--include" and "--exclude", or the "include" and "exclude" lists of
+the configuration (e.g. "include": ["APP_*"] in .stacksenv/config.json), only
+the fetched variables matching an include pattern, if any, and no exclude
+pattern are injected. Patterns use "*", "?" and "[...]" like shell globs;
+the flags replace the configured lists. Variables from env files are always
+injected.
+
+Unless "--quiet" is given, the branch and a checksum of the injected
+variables are printed to stderr before the command starts, e.g.
+"stacksenv: environment 3f2a9c1b7d04 (branch dev, 12 variables)". Two runs
+print the same checksum exactly when they inject the same variables with the
+same values. The checksum is the start of the environment hash of the
+stacksenv SDK (stacksenv.Hash).
+
+Interrupting stacksenv (Ctrl-C) while it fetches the environment aborts the
+fetch. Once the command runs, interrupts are left to the command, which gets
+them from the terminal, so interactive programs keep working. If stacksenv is
+asked to terminate (SIGTERM), the command is interrupted, and killed if it
+doesn't exit within 10 seconds.
+
+If no environment is configured, or the selected remote doesn't exist, and
+stdin is a terminal, stacksenv asks which environment to use: one of the
+configured remotes or a pasted stacksenv:// URL, and the branch, listing the
+branches the server reports for the credentials. Otherwise, like in CI,
+stacksenv fails with an error instead, or runs the command without fetched
+variables if no environment is configured at all.
+
+With "--exec", stacksenv replaces itself with the command once the
+environment is fetched, like the exec builtin of shells, instead of running
+it as a child process. The command keeps the process ID of stacksenv, gets
+the signals sent to it directly and its exit status is the one process
+supervisors see, without a stacksenv parent in the process tree. Replacing
+the process is not supported on Windows, nor with "--watch".
+
+With "--watch", stacksenv subscribes to the changes of the environment and
+restarts the command with the fresh variables whenever it changes. Servers
+without subscriptions are polled every "--watch-interval" instead. Env
+files are read once at startup. If the remote opted in with "stacksenv remote
+heartbeat", heartbeats are sent to the server while watching. If the server
+reports that the credentials were revoked, the command is stopped and the
+local cache purged.
+
+Starting an interactive shell, e.g. "stacksenv run -- bash", with the
+environment of a protected branch is guarded by "protected_shell", see
+"stacksenv shell".`,
+	Args: cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		watch, err := cmd.Flags().GetBool("watch")
+		if err != nil {
+			return err
+		}
+		replace, err := cmd.Flags().GetBool("exec")
+		if err != nil {
+			return err
+		}
+		interval, err := cmd.Flags().GetDuration("watch-interval")
+		if err != nil {
+			return err
+		}
+		envFiles, err := cmd.Flags().GetStringArray("env-file")
+		if err != nil {
+			return err
+		}
+		extraEnv, err := readEnvFiles(envFiles)
+		if err != nil {
+			return err
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+
+		args, err = withDefaultCommand(cmd, args, v.GetString("default_command"))
+		if err != nil {
+			return err
+		}
+
+		service, err := newInjectingClientService(v)
+		if err != nil {
+			return err
+		}
+		var executor stacksenv.CommandExecutor
+		if replace {
+			executor = stacksenv.NewExecCommandExecutor()
+		}
+		handler := stacksenv.NewHandlerWithLogger(loginTokenParser{v}, service, executor, newLogger())
+		handler.ExtraEnv = extraEnv
+		if !v.GetBool("quiet") {
+			handler.OnStart = printEnvChecksum
+		}
+
+		url, err := resolveStacksenvURL(v)
+		if (err != nil || url == "") && canPromptForConfig() {
+			url, err = promptStacksenvURL(v, err)
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkMinServerVersionURL(v, url); err != nil {
+			return err
+		}
+		marker, err := guardProtectedURL(v, url, args)
+		if err != nil {
+			return err
+		}
+		handler.ExtraEnv = append(handler.ExtraEnv, marker...)
+		if !watch {
+			return handleRevoked(logRequestID(handleInForeground(handler, url, args)))
+		}
+
+		if url == "" {
+			return errNoCredentials
+		}
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		if heartbeatEnabled(v) {
+			heartbeatEvery, err := heartbeatInterval(v)
+			if err != nil {
+				return err
+			}
+			httpClient, err := newHTTPClient(v)
+			if err != nil {
+				return err
+			}
+			// Invalid URLs are left to the watch to report
+			if config, err := (loginTokenParser{v}).ParseURL(strings.TrimPrefix(url, "stacksenv://")); err == nil {
+				go sendHeartbeats(ctx, httpClient, config, heartbeatEvery)
+			}
+		}
+
+		handler.OnStart = publishingStart(handler.OnStart)
+		return handleRevoked(logRequestID(handler.WatchStacksenvURLCLI(ctx, url, args, interval)))
+	},
+}
+
+// envChecksumLength is the number of hex digits of the checksum printed by
+// printEnvChecksum.
+const envChecksumLength = 12
+
+// printEnvChecksum prints a short checksum of the environment a command is
+// started with to stderr, so developers can compare their setups.
+func printEnvChecksum(branch string, env []string) {
+	if branch == "" {
+		branch = "default"
+	}
+	properties := envToProperties(env)
+	fmt.Fprintf(os.Stderr, "stacksenv: environment %s (branch %s, %d variables)\n",
+		stacksenv.Hash(properties)[:envChecksumLength], branch, len(properties))
+}
+
+// envToProperties converts KEY=VALUE entries to variables sorted by name.
+// Later entries override earlier ones with the same name, like in the started
+// process.
+func envToProperties(env []string) []stacksenv.ContextData[any] {
+	properties := make([]stacksenv.ContextData[any], 0, len(env))
+	for _, entry := range env {
+		key, value, _ := strings.Cut(entry, "=")
+		properties = append(properties, stacksenv.ContextData[any]{Property: key, Value: value})
+	}
+	return stacksenv.NewEnvSet(properties).Sorted()
+}
+
+// readEnvFiles reads the given dotenv files and returns their variables as
+// KEY=VALUE entries, in file order.
+func readEnvFiles(paths []string) ([]string, error) {
+	var env []string
+	for _, path := range paths {
+		vars, err := dotenv.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read env file: %w", err)
+		}
+		for _, variable := range vars {
+			env = append(env, variable.Key+"="+variable.Value)
+		}
+	}
+	return env, nil
+}
+
+// withDefaultCommand prepends the configured default command to args unless a
+// command was given before "--". Arguments after "--" are appended to the
+// default command.
+func withDefaultCommand(cmd *cobra.Command, args []string, defaultCommand string) ([]string, error) {
+	// A command was given explicitly
+	if dash := cmd.ArgsLenAtDash(); len(args) > 0 && dash != 0 {
+		return args, nil
+	}
+
+	if defaultCommand == "" {
+		if len(args) == 0 {
+			return nil, errors.New("no command given and no default_command configured")
+		}
+		return args, nil
+	}
+
+	words, err := splitCommandLine(defaultCommand)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default_command: %w", err)
+	}
+	if len(words) == 0 {
+		return nil, errors.New("invalid default_command: command is empty")
+	}
+
+	return append(words, args...), nil
+}
+
+// splitCommandLine splits a command line into words like a POSIX shell does for
+// simple commands: words are separated by whitespace, and single quotes, double
+// quotes and backslashes can be used to include whitespace in a word.
+// Variable expansion and other shell features are not supported.
+func splitCommandLine(line string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote != 0:
+			switch {
+			case r == quote:
+				quote = 0
+			case r == '\\' && quote == '"':
+				escaped = true
+			default:
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/configstore"
+)
+
+// configSchemaFile is the file the JSON Schema of the configuration is
+// written to, next to the JSON configuration files the CLI creates.
+const configSchemaFile = "config.schema.json"
+
+// configSchemaRef is the "$schema" reference of the configuration files the
+// CLI creates, relative to the file.
+const configSchemaRef = "./" + configSchemaFile
+
+// schemaKind is a kind of file stacksenv publishes a JSON Schema for.
+type schemaKind struct {
+	Name        string
+	Description string
+	Schema      func() map[string]interface{}
+}
+
+// schemaKinds lists the files stacksenv publishes JSON Schemas for.
+var schemaKinds = []schemaKind{
+	{"config", "configuration files: config.json, the global config, profiles and sessions", configSchema},
+}
+
+func init() {
+	operations.subscribe("schema", func(event *operationEvent) error {
+		return writeConfigSchema(event.Path, event.ConfigData, event.Format)
+	}, eventConfigWritten)
+
+	rootCmd.AddCommand(schemaCmd)
+	schemaCmd.AddCommand(schemaPrintCmd)
+	schemaCmd.AddCommand(schemaListCmd)
+}
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Publish the JSON Schemas of the files stacksenv reads",
+	Long: `Print the JSON Schemas of the files stacksenv reads, so editors can validate
+and complete them as they are typed.
+
+The JSON configuration files the CLI creates ("stacksenv init" and the global
+configuration) reference the schema with "$schema": "./` + configSchemaFile + `",
+and the schema is written next to them. It is refreshed whenever the CLI
+updates such a file, so it follows upgrades of the CLI.`,
+}
+
+var schemaPrintCmd = &cobra.Command{
+	Use:       "print <kind>",
+	Short:     "Print the JSON Schema of a kind of file",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: schemaKindNames(),
+	RunE: func(_ *cobra.Command, args []string) error {
+		kind, err := findSchemaKind(args[0])
+		if err != nil {
+			return err
+		}
+		data, err := marshalSchema(kind)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	},
+}
+
+var schemaListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the kinds of files with a JSON Schema",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		for _, kind := range schemaKinds {
+			fmt.Printf("%-8s %s\n", kind.Name, kind.Description)
+		}
+		return nil
+	},
+}
+
+// schemaKindNames returns the names of the kinds of files with a schema.
+func schemaKindNames() []string {
+	names := make([]string, 0, len(schemaKinds))
+	for _, kind := range schemaKinds {
+		names = append(names, kind.Name)
+	}
+	return names
+}
+
+// findSchemaKind returns the kind of file with the given name.
+func findSchemaKind(name string) (schemaKind, error) {
+	index := slices.IndexFunc(schemaKinds, func(kind schemaKind) bool {
+		return strings.EqualFold(kind.Name, name)
+	})
+	if index < 0 {
+		return schemaKind{}, fmt.Errorf("unknown schema %q (available: %s)", name, strings.Join(schemaKindNames(), ", "))
+	}
+	return schemaKinds[index], nil
+}
+
+// marshalSchema returns the indented JSON Schema of a kind of file.
+func marshalSchema(kind schemaKind) ([]byte, error) {
+	data, err := json.MarshalIndent(kind.Schema(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the %s schema: %w", kind.Name, err)
+	}
+	return append(data, '\n'), nil
+}
+
+// writeConfigSchema writes the JSON Schema of the configuration next to a JSON
+// configuration file referencing it with configSchemaRef. Other files are
+// left alone.
+func writeConfigSchema(configPath string, configData map[string]interface{}, format configstore.Format) error {
+	if format != configstore.JSON || configData[schemaKey] != configSchemaRef {
+		return nil
+	}
+
+	kind, err := findSchemaKind("config")
+	if err != nil {
+		return err
+	}
+	data, err := marshalSchema(kind)
+	if err != nil {
+		return err
+	}
+	schemaPath := filepath.Join(filepath.Dir(configPath), configSchemaFile)
+	if err := configstore.WriteFileAtomic(schemaPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write the configuration schema: %w", err)
+	}
+	return nil
+}
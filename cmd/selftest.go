@@ -0,0 +1,341 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/configstore"
+	"github.com/stacksenv/cli/pkg/keyring"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+	"github.com/stacksenv/cli/pkg/term"
+)
+
+const (
+	checkPassed      = "ok"
+	checkFailed      = "fail"
+	checkSkipped     = "skip"
+	checkUnsupported = "n/a"
+)
+
+// selftestEnvVar is the variable the executor check injects into its command.
+const selftestEnvVar = "STACKSENV_SELFTEST"
+
+// selftestCheck is a check run by "stacksenv selftest".
+type selftestCheck struct {
+	Name        string
+	Description string
+	// Run returns an error if the check fails, or a skippedError if it
+	// can't run on this machine.
+	Run func() error
+}
+
+// skippedError is returned by checks that don't apply to this machine.
+type skippedError struct {
+	reason error
+}
+
+func (e *skippedError) Error() string {
+	return "skipped: " + e.reason.Error()
+}
+
+// selftestResult is the outcome of a check.
+type selftestResult struct {
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// selftestChecks are the checks run by "stacksenv selftest", in order.
+var selftestChecks = []selftestCheck{
+	{"crypto", "encrypt/decrypt round-trip", checkCryptoRoundTrip},
+	{"payload", "server payload decoding", checkPayloadDecoding},
+	{"config", "config read/write", checkConfigReadWrite},
+	{"executor", "command launch", checkExecutor},
+	{"keyring", "OS keyring access", checkKeyring},
+}
+
+func init() {
+	rootCmd.AddCommand(selftestCmd)
+	selftestCmd.Flags().StringP("output", "o", "text", "output format: text or json")
+}
+
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Check that stacksenv works on this machine",
+	Long: `Run a battery of offline checks verifying the installation on this machine,
+e.g. before rolling stacksenv out to a fleet:
+
+  crypto    encrypting and decrypting variables
+  payload   decoding server responses, in every supported encryption scheme
+  config    reading and writing JSON, YAML and TOML configuration files and
+            encrypted credentials, in a temporary directory
+  executor  launching a command with injected variables
+  keyring   storing, reading and removing a credential in the OS keyring
+
+No server is contacted and the configuration is left untouched. The keyring
+check is skipped where no keyring is available. The command exits with a
+non-zero status if a check fails. Use "--output json" for a machine-readable
+report.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if output != "text" && output != "json" {
+			return fmt.Errorf("unsupported output format %q (supported: text, json)", output)
+		}
+		// The configuration isn't read, so only the flag selects colors
+		color, err := cmd.Flags().GetString(colorKey)
+		if err != nil {
+			return err
+		}
+
+		results := make([]selftestResult, 0, len(selftestChecks))
+		failed := 0
+		for _, check := range selftestChecks {
+			result := selftestResult{Check: check.Name, Status: checkPassed, Message: check.Description}
+			var skipped *skippedError
+			if err := check.Run(); errors.As(err, &skipped) {
+				result.Status, result.Message = checkSkipped, fmt.Sprintf("%s: %v", check.Description, skipped.reason)
+			} else if err != nil {
+				result.Status, result.Message = checkFailed, fmt.Sprintf("%s: %v", check.Description, err)
+				failed++
+			}
+			results = append(results, result)
+		}
+
+		if output == "json" {
+			report := struct {
+				Passed  bool             `json:"passed"`
+				Results []selftestResult `json:"results"`
+			}{failed == 0, results}
+
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+		} else {
+			out, err := newColorWriter(os.Stdout, color)
+			if err != nil {
+				return err
+			}
+			for _, result := range results {
+				out.Printf("%s %-9s %s\n", formatCheckStatus(out, result.Status), result.Check, result.Message)
+			}
+			out.Printf("%d checks, %d failed\n", len(results), failed)
+		}
+
+		if failed > 0 {
+			return errors.New("selftest failed")
+		}
+		return nil
+	},
+}
+
+// formatCheckStatus returns the padded status of a check, in green, red,
+// yellow or dim if the output is colored.
+func formatCheckStatus(out *term.Writer, status string) string {
+	colors := map[string]term.Color{checkPassed: term.Green, checkFailed: term.Red, checkSkipped: term.Yellow, checkUnsupported: term.Dim}
+	return out.Paint(fmt.Sprintf("%-4s", status), colors[status])
+}
+
+// selftestVariables returns the variables the checks encrypt and decode,
+// including platform restrictions and a tombstone.
+func selftestVariables() []stacksenv.ContextData[any] {
+	return []stacksenv.ContextData[any]{
+		{Property: "SELFTEST_STRING", Value: "héllo wörld ✓"},
+		{Property: "SELFTEST_NUMBER", Value: float64(42)},
+		{Property: "SELFTEST_PLATFORM", Value: "yes", OS: []string{runtime.GOOS}, Arch: []string{runtime.GOARCH}},
+		{Property: "SELFTEST_DELETED", Value: "gone", DeletedAt: "2026-01-01T00:00:00Z", PurgeAt: "2026-01-31T00:00:00Z"},
+	}
+}
+
+// randomToken returns a random string, e.g. for secrets.
+func randomToken() string {
+	return rand.Text()
+}
+
+// checkCryptoRoundTrip encrypts and decrypts variables, and checks that a
+// wrong key is rejected.
+func checkCryptoRoundTrip() error {
+	variables := selftestVariables()
+	secret, aad := randomToken(), randomToken()
+
+	encrypted, err := stacksenv.Encrypt(variables, secret, aad)
+	if err != nil {
+		return err
+	}
+	decrypted, err := stacksenv.Decrypt(encrypted, secret, aad)
+	if err != nil {
+		return err
+	}
+	if stacksenv.Hash(decrypted) != stacksenv.Hash(variables) {
+		return errors.New("decrypted variables differ from the encrypted ones")
+	}
+	if _, err := stacksenv.Decrypt(encrypted, randomToken(), aad); err == nil {
+		return errors.New("decryption with a wrong key succeeded")
+	}
+	return nil
+}
+
+// selftestHTTPClient answers every request with a fixed body.
+type selftestHTTPClient struct {
+	body []byte
+}
+
+func (c *selftestHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(bytes.NewReader(c.body)),
+		Request:    req,
+	}, nil
+}
+
+// checkPayloadDecoding decodes server responses encrypted with each scheme
+// servers use, with and without payload header, through the built-in codecs,
+// and checks that tombstones are dropped.
+func checkPayloadDecoding() error {
+	config := &stacksenv.Config{ID: "selftest", Secret: randomToken(), SecretKey: randomToken(), ServerURL: "selftest.invalid", Branch: "main"}
+	variables := selftestVariables()
+	schemes := []struct {
+		name         string
+		sharedSecret string
+		aad          string
+		header       *stacksenv.PayloadHeader
+	}{
+		{"current", config.SecretKey, config.Secret + "|" + config.SecretKey, nil},
+		{"legacy", config.Secret, config.SecretKey, nil},
+		{"unauthenticated", config.SecretKey, "", nil},
+		{"versioned", config.Secret, config.SecretKey, &stacksenv.PayloadHeader{Version: stacksenv.PayloadVersion, KeyUsage: stacksenv.KeyUsageSecretSecretKey}},
+	}
+
+	for _, scheme := range schemes {
+		encrypted, err := stacksenv.Encrypt(variables, scheme.sharedSecret, scheme.aad)
+		if err != nil {
+			return err
+		}
+		if scheme.header != nil {
+			encrypted = stacksenv.FormatPayload(*scheme.header, encrypted)
+		}
+		envelope, err := json.Marshal(stacksenv.ServerResponse{EncryptedData: encrypted})
+		if err != nil {
+			return err
+		}
+		bodies := map[string][]byte{stacksenv.DefaultCodec: envelope, "raw": []byte(encrypted)}
+		for codecName, body := range bodies {
+			codec, err := stacksenv.GetCodec(codecName)
+			if err != nil {
+				return err
+			}
+			service := stacksenv.NewClientServiceWithCodec(&selftestHTTPClient{body: body}, stacksenv.NewCryptoService(), codec)
+			decoded, err := service.GetContextDecryptedData(config)
+			if err != nil {
+				return fmt.Errorf("%s scheme, %s codec: %w", scheme.name, codecName, err)
+			}
+			if stacksenv.Hash(decoded) != stacksenv.Hash(variables) || len(decoded) != len(variables)-1 {
+				return fmt.Errorf("%s scheme, %s codec: decoded variables differ from the sent ones", scheme.name, codecName)
+			}
+		}
+	}
+	return nil
+}
+
+// checkConfigReadWrite writes and reads back a configuration file in each
+// format, and seals and opens a credential, in a temporary directory.
+func checkConfigReadWrite() error {
+	dir, err := os.MkdirTemp("", selftestTempPrefix+"*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	token := randomToken()
+	configData := map[string]interface{}{
+		"serverurl":       "selftest.invalid",
+		"token":           token,
+		"stacksenv_url":   "stacksenv://selftest:" + token + "@selftest.invalid/main",
+		"default_command": "true",
+	}
+	files := []struct {
+		name   string
+		format configstore.Format
+	}{{"config.json", configstore.JSON}, {"config.yaml", configstore.YAML}, {"config.toml", configstore.TOML}}
+	for _, file := range files {
+		path, format := filepath.Join(dir, file.name), file.format
+		if err := configStore.Write(path, configData, format); err != nil {
+			return fmt.Errorf("%s: %w", format, err)
+		}
+		read, readFormat, err := configStore.Read(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", format, err)
+		}
+		if readFormat != format {
+			return fmt.Errorf("%s: file read back as %s", format, readFormat)
+		}
+		for key, value := range configData {
+			if read[key] != value {
+				return fmt.Errorf("%s: %s read back as %v", format, key, read[key])
+			}
+		}
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+	sealed, err := sealValue(key, token)
+	if err != nil {
+		return fmt.Errorf("encrypted credentials: %w", err)
+	}
+	if opened, err := openValue(key, strings.TrimPrefix(sealed, sealedValuePrefix)); err != nil || opened != token {
+		return fmt.Errorf("encrypted credentials: failed to decrypt a credential: %v", err)
+	}
+	return nil
+}
+
+// checkExecutor launches a shell command that checks an injected variable.
+func checkExecutor() error {
+	value := randomToken()
+	script := `test "$` + selftestEnvVar + `" = ` + value
+	if runtime.GOOS == "windows" {
+		script = `if not %` + selftestEnvVar + `%==` + value + ` exit 1`
+	}
+	command := shellCommand(script)
+	return stacksenv.NewCommandExecutor().Execute(command[0], command[1:], []string{selftestEnvVar + "=" + value})
+}
+
+// checkKeyring stores, reads and deletes a credential in the OS keyring.
+func checkKeyring() error {
+	account := "selftest:" + randomToken()
+	secret := randomToken()
+
+	if err := credentials.Set(account, secret); errors.Is(err, keyring.ErrUnsupported) {
+		return &skippedError{reason: err}
+	} else if err != nil {
+		return fmt.Errorf("failed to store a credential: %w", err)
+	}
+	read, err := credentials.Get(account)
+	if deleteErr := credentials.Delete(account); deleteErr != nil && err == nil {
+		return fmt.Errorf("failed to remove the credential: %w", deleteErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the credential back: %w", err)
+	}
+	if read != secret {
+		return errors.New("the credential read back differs from the stored one")
+	}
+	return nil
+}
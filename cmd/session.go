@@ -0,0 +1,393 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/configstore"
+)
+
+const (
+	// sessionsKey is the configuration key holding the list of sessions.
+	sessionsKey = "sessions"
+	// activeSessionKey is the configuration key naming the active session.
+	activeSessionKey = "active_session"
+)
+
+// sessionKeys are the settings a session holds, besides its name.
+var sessionKeys = []string{"serverurl", "stacksenv_id", "stacksenv_secret", "stacksenv_key", "stacksenv_branch"}
+
+func init() {
+	rootCmd.AddCommand(sessionCmd)
+	sessionCmd.AddCommand(sessionListCmd)
+	sessionCmd.AddCommand(sessionAddCmd)
+	sessionCmd.AddCommand(sessionRemoveCmd)
+	sessionCmd.AddCommand(sessionUseCmd)
+	addTableFlags(sessionListCmd)
+
+	sessionAddCmd.Flags().String("server", "", "server URL (default: the configured server)")
+	sessionAddCmd.Flags().String("id", "", "environment ID (prompted if not set)")
+	sessionAddCmd.Flags().String("branch", "", "branch (default: the server's default branch)")
+	sessionAddCmd.Flags().Bool("use", false, "make the new session the active one")
+	sessionUseCmd.Flags().Bool("none", false, "deactivate the active session")
+}
+
+var sessionCmd = &cobra.Command{
+	Use:   "session",
+	Short: "Manage sessions",
+	Long: `Manage sessions: named sets of server URL, credentials and branch stored
+under "sessions" in the global configuration (or in the selected profile).
+
+The session named by "active_session" is applied by every command that
+fetches the environment; its settings override the global configuration and
+the profile, but not the local project configuration. Its credentials take
+precedence over "stacksenv_url" and the remotes, except for a remote selected
+with "--remote".`,
+}
+
+var sessionListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List sessions",
+	Long:  `List the sessions with their server URL, environment ID and branch. The active session is marked with "*". Credentials are never shown.`,
+	Args:  cobra.NoArgs,
+	// Commands managing sessions work on the stored sessions only
+	Annotations: map[string]string{managesSessionsAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if _, err := initViper(cmd); err != nil {
+			return err
+		}
+		configData, _, err := readGlobalConfig()
+		if err != nil {
+			return err
+		}
+		section := globalConfigSection(configData, false)
+		active, _ := section[activeSessionKey].(string)
+
+		sw, err := newTableWriter(cmd, os.Stdout, "ACTIVE", "NAME", "SERVER", "ENVIRONMENT", "BRANCH")
+		if err != nil {
+			return err
+		}
+		for _, session := range sessionList(section) {
+			name := fmt.Sprint(session["name"])
+			marker := ""
+			if active != "" && strings.EqualFold(name, active) {
+				marker = "*"
+			}
+			if err := sw.Write(marker, name, sessionValue(session, "serverurl"), sessionValue(session, "stacksenv_id"), sessionValue(session, "stacksenv_branch")); err != nil {
+				return err
+			}
+		}
+		return sw.Flush()
+	},
+}
+
+var sessionAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Add a session",
+	Long: `Add a named session with a server URL, credentials and a branch, e.g.
+"stacksenv session add staging --server stacksenv.example.com --id my-env --branch staging".
+
+The secret and the secret key are prompted for, so they never appear on the
+command line. An existing session with the same name is replaced. With
+"--use", the session also becomes the active one.`,
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{managesSessionsAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if name == "" || strings.ContainsAny(name, " \t") {
+			return fmt.Errorf("invalid session name %q", name)
+		}
+		server, err := cmd.Flags().GetString("server")
+		if err != nil {
+			return err
+		}
+		id, err := cmd.Flags().GetString("id")
+		if err != nil {
+			return err
+		}
+		branch, err := cmd.Flags().GetString("branch")
+		if err != nil {
+			return err
+		}
+		use, err := cmd.Flags().GetBool("use")
+		if err != nil {
+			return err
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+		if server == "" {
+			server = v.GetString("serverurl")
+		}
+		if server == "" {
+			return errors.New("no server URL configured: pass it with --server")
+		}
+		if err := checkServerURL(server); err != nil {
+			return err
+		}
+		if id == "" {
+			if id, err = promptLine("Environment ID", ""); err != nil {
+				return err
+			}
+		}
+		secret, err := promptSecret("Secret")
+		if err != nil {
+			return err
+		}
+		secretKey, err := promptSecret("Secret key")
+		if err != nil {
+			return err
+		}
+		if id == "" || secret == "" || secretKey == "" {
+			return errors.New("environment ID, secret and secret key are required")
+		}
+
+		unlock, err := lockGlobalConfig()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		configData, format, err := readGlobalConfig()
+		if err != nil {
+			return err
+		}
+		section := globalConfigSection(configData, true)
+
+		session := map[string]interface{}{
+			"name":             name,
+			"serverurl":        server,
+			"stacksenv_id":     id,
+			"stacksenv_secret": secret,
+			"stacksenv_key":    secretKey,
+		}
+		if branch != "" {
+			session["stacksenv_branch"] = branch
+		}
+
+		sessions, _ := section[sessionsKey].([]interface{})
+		if i := sessionIndex(sessions, name); i >= 0 {
+			sessions[i] = session
+		} else {
+			sessions = append(sessions, session)
+		}
+		section[sessionsKey] = sessions
+		if use {
+			section[activeSessionKey] = name
+		}
+
+		if err := writeGlobalConfig(configData, format); err != nil {
+			return err
+		}
+
+		fmt.Printf("Added session %s\n", name)
+		if use {
+			fmt.Printf("Switched to session %s\n", name)
+		}
+		return nil
+	},
+}
+
+var sessionRemoveCmd = &cobra.Command{
+	Use:         "remove <name>",
+	Aliases:     []string{"rm"},
+	Short:       "Remove a session",
+	Long:        `Remove a session. If it is the active session, no session is active afterwards.`,
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{managesSessionsAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		if _, err := initViper(cmd); err != nil {
+			return err
+		}
+		unlock, err := lockGlobalConfig()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		configData, format, err := readGlobalConfig()
+		if err != nil {
+			return err
+		}
+		section := globalConfigSection(configData, false)
+
+		sessions, _ := section[sessionsKey].([]interface{})
+		i := sessionIndex(sessions, name)
+		if i < 0 {
+			return fmt.Errorf("no such session %q", name)
+		}
+		name = fmt.Sprint(sessions[i].(map[string]interface{})["name"])
+		section[sessionsKey] = append(sessions[:i], sessions[i+1:]...)
+
+		if active, _ := section[activeSessionKey].(string); strings.EqualFold(active, name) {
+			delete(section, activeSessionKey)
+		}
+
+		if err := writeGlobalConfig(configData, format); err != nil {
+			return err
+		}
+
+		fmt.Printf("Removed session %s\n", name)
+		return nil
+	},
+}
+
+var sessionUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Switch the active session",
+	Long: `Make a session the active one, so commands fetching the environment use its
+server URL, credentials and branch. With "--none", no session is active
+afterwards.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if none, _ := cmd.Flags().GetBool("none"); none {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	Annotations: map[string]string{managesSessionsAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := initViper(cmd); err != nil {
+			return err
+		}
+		unlock, err := lockGlobalConfig()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		configData, format, err := readGlobalConfig()
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 0 {
+			section := globalConfigSection(configData, false)
+			if _, ok := section[activeSessionKey]; !ok {
+				fmt.Println("No session is active")
+				return nil
+			}
+			delete(section, activeSessionKey)
+			if err := writeGlobalConfig(configData, format); err != nil {
+				return err
+			}
+			fmt.Println("Deactivated the active session")
+			return nil
+		}
+
+		section := globalConfigSection(configData, true)
+		sessions, _ := section[sessionsKey].([]interface{})
+		i := sessionIndex(sessions, args[0])
+		if i < 0 {
+			return fmt.Errorf("no such session %q", args[0])
+		}
+		name := fmt.Sprint(sessions[i].(map[string]interface{})["name"])
+		section[activeSessionKey] = name
+
+		if err := writeGlobalConfig(configData, format); err != nil {
+			return err
+		}
+
+		fmt.Printf("Switched to session %s\n", name)
+		return nil
+	},
+}
+
+// applySession merges the settings of the named session into the viper
+// instance.
+func applySession(v *viper.Viper, name string) error {
+	sessions, _ := v.Get(sessionsKey).([]interface{})
+	i := sessionIndex(sessions, name)
+	if i < 0 {
+		return fmt.Errorf("active session %q not found in the configuration: run \"stacksenv session use\" to switch sessions", name)
+	}
+
+	settings := make(map[string]interface{})
+	for key, value := range sessions[i].(map[string]interface{}) {
+		if !strings.EqualFold(key, "name") {
+			settings[key] = value
+		}
+	}
+	if err := v.MergeConfigMap(settings); err != nil {
+		return fmt.Errorf("failed to apply session %q: %w", name, err)
+	}
+
+	// Record the file defining the session; the last one wins like in viper
+	for i := len(loadedConfigSources) - 1; i >= 0; i-- {
+		source := loadedConfigSources[i]
+		configData, _, err := configStore.Read(source.Path)
+		if err != nil {
+			continue
+		}
+		if _, ok := lookupSession(configData, source.Profile, name); ok {
+			loadedConfigSources = append(loadedConfigSources, configSource{Scope: "session", Path: source.Path, Profile: source.Profile, Session: name})
+			break
+		}
+	}
+	debugLog("Using session: %s", name)
+	return nil
+}
+
+// lookupSession returns the named session of a configuration file, looking
+// in the section of profile if it isn't empty.
+func lookupSession(configData map[string]interface{}, profile, name string) (map[string]interface{}, bool) {
+	key := sessionsKey
+	if profile != "" {
+		key = "profiles." + profile + "." + sessionsKey
+	}
+	value, ok := configstore.Lookup(configData, key)
+	if !ok {
+		return nil, false
+	}
+	sessions, _ := value.([]interface{})
+	i := sessionIndex(sessions, name)
+	if i < 0 {
+		return nil, false
+	}
+	return sessions[i].(map[string]interface{}), true
+}
+
+// sessionIndex returns the index of the session with the given name, matched
+// case-insensitively, or -1.
+func sessionIndex(sessions []interface{}, name string) int {
+	for i, session := range sessions {
+		session, ok := session.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if sessionName, ok := session["name"].(string); ok && strings.EqualFold(sessionName, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sessionList returns the well-formed sessions of a configuration section.
+func sessionList(section map[string]interface{}) []map[string]interface{} {
+	sessions, _ := section[sessionsKey].([]interface{})
+
+	list := make([]map[string]interface{}, 0, len(sessions))
+	for _, session := range sessions {
+		if session, ok := session.(map[string]interface{}); ok {
+			if _, ok := session["name"].(string); ok {
+				list = append(list, session)
+			}
+		}
+	}
+	return list
+}
+
+// sessionValue returns a setting of a session for display.
+func sessionValue(session map[string]interface{}, key string) string {
+	if value, ok := session[key]; ok && value != nil {
+		return fmt.Sprint(value)
+	}
+	return ""
+}
@@ -1,36 +1,208 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"slices"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/configstore"
 )
 
 func init() {
 	rootCmd.AddCommand(setCmd)
-	setCmd.Flags().String("serverurl", "", "Set the server URL in the global configuration")
+	setCmd.Flags().String("serverurl", "", "Set the server URL (same as serverurl=<url>)")
+	setCmd.Flags().Bool("global", false, "write to the global configuration (default)")
+	setCmd.Flags().Bool("local", false, "write to the local project configuration (.stacksenv/config.json)")
+	setCmd.MarkFlagsMutuallyExclusive("global", "local")
 }
 
 var setCmd = &cobra.Command{
-	Use:   "set",
+	Use:   "set [--global|--local] <key>=<value>...",
 	Short: "Set a value for a key",
-	Long:  `Set a value for a key in the global configuration.`,
+	Long: `Set configuration values, e.g. "stacksenv set --local serverurl=stacksenv.example.com".
+
+Values are written to the global configuration (or the section of the
+selected profile), or to the local project configuration of the current
+directory with "--local". Files keep their format (JSON, YAML or TOML).
+
+Nested keys are addressed with dots (e.g. "remotes.staging=stacksenv://...").
+Values are stored as strings, except for true, false, numbers and JSON arrays
+and objects given for keys that don't require a string.`,
+	Annotations: map[string]string{inspectsConfigAnnotation: "true"},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		local, err := cmd.Flags().GetBool("local")
+		if err != nil {
+			return err
+		}
 		serverURL, err := cmd.Flags().GetString("serverurl")
 		if err != nil {
 			return err
 		}
-
-		// If serverurl flag is provided, update the global config
 		if serverURL != "" {
-			if err := updateGlobalConfig("serverurl", serverURL); err != nil {
+			args = append([]string{"serverurl=" + serverURL}, args...)
+		}
+		if len(args) == 0 {
+			return errors.New("nothing to set: pass <key>=<value> arguments")
+		}
+
+		keys := make([]string, 0, len(args))
+		values := make([]interface{}, 0, len(args))
+		for _, arg := range args {
+			key, raw, ok := strings.Cut(arg, "=")
+			key = strings.ToLower(strings.TrimSpace(key))
+			if !ok || key == "" {
+				return fmt.Errorf("invalid argument %q: expected <key>=<value>", arg)
+			}
+			value := parseConfigValue(key, raw)
+			if err := checkSetValue(key, value); err != nil {
 				return err
 			}
-			fmt.Printf("Successfully updated serverurl to: %s\n", serverURL)
-			return nil
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+
+		var configPath string
+		if local {
+			configPath, err = getLocalConfigPath()
+		} else {
+			configPath, err = getGlobalConfigPath()
+		}
+		if err != nil {
+			return err
+		}
+		if !local {
+			// Selects the profile, creating the global configuration on a
+			// fresh machine: before taking its lock, which that would take too
+			if _, err := initViper(cmd); err != nil {
+				return err
+			}
+		}
+
+		unlock, err := configStore.Lock(configPath)
+		if err != nil {
+			return err
 		}
+		defer unlock()
 
-		fmt.Println("set called with args:", args)
+		var configData map[string]interface{}
+		var format configstore.Format
+		if local {
+			configData, format, err = configStore.Read(configPath)
+		} else {
+			configData, format, err = readGlobalConfig()
+		}
+		if err != nil {
+			return err
+		}
+		if len(configData) == 0 {
+			configData[configstore.VersionKey] = currentConfigVersion()
+		}
+
+		section := configData
+		if !local {
+			section = globalConfigSection(configData, true)
+		}
+		for i, key := range keys {
+			if err := setConfigKey(section, key, values[i]); err != nil {
+				return err
+			}
+		}
+
+		if err := configStore.Write(configPath, configData, format); err != nil {
+			return err
+		}
+
+		for i, key := range keys {
+			value, err := formatConfigValue(values[i])
+			if err != nil {
+				return err
+			}
+			if isSensitiveConfigKey(key) {
+				value = "***"
+			}
+			fmt.Printf("Set %s to %s in %s\n", key, value, configPath)
+		}
 		return nil
 	},
 }
+
+// parseConfigValue converts the value of a <key>=<value> argument: JSON
+// literals other than strings are decoded unless key requires a string.
+func parseConfigValue(key, raw string) interface{} {
+	if slices.Contains(stringConfigKeys, key) {
+		return raw
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return raw
+	}
+	if _, isString := value.(string); isString {
+		return raw
+	}
+	return value
+}
+
+// checkSetValue validates a single value about to be set: errors are
+// returned, unknown keys are reported as warnings.
+func checkSetValue(key string, value interface{}) error {
+	configData := make(map[string]interface{})
+	if err := setConfigKey(configData, key, value); err != nil {
+		return err
+	}
+	// The value is checked as it will be loaded, unless that depends on
+	// variables set elsewhere, e.g. in CI
+	configData, unset := expandConfigValues(configData)
+	for _, name := range unset {
+		fmt.Fprintf(os.Stderr, "warning: %s: environment variable %s is unset and has no default\n", key, name)
+	}
+	if len(unset) > 0 {
+		return nil
+	}
+	for _, issue := range checkConfigData(configData) {
+		if issue.Severity == severityError {
+			return fmt.Errorf("%s: %s", issue.Key, issue.Message)
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s: %s\n", issue.Key, issue.Message)
+	}
+	return nil
+}
+
+// setConfigKey sets a dotted key in a configuration map, matching existing
+// segments case-insensitively like viper does and creating missing mappings.
+func setConfigKey(configData map[string]interface{}, key string, value interface{}) error {
+	segments := strings.Split(key, ".")
+	current := configData
+	for i, segment := range segments {
+		if segment == "" {
+			return fmt.Errorf("invalid configuration key %q", key)
+		}
+
+		existing := segment
+		for k := range current {
+			if strings.EqualFold(k, segment) {
+				existing = k
+				break
+			}
+		}
+
+		if i == len(segments)-1 {
+			delete(current, existing)
+			current[segment] = value
+			return nil
+		}
+
+		next, ok := current[existing]
+		if !ok || next == nil {
+			next = make(map[string]interface{})
+			current[existing] = next
+		}
+		if current, ok = next.(map[string]interface{}); !ok {
+			return fmt.Errorf("cannot set %s: %s is not a mapping", key, strings.Join(segments[:i+1], "."))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"os"
+	"runtime"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(shellCmd)
+	shellCmd.Flags().String("shell", "", "shell to start (defaults to $SHELL)")
+	addFilterFlags(shellCmd)
+	addForceFlag(shellCmd)
+}
+
+var shellCmd = &cobra.Command{
+	Use:   "shell",
+	Short: "Start a subshell with the environment loaded",
+	Long: `Start an interactive subshell with the environment variables fetched from
+the server, so commands can be run without prefixing them with stacksenv.
+
+The shell is taken from "--shell", then $SHELL, falling back to the platform
+default. STACKSENV_SHELL=1 and STACKSENV_BRANCH are set inside the subshell, so
+stacksenv commands run in it use the same branch. "--include", "--exclude"
+and the "include" and "exclude" configuration lists select the variables
+like for "stacksenv run".
+Exit the shell to return.
+
+If the branch matches a pattern of "protected_branches" (default ["prod",
+"production"]), "protected_shell" in the configuration tells what happens:
+
+  confirm  the branch name must be typed on a terminal to start the shell
+           (default); without a terminal, stacksenv fails instead
+  deny     the shell is never started, use "stacksenv run" for commands
+  allow    the shell is started
+
+The shell of a protected branch gets STACKSENV_PROTECTED set to the branch
+and a red PROTECTED marker in front of its prompt (bash, zsh, POSIX shells
+and cmd), unless its startup files replace the prompt. The same applies to
+"stacksenv run" and "stacksenv <command>" starting an interactive shell, e.g.
+"stacksenv run -- bash".
+
+As the values can be printed in the shell, it isn't started on a terminal
+whose session is being recorded, unless "--force" is set; the whole shell
+session is then wrapped in redaction markers.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		recording, err := checkRecording(cmd)
+		if err != nil {
+			return err
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+
+		config, err := resolveStacksenvConfig(v)
+		if err != nil {
+			return err
+		}
+		shell := resolveShell(v.GetString("shell"))
+		marker, err := guardProtectedShell(v, config.Branch, shell)
+		if err != nil {
+			return err
+		}
+		properties, err := fetchContextData(v)
+		if err != nil {
+			return err
+		}
+		filter, err := newVariableFilter(v)
+		if err != nil {
+			return err
+		}
+		if filter != nil {
+			properties = filter.apply(properties)
+		}
+
+		env := contextDataToEnv(properties)
+		env = append(env, "STACKSENV_SHELL=1", branchEnvVar+"="+config.Branch)
+		env = append(env, marker...)
+
+		endRedacted := startRedacted(recording)
+		defer endRedacted()
+		return executeInForeground(shell, nil, env)
+	},
+}
+
+// resolveShell returns the shell to start: the explicit choice, then $SHELL,
+// then the platform default.
+func resolveShell(shell string) string {
+	if shell != "" {
+		return shell
+	}
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	if runtime.GOOS == "windows" {
+		if comspec := os.Getenv("COMSPEC"); comspec != "" {
+			return comspec
+		}
+		return "cmd.exe"
+	}
+	return "/bin/sh"
+}
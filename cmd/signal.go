@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+// signalContext returns a context cancelled when stacksenv is interrupted or
+// asked to terminate, to abort what it is doing.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// commandContext returns a context for fetching an environment and running a
+// command with it in the foreground. It is cancelled when stacksenv is asked to
+// terminate, or interrupted before commandStarted is called.
+//
+// Interrupts received once the command has started are ignored: the terminal
+// sends them to the command as well, and interactive programs such as shells
+// handle them without exiting.
+func commandContext() (ctx context.Context, commandStarted func(), stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	var started atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig == os.Interrupt && started.Load() {
+					continue
+				}
+				debugLog("Received %v, stopping", sig)
+				cancel()
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	stop = func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+	return ctx, func() { started.Store(true) }, stop
+}
+
+// handleInForeground fetches the environment with handler, if url is set, and
+// runs the command in the foreground with it, as described by commandContext.
+func handleInForeground(handler *stacksenv.Handler, url string, args []string) error {
+	ctx, commandStarted, stop := commandContext()
+	defer stop()
+
+	started := false
+	onStart := handler.OnStart
+	if url != "" {
+		onStart = publishingStart(onStart)
+	}
+	handler.OnStart = func(branch string, env []string) {
+		started = true
+		commandStarted()
+		if onStart != nil {
+			onStart(branch, env)
+		}
+	}
+	err := handler.HandleStacksenvURLCLIContext(ctx, url, args)
+	if !started && ctx.Err() != nil {
+		return errors.New("interrupted while fetching the environment")
+	}
+	return err
+}
+
+// executeInForeground runs a command in the foreground with the given
+// environment entries. It is stopped if stacksenv is asked to terminate.
+func executeInForeground(command string, args []string, env []string) error {
+	ctx, commandStarted, stop := commandContext()
+	defer stop()
+
+	commandStarted()
+	return stacksenv.ExecuteWithContext(ctx, stacksenv.NewCommandExecutor(), command, args, env)
+}
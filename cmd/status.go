@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the resolved configuration",
+	Long: `Show which configuration files were merged, the resolved server URL,
+environment ID and branch, whether credentials are configured and whether a
+local cache exists.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Config files:")
+		if len(loadedConfigSources) == 0 {
+			fmt.Println("  (none)")
+		}
+		for _, source := range loadedConfigSources {
+			if source.Session != "" {
+				fmt.Printf("  %-8s %s (%s)\n", source.Scope, source.Path, source.Session)
+				continue
+			}
+			if source.Profile != "" {
+				fmt.Printf("  %-8s %s (%s)\n", source.Scope, source.Path, source.Profile)
+				continue
+			}
+			fmt.Printf("  %-8s %s\n", source.Scope, source.Path)
+		}
+		fmt.Println()
+
+		if activeProfile != "" {
+			fmt.Printf("Profile: %s\n", activeProfile)
+		}
+		if activeSession != "" {
+			fmt.Printf("Session: %s\n", activeSession)
+		}
+		if activeProfile != "" || activeSession != "" {
+			fmt.Println()
+		}
+
+		serverURL := v.GetString("serverurl")
+		id, branch, auth := "(not set)", "(not set)", "not configured"
+		url, err := resolveStacksenvURL(v)
+		if err != nil {
+			return err
+		}
+		if url != "" {
+			config, err := stacksenv.ParseURL(strings.TrimPrefix(url, "stacksenv://"))
+			if err != nil {
+				auth = fmt.Sprintf("invalid credentials (%v)", err)
+			} else {
+				serverURL, id, branch = config.ServerURL, config.ID, config.Branch
+				auth = "credentials configured"
+			}
+		}
+		if serverURL == "" {
+			serverURL = "(not set)"
+		}
+
+		fmt.Printf("Server URL:   %s\n", serverURL)
+		fmt.Printf("Environment:  %s\n", id)
+		fmt.Printf("Branch:       %s\n", branch)
+		fmt.Printf("Auth:         %s\n", auth)
+		fmt.Printf("Cache:        %s\n", cacheStatus())
+		return nil
+	},
+}
+
+// cacheStatus describes the contents of the offline cache.
+func cacheStatus() string {
+	entries, err := readCacheEntries()
+	if err != nil {
+		return "unknown"
+	}
+	if len(entries) == 0 {
+		return "none"
+	}
+
+	var total int64
+	for _, entry := range entries {
+		total += entry.size
+	}
+	return fmt.Sprintf("%d environments, %s", len(entries), formatByteSize(total))
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+)
+
+// The data stacksenv keeps about the environments it fetches, the offline
+// cache and the audit log, is namespaced by tenant: the server and the
+// environment ID of the credentials. Each tenant has its own directory under
+// <data dir>/tenants, so that nothing of one tenant is mixed with the data of
+// another, and "stacksenv purge" can remove all of it at once.
+//
+// Earlier versions kept the data of every tenant in <data dir>/cache and
+// <data dir>/audit.log. These shared locations are still read, and purged, but
+// no longer written.
+
+// tenantsDirName is the directory of the data dir holding the tenant
+// directories.
+const tenantsDirName = "tenants"
+
+// tenantKey returns the name of the directory of a tenant: a hash of its
+// server and environment ID, so it doesn't reveal them.
+func tenantKey(server, environment string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(server) + "\x00" + environment))
+	return hex.EncodeToString(sum[:16])
+}
+
+// getTenantsDir returns the directory holding the tenant directories.
+func getTenantsDir() (string, error) {
+	dataDir, err := getDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, tenantsDirName), nil
+}
+
+// getTenantDir returns the directory of the data of a tenant.
+func getTenantDir(server, environment string) (string, error) {
+	tenantsDir, err := getTenantsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(tenantsDir, tenantKey(server, environment)), nil
+}
+
+// sameTenant reports whether two servers and environment IDs designate the
+// same tenant. Server names are matched case-insensitively.
+func sameTenant(server, environment, otherServer, otherEnvironment string) bool {
+	return strings.EqualFold(server, otherServer) && environment == otherEnvironment
+}
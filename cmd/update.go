@@ -14,6 +14,7 @@ import (
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/term"
 	"github.com/stacksenv/cli/version"
 )
 
@@ -37,23 +38,58 @@ func init() {
 var updateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "Update the stacksenv CLI",
-	Long:  `Update the stacksenv CLI to the latest version.`,
-	RunE: func(_ *cobra.Command, _ []string) error {
-		return performUpdate()
+	Long: `Update the stacksenv CLI to the latest version.
+
+With "--verify", the downloaded archive is verified like "stacksenv update
+verify" does before it is installed, and the update fails if the release
+doesn't publish signed attestations.`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		verify, err := cmd.Flags().GetBool("verify")
+		if err != nil {
+			return err
+		}
+		var verifier *releaseVerifier
+		if verify {
+			v, err := initViper(cmd)
+			if err != nil {
+				return err
+			}
+			if verifier, err = newReleaseVerifier(cmd, v); err != nil {
+				return err
+			}
+		}
+		return performUpdate(quiet, verifier)
 	},
 }
 
 var updateCheckCmd = &cobra.Command{
 	Use:   "check",
 	Short: "Check for updates",
-	Long:  `Check if a newer version of stacksenv is available.`,
-	RunE: func(_ *cobra.Command, _ []string) error {
-		return checkForUpdates()
+	Long: `Check if a newer version of stacksenv is available.
+
+The check also fetches the advisories feed of the CLI and shows the notices
+applying to the installed version: security fixes, versions reaching their
+end of life and deprecations. Set "advisories_url" to read the feed from a
+mirror.`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+		feedURL := v.GetString(advisoriesURLKey)
+		if feedURL == "" {
+			feedURL = advisoriesURL
+		}
+		return checkForUpdates(quiet, feedURL)
 	},
 }
 
-// checkForUpdates checks if a newer version is available and displays the result.
-func checkForUpdates() error {
+// checkForUpdates checks if a newer version is available and displays the
+// result, followed by the advisories of the feed at feedURL applying to the
+// installed version.
+func checkForUpdates(quiet bool, feedURL string) error {
 	currentVersion := version.Version
 	if currentVersion == "(untracked)" {
 		fmt.Println("Current version: (development build)")
@@ -61,7 +97,7 @@ func checkForUpdates() error {
 		fmt.Printf("Current version: %s\n", currentVersion)
 	}
 
-	latestRelease, err := getLatestRelease()
+	latestRelease, err := getLatestReleaseWithSpinner(quiet)
 	if err != nil {
 		return fmt.Errorf("failed to check for updates: %w", err)
 	}
@@ -80,15 +116,18 @@ func checkForUpdates() error {
 		fmt.Println("\n✓ You are running the latest version")
 	}
 
+	printAdvisories(feedURL, currentVersion)
 	return nil
 }
 
-// performUpdate downloads and installs the latest version of stacksenv.
-func performUpdate() error {
+// performUpdate downloads and installs the latest version of stacksenv,
+// verifying the downloaded archive first with verifier if it isn't nil; see
+// verifyReleaseArtifact.
+func performUpdate(quiet bool, verifier *releaseVerifier) error {
 	currentVersion := version.Version
 	fmt.Printf("Current version: %s\n", currentVersion)
 
-	latestRelease, err := getLatestRelease()
+	latestRelease, err := getLatestReleaseWithSpinner(quiet)
 	if err != nil {
 		return fmt.Errorf("failed to get latest release: %w", err)
 	}
@@ -114,17 +153,26 @@ func performUpdate() error {
 	fmt.Printf("Downloading %s...\n", assetName)
 
 	// Download the archive
-	tmpDir, err := os.MkdirTemp("", "stacksenv-update-*")
+	tmpDir, err := os.MkdirTemp("", updateTempPrefix+"*")
 	if err != nil {
 		return fmt.Errorf("failed to create temp directory: %w", err)
 	}
 	defer os.RemoveAll(tmpDir)
 
 	archivePath := filepath.Join(tmpDir, assetName)
-	if err := downloadFile(assetURL, archivePath); err != nil {
+	if err := downloadFile(assetURL, archivePath, quiet); err != nil {
 		return fmt.Errorf("failed to download release: %w", err)
 	}
 
+	if verifier != nil {
+		fmt.Println("Verifying...")
+		result, err := verifyReleaseArtifact(verifier, latestRelease, archivePath, assetName)
+		if err != nil {
+			return fmt.Errorf("release verification failed: %w", err)
+		}
+		printReleaseVerification(assetName, latestRelease, result)
+	}
+
 	fmt.Println("Extracting...")
 
 	// Extract the binary
@@ -166,9 +214,23 @@ func performUpdate() error {
 	return nil
 }
 
+// getLatestReleaseWithSpinner fetches the latest release while showing a spinner.
+func getLatestReleaseWithSpinner(quiet bool) (*githubRelease, error) {
+	spinner := term.NewSpinner(os.Stderr, "Checking for updates...", quiet)
+	spinner.Start()
+	defer spinner.Stop()
+
+	return getLatestRelease()
+}
+
 // getLatestRelease fetches the latest release information from GitHub API.
 func getLatestRelease() (*githubRelease, error) {
-	resp, err := http.Get(githubAPIURL)
+	return getReleaseFrom(githubAPIURL)
+}
+
+// getReleaseFrom fetches release information from a GitHub API URL.
+func getReleaseFrom(url string) (*githubRelease, error) {
+	resp, err := http.Get(url)
 	if err != nil {
 		return nil, err
 	}
@@ -238,8 +300,9 @@ func findAsset(release *githubRelease, osName, arch string) (string, string, err
 	return "", "", fmt.Errorf("no asset found for %s/%s", osName, arch)
 }
 
-// downloadFile downloads a file from a URL to a local path.
-func downloadFile(url, dest string) error {
+// downloadFile downloads a file from a URL to a local path, reporting the
+// download progress on a terminal unless quiet is set.
+func downloadFile(url, dest string, quiet bool) error {
 	resp, err := http.Get(url)
 	if err != nil {
 		return err
@@ -256,7 +319,9 @@ func downloadFile(url, dest string) error {
 	}
 	defer out.Close()
 
-	_, err = io.Copy(out, resp.Body)
+	progress := term.NewProgressWriter(os.Stderr, "Downloading", resp.ContentLength, quiet)
+	_, err = io.Copy(out, io.TeeReader(resp.Body, progress))
+	progress.Done()
 	return err
 }
 
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+const (
+	// advisoriesURL is the default location of the advisories feed.
+	advisoriesURL = "https://raw.githubusercontent.com/stacksenv/cli/main/advisories.json"
+
+	// advisoriesURLKey is the configuration key replacing advisoriesURL, e.g.
+	// with a mirror reachable from a network without Internet access.
+	advisoriesURLKey = "advisories_url"
+
+	// advisoriesTimeout bounds the request fetching the advisories feed, so
+	// an unreachable feed doesn't hold up "stacksenv update check".
+	advisoriesTimeout = 10 * time.Second
+
+	// maxAdvisoriesSize caps the size of the advisories feed read.
+	maxAdvisoriesSize = 1 << 20
+)
+
+// Kinds of advisories.
+const (
+	advisorySecurity    = "security"
+	advisoryEOL         = "eol"
+	advisoryDeprecation = "deprecation"
+)
+
+// advisory is a notice about some versions of the CLI: a security fix, the
+// end of life of a version or a deprecation.
+type advisory struct {
+	ID      string `json:"id"`
+	Kind    string `json:"kind"`
+	Summary string `json:"summary"`
+	URL     string `json:"url,omitempty"`
+	// Introduced is the first affected version; empty if all versions before
+	// Fixed are affected.
+	Introduced string `json:"introduced,omitempty"`
+	// Fixed is the first version not affected; empty if no version is, e.g.
+	// for a deprecation announced for all versions.
+	Fixed string `json:"fixed,omitempty"`
+}
+
+// advisoriesFeed is the document served at advisoriesURL.
+type advisoriesFeed struct {
+	Advisories []advisory `json:"advisories"`
+}
+
+// affects reports whether the advisory applies to version.
+func (a advisory) affects(version string) bool {
+	if a.Introduced != "" && stacksenv.CompareVersions(version, a.Introduced) < 0 {
+		return false
+	}
+	return a.Fixed == "" || stacksenv.CompareVersions(version, a.Fixed) < 0
+}
+
+// getAdvisories fetches the advisories feed at url.
+func getAdvisories(url string) ([]advisory, error) {
+	client := &http.Client{Timeout: advisoriesTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var feed advisoriesFeed
+	if err := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, maxAdvisoriesSize)).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("invalid advisories feed: %w", err)
+	}
+	return feed.Advisories, nil
+}
+
+// relevantAdvisories returns the advisories applying to version, security
+// fixes first.
+func relevantAdvisories(advisories []advisory, version string) []advisory {
+	var relevant []advisory
+	for _, a := range advisories {
+		if a.affects(version) {
+			relevant = append(relevant, a)
+		}
+	}
+	rank := func(a advisory) int {
+		switch a.Kind {
+		case advisorySecurity:
+			return 0
+		case advisoryEOL:
+			return 1
+		case advisoryDeprecation:
+			return 2
+		}
+		return 3
+	}
+	slices.SortStableFunc(relevant, func(a, b advisory) int { return rank(a) - rank(b) })
+	return relevant
+}
+
+// printAdvisories fetches the advisories feed and prints the notices applying
+// to version. A feed that can't be fetched is reported as a warning: the
+// update check itself succeeded.
+func printAdvisories(url, version string) {
+	advisories, err := getAdvisories(url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to check for advisories: %v\n", err)
+		return
+	}
+	relevant := relevantAdvisories(advisories, version)
+	if len(relevant) == 0 {
+		return
+	}
+
+	fmt.Printf("\n⚠ Advisories for version %s:\n", version)
+	for _, a := range relevant {
+		kind := a.Kind
+		if kind == "" {
+			kind = "notice"
+		}
+		line := fmt.Sprintf("  [%s] %s", strings.ToUpper(kind), a.Summary)
+		if a.ID != "" {
+			line = fmt.Sprintf("  [%s] %s: %s", strings.ToUpper(kind), a.ID, a.Summary)
+		}
+		switch {
+		case a.Fixed != "" && a.Kind == advisorySecurity:
+			line += fmt.Sprintf(" (fixed in %s)", a.Fixed)
+		case a.Fixed != "":
+			line += fmt.Sprintf(" (upgrade to %s or later)", a.Fixed)
+		}
+		fmt.Println(line)
+		if a.URL != "" {
+			fmt.Printf("      %s\n", a.URL)
+		}
+	}
+}
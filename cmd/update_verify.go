@@ -0,0 +1,542 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+const (
+	// githubReleaseTagURL is the GitHub API URL of the release of a tag.
+	githubReleaseTagURL = "https://api.github.com/repos/stacksenv/cli/releases/tags/%s"
+
+	// releaseSourceRepo is the repository release artifacts must be built
+	// from, as recorded by their provenance.
+	releaseSourceRepo = "github.com/stacksenv/cli"
+
+	// checksumsAsset is the name of the release asset listing the SHA-256
+	// digests of the other assets, in the format of sha256sum, for the
+	// version of the release: the default of goreleaser.
+	checksumsAsset = "stacksenv_%s_checksums.txt"
+	// provenanceSuffix and sbomSuffix are appended to the name of an asset
+	// to get the names of its SLSA provenance and SBOM attestations: DSSE
+	// envelopes of in-toto statements, one per line.
+	provenanceSuffix = ".intoto.jsonl"
+	sbomSuffix       = ".sbom.intoto.jsonl"
+
+	// releaseKeyKey is the configuration key naming the PEM public key the
+	// attestations of releases must be signed with, instead of the embedded
+	// releasePublicKey.
+	releaseKeyKey = "release_key"
+
+	// maxAttestationSize caps the size of the checksums and attestation
+	// assets read.
+	maxAttestationSize = 4 << 20
+)
+
+// releasePublicKey is the public key the attestations of releases are signed
+// with, base64-encoded in the PKIX DER format. It is set at build time with
+// -ldflags "-X github.com/stacksenv/cli/cmd.releasePublicKey=...": builds
+// without it can only verify releases against a key given with --key or
+// release_key.
+var releasePublicKey = ""
+
+// inTotoPayloadType is the DSSE payload type of in-toto statements.
+const inTotoPayloadType = "application/vnd.in-toto+json"
+
+// dsseEnvelope is a signed attestation.
+type dsseEnvelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     string `json:"payload"`
+	Signatures  []struct {
+		KeyID string `json:"keyid"`
+		Sig   string `json:"sig"`
+	} `json:"signatures"`
+}
+
+// inTotoStatement is the payload of an attestation: a predicate about its
+// subjects, the artifacts it was made for.
+type inTotoStatement struct {
+	Subject []struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+// releaseVerification is the outcome of verifyReleaseArtifact.
+type releaseVerification struct {
+	Digest  string // SHA-256 digest of the artifact
+	Builder string // ID of the builder recorded by the provenance
+	Source  string // source the provenance says the artifact was built from
+	SBOM    string // predicate type of the SBOM attestation, empty without one
+}
+
+// releaseVerifier holds what verifyReleaseArtifact needs: the key the
+// attestations must be signed with and the client fetching them.
+type releaseVerifier struct {
+	key        crypto.PublicKey
+	httpClient stacksenv.HTTPClient
+}
+
+func init() {
+	updateCmd.AddCommand(updateVerifyCmd)
+	updateCmd.Flags().Bool("verify", false, "verify the provenance of the update before installing it")
+	updateCmd.Flags().String("key", "", "PEM public key the release attestations must be signed with (default \"release_key\", then the embedded key)")
+	updateVerifyCmd.Flags().String("release", "", "tag of the release to verify against (default the latest release)")
+	updateVerifyCmd.Flags().String("key", "", "PEM public key the release attestations must be signed with (default \"release_key\", then the embedded key)")
+}
+
+var updateVerifyCmd = &cobra.Command{
+	Use:   "verify [archive]",
+	Short: "Verify a release archive against its provenance",
+	Long: `Verify a release archive against the attestations published with it, before
+installing it.
+
+Without an argument, the archive of the latest release for this platform is
+downloaded and verified; with "--release", the archive of that release. The
+archive:
+
+  - must have the SHA-256 digest listed for it in
+    stacksenv_<version>_checksums.txt
+  - must be the subject of the SLSA provenance <archive>.intoto.jsonl, which
+    must record it was built from github.com/stacksenv/cli at the release tag
+  - must be the subject of the SBOM attestation <archive>.sbom.intoto.jsonl,
+    if the release publishes one
+
+The attestations must carry a valid signature by the release key embedded in
+the CLI, or by the PEM public key (ECDSA, Ed25519 or RSA) of "--key" or
+"release_key" if set. Releases that don't publish signed attestations fail the
+verification.
+
+"stacksenv update --verify" runs the same verification before installing.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		tag, err := cmd.Flags().GetString("release")
+		if err != nil {
+			return err
+		}
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+		verifier, err := newReleaseVerifier(cmd, v)
+		if err != nil {
+			return err
+		}
+
+		release, err := getRelease(tag, quiet)
+		if err != nil {
+			return fmt.Errorf("failed to get release: %w", err)
+		}
+
+		var archivePath, assetName string
+		if len(args) == 1 {
+			archivePath, assetName = args[0], filepath.Base(args[0])
+		} else {
+			osName, arch := getOSArch()
+			var assetURL string
+			if assetURL, assetName, err = findAsset(release, osName, arch); err != nil {
+				return fmt.Errorf("failed to find release asset: %w", err)
+			}
+			tmpDir, err := os.MkdirTemp("", verifyTempPrefix+"*")
+			if err != nil {
+				return fmt.Errorf("failed to create temp directory: %w", err)
+			}
+			defer os.RemoveAll(tmpDir)
+			archivePath = filepath.Join(tmpDir, assetName)
+			if err := downloadFile(assetURL, archivePath, quiet); err != nil {
+				return fmt.Errorf("failed to download release: %w", err)
+			}
+		}
+
+		result, err := verifyReleaseArtifact(verifier, release, archivePath, assetName)
+		if err != nil {
+			return fmt.Errorf("%s: verification failed: %w", assetName, err)
+		}
+		printReleaseVerification(assetName, release, result)
+		return nil
+	},
+}
+
+// getRelease fetches the release of tag, or the latest release if tag is
+// empty, while showing a spinner.
+func getRelease(tag string, quiet bool) (*githubRelease, error) {
+	if tag == "" {
+		return getLatestReleaseWithSpinner(quiet)
+	}
+	if !strings.HasPrefix(tag, "v") {
+		tag = "v" + tag
+	}
+	return getReleaseFrom(fmt.Sprintf(githubReleaseTagURL, tag))
+}
+
+// newReleaseVerifier returns the verifier of releases for the --key flag of
+// cmd and the configuration of v.
+func newReleaseVerifier(cmd *cobra.Command, v *viper.Viper) (*releaseVerifier, error) {
+	key, err := releaseKey(cmd, v.GetString(releaseKeyKey))
+	if err != nil {
+		return nil, err
+	}
+	httpClient, err := newHTTPClient(v)
+	if err != nil {
+		return nil, err
+	}
+	return &releaseVerifier{key: key, httpClient: httpClient}, nil
+}
+
+// releaseKey returns the public key release attestations must be signed
+// with: the one of the --key flag, or of the file configured, or the
+// embedded releasePublicKey.
+func releaseKey(cmd *cobra.Command, configured string) (crypto.PublicKey, error) {
+	path, err := cmd.Flags().GetString("key")
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = configured
+	}
+	if path == "" {
+		return embeddedReleaseKey()
+	}
+
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read release key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("release key %s is not a PEM file", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid release key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// embeddedReleaseKey returns the public key embedded in the CLI at build time.
+func embeddedReleaseKey() (crypto.PublicKey, error) {
+	if releasePublicKey == "" {
+		return nil, fmt.Errorf("this build of the CLI embeds no release key: set --key or %q to the release public key", releaseKeyKey)
+	}
+	der, err := base64.StdEncoding.DecodeString(releasePublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedded release key: %w", err)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedded release key: %w", err)
+	}
+	return key, nil
+}
+
+// verifyReleaseArtifact verifies the archive at path, published as the asset
+// named name of release, against the checksums and the attestations of the
+// release, which must be signed with the key of verifier.
+func verifyReleaseArtifact(verifier *releaseVerifier, release *githubRelease, path, name string) (*releaseVerification, error) {
+	digest, err := fileSHA256(path)
+	if err != nil {
+		return nil, err
+	}
+	result := &releaseVerification{Digest: digest}
+
+	checksumsName := checksumsAssetName(release)
+	checksums, err := fetchReleaseAsset(verifier.httpClient, release, checksumsName)
+	if err != nil {
+		return nil, err
+	}
+	listed, ok := parseChecksums(checksums)[name]
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't list %s", checksumsName, name)
+	}
+	if !strings.EqualFold(listed, digest) {
+		return nil, fmt.Errorf("SHA-256 digest %s doesn't match %s listed in %s", digest, listed, checksumsName)
+	}
+
+	provenance, err := fetchReleaseAsset(verifier.httpClient, release, name+provenanceSuffix)
+	if err != nil {
+		return nil, err
+	}
+	statement, err := verifiedStatement(provenance, name, digest, verifier.key)
+	if err != nil {
+		return nil, fmt.Errorf("provenance: %w", err)
+	}
+	if !strings.HasPrefix(statement.PredicateType, "https://slsa.dev/provenance/") {
+		return nil, fmt.Errorf("provenance: unexpected predicate type %q", statement.PredicateType)
+	}
+	if result.Builder, result.Source, err = provenanceOrigin(statement); err != nil {
+		return nil, fmt.Errorf("provenance: %w", err)
+	}
+	if !isReleaseSource(result.Source, release.TagName) {
+		return nil, fmt.Errorf("provenance: built from %s, not from %s at %s", result.Source, releaseSourceRepo, release.TagName)
+	}
+
+	if _, published := releaseAssetURL(release, name+sbomSuffix); published {
+		sbom, err := fetchReleaseAsset(verifier.httpClient, release, name+sbomSuffix)
+		if err != nil {
+			return nil, err
+		}
+		statement, err := verifiedStatement(sbom, name, digest, verifier.key)
+		if err != nil {
+			return nil, fmt.Errorf("SBOM: %w", err)
+		}
+		result.SBOM = statement.PredicateType
+	}
+	return result, nil
+}
+
+// printReleaseVerification prints the outcome of a successful verification.
+func printReleaseVerification(name string, release *githubRelease, result *releaseVerification) {
+	fmt.Printf("✓ %s matches the SHA-256 digest %s listed in %s of %s\n", name, result.Digest, checksumsAssetName(release), release.TagName)
+	fmt.Printf("✓ SLSA provenance: built by %s from %s\n", result.Builder, result.Source)
+	if result.SBOM != "" {
+		fmt.Printf("✓ SBOM attestation: %s\n", result.SBOM)
+	} else {
+		fmt.Println("- No SBOM attestation is published for this release")
+	}
+	fmt.Println("✓ Attestations signed by the release key")
+}
+
+// verifiedStatement returns the in-toto statement of the attestations in
+// data, one DSSE envelope per line, made for the artifact named name with the
+// given SHA-256 digest and signed with key.
+func verifiedStatement(data []byte, name, digest string, key crypto.PublicKey) (*inTotoStatement, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxAttestationSize)
+	var lastErr error = errors.New("no attestation found")
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		statement, err := parseAttestation(line, key)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, subject := range statement.Subject {
+			if subject.Name == name && strings.EqualFold(subject.Digest["sha256"], digest) {
+				return statement, nil
+			}
+		}
+		lastErr = fmt.Errorf("no attestation has %s with digest %s as subject", name, digest)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, lastErr
+}
+
+// parseAttestation decodes a DSSE envelope holding an in-toto statement and
+// verifies its signature by key.
+func parseAttestation(line []byte, key crypto.PublicKey) (*inTotoStatement, error) {
+	var envelope dsseEnvelope
+	if err := json.Unmarshal(line, &envelope); err != nil {
+		return nil, fmt.Errorf("invalid attestation: %w", err)
+	}
+	if envelope.PayloadType != inTotoPayloadType {
+		return nil, fmt.Errorf("unexpected attestation payload type %q", envelope.PayloadType)
+	}
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation payload: %w", err)
+	}
+
+	pae := dssePAE(envelope.PayloadType, payload)
+	signed := false
+	for _, signature := range envelope.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(signature.Sig)
+		if err == nil && verifySignature(key, pae, sig) {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return nil, errors.New("attestation isn't signed by the release key")
+	}
+
+	var statement inTotoStatement
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		return nil, fmt.Errorf("invalid in-toto statement: %w", err)
+	}
+	return &statement, nil
+}
+
+// dssePAE returns the pre-authentication encoding of a DSSE payload, the
+// message its signatures sign.
+func dssePAE(payloadType string, payload []byte) []byte {
+	return fmt.Appendf(nil, "DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload)
+}
+
+// verifySignature reports whether sig is a valid signature of message by key.
+func verifySignature(key crypto.PublicKey, message, sig []byte) bool {
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, message, sig)
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(message)
+		return ecdsa.VerifyASN1(key, sum[:], sig)
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(message)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig) == nil || rsa.VerifyPSS(key, crypto.SHA256, sum[:], sig, nil) == nil
+	}
+	return false
+}
+
+// provenanceOrigin returns the builder ID and the source recorded by a SLSA
+// provenance statement, in the v0.2 or v1 format.
+func provenanceOrigin(statement *inTotoStatement) (string, string, error) {
+	var predicate struct {
+		// SLSA provenance v0.2
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Invocation struct {
+			ConfigSource struct {
+				URI string `json:"uri"`
+			} `json:"configSource"`
+		} `json:"invocation"`
+		// SLSA provenance v1
+		RunDetails struct {
+			Builder struct {
+				ID string `json:"id"`
+			} `json:"builder"`
+		} `json:"runDetails"`
+		BuildDefinition struct {
+			ExternalParameters struct {
+				Workflow struct {
+					Repository string `json:"repository"`
+					Ref        string `json:"ref"`
+				} `json:"workflow"`
+			} `json:"externalParameters"`
+		} `json:"buildDefinition"`
+	}
+	if err := json.Unmarshal(statement.Predicate, &predicate); err != nil {
+		return "", "", fmt.Errorf("invalid predicate: %w", err)
+	}
+
+	if uri := predicate.Invocation.ConfigSource.URI; uri != "" {
+		return predicate.Builder.ID, uri, nil
+	}
+	if workflow := predicate.BuildDefinition.ExternalParameters.Workflow; workflow.Repository != "" {
+		return predicate.RunDetails.Builder.ID, workflow.Repository + "@" + workflow.Ref, nil
+	}
+	return "", "", errors.New("the source of the build isn't recorded")
+}
+
+// isReleaseSource reports whether the source of a build recorded in its
+// provenance, "<repository URI>@<ref>", is exactly the tag of the release in
+// the repository of the CLI, e.g.
+// "git+https://github.com/stacksenv/cli@refs/tags/v1.2.0".
+func isReleaseSource(source, tag string) bool {
+	repository, ok := strings.CutSuffix(source, "@refs/tags/"+tag)
+	if !ok {
+		return false
+	}
+	u, err := neturl.Parse(strings.TrimPrefix(repository, "git+"))
+	if err != nil || u.Scheme != "https" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return false
+	}
+	path := strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git")
+	return strings.ToLower(u.Host)+path == releaseSourceRepo
+}
+
+// checksumsAssetName returns the name of the checksums asset of release.
+func checksumsAssetName(release *githubRelease) string {
+	return fmt.Sprintf(checksumsAsset, strings.TrimPrefix(release.TagName, "v"))
+}
+
+// parseChecksums parses a checksums file in the format of sha256sum into a
+// map of file names to digests.
+func parseChecksums(data []byte) map[string]string {
+	checksums := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		// A leading '*' marks files hashed in binary mode
+		checksums[strings.TrimPrefix(fields[1], "*")] = fields[0]
+	}
+	return checksums
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 digest of a file.
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// releaseAssetURL returns the download URL of the asset of release named name.
+func releaseAssetURL(release *githubRelease, name string) (string, bool) {
+	for _, asset := range release.Assets {
+		if asset.Name == name {
+			return asset.BrowserDownloadURL, true
+		}
+	}
+	return "", false
+}
+
+// fetchReleaseAsset downloads a small asset of release, such as its
+// checksums, with httpClient.
+func fetchReleaseAsset(httpClient stacksenv.HTTPClient, release *githubRelease, name string) ([]byte, error) {
+	url, ok := releaseAssetURL(release, name)
+	if !ok {
+		return nil, fmt.Errorf("release %s doesn't publish %s", release.TagName, name)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: unexpected status code: %d", name, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAttestationSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	if len(data) > maxAttestationSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", name, maxAttestationSize)
+	}
+	return data, nil
+}
@@ -2,12 +2,17 @@ package cmd
 
 import (
 	"bufio"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"maps"
+	"math"
+	neturl "net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/samber/lo"
@@ -15,8 +20,10 @@ import (
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/stacksenv/cli/config"
+	"github.com/stacksenv/cli/pkg/configstore"
 	"github.com/stacksenv/cli/pkg/homedir"
-	"go.yaml.in/yaml/v3"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+	"github.com/stacksenv/cli/pkg/term"
 )
 
 // debugEnabled stores whether debug logging is enabled.
@@ -37,6 +44,25 @@ func debugLogLn(v ...interface{}) {
 	}
 }
 
+// newLogger returns the logger of the stacksenv package: its messages go to
+// standard error, debug messages only with --debug.
+func newLogger() stacksenv.Logger {
+	return stacksenv.NewWriterLogger(os.Stderr, debugEnabled)
+}
+
+// logRequestID logs the request ID and the cause of a failed server
+// operation under --debug. The error is returned unchanged: its message
+// already ends with the request ID, so it can be matched against server logs.
+// The request IDs of successful operations are logged under --debug by the
+// client service.
+func logRequestID(err error) error {
+	var reqErr *stacksenv.RequestError
+	if errors.As(err, &reqErr) {
+		debugLog("Request %s failed: %v", reqErr.RequestID, reqErr.Err)
+	}
+	return err
+}
+
 // generateEnvKeyReplacements generates key replacement pairs for environment variable mapping.
 // This allows environment variables like FB_BRANDING_DISABLE_EXTERNAL to map to configuration
 // keys like branding.disableExternal by converting flag names to snake_case format.
@@ -52,30 +78,17 @@ func generateEnvKeyReplacements(cmd *cobra.Command) []string {
 	return replacements
 }
 
-// loadConfigFile attempts to load a configuration file using viper and merge it into the main viper instance.
-// It supports JSON and YAML formats, trying JSON first if the file has no extension.
+// loadConfigFile attempts to load a configuration file and merge it into the
+// main viper instance. It supports JSON, YAML and TOML, see configstore.Parse.
 // Returns true if the config was successfully loaded and merged.
 func loadConfigFile(v *viper.Viper, configPath string, logMessage string) bool {
-	vTemp := viper.New()
-	vTemp.SetConfigFile(configPath)
-
-	// If file has no extension, try JSON first, then YAML
-	if filepath.Ext(configPath) == "" {
-		vTemp.SetConfigType("json")
-		if err := vTemp.ReadInConfig(); err != nil {
-			vTemp.SetConfigType("yaml")
-			if err := vTemp.ReadInConfig(); err != nil {
-				return false
-			}
-		}
-	} else {
-		if err := vTemp.ReadInConfig(); err != nil {
-			return false
-		}
+	settings, _, err := configstore.ReadFile(configPath)
+	if err != nil {
+		return false
 	}
 
 	// Merge the loaded config into the main viper instance
-	if err := v.MergeConfigMap(vTemp.AllSettings()); err != nil {
+	if err := mergeMigratedConfig(v, settings, configPath); err != nil {
 		return false
 	}
 
@@ -85,6 +98,27 @@ func loadConfigFile(v *viper.Viper, configPath string, logMessage string) bool {
 	return true
 }
 
+// mergeMigratedConfig opens the credentials of the settings read from a
+// configuration file, applies the pending schema migrations to them in
+// memory, expands the environment variable references in their values and
+// merges them into v. Files written by a newer version of the CLI are merged
+// as they are, with a warning.
+func mergeMigratedConfig(v *viper.Viper, settings map[string]interface{}, configPath string) error {
+	if err := openConfigCredentials(settings); err != nil {
+		log.Printf("Warning: %s: %v", configPath, err)
+	}
+	if applied, err := configstore.Migrate(settings, configMigrations); err != nil {
+		log.Printf("Warning: %s: %v", configPath, err)
+	} else if len(applied) > 0 {
+		debugLog("Migrated %s in memory (%s); run \"stacksenv config migrate\" to update the file", configPath, strings.Join(applied, ", "))
+	}
+	settings, unset := expandConfigValues(settings)
+	if len(unset) > 0 {
+		debugLog("%s references unset environment variables: %s", configPath, strings.Join(unset, ", "))
+	}
+	return v.MergeConfigMap(settings)
+}
+
 // ensureGlobalConfigExists creates the global configuration file and directory if they don't exist.
 // The config file is initialized with default values including serverurl from config.DefaultServerURL.
 func ensureGlobalConfigExists(configPath string) error {
@@ -100,18 +134,21 @@ func ensureGlobalConfigExists(configPath string) error {
 		return err
 	}
 
-	// Create default config with serverurl and sessions properties
-	defaultConfig := map[string]interface{}{
-		"serverurl": config.DefaultServerURL,
-		"sessions":  []interface{}{},
-	}
-	configJSON, err := json.MarshalIndent(defaultConfig, "", "  ")
+	// Another process may be creating or updating the file meanwhile
+	unlock, err := configStore.Lock(configPath)
 	if err != nil {
 		return err
 	}
-	configJSON = append(configJSON, '\n')
+	defer unlock()
+	if _, err := os.Stat(configPath); err == nil {
+		return nil
+	}
 
-	if err := os.WriteFile(configPath, configJSON, 0644); err != nil {
+	// Create default config with serverurl and sessions properties
+	defaultConfig := defaultGlobalConfig()
+	defaultConfig[schemaKey] = configSchemaRef
+	defaultConfig[configstore.VersionKey] = currentConfigVersion()
+	if err := configStore.Write(configPath, defaultConfig, configstore.JSON); err != nil {
 		return err
 	}
 
@@ -121,138 +158,271 @@ func ensureGlobalConfigExists(configPath string) error {
 
 // getGlobalConfigPath returns the path to the global configuration file.
 func getGlobalConfigPath() (string, error) {
-	home, err := homedir.Dir()
+	configDir, err := getConfigDir()
 	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
+		return "", err
 	}
-	return filepath.Join(home, ".stacksenv", "config"), nil
+	return filepath.Join(configDir, "config"), nil
 }
 
-// readGlobalConfig reads the global configuration file and returns its contents.
-// It supports both JSON and YAML formats and returns the data along with the detected format.
-func readGlobalConfig() (map[string]interface{}, bool, error) {
-	configPath, err := getGlobalConfigPath()
+// getCacheDirs returns the cache directories of every tenant, and the cache
+// directory shared by all tenants in earlier versions.
+func getCacheDirs() ([]string, error) {
+	dataDir, err := getDataDir()
 	if err != nil {
-		return nil, false, err
+		return nil, err
 	}
+	tenantCacheDirs, err := filepath.Glob(filepath.Join(dataDir, tenantsDirName, "*", "cache"))
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{filepath.Join(dataDir, "cache")}, tenantCacheDirs...), nil
+}
 
-	configData := make(map[string]interface{})
-	isYAML := false
-
-	// Check if config file exists
-	if _, err := os.Stat(configPath); err == nil {
-		// Read existing config
-		data, err := os.ReadFile(configPath)
-		if err != nil {
-			return nil, false, fmt.Errorf("failed to read config file: %w", err)
-		}
-
-		// Try to determine format and parse accordingly
-		// Check if it's YAML (starts with key: or has YAML-like structure)
-		if len(data) > 0 && (data[0] != '{' && data[0] != '[') {
-			// Likely YAML format
-			if err := yaml.Unmarshal(data, &configData); err == nil {
-				isYAML = true
-			} else {
-				// Try JSON as fallback
-				if err := json.Unmarshal(data, &configData); err != nil {
-					return nil, false, fmt.Errorf("failed to parse config file (tried YAML and JSON): %w", err)
-				}
-			}
-		} else {
-			// Try JSON first
-			if err := json.Unmarshal(data, &configData); err != nil {
-				// Fallback to YAML
-				if err := yaml.Unmarshal(data, &configData); err != nil {
-					return nil, false, fmt.Errorf("failed to parse config file (tried JSON and YAML): %w", err)
-				}
-				isYAML = true
-			}
+// purgeCache removes the cache directories of every tenant.
+func purgeCache() error {
+	cacheDirs, err := getCacheDirs()
+	if err != nil {
+		return err
+	}
+	for _, cacheDir := range cacheDirs {
+		if err := os.RemoveAll(cacheDir); err != nil {
+			return fmt.Errorf("failed to remove cache: %w", err)
 		}
+	}
+	return nil
+}
+
+// handleRevoked publishes the revocation if err reports revoked credentials,
+// so the local cache is purged and nothing fetched with them outlives the
+// revocation. It returns err.
+func handleRevoked(err error) error {
+	if !errors.Is(err, stacksenv.ErrRevoked) {
+		return err
+	}
+	if purgeErr := operations.publish(operationEvent{Kind: eventRevoked, Err: err}); purgeErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: credentials revoked, but %v\n", purgeErr)
 	} else {
-		// Create default config structure if file doesn't exist
-		configData = map[string]interface{}{
-			"serverurl": config.DefaultServerURL,
-			"sessions":  []interface{}{},
-		}
-		// Default to JSON format for new files
-		isYAML = false
+		fmt.Fprintln(os.Stderr, "Credentials revoked: purged the local cache")
+	}
+	return err
+}
+
+// readGlobalConfig reads the global configuration file and returns its contents.
+// It supports JSON, YAML and TOML and returns the data along with the detected format.
+func readGlobalConfig() (map[string]interface{}, configstore.Format, error) {
+	configPath, err := getGlobalConfigPath()
+	if err != nil {
+		return nil, configstore.JSON, err
+	}
+
+	// Create default config structure if file doesn't exist
+	if _, err := os.Stat(configPath); err != nil {
+		return defaultGlobalConfig(), configstore.JSON, nil
 	}
 
-	return configData, isYAML, nil
+	return configStore.Read(configPath)
 }
 
-// writeGlobalConfig writes the configuration data to the global config file.
-// It preserves the format (JSON or YAML) based on the isYAML parameter.
-func writeGlobalConfig(configData map[string]interface{}, isYAML bool) error {
+// defaultGlobalConfig returns the contents of a new global configuration file.
+func defaultGlobalConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"serverurl": config.DefaultServerURL,
+		"sessions":  []interface{}{},
+	}
+}
+
+// writeGlobalConfig writes the configuration data to the global config file
+// in the given format.
+func writeGlobalConfig(configData map[string]interface{}, format configstore.Format) error {
 	configPath, err := getGlobalConfigPath()
 	if err != nil {
 		return err
 	}
+	return configStore.Write(configPath, configData, format)
+}
 
-	// Ensure directory exists
-	configDir := filepath.Dir(configPath)
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
+// configStore reads and writes the configuration files of the CLI: it opens
+// their credentials when reading, seals them or moves them to the keyring as
+// the files ask when writing, removes the credentials left behind from the
+// keyring, and publishes the files written.
+var configStore = &configstore.Store{
+	Open:       openConfigCredentials,
+	Seal:       sealConfigCredentials,
+	Replaced:   releaseKeyringCredentials,
+	AfterWrite: publishConfigWritten,
+}
+
+// openConfigCredentials decrypts the sealed credentials of configuration data
+// and resolves its references to the keyring, in place.
+func openConfigCredentials(configData map[string]interface{}) error {
+	if err := unsealConfig(configData); err != nil {
+		return err
 	}
+	return resolveKeyringRefs(configData)
+}
 
-	// Write config back to file in the same format
-	var configBytes []byte
-	if isYAML {
-		configBytes, err = yaml.Marshal(configData)
-		if err != nil {
-			return fmt.Errorf("failed to marshal config to YAML: %w", err)
-		}
-	} else {
-		configBytes, err = json.MarshalIndent(configData, "", "  ")
-		if err != nil {
-			return fmt.Errorf("failed to marshal config to JSON: %w", err)
+// sealConfigCredentials returns a copy of the configuration data of a file
+// with its credentials moved to the keyring or encrypted, as the file asks.
+func sealConfigCredentials(configPath string, configData map[string]interface{}) (map[string]interface{}, error) {
+	configData, err := storeKeyringCredentials(configPath, configData)
+	if err != nil {
+		return nil, err
+	}
+	return sealConfig(configData)
+}
+
+// lockGlobalConfig takes the advisory lock of the global configuration file;
+// see configstore.Store.Lock.
+func lockGlobalConfig() (func(), error) {
+	configPath, err := getGlobalConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	return configStore.Lock(configPath)
+}
+
+// localConfigFiles are the names of the local project configuration files in
+// the .stacksenv directory, in order of priority.
+var localConfigFiles = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+// getLocalConfigPath returns the path of the local project configuration file
+// in the current working directory: the first existing one of
+// .stacksenv/config.json, config.yaml, config.yml and config.toml, or
+// config.json if none exists.
+func getLocalConfigPath() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current working directory: %w", err)
+	}
+
+	stacksenvDir := filepath.Join(cwd, ".stacksenv")
+	for _, configFile := range localConfigFiles {
+		localConfigPath := filepath.Join(stacksenvDir, configFile)
+		if _, err := os.Stat(localConfigPath); err == nil {
+			return localConfigPath, nil
 		}
-		configBytes = append(configBytes, '\n')
 	}
+	return filepath.Join(stacksenvDir, "config.json"), nil
+}
 
-	if err := os.WriteFile(configPath, configBytes, 0644); err != nil {
-		return fmt.Errorf("failed to write config file: %w", err)
+// globalConfigSection returns the part of the global configuration the
+// update functions below modify: the section of the active profile if one is
+// selected, or the whole configuration otherwise. With create, a missing
+// profile section is added; otherwise nil is returned for it.
+func globalConfigSection(configData map[string]interface{}, create bool) map[string]interface{} {
+	if activeProfile == "" {
+		return configData
 	}
 
-	return nil
+	profiles, _ := configData["profiles"].(map[string]interface{})
+	if profiles == nil {
+		if !create {
+			return nil
+		}
+		profiles = make(map[string]interface{})
+		configData["profiles"] = profiles
+	}
+
+	// Profile names are matched case-insensitively like viper does
+	for name, section := range profiles {
+		if strings.EqualFold(name, activeProfile) {
+			if section, ok := section.(map[string]interface{}); ok {
+				return section
+			}
+		}
+	}
+	if !create {
+		return nil
+	}
+	section := make(map[string]interface{})
+	profiles[activeProfile] = section
+	return section
 }
 
-// updateGlobalConfig updates a property in the global configuration file.
-// It reads the existing config, updates the specified key with the new value,
-// and writes it back preserving the original format (JSON or YAML).
-func updateGlobalConfig(key string, value interface{}) error {
-	// Read existing config
-	configData, isYAML, err := readGlobalConfig()
+// updateGlobalConfigFile applies update to the global configuration file
+// under its lock and writes it back, preserving its format (JSON, YAML or
+// TOML), if update reports a change. A missing file starts from the defaults.
+func updateGlobalConfigFile(update func(configData map[string]interface{}) (bool, error)) error {
+	configPath, err := getGlobalConfigPath()
 	if err != nil {
 		return err
 	}
+	return configStore.Update(configPath, func(configData map[string]interface{}) (bool, error) {
+		if len(configData) == 0 {
+			maps.Copy(configData, defaultGlobalConfig())
+		}
+		return update(configData)
+	})
+}
 
-	// Update the specified key
-	configData[key] = value
+// updateGlobalConfig updates a property in the global configuration file, or
+// in the section of the active profile, preserving the original format
+// (JSON, YAML or TOML).
+func updateGlobalConfig(key string, value interface{}) error {
+	return updateGlobalConfigValues(map[string]interface{}{key: value})
+}
 
-	// Write updated config back
-	if err := writeGlobalConfig(configData, isYAML); err != nil {
-		return err
-	}
+// updateGlobalConfigValues updates several properties of the global configuration
+// file, or of the section of the active profile, at once, preserving the
+// original format (JSON, YAML or TOML).
+func updateGlobalConfigValues(values map[string]interface{}) error {
+	return updateGlobalConfigFile(func(configData map[string]interface{}) (bool, error) {
+		maps.Copy(globalConfigSection(configData, true), values)
+		return true, nil
+	})
+}
 
-	return nil
+// removeGlobalConfigKeys removes properties from the global configuration file,
+// or from the section of the active profile, preserving the original format
+// (JSON, YAML or TOML). It reports which keys were present.
+func removeGlobalConfigKeys(keys ...string) ([]string, error) {
+	var removed []string
+	err := updateGlobalConfigFile(func(configData map[string]interface{}) (bool, error) {
+		section := globalConfigSection(configData, false)
+		for _, key := range keys {
+			if _, ok := section[key]; ok {
+				delete(section, key)
+				removed = append(removed, key)
+			}
+		}
+		return len(removed) > 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
 }
 
 // createLocalConfig creates a local configuration file in the current working directory.
-// The file is created as .stacksenv/config.json with default values.
+// The file is created as .stacksenv/config.json with default values and, if
+// branch isn't empty, branch as the default branch of the project.
 // Returns an error if the file already exists or if creation fails.
-func createLocalConfig() error {
-	cwd, err := os.Getwd()
+func createLocalConfig(branch string) error {
+	configPath, err := newLocalConfigPath(true)
 	if err != nil {
-		return fmt.Errorf("failed to get current working directory: %w", err)
+		return err
 	}
+	return writeLocalConfig(configPath, defaultLocalConfig(branch))
+}
 
-	configDir := filepath.Join(cwd, ".stacksenv")
-	configPath := filepath.Join(configDir, "config.json")
+// newLocalConfigPath returns the path of the local configuration file to
+// create in the current working directory. If the file exists, the user is
+// asked to confirm recreating it if confirm is set; otherwise an error is
+// returned.
+func newLocalConfigPath(confirm bool) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current working directory: %w", err)
+	}
+	configPath := filepath.Join(cwd, ".stacksenv", "config.json")
 
 	// Check if config file already exists
 	if _, err := os.Stat(configPath); err == nil {
+		if !confirm {
+			return "", fmt.Errorf("local config file already exists at: %s", configPath)
+		}
+
 		// Prompt user for confirmation to recreate
 		fmt.Printf("Local config file already exists at: %s\n", configPath)
 		fmt.Print("Do you want to recreate it? (y/n): ")
@@ -260,34 +430,36 @@ func createLocalConfig() error {
 		reader := bufio.NewReader(os.Stdin)
 		response, err := reader.ReadString('\n')
 		if err != nil {
-			return fmt.Errorf("failed to read user input: %w", err)
+			return "", fmt.Errorf("failed to read user input: %w", err)
 		}
 
 		response = strings.TrimSpace(strings.ToLower(response))
 		if response != "y" && response != "yes" {
 			fmt.Println("Operation cancelled.")
-			return fmt.Errorf("operation cancelled by user")
-		}
-
-		// Remove existing config file
-		if err := os.Remove(configPath); err != nil {
-			return fmt.Errorf("failed to remove existing config file: %w", err)
+			return "", fmt.Errorf("operation cancelled by user")
 		}
 	}
 
-	// Create .stacksenv directory if it doesn't exist
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
-	}
+	return configPath, nil
+}
 
-	// Create default config with serverurl from global config
+// defaultLocalConfig returns the configuration written by "stacksenv init"
+// without the wizard: placeholders for the credentials and, if branch isn't
+// empty, branch as the default branch of the project.
+func defaultLocalConfig(branch string) map[string]interface{} {
 	defaultConfig := map[string]interface{}{
+		schemaKey:                  configSchemaRef,
+		configstore.VersionKey:     currentConfigVersion(),
 		"_stacksenv_id":            "",
 		"_stacksenv_key":           "",
 		"_stacksenv_secret":        "",
 		"_stacksenv_branch":        "",
 		"_stacksenv_disable_https": false,
 	}
+	if branch != "" {
+		delete(defaultConfig, "_stacksenv_branch")
+		defaultConfig["stacksenv_branch"] = branch
+	}
 
 	// Get serverurl from global config if available
 	globalConfig, _, err := readGlobalConfig()
@@ -296,30 +468,65 @@ func createLocalConfig() error {
 			defaultConfig["serverurl"] = serverurl
 		}
 	}
+	return defaultConfig
+}
 
-	configJSON, err := json.MarshalIndent(defaultConfig, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
-	}
-	configJSON = append(configJSON, '\n')
+// writeLocalConfig writes a new local configuration file, replacing an
+// existing one. Its placeholders are written as they are.
+func writeLocalConfig(configPath string, configData map[string]interface{}) error {
+	return localConfigStore.Write(configPath, configData, configstore.JSON)
+}
 
-	if err := os.WriteFile(configPath, configJSON, 0644); err != nil {
-		return fmt.Errorf("failed to write config file: %w", err)
-	}
+// localConfigStore writes new local configuration files: as configStore, but
+// without sealing their credentials, which "stacksenv init" leaves empty.
+var localConfigStore = &configstore.Store{AfterWrite: writeConfigSchema}
 
-	return nil
+// configSource describes a configuration file merged by initViper.
+type configSource struct {
+	Scope   string // "explicit" (--config), "file" (./ or $HOME), "system", "global", "profile", "session" or "local"
+	Path    string
+	Profile string // name of the profile section of the file, for the "profile" scope
+	Session string // name of the session of the file, for the "session" scope
 }
 
+// loadedConfigSources lists the configuration files merged by the last call to
+// initViper, in merge order (later files override earlier ones).
+var loadedConfigSources []configSource
+
+// profileEnvVar is the environment variable selecting the configuration profile.
+const profileEnvVar = "STACKSENV_PROFILE"
+
+// createsProfileAnnotation marks commands that may select a profile which
+// doesn't exist yet because they create it, like "stacksenv login".
+const createsProfileAnnotation = "stacksenv_creates_profile"
+
+// activeProfile is the profile selected by the last call to initViper, or an
+// empty string if none is selected.
+var activeProfile string
+
+// managesSessionsAnnotation marks commands that manage the sessions
+// themselves, so initViper doesn't apply the active session for them.
+const managesSessionsAnnotation = "stacksenv_manages_sessions"
+
+// activeSession is the session applied by the last call to initViper, or an
+// empty string if none is active.
+var activeSession string
+
 // initViper initializes and configures a Viper instance with configuration from multiple sources.
 // Configuration precedence (highest to lowest):
 // 1. Command-line flags
 // 2. Environment variables (FB_ prefix)
-// 3. Local project config (.stacksenv/config.json or .stacksenv/config.yaml in current directory)
-// 4. Global user config ($HOME/.stacksenv/config)
-// 5. System-wide config (/etc/stacksenv/.stacksenv)
-// 6. Standard config paths (current directory, $HOME, /etc/stacksenv/)
+// 3. Local project config (.stacksenv/config.{json,yaml,yml,toml} in current directory)
+// 4. Active session (the "sessions" entry named by "active_session")
+// 5. Selected profile (profiles.<name> of the configuration, see selectedProfile)
+// 6. Global user config ($HOME/.stacksenv/config)
+// 7. System-wide config (/etc/stacksenv/.stacksenv)
+// 8. Standard config paths (current directory, $HOME, /etc/stacksenv/)
 func initViper(cmd *cobra.Command) (*viper.Viper, error) {
 	v := viper.New()
+	loadedConfigSources = nil
+	activeProfile = ""
+	activeSession = ""
 
 	// Get config file path from command-line flag
 	cfgFile, err := cmd.Flags().GetString("config")
@@ -327,18 +534,16 @@ func initViper(cmd *cobra.Command) (*viper.Viper, error) {
 		return nil, err
 	}
 
-	// Configure config file search paths if no explicit config file is specified
+	// Look for a config file in the standard paths if no explicit config file
+	// is specified. The file is read separately so it can be migrated before
+	// it is merged.
+	fileUsed := cfgFile
 	if cfgFile == "" {
 		home, err := homedir.Dir()
 		if err != nil {
 			return nil, err
 		}
-		v.AddConfigPath(".")
-		v.AddConfigPath(home)
-		v.AddConfigPath("/etc/stacksenv/")
-		v.SetConfigName(".stacksenv")
-	} else {
-		v.SetConfigFile(cfgFile)
+		fileUsed, _ = configstore.Find(".stacksenv", ".", home, "/etc/stacksenv/")
 	}
 
 	// Configure environment variable support
@@ -350,51 +555,88 @@ func initViper(cmd *cobra.Command) (*viper.Viper, error) {
 	if err := v.BindPFlags(cmd.Flags()); err != nil {
 		return nil, err
 	}
+	for name, key := range flagConfigKeys {
+		if flag := cmd.Flags().Lookup(name); flag != nil {
+			if err := v.BindPFlag(key, flag); err != nil {
+				return nil, err
+			}
+		}
+	}
 
 	// Get debug flag value and set global debugEnabled
 	debugEnabled, _ = cmd.Flags().GetBool("debug")
 
 	// Attempt to read configuration from standard paths
 	configFound := false
-	if err := v.ReadInConfig(); err != nil {
-		var parseErr viper.ConfigParseError
-		if errors.As(err, &parseErr) {
-			return nil, err
+	var fileSettings map[string]interface{}
+	if fileUsed != "" {
+		if _, err := os.Stat(fileUsed); err == nil {
+			if fileSettings, _, err = configstore.ReadFile(fileUsed); err != nil {
+				return nil, fmt.Errorf("%s: %w", fileUsed, err)
+			}
 		}
+	}
+	if fileSettings == nil {
 		debugLogLn("No config file used")
 	} else {
+		if err := mergeMigratedConfig(v, fileSettings, fileUsed); err != nil {
+			return nil, err
+		}
 		configFound = true
-		debugLog("Using config file: %s", v.ConfigFileUsed())
+		scope := "file"
+		switch {
+		case cfgFile != "":
+			scope = "explicit"
+		case strings.HasPrefix(fileUsed, "/etc/stacksenv/"):
+			scope = "system"
+		}
+		loadedConfigSources = append(loadedConfigSources, configSource{Scope: scope, Path: fileUsed})
+		debugLog("Using config file: %s", fileUsed)
 	}
 
 	// Load global fallback config if no config was found in standard paths
 	if cfgFile == "" && !configFound {
-		home, err := homedir.Dir()
+		globalConfigPath, err := getGlobalConfigPath()
 		if err == nil {
-			globalConfigPath := filepath.Join(home, ".stacksenv", "config")
-
 			// Ensure global config file exists (create if missing)
 			if err := ensureGlobalConfigExists(globalConfigPath); err != nil {
 				debugLog("Failed to ensure global config exists: %v", err)
 			}
 
 			// Load and merge global config
-			loadConfigFile(v, globalConfigPath, "Loaded config from: %s")
+			if loadConfigFile(v, globalConfigPath, "Loaded config from: %s") {
+				loadedConfigSources = append(loadedConfigSources, configSource{Scope: "global", Path: globalConfigPath})
+			}
 		}
 	}
 
+	// Apply the selected profile (overwrites global config)
+	if profile := selectedProfile(cmd, v); profile != "" {
+		if err := applyProfile(cmd, v, profile); err != nil {
+			return nil, err
+		}
+		activeProfile = profile
+	}
+
+	// Apply the active session (overwrites global config and profile)
+	if name := v.GetString(activeSessionKey); name != "" && cmd.Annotations[managesSessionsAnnotation] == "" {
+		if err := applySession(v, name); err != nil {
+			return nil, err
+		}
+		activeSession = name
+	}
+
 	// Load local project config (overwrites global config)
-	// Priority: config.json > config.yaml > config.yml
+	// Priority: config.json > config.yaml > config.yml > config.toml
 	if cfgFile == "" {
 		cwd, err := os.Getwd()
 		if err == nil {
 			stacksenvDir := filepath.Join(cwd, ".stacksenv")
-			configFiles := []string{"config.json", "config.yaml", "config.yml"}
-
-			for _, configFile := range configFiles {
+			for _, configFile := range localConfigFiles {
 				localConfigPath := filepath.Join(stacksenvDir, configFile)
 				if _, err := os.Stat(localConfigPath); err == nil {
 					if loadConfigFile(v, localConfigPath, "Loaded local config from: %s (overwrites global config)") {
+						loadedConfigSources = append(loadedConfigSources, configSource{Scope: "local", Path: localConfigPath})
 						break // Only load the first found config file
 					}
 				}
@@ -402,9 +644,66 @@ func initViper(cmd *cobra.Command) (*viper.Viper, error) {
 		}
 	}
 
+	if v.GetBool(strictKey) && cmd.Annotations[inspectsConfigAnnotation] == "" {
+		if err := checkStrictConfig(); err != nil {
+			return nil, err
+		}
+	}
+	// Reject a bad color mode up front rather than when output is written
+	if _, err := term.ParseColorMode(v.GetString(colorKey)); err != nil && cmd.Annotations[inspectsConfigAnnotation] == "" {
+		return nil, err
+	}
+
 	return v, nil
 }
 
+// selectedProfile returns the name of the configuration profile selected by
+// the --profile flag, the STACKSENV_PROFILE environment variable or the
+// "default_profile" configuration key, in that order.
+func selectedProfile(cmd *cobra.Command, v *viper.Viper) string {
+	if flag := cmd.Flags().Lookup("profile"); flag != nil && flag.Changed {
+		return flag.Value.String()
+	}
+	if profile := os.Getenv(profileEnvVar); profile != "" {
+		return profile
+	}
+	return v.GetString("default_profile")
+}
+
+// applyProfile merges the settings of a profile, stored under
+// profiles.<name> in the configuration, into the viper instance.
+func applyProfile(cmd *cobra.Command, v *viper.Viper, name string) error {
+	if strings.Contains(name, ".") {
+		return fmt.Errorf("invalid profile name %q: names must not contain dots", name)
+	}
+
+	settings, ok := v.Get("profiles." + name).(map[string]interface{})
+	if !ok {
+		if cmd.Annotations[createsProfileAnnotation] != "" {
+			debugLog("Profile %s doesn't exist yet", name)
+			return nil
+		}
+		return fmt.Errorf("profile %q not found in the configuration", name)
+	}
+	if err := v.MergeConfigMap(settings); err != nil {
+		return fmt.Errorf("failed to apply profile %q: %w", name, err)
+	}
+
+	// Record the file defining the profile; the last one wins like in viper
+	for i := len(loadedConfigSources) - 1; i >= 0; i-- {
+		configData, _, err := configStore.Read(loadedConfigSources[i].Path)
+		if err != nil {
+			continue
+		}
+		if _, ok := configstore.Lookup(configData, "profiles."+name); ok {
+			loadedConfigSources = append(loadedConfigSources, configSource{Scope: "profile", Path: loadedConfigSources[i].Path, Profile: name})
+			break
+		}
+	}
+	debugLog("Using profile: %s", name)
+	return nil
+}
+
 // store represents the application's storage state.
 // Currently contains only databaseExisted flag; storage field is reserved for future use.
 type store struct {
@@ -466,8 +765,339 @@ func checkSeperatedVariables(v *viper.Viper) (bool, string) {
 
 	disableHTTPS := v.GetBool("stacksenv_disable_https")
 
+	// The URL carries the bare host, so strip the scheme of a full server URL
+	serverURL, plainHTTP := splitServerURL(serverURL)
+	disableHTTPS = disableHTTPS || plainHTTP
+
 	// Construct URL: stacksenv://ID:KEY:SECRET@SERVER_URL/BRANCH?disable_https=true
 	// ParseURL requires format: ID:KEY:SECRET@SERVER_URL/BRANCH?disable_https=true
-	url := fmt.Sprintf("stacksenv://%s:%s:%s@%s/%s?disable_https=%t", id, secret, key, serverURL, branch, disableHTTPS)
+	// The access token stored by "stacksenv login" is kept out of the URL
+	// and added by withLoginToken
+	url := fmt.Sprintf("stacksenv://%s:%s:%s@%s/%s?disable_https=%t",
+		stacksenv.EscapeCredential(id), stacksenv.EscapeCredential(secret), stacksenv.EscapeCredential(key), serverURL, neturl.PathEscape(branch), disableHTTPS)
 	return true, url
 }
+
+// withLoginToken sets the access token stored by "stacksenv login" on
+// envConfig if it has none and the token was issued for its environment: the
+// configured stacksenv_id on the configured server.
+func withLoginToken(v *viper.Viper, envConfig *stacksenv.Config) {
+	token := v.GetString("token")
+	if token == "" || envConfig.Token != "" || envConfig.ID != v.GetString("stacksenv_id") {
+		return
+	}
+	serverURL := v.GetString("serverurl")
+	if serverURL == "" {
+		serverURL = config.DefaultServerURL
+	}
+	if host, _ := splitServerURL(serverURL); host == envConfig.ServerURL {
+		envConfig.Token = token
+	}
+}
+
+// loginTokenParser is the URLParser of the handlers of the CLI, adding the
+// access token stored by "stacksenv login" to the configurations of the URLs
+// with withLoginToken.
+type loginTokenParser struct {
+	v *viper.Viper
+}
+
+func (p loginTokenParser) ParseURL(url string) (stacksenv.Config, error) {
+	envConfig, err := stacksenv.ParseURL(url)
+	if err != nil {
+		return envConfig, err
+	}
+	withLoginToken(p.v, &envConfig)
+	return envConfig, nil
+}
+
+// splitServerURL strips the http:// or https:// scheme from a server URL.
+// It reports whether the URL explicitly asked for plain HTTP.
+func splitServerURL(serverURL string) (string, bool) {
+	if host, ok := strings.CutPrefix(serverURL, "http://"); ok {
+		return strings.TrimSuffix(host, "/"), true
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(serverURL, "https://"), "/"), false
+}
+
+// errNoCredentials is returned by commands that need to talk to the server
+// when no stacksenv credentials are configured.
+var errNoCredentials = errors.New("no stacksenv credentials configured: run 'stacksenv init' or set stacksenv_url")
+
+// resolveStacksenvURL returns the stacksenv URL configured through viper.
+//
+// A remote selected with "--remote" takes precedence over the credentials of
+// the active session, over an explicit "stacksenv_url", which takes
+// precedence over the default remote, which takes precedence over the
+// separated stacksenv_id/stacksenv_key/stacksenv_secret variables. It returns an empty string if no credentials are configured, and
+// an error if the selected remote doesn't exist.
+//
+// The options of withURLOptions are applied to the URL.
+func resolveStacksenvURL(v *viper.Viper) (string, error) {
+	var url string
+	if name := v.GetString("remote"); name != "" {
+		url = remoteURL(v, name)
+		if url == "" {
+			return "", fmt.Errorf("no such remote %q: add it with 'stacksenv remote add %s <url>'", name, name)
+		}
+	}
+	if url == "" && activeSession != "" {
+		// Sessions hold separated credentials, applied by initViper
+		_, url = checkSeperatedVariables(v)
+	}
+	if url == "" {
+		url = v.GetString("stacksenv_url")
+	}
+	if url == "" {
+		url = remoteURL(v, defaultRemote)
+	}
+	if url == "" {
+		_, url = checkSeperatedVariables(v)
+	}
+
+	if url == "" {
+		return "", nil
+	}
+	if branch := resolveBranch(v); branch != "" {
+		url = withURLBranch(url, branch)
+	}
+	return withURLOptions(v, url)
+}
+
+// pageSizeKey is the configuration key setting the number of variables per
+// page asked of the server when fetching an environment.
+const pageSizeKey = "page_size"
+
+// signRequestsKey is the configuration key signing the requests to the
+// server with the environment secret, for servers rejecting unsigned ones.
+const signRequestsKey = "sign_requests"
+
+// withURLOptions applies the fetch options configured through viper to a
+// stacksenv URL: with "--no-personal", the URL asks the server not to merge
+// the personal overlay of the authenticated user, with "page_size", for
+// pages of at most that many variables, and with "sign_requests", its
+// requests are signed.
+func withURLOptions(v *viper.Viper, url string) (string, error) {
+	if v.GetBool("no-personal") {
+		url = withURLParam(url, "personal", "false")
+	}
+	if v.GetBool(signRequestsKey) {
+		url = withURLParam(url, "sign", "true")
+	}
+	if configured := v.Get(pageSizeKey); configured != nil {
+		pageSize, err := configPageSize(configured)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s: %w", pageSizeKey, err)
+		}
+		url = withURLParam(url, "page_size", strconv.Itoa(pageSize))
+	}
+	return url, nil
+}
+
+// configPageSize parses a page size from the configuration: a positive
+// number, or a string holding one, as set through the environment.
+func configPageSize(value interface{}) (int, error) {
+	var pageSize int
+	switch value := value.(type) {
+	case int:
+		pageSize = value
+	case int64:
+		pageSize = int(value)
+	case uint64:
+		pageSize = int(value)
+	case float64:
+		if value != math.Trunc(value) {
+			return 0, fmt.Errorf("invalid page size %v: expected a whole number of variables", value)
+		}
+		pageSize = int(value)
+	case string:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid page size %q: expected a number of variables", value)
+		}
+		pageSize = n
+	default:
+		return 0, fmt.Errorf("invalid page size %v: expected a number of variables", value)
+	}
+	if pageSize <= 0 {
+		return 0, fmt.Errorf("invalid page size %d: must be positive", pageSize)
+	}
+	return pageSize, nil
+}
+
+// branchEnvVar is the environment variable selecting the branch.
+const branchEnvVar = "STACKSENV_BRANCH"
+
+// resolveBranch returns the branch selected by the --branch flag, the
+// STACKSENV_BRANCH environment variable or the "stacksenv_branch" key of the
+// local project configuration, in that order. It returns an empty string if
+// none is set, so the branch of the configured credentials is used.
+func resolveBranch(v *viper.Viper) string {
+	if branch := v.GetString("branch"); branch != "" {
+		return branch
+	}
+	if branch := os.Getenv(branchEnvVar); branch != "" {
+		return branch
+	}
+	for _, source := range loadedConfigSources {
+		if source.Scope != "local" {
+			continue
+		}
+		configData, _, err := configStore.Read(source.Path)
+		if err != nil {
+			continue
+		}
+		configData, _ = expandConfigValues(configData)
+		if branch, ok := configstore.String(configData, "stacksenv_branch"); ok && branch != "" {
+			return branch
+		}
+	}
+	return ""
+}
+
+// withURLBranch replaces the branch of a stacksenv URL, the last segment of
+// its path. Malformed URLs are returned unchanged for the parser to report.
+func withURLBranch(url, branch string) string {
+	at := strings.Index(url, "@")
+	if at < 0 {
+		return url
+	}
+	end := len(url)
+	if query := strings.IndexAny(url[at:], "?#"); query >= 0 {
+		end = at + query
+	}
+	slash := strings.LastIndex(url[at:end], "/")
+	if slash < 0 {
+		return url
+	}
+	start := at + slash + 1
+	return url[:start] + neturl.PathEscape(branch) + url[end:]
+}
+
+// withURLParam appends a query parameter to a stacksenv URL.
+func withURLParam(url, key, value string) string {
+	separator := "?"
+	if strings.Contains(url, "?") {
+		separator = "&"
+	}
+	return url + separator + key + "=" + neturl.QueryEscape(value)
+}
+
+// checkMinServerVersion enforces the --min-server-version setting against the
+// server of config. Nothing is sent to the server if it isn't set.
+func checkMinServerVersion(v *viper.Viper, config *stacksenv.Config) error {
+	minVersion := v.GetString("min-server-version")
+	if minVersion == "" {
+		return nil
+	}
+	httpClient, err := newHTTPClient(v)
+	if err != nil {
+		return err
+	}
+	return logRequestID(stacksenv.CheckMinServerVersion(context.Background(), config, httpClient, minVersion))
+}
+
+// checkMinServerVersionURL is like checkMinServerVersion for the server of a
+// stacksenv URL. Invalid URLs are left to the command to report.
+func checkMinServerVersionURL(v *viper.Viper, url string) error {
+	if v.GetString("min-server-version") == "" || url == "" {
+		return nil
+	}
+	config, err := stacksenv.ParseURL(strings.TrimPrefix(url, "stacksenv://"))
+	if err != nil {
+		return nil
+	}
+	return checkMinServerVersion(v, &config)
+}
+
+// resolveStacksenvConfig parses the stacksenv URL configured through viper.
+// It returns errNoCredentials if no credentials are configured.
+func resolveStacksenvConfig(v *viper.Viper) (*stacksenv.Config, error) {
+	url, err := resolveStacksenvURL(v)
+	if err != nil {
+		return nil, err
+	}
+	if url == "" {
+		return nil, errNoCredentials
+	}
+
+	config, err := loginTokenParser{v}.ParseURL(strings.TrimPrefix(url, "stacksenv://"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse stacksenv URL: %w", err)
+	}
+	return &config, nil
+}
+
+// fetchContextData fetches and decrypts the environment configured through
+// viper, in the branch selected as described by resolveBranch.
+func fetchContextData(v *viper.Viper) ([]stacksenv.ContextData[any], error) {
+	return fetchBranchContextData(v, "")
+}
+
+// fetchBranchContextData fetches and decrypts the given branch of the
+// environment configured through viper, or the configured branch if branch is
+// empty.
+func fetchBranchContextData(v *viper.Viper, branch string) ([]stacksenv.ContextData[any], error) {
+	return fetchContextDataWith(v, func(config *stacksenv.Config) {
+		if branch != "" {
+			config.Branch = branch
+		}
+	})
+}
+
+// fetchContextDataWith fetches and decrypts the environment configured through
+// viper after adjusting its configuration with configure.
+func fetchContextDataWith(v *viper.Viper, configure func(config *stacksenv.Config)) ([]stacksenv.ContextData[any], error) {
+	config, err := resolveStacksenvConfig(v)
+	if err != nil {
+		return nil, err
+	}
+	configure(config)
+	if err := checkMinServerVersion(v, config); err != nil {
+		return nil, err
+	}
+
+	service, err := newClientService(v)
+	if err != nil {
+		return nil, err
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	spinner := term.NewSpinner(os.Stderr, "Fetching environment...", v.GetBool("quiet"))
+	spinner.Start()
+	defer spinner.Stop()
+	properties, err := stacksenv.FetchWithContext(ctx, service, config)
+	// Stop before the outcome of the fetch is reported
+	spinner.Stop()
+	if ctx.Err() != nil {
+		return nil, errors.New("interrupted while fetching the environment")
+	}
+	if err != nil {
+		return nil, handleRevoked(logRequestID(fmt.Errorf("unable to retrieve environment context data: %w", err)))
+	}
+	event := tenantEvent(eventFetched, config)
+	event.Variables = len(properties)
+	if err := operations.publish(event); err != nil {
+		debugLog("Failed to publish the fetch: %v", err)
+	}
+	return properties, nil
+}
+
+// contextDataToEnv converts context data to sorted KEY=VALUE environment entries.
+func contextDataToEnv(properties []stacksenv.ContextData[any]) []string {
+	values := contextDataToMap(properties)
+
+	env := make([]string, 0, len(values))
+	for name, value := range values {
+		env = append(env, name+"="+value)
+	}
+	slices.Sort(env)
+	return env
+}
+
+// contextDataToMap converts context data to a map of property names to string values.
+// Variables restricted to other platforms are skipped.
+func contextDataToMap(properties []stacksenv.ContextData[any]) map[string]string {
+	return stacksenv.NewEnvSet(stacksenv.FilterCurrentPlatform(properties)).Map()
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/term"
+)
+
+const (
+	// validatorsKey is the configuration key mapping the names of validators
+	// to the commands checking candidate variables.
+	validatorsKey = "validators"
+	// validatorTimeout bounds how long a validator may run.
+	validatorTimeout = 30 * time.Second
+)
+
+// validatorInput is the document a validator reads on stdin.
+type validatorInput struct {
+	// Source is "server" for the variables of a branch, or the path of the
+	// file the variables were read from.
+	Source    string            `json:"source"`
+	Branch    string            `json:"branch,omitempty"`
+	Variables map[string]string `json:"variables"`
+}
+
+// validatorIssue is a problem reported by a validator.
+type validatorIssue struct {
+	Validator string `json:"validator"`
+	Severity  string `json:"severity"`
+	Key       string `json:"key,omitempty"`
+	Message   string `json:"message"`
+}
+
+// validator is an external command checking candidate variables.
+type validator struct {
+	name    string
+	command []string
+}
+
+// configuredValidators returns the validators of the configuration, sorted by
+// name.
+func configuredValidators(v *viper.Viper) ([]validator, error) {
+	configured := v.GetStringMapString(validatorsKey)
+	validators := make([]validator, 0, len(configured))
+	for _, name := range slices.Sorted(maps.Keys(configured)) {
+		command, err := splitCommandLine(configured[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid command of validator %s: %w", name, err)
+		}
+		if len(command) == 0 {
+			return nil, fmt.Errorf("invalid command of validator %s: command is empty", name)
+		}
+		validators = append(validators, validator{name: name, command: command})
+	}
+	return validators, nil
+}
+
+// runValidators runs the configured validators on candidate variables and
+// returns the issues they report.
+func runValidators(v *viper.Viper, input validatorInput) ([]validatorIssue, error) {
+	validators, err := configuredValidators(v)
+	if err != nil || len(validators) == 0 {
+		return nil, err
+	}
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the variables: %w", err)
+	}
+	var issues []validatorIssue
+	for _, val := range validators {
+		issues = append(issues, val.run(data)...)
+	}
+	return issues, nil
+}
+
+// run runs the validator with input on stdin.
+//
+// A validator fails by exiting with a non-zero status. It may print
+// {"issues": [{"key": ..., "message": ..., "severity": ...}]} to stdout to
+// report issues, or else plain lines, each reported as an issue. Issues are
+// errors if the validator failed, and warnings otherwise, unless they give
+// their severity.
+func (val validator) run(input []byte) []validatorIssue {
+	ctx, cancel := context.WithTimeout(context.Background(), validatorTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, val.command[0], val.command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+	debugLog("Validator %s: %v", val.name, runErr)
+
+	defaultSeverity := severityWarning
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return []validatorIssue{{Validator: val.name, Severity: severityError, Message: fmt.Sprintf("timed out after %s", validatorTimeout)}}
+	case errors.As(runErr, &exitErr):
+		defaultSeverity = severityError
+	case runErr != nil:
+		return []validatorIssue{{Validator: val.name, Severity: severityError, Message: fmt.Sprintf("failed to run: %v", runErr)}}
+	}
+
+	var output struct {
+		Issues []validatorIssue `json:"issues"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		for _, line := range strings.Split(stdout.String(), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				output.Issues = append(output.Issues, validatorIssue{Message: line})
+			}
+		}
+	}
+	for i := range output.Issues {
+		output.Issues[i].Validator = val.name
+		if output.Issues[i].Severity != severityError && output.Issues[i].Severity != severityWarning {
+			output.Issues[i].Severity = defaultSeverity
+		}
+	}
+
+	if exitErr != nil && !slices.ContainsFunc(output.Issues, func(issue validatorIssue) bool { return issue.Severity == severityError }) {
+		message := exitErr.Error()
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			message += ": " + detail
+		}
+		output.Issues = append(output.Issues, validatorIssue{Validator: val.name, Severity: severityError, Message: message})
+	}
+	return output.Issues
+}
+
+// checkValidators runs the configured validators on candidate variables,
+// prints the issues they report to stderr, and fails if any is an error.
+func checkValidators(v *viper.Viper, input validatorInput) error {
+	issues, err := runValidators(v, input)
+	if err != nil || len(issues) == 0 {
+		return err
+	}
+	out, err := newColorWriter(os.Stderr, v.GetString(colorKey))
+	if err != nil {
+		return err
+	}
+	printValidatorIssues(out, issues)
+	if countValidatorErrors(issues) > 0 {
+		return errors.New("the validators rejected the variables")
+	}
+	return nil
+}
+
+// printValidatorIssues prints issues reported by validators, one per line.
+func printValidatorIssues(out *term.Writer, issues []validatorIssue) {
+	severityColors := map[string]term.Color{severityError: term.Red, severityWarning: term.Yellow}
+	for _, issue := range issues {
+		location := issue.Validator
+		if issue.Key != "" {
+			location += ": " + issue.Key
+		}
+		severity := out.Paint(fmt.Sprintf("%-8s", issue.Severity), severityColors[issue.Severity])
+		out.Printf("%s %s: %s\n", severity, location, issue.Message)
+	}
+}
+
+// countValidatorErrors returns the number of errors among issues.
+func countValidatorErrors(issues []validatorIssue) int {
+	count := 0
+	for _, issue := range issues {
+		if issue.Severity == severityError {
+			count++
+		}
+	}
+	return count
+}
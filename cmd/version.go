@@ -1,20 +1,82 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/stacksenv"
 	"github.com/stacksenv/cli/version"
 )
 
 func init() {
 	rootCmd.AddCommand(versionCmd)
+	versionCmd.Flags().Bool("server", false, "also show the version of the configured server and the features it supports")
 }
 
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print the version number",
-	Run: func(_ *cobra.Command, _ []string) {
+	Long: `Print the version number.
+
+With "--server", the version of the configured server is shown as well,
+together with the features of the CLI it supports and the server version
+each of the others requires.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
 		fmt.Println("StacksENV v" + version.Version + "/" + version.CommitSHA)
+
+		server, err := cmd.Flags().GetBool("server")
+		if err != nil || !server {
+			return err
+		}
+
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+		config, err := resolveStacksenvConfig(v)
+		if err != nil {
+			return err
+		}
+
+		httpClient, err := newHTTPClient(v)
+		if err != nil {
+			return err
+		}
+		info, err := stacksenv.GetServerInfo(context.Background(), config, httpClient)
+		if err != nil {
+			return logRequestID(err)
+		}
+
+		serverVersion := info.Version
+		if serverVersion == "" {
+			serverVersion = "older than " + stacksenv.VersionEndpointVersion + " (not reported)"
+		}
+		fmt.Printf("Server %s: %s\n", config.ServerURL, serverVersion)
+
+		features := make([]string, 0, len(stacksenv.CompatibilityMatrix))
+		for feature := range stacksenv.CompatibilityMatrix {
+			features = append(features, string(feature))
+		}
+		slices.Sort(features)
+
+		var supported, unsupported []string
+		for _, feature := range features {
+			if info.Supports(stacksenv.Feature(feature)) {
+				supported = append(supported, feature)
+			} else {
+				unsupported = append(unsupported, fmt.Sprintf("%s (requires %s)", feature, stacksenv.CompatibilityMatrix[stacksenv.Feature(feature)]))
+			}
+		}
+		if len(supported) > 0 {
+			fmt.Printf("Supported:    %s\n", strings.Join(supported, ", "))
+		}
+		if len(unsupported) > 0 {
+			fmt.Printf("Unsupported:  %s\n", strings.Join(unsupported, ", "))
+		}
+		return nil
 	},
 }
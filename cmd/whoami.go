@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+func init() {
+	rootCmd.AddCommand(whoamiCmd)
+}
+
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show the authenticated identity",
+	Long: `Show the identity the configured credentials belong to, the environment ID
+and server URL in use, and the branches the credentials grant access to.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		v, err := initViper(cmd)
+		if err != nil {
+			return err
+		}
+
+		config, err := resolveStacksenvConfig(v)
+		if err != nil {
+			return err
+		}
+
+		if err := checkMinServerVersion(v, config); err != nil {
+			return err
+		}
+
+		httpClient, err := newHTTPClient(v)
+		if err != nil {
+			return err
+		}
+		identity, err := stacksenv.WhoAmI(context.Background(), config, httpClient)
+		if err != nil {
+			return logRequestID(err)
+		}
+
+		subject := identity.Subject
+		if subject == "" {
+			subject = "(anonymous)"
+		}
+		branches := strings.Join(identity.Branches, ", ")
+		if branches == "" {
+			branches = "(none reported)"
+		}
+
+		fmt.Printf("Identity:     %s\n", subject)
+		fmt.Printf("Environment:  %s\n", config.ID)
+		fmt.Printf("Server URL:   %s\n", config.ServerURL)
+		fmt.Printf("Branches:     %s\n", branches)
+		return nil
+	},
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+
+	"github.com/spf13/viper"
+	"github.com/stacksenv/cli/pkg/stacksenv"
+)
+
+// variableNamePattern matches the names of the variables that can be
+// written: valid shell variable names.
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// checkVariableName returns an error if name can't be the name of a variable.
+func checkVariableName(name string) error {
+	if !variableNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid variable name %q: expected letters, digits and underscores, not starting with a digit", name)
+	}
+	return nil
+}
+
+// branchUpdate changes the variables of a branch, tombstones included, and
+// returns the updated variables. It may run several times, on the variables
+// fetched anew, if the branch changes concurrently.
+type branchUpdate func(properties []stacksenv.ContextData[any]) ([]stacksenv.ContextData[any], error)
+
+// maxWriteAttempts is the number of times updateBranch fetches, updates and
+// writes a branch changed concurrently before it gives up.
+const maxWriteAttempts = 3
+
+// updateBranch fetches the variables of the branch configured through viper,
+// after adjusting its configuration with configure if set, changes them with
+// update and writes them back to the server.
+//
+// The branch is fetched from the server, never from the offline cache, with
+// its tombstones and without personal overlays, so that writing it back
+// loses neither soft-deleted variables nor leaks personal values into the
+// shared branch. The updated variables are checked with the configured
+// validators before they are written. The write is conditional on the
+// version of the fetched branch, if the server reports one: if another write
+// got in between, the branch is fetched and updated again, up to
+// maxWriteAttempts times. It returns the configuration of the written branch.
+func updateBranch(v *viper.Viper, configure func(config *stacksenv.Config), update branchUpdate) (*stacksenv.Config, error) {
+	config, err := resolveStacksenvConfig(v)
+	if err != nil {
+		return nil, err
+	}
+	if configure != nil {
+		configure(config)
+	}
+	if err := checkMinServerVersion(v, config); err != nil {
+		return nil, err
+	}
+	config.IncludeDeleted = true
+	config.NoPersonal = true
+
+	service, err := newServerClientService(v)
+	if err != nil {
+		return nil, err
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	for attempt := 1; ; attempt++ {
+		err := writeBranch(ctx, v, service, config, update)
+		if errors.Is(err, stacksenv.ErrConflict) && attempt < maxWriteAttempts {
+			debugLog("Branch %s changed while updating it, retrying", config.Branch)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return config, nil
+	}
+}
+
+// writeBranch performs a single fetch, update and write of updateBranch.
+func writeBranch(ctx context.Context, v *viper.Viper, service stacksenv.ClientService, config *stacksenv.Config, update branchUpdate) error {
+	properties, version, err := stacksenv.FetchVersionedWithContext(ctx, service, config)
+	if ctx.Err() != nil {
+		return errors.New("interrupted while fetching the environment")
+	}
+	if err != nil {
+		return handleRevoked(logRequestID(fmt.Errorf("unable to retrieve environment context data: %w", err)))
+	}
+
+	updated, err := update(properties)
+	if err != nil {
+		return err
+	}
+	err = checkValidators(v, validatorInput{
+		Source:    "server",
+		Branch:    config.Branch,
+		Variables: stacksenv.NewEnvSet(updated).Map(),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = stacksenv.PutIfMatchWithContext(ctx, service, config, updated, version)
+	if ctx.Err() != nil {
+		return errors.New("interrupted while writing the environment: it may have been written")
+	}
+	if errors.Is(err, stacksenv.ErrConflict) {
+		return fmt.Errorf("unable to write the environment: %w", err)
+	}
+	if err != nil {
+		return handleRevoked(logRequestID(fmt.Errorf("unable to write the environment: %w", err)))
+	}
+	return nil
+}
+
+// setVariables sets the values of variables in properties, replacing the
+// variables and tombstones with the same names. A replaced variable keeps its
+// platform restrictions, unless the name had variants for several platforms,
+// which are replaced by a variable for every platform.
+func setVariables(properties []stacksenv.ContextData[any], values map[string]string) []stacksenv.ContextData[any] {
+	variants := make(map[string]int, len(values))
+	for _, contextData := range properties {
+		if !contextData.IsDeleted() {
+			variants[contextData.Property]++
+		}
+	}
+
+	updated := make([]stacksenv.ContextData[any], 0, len(properties)+len(values))
+	set := make(map[string]bool, len(values))
+	for _, contextData := range properties {
+		value, ok := values[contextData.Property]
+		if !ok {
+			updated = append(updated, contextData)
+			continue
+		}
+		if set[contextData.Property] {
+			continue
+		}
+		set[contextData.Property] = true
+		replacement := stacksenv.ContextData[any]{Property: contextData.Property, Value: value}
+		if variants[contextData.Property] == 1 && !contextData.IsDeleted() {
+			replacement.OS, replacement.Arch = contextData.OS, contextData.Arch
+		}
+		updated = append(updated, replacement)
+	}
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if !set[name] {
+			updated = append(updated, stacksenv.ContextData[any]{Property: name, Value: values[name]})
+		}
+	}
+	return updated
+}
@@ -0,0 +1,327 @@
+// Package configstore reads and writes the configuration files of the CLI:
+// JSON, YAML and TOML files, read whatever their extension and written back
+// in the format they were read in, replaced atomically and updated under an
+// advisory lock so concurrent processes don't lose each other's changes.
+//
+// Configuration data is handled as generic maps, as decoded from the files.
+// Lookup, Delete and the typed accessors match keys case-insensitively like
+// viper does, and Migrate upgrades the data to the current schema version.
+package configstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/stacksenv/cli/pkg/filelock"
+	"go.yaml.in/yaml/v3"
+)
+
+// Format is the serialization format of a configuration file.
+type Format int
+
+// Supported formats.
+const (
+	JSON Format = iota
+	YAML
+	TOML
+)
+
+// String returns the name of the format.
+func (f Format) String() string {
+	switch f {
+	case YAML:
+		return "YAML"
+	case TOML:
+		return "TOML"
+	default:
+		return "JSON"
+	}
+}
+
+// Extensions lists the extensions of configuration files, in the order Find
+// looks for them.
+var Extensions = []string{"json", "toml", "yaml", "yml"}
+
+// FormatFromExt returns the format implied by the extension of a
+// configuration file path, and false if the extension doesn't imply one.
+func FormatFromExt(path string) (Format, bool) {
+	switch filepath.Ext(path) {
+	case ".json":
+		return JSON, true
+	case ".yaml", ".yml":
+		return YAML, true
+	case ".toml":
+		return TOML, true
+	}
+	return JSON, false
+}
+
+// Unmarshal parses configuration data in the given format.
+func Unmarshal(data []byte, format Format) (map[string]interface{}, error) {
+	configData := make(map[string]interface{})
+	var err error
+	switch format {
+	case YAML:
+		err = yaml.Unmarshal(data, &configData)
+	case TOML:
+		err = toml.Unmarshal(data, &configData)
+	default:
+		err = json.Unmarshal(data, &configData)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if configData == nil {
+		configData = make(map[string]interface{})
+	}
+	return configData, nil
+}
+
+// Marshal serializes configuration data in the given format.
+func Marshal(configData map[string]interface{}, format Format) ([]byte, error) {
+	switch format {
+	case YAML:
+		return yaml.Marshal(configData)
+	case TOML:
+		return toml.Marshal(configData)
+	default:
+		data, err := json.MarshalIndent(configData, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+}
+
+// Parse parses the contents of the configuration file at path and returns
+// them along with their format.
+//
+// The format implied by the extension of path is tried first, then JSON (for
+// content starting with '{'), YAML and TOML, so extensionless files are
+// parsed too.
+func Parse(data []byte, path string) (map[string]interface{}, Format, error) {
+	candidates := []Format{YAML, TOML, JSON}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		candidates = []Format{JSON, YAML, TOML}
+	}
+	if extFormat, hasExt := FormatFromExt(path); hasExt {
+		candidates = append([]Format{extFormat}, slices.DeleteFunc(candidates, func(f Format) bool { return f == extFormat })...)
+	}
+
+	var firstErr error
+	for _, format := range candidates {
+		configData, err := Unmarshal(data, format)
+		if err == nil {
+			return configData, format, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, JSON, fmt.Errorf("failed to parse config file (tried JSON, YAML and TOML): %w", firstErr)
+}
+
+// ReadFile reads a configuration file and returns its contents along with its
+// format, see Parse. A missing file yields an empty configuration; its format
+// is derived from the file extension.
+func ReadFile(path string) (map[string]interface{}, Format, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		format, _ := FormatFromExt(path)
+		return make(map[string]interface{}), format, nil
+	}
+	if err != nil {
+		return nil, JSON, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return Parse(data, path)
+}
+
+// Find returns the path of the first existing configuration file named name
+// with one of the Extensions in the given directories, searched in order.
+func Find(name string, dirs ...string) (string, bool) {
+	for _, dir := range dirs {
+		for _, ext := range Extensions {
+			path := filepath.Join(dir, name+"."+ext)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path, true
+			}
+		}
+	}
+	return "", false
+}
+
+// FileMode is the mode of the configuration files, which hold credentials:
+// readable and writable by their owner only.
+const FileMode os.FileMode = 0600
+
+// WriteFileAtomic writes data to a file through a temporary file renamed over
+// it, so readers never see a partially written file. An existing file keeps
+// its permissions; a new one is created with perm.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return writeFileAtomic(path, data, perm)
+}
+
+// WritePrivateFileAtomic is like WriteFileAtomic for files holding
+// credentials: the file gets FileMode, even if it existed with wider
+// permissions.
+func WritePrivateFileAtomic(path string, data []byte) error {
+	return writeFileAtomic(path, data, FileMode)
+}
+
+// writeFileAtomic writes data to path through a temporary file with perm.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// Removing the file fails once it is renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// DefaultLockTimeout is how long a Store waits for other processes to finish
+// writing a configuration file unless LockTimeout is set.
+const DefaultLockTimeout = 30 * time.Second
+
+// Store reads and writes configuration files. The hooks let the CLI keep
+// credentials out of the files: Open is applied to the data of every file
+// read and Seal to the data of every file written.
+type Store struct {
+	// Open, if set, is called with the data of every file read, e.g. to
+	// decrypt the sealed values in place.
+	Open func(configData map[string]interface{}) error
+	// Seal, if set, returns the data to write to the file at path instead of
+	// configData, e.g. with its credentials encrypted. It must not modify
+	// configData.
+	Seal func(path string, configData map[string]interface{}) (map[string]interface{}, error)
+	// AfterWrite, if set, is called once a file is written with the data
+	// written, e.g. to write companion files.
+	AfterWrite func(path string, configData map[string]interface{}, format Format) error
+	// Replaced, if set, is called once a file is written with the data it
+	// held before, as stored (not opened), nil if it didn't exist, and the
+	// data written, e.g. to remove the credentials only the previous data
+	// referenced.
+	Replaced func(path string, previous, written map[string]interface{})
+	// LockTimeout is how long Lock waits for the lock of a file, or
+	// DefaultLockTimeout if zero.
+	LockTimeout time.Duration
+}
+
+// Read reads a configuration file like ReadFile and opens its data.
+func (s *Store) Read(path string) (map[string]interface{}, Format, error) {
+	configData, format, err := ReadFile(path)
+	if err != nil {
+		return nil, format, err
+	}
+	if s.Open != nil {
+		if err := s.Open(configData); err != nil {
+			return nil, format, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return configData, format, nil
+}
+
+// Write writes configuration data to a file in the given format, creating
+// its directory if needed, and replacing the file atomically. The file gets
+// FileMode, as it may hold credentials.
+func (s *Store) Write(path string, configData map[string]interface{}, format Format) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	var previous map[string]interface{}
+	if s.Replaced != nil {
+		previous, _, _ = ReadFile(path)
+	}
+	if s.Seal != nil {
+		var err error
+		if configData, err = s.Seal(path, configData); err != nil {
+			return err
+		}
+	}
+	data, err := Marshal(configData, format)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config to %s: %w", format, err)
+	}
+	if err := WritePrivateFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	if s.Replaced != nil {
+		s.Replaced(path, previous, configData)
+	}
+	if s.AfterWrite != nil {
+		return s.AfterWrite(path, configData, format)
+	}
+	return nil
+}
+
+// Lock takes the advisory lock of a configuration file, to be held from
+// reading the file until writing it back so concurrent updates, e.g. by
+// parallel CI jobs, aren't lost. It returns the function releasing the lock.
+func (s *Store) Lock(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+	timeout := s.LockTimeout
+	if timeout == 0 {
+		timeout = DefaultLockTimeout
+	}
+	lock, err := filelock.Acquire(path+".lock", timeout)
+	if errors.Is(err, filelock.ErrTimeout) {
+		return nil, fmt.Errorf("%s is being updated by another stacksenv process: %w", path, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		lock.Release() //nolint:errcheck
+	}, nil
+}
+
+// Update applies update to the data of a configuration file under its lock
+// and writes the data back in the format it was read in if update reports a
+// change. A missing file is created, in the format implied by its extension.
+func (s *Store) Update(path string, update func(configData map[string]interface{}) (bool, error)) error {
+	unlock, err := s.Lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	configData, format, err := s.Read(path)
+	if err != nil {
+		return err
+	}
+	changed, err := update(configData)
+	if err != nil || !changed {
+		return err
+	}
+	return s.Write(path, configData, format)
+}
@@ -0,0 +1,145 @@
+package configstore
+
+import (
+	"math"
+	"strings"
+)
+
+// Lookup looks up a dotted key in configuration data, matching each segment
+// case-insensitively like viper does.
+func Lookup(configData map[string]interface{}, key string) (interface{}, bool) {
+	var current interface{} = configData
+	for _, segment := range strings.Split(key, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		found := false
+		for k, value := range m {
+			if strings.EqualFold(k, segment) {
+				current, found = value, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// Delete removes a dotted key from configuration data, matching each segment
+// case-insensitively. It reports whether the key was present.
+func Delete(configData map[string]interface{}, key string) bool {
+	parentKey, name := "", key
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		parentKey, name = key[:i], key[i+1:]
+	}
+
+	parent := configData
+	if parentKey != "" {
+		value, ok := Lookup(configData, parentKey)
+		if !ok {
+			return false
+		}
+		if parent, ok = value.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+
+	for k := range parent {
+		if strings.EqualFold(k, name) {
+			delete(parent, k)
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the string value of a dotted key, and false if the key is
+// missing or holds another type.
+func String(configData map[string]interface{}, key string) (string, bool) {
+	value, ok := Lookup(configData, key)
+	if !ok {
+		return "", false
+	}
+	s, ok := value.(string)
+	return s, ok
+}
+
+// Bool returns the boolean value of a dotted key, and false if the key is
+// missing or holds another type.
+func Bool(configData map[string]interface{}, key string) (bool, bool) {
+	value, ok := Lookup(configData, key)
+	if !ok {
+		return false, false
+	}
+	b, ok := value.(bool)
+	return b, ok
+}
+
+// Int returns the integer value of a dotted key, and false if the key is
+// missing or doesn't hold a whole number. Numbers are decoded as float64 from
+// JSON and as integers from YAML and TOML.
+func Int(configData map[string]interface{}, key string) (int, bool) {
+	value, ok := Lookup(configData, key)
+	if !ok {
+		return 0, false
+	}
+	return toInt(value)
+}
+
+// toInt converts a decoded number to an int, and returns false if value isn't
+// a whole number.
+func toInt(value interface{}) (int, bool) {
+	switch value := value.(type) {
+	case int:
+		return value, true
+	case int64:
+		return int(value), true
+	case uint64:
+		return int(value), true
+	case float64:
+		if value != math.Trunc(value) {
+			return 0, false
+		}
+		return int(value), true
+	}
+	return 0, false
+}
+
+// Strings returns the list of strings of a dotted key, and false if the key
+// is missing or holds something else than a list of strings.
+func Strings(configData map[string]interface{}, key string) ([]string, bool) {
+	value, ok := Lookup(configData, key)
+	if !ok {
+		return nil, false
+	}
+	switch value := value.(type) {
+	case []string:
+		return value, true
+	case []interface{}:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			list = append(list, s)
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+// Map returns the mapping of a dotted key, and false if the key is missing or
+// holds another type. The mapping is not copied.
+func Map(configData map[string]interface{}, key string) (map[string]interface{}, bool) {
+	value, ok := Lookup(configData, key)
+	if !ok {
+		return nil, false
+	}
+	m, ok := value.(map[string]interface{})
+	return m, ok
+}
@@ -0,0 +1,81 @@
+package configstore
+
+import (
+	"fmt"
+	"math"
+)
+
+// VersionKey is the configuration key holding the schema version of a
+// configuration file. Files without it are version 0.
+const VersionKey = "version"
+
+// Migration upgrades configuration data from the previous schema version to
+// Version.
+type Migration struct {
+	Version     int
+	Description string
+	Migrate     func(configData map[string]interface{})
+}
+
+// CurrentVersion returns the schema version reached by a list of migrations,
+// given in order: the version of the last one.
+func CurrentVersion(migrations []Migration) int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// Version returns the schema version of configuration data.
+func Version(configData map[string]interface{}) (int, error) {
+	value, ok := configData[VersionKey]
+	if !ok || value == nil {
+		return 0, nil
+	}
+
+	var version float64
+	switch value := value.(type) {
+	case int:
+		version = float64(value)
+	case int64:
+		version = float64(value)
+	case uint64:
+		version = float64(value)
+	case float64:
+		version = value
+	default:
+		return 0, fmt.Errorf("invalid config version %v: expected a number", value)
+	}
+	if version < 0 || version != math.Trunc(version) {
+		return 0, fmt.Errorf("invalid config version %v: expected a non-negative integer", value)
+	}
+	return int(version), nil
+}
+
+// Migrate applies the pending migrations, given in order, to configuration
+// data in place and stamps it with the current version. It returns the
+// descriptions of the applied migrations, and an error without touching the
+// data if the version is invalid or newer than the migrations reach.
+func Migrate(configData map[string]interface{}, migrations []Migration) ([]string, error) {
+	version, err := Version(configData)
+	if err != nil {
+		return nil, err
+	}
+	current := CurrentVersion(migrations)
+	if version > current {
+		return nil, fmt.Errorf("config version %d is newer than this version of stacksenv supports (%d): please upgrade stacksenv", version, current)
+	}
+
+	var applied []string
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+		migration.Migrate(configData)
+		applied = append(applied, fmt.Sprintf("version %d: %s", migration.Version, migration.Description))
+	}
+	if len(applied) > 0 {
+		configData[VersionKey] = current
+	}
+	return applied, nil
+}
@@ -0,0 +1,340 @@
+// Package dotenv reads environment variables from dotenv (.env) files.
+//
+// The syntax is:
+//
+//	# comment
+//	KEY=value
+//	export KEY=value
+//	KEY='literal value'
+//	KEY="value with \n escapes"
+//	KEY="value spanning
+//	multiple lines"
+//
+// Single-quoted values are taken literally. Double-quoted values support the
+// escapes \n, \r, \t, \", \\ and \$. Both may span multiple lines and may be
+// followed by a comment.
+//
+// Files are parsed in one of two modes:
+//
+// Lenient mode (Parse, ReadFile) accepts the variations found in real-world
+// files and normalizes them:
+//   - a leading UTF-8 byte order mark is removed
+//   - CRLF line endings are treated like LF
+//   - whitespace around keys, around "=" and around unquoted values is trimmed
+//   - unquoted values may contain spaces, e.g. KEY=hello world
+//   - in unquoted values, " #" starts a comment, e.g. KEY=value # comment
+//   - unknown escapes in double-quoted values are kept as the escaped character
+//   - keys may contain any character except whitespace and "="
+//   - if a key is defined more than once, the last value wins and the variable
+//     keeps the position of its first definition
+//
+// Strict mode (ParseStrict, ReadFileStrict) reports each of these
+// normalizations as a problem instead, with its line and column. Keys must then
+// be valid shell variable names ([A-Za-z_][A-Za-z0-9_]*).
+//
+// Lines that are not assignments and unterminated quotes are errors in both modes.
+package dotenv
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Variable is a single KEY=VALUE assignment of a dotenv file.
+type Variable struct {
+	Key   string
+	Value string
+}
+
+// ParseError is a problem found at a specific position of a dotenv file.
+// Lines and columns start at 1; columns count characters, not bytes.
+type ParseError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// Errors lists all problems found in a dotenv file, in file order.
+type Errors []*ParseError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// strictKeyPattern matches the keys accepted in strict mode.
+var strictKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// byteOrderMark is the UTF-8 encoded byte order mark.
+const byteOrderMark = "\ufeff"
+
+// ReadFile reads and parses the dotenv file at path in lenient mode.
+func ReadFile(path string) ([]Variable, error) {
+	return readFile(path, false)
+}
+
+// ReadFileStrict reads and parses the dotenv file at path in strict mode.
+func ReadFileStrict(path string) ([]Variable, error) {
+	return readFile(path, true)
+}
+
+func readFile(path string, strict bool) ([]Variable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	vars, err := parse(data, strict)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return vars, nil
+}
+
+// Parse parses dotenv data in lenient mode and returns the assignments in file
+// order. Errors are returned as Errors.
+func Parse(data []byte) ([]Variable, error) {
+	return parse(data, false)
+}
+
+// ParseStrict parses dotenv data in strict mode and returns the assignments in
+// file order. All problems found are returned together as Errors.
+func ParseStrict(data []byte) ([]Variable, error) {
+	return parse(data, true)
+}
+
+// parser holds the state of a single parse.
+type parser struct {
+	lines  []string
+	strict bool
+	errs   Errors
+
+	vars      []Variable
+	index     map[string]int // key -> index in vars
+	firstLine map[string]int // key -> line of the first definition
+}
+
+func parse(data []byte, strict bool) ([]Variable, error) {
+	text := string(data)
+	p := &parser{
+		strict:    strict,
+		index:     make(map[string]int),
+		firstLine: make(map[string]int),
+	}
+
+	if strings.HasPrefix(text, byteOrderMark) {
+		p.problem(1, 1, "byte order mark at the start of the file")
+		text = strings.TrimPrefix(text, byteOrderMark)
+	}
+
+	p.lines = strings.Split(text, "\n")
+	for i := 0; i < len(p.lines); i++ {
+		i = p.parseLine(i)
+	}
+
+	if len(p.errs) > 0 {
+		slices.SortStableFunc(p.errs, func(a, b *ParseError) int {
+			return cmp.Or(cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column))
+		})
+		return nil, p.errs
+	}
+	return p.vars, nil
+}
+
+// fail records an error reported in both modes.
+func (p *parser) fail(line, column int, format string, args ...any) {
+	p.errs = append(p.errs, &ParseError{Line: line, Column: column, Msg: fmt.Sprintf(format, args...)})
+}
+
+// problem records an error reported in strict mode only.
+func (p *parser) problem(line, column int, format string, args ...any) {
+	if p.strict {
+		p.fail(line, column, format, args...)
+	}
+}
+
+// line returns line i without its line ending, reporting CRLF endings.
+func (p *parser) line(i int) string {
+	line := p.lines[i]
+	if stripped, ok := strings.CutSuffix(line, "\r"); ok {
+		p.problem(i+1, utf8.RuneCountInString(line), "carriage return (CRLF line ending)")
+		return stripped
+	}
+	return line
+}
+
+// parseLine parses the assignment starting on line i and returns the index of
+// the last line it consumed.
+func (p *parser) parseLine(i int) int {
+	lineNo := i + 1
+	line := p.line(i)
+
+	// col is the 1-based column of the first character of rest
+	rest := strings.TrimLeftFunc(line, unicode.IsSpace)
+	col := 1 + utf8.RuneCountInString(line) - utf8.RuneCountInString(rest)
+	if rest == "" || strings.HasPrefix(rest, "#") {
+		return i
+	}
+	advance := func(n int) {
+		col += utf8.RuneCountInString(rest[:n])
+		rest = rest[n:]
+	}
+
+	if after, ok := strings.CutPrefix(rest, "export"); ok && after != "" && (after[0] == ' ' || after[0] == '\t') {
+		advance(len(rest) - len(strings.TrimLeft(after, " \t")))
+	}
+
+	eq := strings.IndexByte(rest, '=')
+	if eq < 0 {
+		p.fail(lineNo, col, "expected KEY=VALUE")
+		return i
+	}
+
+	keyCol := col
+	key := strings.TrimRightFunc(rest[:eq], unicode.IsSpace)
+	switch {
+	case key == "":
+		p.fail(lineNo, keyCol, "missing variable name")
+		return i
+	case strings.IndexFunc(key, unicode.IsSpace) >= 0:
+		p.fail(lineNo, keyCol, "variable name %q contains whitespace", key)
+		return i
+	case !strictKeyPattern.MatchString(key):
+		p.problem(lineNo, keyCol, "invalid variable name %q", key)
+	}
+	if len(key) < eq {
+		p.problem(lineNo, keyCol+utf8.RuneCountInString(key), "whitespace before '='")
+	}
+	advance(eq + 1)
+
+	if trimmed := strings.TrimLeft(rest, " \t"); len(trimmed) < len(rest) && trimmed != "" && trimmed[0] != '#' {
+		p.problem(lineNo, col, "whitespace after '='")
+		advance(len(rest) - len(trimmed))
+	}
+
+	var (
+		value string
+		ok    bool
+	)
+	switch {
+	case strings.HasPrefix(rest, "'") || strings.HasPrefix(rest, `"`):
+		value, i, ok = p.parseQuoted(i, rest, col)
+		if !ok {
+			return i
+		}
+	default:
+		value = p.parseUnquoted(lineNo, rest, col)
+	}
+
+	p.define(lineNo, keyCol, key, value)
+	return i
+}
+
+// parseUnquoted parses an unquoted value starting at column col of line lineNo.
+func (p *parser) parseUnquoted(lineNo int, value string, col int) string {
+	if j := strings.Index(value, " #"); j >= 0 {
+		p.problem(lineNo, col+utf8.RuneCountInString(value[:j+1]), "comment after unquoted value (quote the value to keep '#')")
+		value = value[:j]
+	} else if j := strings.Index(value, "\t#"); j >= 0 {
+		p.problem(lineNo, col+utf8.RuneCountInString(value[:j+1]), "comment after unquoted value (quote the value to keep '#')")
+		value = value[:j]
+	}
+
+	trimmed := strings.TrimRightFunc(value, unicode.IsSpace)
+	if j := strings.IndexFunc(trimmed, unicode.IsSpace); j >= 0 {
+		p.problem(lineNo, col+utf8.RuneCountInString(trimmed[:j]), "unquoted value contains whitespace (quote the value)")
+	} else if len(trimmed) < len(value) {
+		p.problem(lineNo, col+utf8.RuneCountInString(trimmed), "trailing whitespace after value")
+	}
+	return trimmed
+}
+
+// parseQuoted parses a quoted value starting with the quote at column col of
+// line i. The value may continue on the following lines. It returns the value,
+// the index of the last line consumed and whether the value was terminated.
+func (p *parser) parseQuoted(i int, rest string, col int) (string, int, bool) {
+	startLine, startCol := i+1, col
+	quote := rest[0]
+	rest = rest[1:]
+	col++
+
+	var b strings.Builder
+	for {
+		for j := 0; j < len(rest); j++ {
+			c := rest[j]
+			switch {
+			case c == quote:
+				p.checkAfterQuote(i+1, col+utf8.RuneCountInString(rest[:j+1]), rest[j+1:])
+				return b.String(), i, true
+
+			case c == '\\' && quote == '"' && j+1 < len(rest):
+				j++
+				switch rest[j] {
+				case 'n':
+					b.WriteByte('\n')
+				case 'r':
+					b.WriteByte('\r')
+				case 't':
+					b.WriteByte('\t')
+				case '"', '\\', '$':
+					b.WriteByte(rest[j])
+				default:
+					p.problem(i+1, col+utf8.RuneCountInString(rest[:j-1]), "unknown escape sequence \\%c", rest[j])
+					b.WriteByte(rest[j])
+				}
+
+			default:
+				b.WriteByte(c)
+			}
+		}
+
+		// The value continues on the next line
+		if i+1 >= len(p.lines) {
+			kind := "double"
+			if quote == '\'' {
+				kind = "single"
+			}
+			p.fail(startLine, startCol, "unterminated %s-quoted value", kind)
+			return "", i, false
+		}
+		i++
+		b.WriteByte('\n')
+		rest, col = p.line(i), 1
+	}
+}
+
+// checkAfterQuote checks the text following a closing quote: only whitespace
+// and a comment are allowed.
+func (p *parser) checkAfterQuote(lineNo, col int, after string) {
+	trimmed := strings.TrimLeftFunc(after, unicode.IsSpace)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return
+	}
+	p.fail(lineNo, col+utf8.RuneCountInString(after)-utf8.RuneCountInString(trimmed), "unexpected text after closing quote")
+}
+
+// define records an assignment, handling duplicate keys.
+func (p *parser) define(lineNo, col int, key, value string) {
+	if n, ok := p.index[key]; ok {
+		p.problem(lineNo, col, "duplicate key %q (first defined on line %d)", key, p.firstLine[key])
+		p.vars[n].Value = value
+		return
+	}
+
+	p.index[key] = len(p.vars)
+	p.firstLine[key] = lineNo
+	p.vars = append(p.vars, Variable{Key: key, Value: value})
+}
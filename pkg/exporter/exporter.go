@@ -0,0 +1,91 @@
+// Package exporter writes environment variables in file formats understood by
+// other tools, such as dotenv files, Terraform variable files or Kubernetes
+// Secrets.
+//
+// Formats are registered by name in a registry, so new formats can be added
+// with Register without touching the commands that export variables.
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Variable is a single environment variable to export.
+type Variable struct {
+	Key   string
+	Value string
+}
+
+// Exporter writes variables in a specific format.
+type Exporter interface {
+	// Name returns the format name used to select the exporter, e.g. "dotenv".
+	Name() string
+	// Description returns a short, human-readable description of the format.
+	Description() string
+	// Export writes the variables to w, in the given order.
+	Export(w io.Writer, vars []Variable) error
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Exporter)
+)
+
+// Register makes an exporter available under its name. Registering a name
+// twice replaces the previous exporter.
+func Register(e Exporter) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToLower(e.Name())] = e
+}
+
+// Get returns the exporter registered under name, ignoring case.
+func Get(name string) (Exporter, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	e, ok := registry[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported export format %q (supported: %s)", name, strings.Join(names(), ", "))
+	}
+	return e, nil
+}
+
+// List returns all registered exporters sorted by name.
+func List() []Exporter {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	exporters := make([]Exporter, 0, len(registry))
+	for _, name := range names() {
+		exporters = append(exporters, registry[name])
+	}
+	return exporters
+}
+
+// names returns the sorted names of the registered exporters. The caller must
+// hold registryMu.
+func names() []string {
+	list := make([]string, 0, len(registry))
+	for name := range registry {
+		list = append(list, name)
+	}
+	slices.Sort(list)
+	return list
+}
+
+// FromMap converts a map of variables to a slice sorted by key.
+func FromMap(values map[string]string) []Variable {
+	vars := make([]Variable, 0, len(values))
+	for key, value := range values {
+		vars = append(vars, Variable{Key: key, Value: value})
+	}
+	slices.SortFunc(vars, func(a, b Variable) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return vars
+}
@@ -0,0 +1,179 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+func init() {
+	Register(dotenvExporter{})
+	Register(jsonExporter{})
+	Register(yamlExporter{})
+	Register(tfvarsExporter{})
+	Register(k8sExporter{})
+	Register(systemdExporter{})
+	Register(shellExporter{})
+}
+
+// plainValuePattern matches values that need no quoting in dotenv and systemd files.
+var plainValuePattern = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+
+// quoteDouble quotes s in double quotes, escaping backslashes, double quotes
+// and line breaks.
+func quoteDouble(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`).Replace(s) + `"`
+}
+
+// dotenvExporter writes KEY=VALUE lines readable by the dotenv package.
+type dotenvExporter struct{}
+
+func (dotenvExporter) Name() string        { return "dotenv" }
+func (dotenvExporter) Description() string { return "KEY=VALUE lines (.env file)" }
+
+func (dotenvExporter) Export(w io.Writer, vars []Variable) error {
+	return writeAssignments(w, vars)
+}
+
+// jsonExporter writes a JSON object mapping names to values.
+type jsonExporter struct{}
+
+func (jsonExporter) Name() string        { return "json" }
+func (jsonExporter) Description() string { return "JSON object" }
+
+func (jsonExporter) Export(w io.Writer, vars []Variable) error {
+	values := make(map[string]string, len(vars))
+	for _, v := range vars {
+		values[v.Key] = v.Value
+	}
+
+	// encoding/json sorts map keys
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// yamlExporter writes a YAML mapping of names to values.
+type yamlExporter struct{}
+
+func (yamlExporter) Name() string        { return "yaml" }
+func (yamlExporter) Description() string { return "YAML mapping" }
+
+func (yamlExporter) Export(w io.Writer, vars []Variable) error {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, v := range vars {
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: v.Key},
+			// Force strings so values like "true" or "8080" keep their type
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v.Value},
+		)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// tfvarsExporter writes a Terraform variable definitions file.
+type tfvarsExporter struct{}
+
+func (tfvarsExporter) Name() string        { return "tfvars" }
+func (tfvarsExporter) Description() string { return "Terraform variable definitions (.tfvars)" }
+
+func (tfvarsExporter) Export(w io.Writer, vars []Variable) error {
+	for _, v := range vars {
+		// Escape template sequences so values are taken literally
+		value := strings.NewReplacer("${", "$${", "%{", "%%{").Replace(v.Value)
+		if _, err := fmt.Fprintf(w, "%s = %s\n", v.Key, quoteDouble(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// k8sExporter writes a Kubernetes Secret manifest.
+type k8sExporter struct{}
+
+func (k8sExporter) Name() string        { return "k8s" }
+func (k8sExporter) Description() string { return "Kubernetes Secret manifest" }
+
+func (k8sExporter) Export(w io.Writer, vars []Variable) error {
+	stringData := &yaml.Node{Kind: yaml.MappingNode}
+	for _, v := range vars {
+		stringData.Content = append(stringData.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: v.Key},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v.Value},
+		)
+	}
+
+	manifest := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "apiVersion"}, {Kind: yaml.ScalarNode, Value: "v1"},
+		{Kind: yaml.ScalarNode, Value: "kind"}, {Kind: yaml.ScalarNode, Value: "Secret"},
+		{Kind: yaml.ScalarNode, Value: "metadata"}, {Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "name"}, {Kind: yaml.ScalarNode, Value: "stacksenv"},
+		}},
+		{Kind: yaml.ScalarNode, Value: "type"}, {Kind: yaml.ScalarNode, Value: "Opaque"},
+		{Kind: yaml.ScalarNode, Value: "stringData"}, stringData,
+	}}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// systemdExporter writes a file for the EnvironmentFile= directive of systemd units.
+type systemdExporter struct{}
+
+func (systemdExporter) Name() string        { return "systemd" }
+func (systemdExporter) Description() string { return "systemd EnvironmentFile" }
+
+// Both formats share the KEY=VALUE syntax with C-style escapes in double quotes.
+func (systemdExporter) Export(w io.Writer, vars []Variable) error {
+	return writeAssignments(w, vars)
+}
+
+// shellExporter writes export statements for POSIX shells, e.g. for
+// eval "$(stacksenv env export --format shell)".
+type shellExporter struct{}
+
+func (shellExporter) Name() string        { return "shell" }
+func (shellExporter) Description() string { return "export statements for POSIX shells" }
+
+func (shellExporter) Export(w io.Writer, vars []Variable) error {
+	for _, v := range vars {
+		// Nothing is special inside single quotes except the quote itself
+		value := "'" + strings.ReplaceAll(v.Value, "'", `'\''`) + "'"
+		if _, err := fmt.Fprintf(w, "export %s=%s\n", v.Key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAssignments writes KEY=VALUE lines, double-quoting values that contain
+// whitespace or special characters.
+func writeAssignments(w io.Writer, vars []Variable) error {
+	for _, v := range vars {
+		value := v.Value
+		if !plainValuePattern.MatchString(value) {
+			value = quoteDouble(value)
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", v.Key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
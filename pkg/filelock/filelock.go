@@ -0,0 +1,62 @@
+// Package filelock provides advisory, exclusive locks on files, so processes
+// can serialize read-modify-write cycles on shared files such as the global
+// configuration.
+//
+// Locks are advisory: they only exclude processes that also take them. They
+// are held on a separate lock file, so the locked file itself can be replaced
+// atomically while the lock is held.
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrTimeout is returned when a lock can't be acquired in time.
+var ErrTimeout = errors.New("timed out waiting for the lock")
+
+// pollInterval is how often Acquire retries to acquire a busy lock.
+const pollInterval = 50 * time.Millisecond
+
+// Lock is an acquired lock.
+type Lock struct {
+	f *os.File
+}
+
+// Acquire takes the exclusive lock on the lock file at path, creating it if
+// needed, waiting up to timeout for other processes to release it.
+func Acquire(path string, timeout time.Duration) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if locked {
+			return &Lock{f: f}, nil
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, ErrTimeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// Release releases the lock. Closing the lock file releases it as well, so
+// locks are also released when the process exits.
+func (l *Lock) Release() error {
+	unlockErr := unlock(l.f)
+	if err := l.f.Close(); err != nil && unlockErr == nil {
+		return err
+	}
+	return unlockErr
+}
@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package filelock
+
+import "os"
+
+// Platforms without file locking, like WebAssembly, run a single process.
+
+func tryLock(*os.File) (bool, error) {
+	return true, nil
+}
+
+func unlock(*os.File) error {
+	return nil
+}
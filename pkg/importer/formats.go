@@ -0,0 +1,269 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/stacksenv/cli/pkg/dotenv"
+	"go.yaml.in/yaml/v3"
+)
+
+// The registration order is the detection order: unambiguous formats first.
+func init() {
+	Register(jsonImporter{})
+	Register(dotenvImporter{})
+	Register(shellImporter{})
+	Register(tomlImporter{})
+	Register(yamlImporter{})
+}
+
+var (
+	// dotenvLinePattern matches a dotenv assignment: no whitespace before "=".
+	dotenvLinePattern = regexp.MustCompile(`^(export\s+)?[A-Za-z_][A-Za-z0-9_.]*=`)
+	// tomlLinePattern matches a TOML key/value pair or table header.
+	tomlLinePattern = regexp.MustCompile(`^([A-Za-z0-9_-]+\s*=\s*\S|\[[^\]]+\]$)`)
+	// yamlLinePattern matches a YAML mapping entry.
+	yamlLinePattern = regexp.MustCompile(`^[A-Za-z_"'][^:]*:(\s|$)`)
+	// shellNamePattern matches a valid shell variable name.
+	shellNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// contentLines returns the trimmed lines of data, skipping blank lines and comments.
+func contentLines(data []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// allLinesMatch reports whether data has content lines and all of them match pattern.
+func allLinesMatch(data []byte, pattern *regexp.Regexp) bool {
+	lines := contentLines(data)
+	return len(lines) > 0 && !slices.ContainsFunc(lines, func(line string) bool {
+		return !pattern.MatchString(line)
+	})
+}
+
+// fromValues converts decoded document values to variables sorted by name.
+// Only scalar values are supported.
+func fromValues(values map[string]any) ([]Variable, error) {
+	vars := make([]Variable, 0, len(values))
+	for key, value := range values {
+		switch v := value.(type) {
+		case map[string]any, []any:
+			return nil, fmt.Errorf("value of %s is not a scalar", key)
+		case nil:
+			vars = append(vars, Variable{Key: key})
+		case string:
+			vars = append(vars, Variable{Key: key, Value: v})
+		default:
+			vars = append(vars, Variable{Key: key, Value: fmt.Sprint(v)})
+		}
+	}
+	slices.SortFunc(vars, func(a, b Variable) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return vars, nil
+}
+
+// jsonImporter reads a JSON object mapping names to scalar values.
+type jsonImporter struct{}
+
+func (jsonImporter) Name() string        { return "json" }
+func (jsonImporter) Description() string { return "JSON object" }
+
+func (jsonImporter) Detect(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+func (jsonImporter) Import(data []byte) ([]Variable, error) {
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return fromValues(values)
+}
+
+// yamlImporter reads a YAML mapping of names to scalar values.
+type yamlImporter struct{}
+
+func (yamlImporter) Name() string        { return "yaml" }
+func (yamlImporter) Description() string { return "YAML mapping" }
+
+func (yamlImporter) Detect(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("---")) {
+		return true
+	}
+	lines := contentLines(data)
+	return len(lines) > 0 && yamlLinePattern.MatchString(lines[0])
+}
+
+func (yamlImporter) Import(data []byte) ([]Variable, error) {
+	var values map[string]any
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return fromValues(values)
+}
+
+// tomlImporter reads a TOML document with top-level scalar values.
+type tomlImporter struct{}
+
+func (tomlImporter) Name() string        { return "toml" }
+func (tomlImporter) Description() string { return "TOML document" }
+
+func (tomlImporter) Detect(data []byte) bool {
+	return allLinesMatch(data, tomlLinePattern)
+}
+
+func (tomlImporter) Import(data []byte) ([]Variable, error) {
+	var values map[string]any
+	if err := toml.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return fromValues(values)
+}
+
+// dotenvImporter reads KEY=VALUE lines (.env files).
+type dotenvImporter struct{}
+
+func (dotenvImporter) Name() string        { return "dotenv" }
+func (dotenvImporter) Description() string { return "KEY=VALUE lines (.env file)" }
+
+func (dotenvImporter) Detect(data []byte) bool {
+	return allLinesMatch(data, dotenvLinePattern)
+}
+
+func (dotenvImporter) Import(data []byte) ([]Variable, error) {
+	return fromDotenv(dotenv.Parse(data))
+}
+
+func (dotenvImporter) ImportStrict(data []byte) ([]Variable, error) {
+	return fromDotenv(dotenv.ParseStrict(data))
+}
+
+// fromDotenv converts the result of a dotenv parse to variables.
+func fromDotenv(vars []dotenv.Variable, err error) ([]Variable, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	imported := make([]Variable, 0, len(vars))
+	for _, v := range vars {
+		imported = append(imported, Variable{Key: v.Key, Value: v.Value})
+	}
+	return imported, nil
+}
+
+// shellImporter reads shell scripts exporting variables, e.g. the output of
+// "export -p" or hand-written "export KEY=value" scripts. Lines that are not
+// variable assignments (shebangs, "set -e", function calls, ...) are skipped.
+// Quotes and backslash escapes are removed; variable references are kept as-is.
+type shellImporter struct{}
+
+func (shellImporter) Name() string        { return "shell" }
+func (shellImporter) Description() string { return "shell script with export statements" }
+
+func (shellImporter) Detect(data []byte) bool {
+	return slices.ContainsFunc(contentLines(data), func(line string) bool {
+		return strings.HasPrefix(line, "export ") || strings.HasPrefix(line, "declare -x ")
+	})
+}
+
+func (shellImporter) Import(data []byte) ([]Variable, error) {
+	var vars []Variable
+	for n, line := range contentLines(data) {
+		words, err := shellWords(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+
+		// Drop the export keyword, "declare -x" of "export -p" output
+		switch {
+		case len(words) > 0 && words[0] == "export":
+			words = words[1:]
+		case len(words) > 1 && words[0] == "declare" && words[1] == "-x":
+			words = words[2:]
+		}
+
+		for _, word := range words {
+			// Further statements separated by ";"
+			if word == "export" {
+				continue
+			}
+			key, value, ok := strings.Cut(word, "=")
+			if !ok || !shellNamePattern.MatchString(key) {
+				// Not an assignment; skip the rest of the statement
+				break
+			}
+			vars = append(vars, Variable{Key: key, Value: value})
+		}
+	}
+	return vars, nil
+}
+
+// shellWords splits a line into words like a POSIX shell does for simple
+// commands, removing quotes and backslash escapes. A trailing comment is dropped.
+func shellWords(line string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote != 0:
+			switch {
+			case r == quote:
+				quote = 0
+			case r == '\\' && quote == '"':
+				escaped = true
+			default:
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == '#' && !inWord:
+			return append(words, finishWord(&word, inWord)...), nil
+		case r == ' ' || r == '\t' || r == ';':
+			words = append(words, finishWord(&word, inWord)...)
+			inWord = false
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	return append(words, finishWord(&word, inWord)...), nil
+}
+
+// finishWord returns the current word, if any, and resets the builder.
+func finishWord(word *strings.Builder, inWord bool) []string {
+	if !inWord {
+		return nil
+	}
+	w := word.String()
+	word.Reset()
+	return []string{w}
+}
@@ -0,0 +1,118 @@
+// Package importer reads environment variables from files in various formats,
+// such as dotenv files, JSON or YAML documents and shell scripts exporting
+// variables.
+//
+// Formats are registered by name in a registry, and the format of an input can
+// be detected by sniffing its content with Detect.
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/stacksenv/cli/pkg/exporter"
+)
+
+// Variable is a single imported environment variable. It is the same type the
+// exporter package writes, so imported variables can be exported directly.
+type Variable = exporter.Variable
+
+// Importer reads variables from data in a specific format.
+type Importer interface {
+	// Name returns the format name used to select the importer, e.g. "dotenv".
+	Name() string
+	// Description returns a short, human-readable description of the format.
+	Description() string
+	// Detect reports whether data looks like it is in this format.
+	Detect(data []byte) bool
+	// Import parses data and returns the variables in input order.
+	Import(data []byte) ([]Variable, error)
+}
+
+// StrictImporter is implemented by importers that offer a strict parsing mode,
+// which reports every irregularity of the input as an error instead of
+// normalizing it.
+type StrictImporter interface {
+	Importer
+	// ImportStrict parses data in strict mode.
+	ImportStrict(data []byte) ([]Variable, error)
+}
+
+// ErrUnknownFormat is returned by Detect if no importer recognizes the input.
+var ErrUnknownFormat = errors.New("unable to detect the input format")
+
+var (
+	registryMu sync.RWMutex
+	// registry holds the importers in registration order, which is the order
+	// Detect tries them in.
+	registry []Importer
+)
+
+// Register makes an importer available under its name. Registering a name
+// twice replaces the previous importer but keeps its detection priority.
+// Newly registered importers are tried last by Detect.
+func Register(i Importer) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for n, existing := range registry {
+		if strings.EqualFold(existing.Name(), i.Name()) {
+			registry[n] = i
+			return
+		}
+	}
+	registry = append(registry, i)
+}
+
+// Get returns the importer registered under name, ignoring case.
+func Get(name string) (Importer, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for _, i := range registry {
+		if strings.EqualFold(i.Name(), name) {
+			return i, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported import format %q (supported: %s)", name, strings.Join(names(), ", "))
+}
+
+// List returns all registered importers sorted by name.
+func List() []Importer {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	importers := slices.Clone(registry)
+	slices.SortFunc(importers, func(a, b Importer) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return importers
+}
+
+// Detect returns the first registered importer that recognizes data.
+// It returns ErrUnknownFormat if none does.
+func Detect(data []byte) (Importer, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for _, i := range registry {
+		if i.Detect(data) {
+			return i, nil
+		}
+	}
+	return nil, ErrUnknownFormat
+}
+
+// names returns the sorted names of the registered importers. The caller must
+// hold registryMu.
+func names() []string {
+	list := make([]string, 0, len(registry))
+	for _, i := range registry {
+		list = append(list, i.Name())
+	}
+	slices.Sort(list)
+	return list
+}
@@ -0,0 +1,30 @@
+// Package keyring stores secrets in the credential store of the operating
+// system: the Keychain on macOS, the Credential Manager on Windows and the
+// Secret Service (e.g. GNOME Keyring or KWallet) on Linux and the BSDs.
+package keyring
+
+import "errors"
+
+var (
+	// ErrNotFound is returned when the keyring holds no secret for a service
+	// and account.
+	ErrNotFound = errors.New("secret not found in the keyring")
+	// ErrUnsupported is returned when no keyring is available on this system.
+	ErrUnsupported = errors.New("no keyring is available on this system")
+)
+
+// Get returns the secret stored for a service and account, or ErrNotFound.
+func Get(service, account string) (string, error) {
+	return get(service, account)
+}
+
+// Set stores a secret for a service and account, replacing any existing one.
+func Set(service, account, secret string) error {
+	return set(service, account, secret)
+}
+
+// Delete removes the secret stored for a service and account. Deleting a
+// secret that doesn't exist returns ErrNotFound.
+func Delete(service, account string) error {
+	return del(service, account)
+}
@@ -0,0 +1,65 @@
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// errItemNotFound is the exit status of security(1) for a missing item.
+const errItemNotFound = 44
+
+func get(service, account string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	if err != nil {
+		return "", securityError(err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func set(service, account, secret string) error {
+	// The commands of the interactive mode end at line breaks
+	if strings.ContainsAny(service+account+secret, "\r\n") {
+		return errors.New("keychain: secrets with line breaks can't be stored")
+	}
+	// Pass the secret on stdin so it doesn't show up in the process list
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+		quote(service), quote(account), quote(secret)))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return securityError(err)
+	}
+	// In interactive mode, failures are only reported on stderr
+	if stderr.Len() > 0 {
+		return fmt.Errorf("keychain: %s", strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func del(service, account string) error {
+	if err := exec.Command("security", "delete-generic-password", "-s", service, "-a", account).Run(); err != nil {
+		return securityError(err)
+	}
+	return nil
+}
+
+// quote quotes a word for the interactive mode of security(1).
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// securityError converts an error of security(1).
+func securityError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == errItemNotFound {
+		return ErrNotFound
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return ErrUnsupported
+	}
+	return fmt.Errorf("keychain: %w", err)
+}
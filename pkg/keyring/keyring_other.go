@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package keyring
+
+func get(_, _ string) (string, error) {
+	return "", ErrUnsupported
+}
+
+func set(_, _, _ string) error {
+	return ErrUnsupported
+}
+
+func del(_, _ string) error {
+	return ErrUnsupported
+}
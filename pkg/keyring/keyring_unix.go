@@ -0,0 +1,58 @@
+//go:build unix && !darwin
+
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The Secret Service is accessed with secret-tool(1) from libsecret.
+
+func get(service, account string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", service, "account", account).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		// secret-tool fails without output if there is no such secret
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) == 0 {
+			return "", ErrNotFound
+		}
+		return "", secretToolError(err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func set(service, account, secret string) error {
+	// secret-tool reads the secret from stdin, so it doesn't show up in the
+	// process list
+	cmd := exec.Command("secret-tool", "store", "--label", service+" "+account, "service", service, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	if _, err := cmd.Output(); err != nil {
+		return secretToolError(err)
+	}
+	return nil
+}
+
+func del(service, account string) error {
+	if _, err := get(service, account); err != nil {
+		return err
+	}
+	if _, err := exec.Command("secret-tool", "clear", "service", service, "account", account).Output(); err != nil {
+		return secretToolError(err)
+	}
+	return nil
+}
+
+// secretToolError converts an error of secret-tool(1).
+func secretToolError(err error) error {
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("%w: install secret-tool (libsecret)", ErrUnsupported)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("secret service: %s", strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return fmt.Errorf("secret service: %w", err)
+}
@@ -0,0 +1,202 @@
+package stacksenv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// setAuthorization attaches the access token of config, if any, as a bearer
+// token, and signs req if config.SignRequests is set (see signRequest). It
+// must be called once the URL and body of req are final.
+func setAuthorization(req *http.Request, config *Config) error {
+	if config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+config.Token)
+	}
+	return signRequest(req, config)
+}
+
+// Login exchanges the environment ID and secret of config for an access token.
+//
+// It sends a POST request to {protocol}://{ServerURL}/cli/login with the ID and
+// Secret as JSON. The SecretKey never leaves the machine: it is only used to
+// decrypt the environment locally.
+//
+// Returns the issued token, or a *RequestError if the exchange fails.
+func Login(ctx context.Context, config *Config, httpClient HTTPClient) (string, error) {
+	requestID := NewRequestID()
+
+	token, err := login(ctx, config, httpClient, requestID)
+	if err != nil {
+		return "", &RequestError{RequestID: requestID, Err: err}
+	}
+
+	return token, nil
+}
+
+// login performs the token exchange for a single request ID.
+func login(ctx context.Context, config *Config, httpClient HTTPClient, requestID string) (string, error) {
+	if config.ID == "" || config.Secret == "" {
+		return "", errors.New("login requires an environment ID and secret")
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"id":     config.ID,
+		"secret": config.Secret,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode login request: %w", err)
+	}
+
+	req, err := newRequest(ctx, http.MethodPost, serverBaseURL(config)+"/cli/login", bytes.NewReader(payload), requestID)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// The secret is in the body, but servers requiring signatures check them
+	// on every request
+	if err := signRequest(req, config); err != nil {
+		return "", err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", unreachableError(config, err)
+	}
+	defer resp.Body.Close()
+
+	var loginResp LoginResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxErrorBodySize)).Decode(&loginResp); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("server returned invalid JSON response: %w. The server may be experiencing issues", err)
+	}
+
+	if loginResp.Error != "" {
+		return "", classify(authStatusClass(resp.StatusCode), resp.StatusCode, fmt.Errorf("server rejected the login: %s", loginResp.Error))
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("server returned HTTP status %d (%s) for login of environment ID '%s'. Please verify your credentials",
+			resp.StatusCode, http.StatusText(resp.StatusCode), config.ID)
+		if resp.StatusCode == http.StatusNotFound {
+			err = unsupportedFeatureError(ctx, config, httpClient, requestID, FeatureLogin, err)
+		}
+		return "", classify(authStatusClass(resp.StatusCode), resp.StatusCode, err)
+	}
+	if loginResp.Token == "" {
+		return "", errors.New("server response is missing the access token")
+	}
+
+	return loginResp.Token, nil
+}
+
+// Logout revokes the access token of config on the server.
+//
+// It sends a POST request to {protocol}://{ServerURL}/cli/logout carrying the
+// token as a bearer token. Returns a *RequestError if the revocation fails.
+func Logout(ctx context.Context, config *Config, httpClient HTTPClient) error {
+	requestID := NewRequestID()
+
+	if err := logout(ctx, config, httpClient, requestID); err != nil {
+		return &RequestError{RequestID: requestID, Err: err}
+	}
+
+	return nil
+}
+
+// logout performs the token revocation for a single request ID.
+func logout(ctx context.Context, config *Config, httpClient HTTPClient, requestID string) error {
+	if config.Token == "" {
+		return errors.New("logout requires an access token")
+	}
+
+	req, err := newRequest(ctx, http.MethodPost, serverBaseURL(config)+"/cli/logout", nil, requestID)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if err := setAuthorization(req, config); err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return unreachableError(config, err)
+	}
+	defer resp.Body.Close()
+
+	// An already revoked or expired token is as good as a revoked one
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusUnauthorized {
+		err := fmt.Errorf("server returned HTTP status %d (%s) while revoking the access token",
+			resp.StatusCode, http.StatusText(resp.StatusCode))
+		if resp.StatusCode == http.StatusNotFound {
+			err = unsupportedFeatureError(ctx, config, httpClient, requestID, FeatureLogout, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// WhoAmI asks the server which identity the credentials of config belong to and
+// which branches they grant access to.
+//
+// It sends a GET request to {protocol}://{ServerURL}/cli/whoami with the ID as a
+// query parameter and the access token, if any, as a bearer token.
+// Returns a *RequestError if the request fails.
+func WhoAmI(ctx context.Context, config *Config, httpClient HTTPClient) (*Identity, error) {
+	requestID := NewRequestID()
+
+	identity, err := whoAmI(ctx, config, httpClient, requestID)
+	if err != nil {
+		return nil, &RequestError{RequestID: requestID, Err: err}
+	}
+
+	return identity, nil
+}
+
+// whoAmI performs the identity lookup for a single request ID.
+func whoAmI(ctx context.Context, config *Config, httpClient HTTPClient, requestID string) (*Identity, error) {
+	u, err := url.Parse(serverBaseURL(config) + "/cli/whoami")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+	params := url.Values{}
+	params.Set("id", config.ID)
+	u.RawQuery = params.Encode()
+
+	req, err := newRequest(ctx, http.MethodGet, u.String(), nil, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if err := setAuthorization(req, config); err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, unreachableError(config, err)
+	}
+	defer resp.Body.Close()
+
+	var identity Identity
+	if err := json.NewDecoder(resp.Body).Decode(&identity); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("server returned invalid JSON response: %w. The server may be experiencing issues", err)
+	}
+
+	if identity.Error != "" {
+		return nil, classify(authStatusClass(resp.StatusCode), resp.StatusCode, fmt.Errorf("server reported an error: %s", identity.Error))
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("server returned HTTP status %d (%s) for environment ID '%s'. Please verify your credentials",
+			resp.StatusCode, http.StatusText(resp.StatusCode), config.ID)
+		if resp.StatusCode == http.StatusNotFound {
+			err = unsupportedFeatureError(ctx, config, httpClient, requestID, FeatureWhoAmI, err)
+		}
+		return nil, classify(authStatusClass(resp.StatusCode), resp.StatusCode, err)
+	}
+
+	return &identity, nil
+}
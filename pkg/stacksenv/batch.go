@@ -0,0 +1,327 @@
+package stacksenv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+Batch endpoint:
+| POST /cli/batch | content-type: application/json |
+
+Fetches the first page of several environments of a server in a single round
+trip. The request holds the parameters of GET /cli for every environment,
+keyed by the caller; the response a result per key, with the payload and
+next cursor GET /cli would return, or the HTTP status and error it would fail
+with:
+
+	request:  {"requests": [{"key": "0", "id": "...", "branch": "...", "personal": true, "key_ids": ["..."]}]}
+	response: {"results": [{"key": "0", "status": 200, "data": "<payload>", "next_cursor": "..."}]}
+
+The token, if any, is sent in the Authorization header: environments with
+different tokens are fetched in separate batches.
+*/
+
+// maxBatchSize is the maximum number of environments fetched by a batch
+// request; larger batches are split.
+const maxBatchSize = 50
+
+// BatchResult is the outcome of the fetch of one configuration of a batch.
+type BatchResult struct {
+	// Config is the configuration fetched
+	Config Config
+	// Variables are the decrypted variables; nil if Err is set
+	Variables []ContextData[any]
+	// Err is the error of the fetch, a *RequestError
+	Err error
+}
+
+// batchItem is the request of one environment in a batch, the parameters of
+// GET /cli.
+type batchItem struct {
+	Key      string   `json:"key"`
+	ID       string   `json:"id"`
+	Branch   string   `json:"branch"`
+	Personal bool     `json:"personal,omitempty"`
+	Deleted  bool     `json:"deleted,omitempty"`
+	PageSize int      `json:"page_size,omitempty"`
+	KeyIDs   []string `json:"key_ids,omitempty"`
+}
+
+// batchItemResult is the result of one environment in a batch.
+type batchItemResult struct {
+	Key        string `json:"key"`
+	Status     int    `json:"status"`
+	Data       string `json:"data,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Revoked    bool   `json:"revoked,omitempty"`
+}
+
+// GetMany fetches and decrypts the environments of several configurations,
+// see GetManyContext.
+func (s *DefaultClientService) GetMany(configs []Config) ([]BatchResult, error) {
+	return s.GetManyContext(context.Background(), configs)
+}
+
+// GetManyContext fetches and decrypts the environments of several
+// configurations, e.g. the services of a monorepo, and returns their results
+// in the order of configs.
+//
+// The configurations are grouped by server and token, and by secret for those
+// with SignRequests, and the first page of every environment of a group is
+// fetched in a single POST request to {protocol}://{ServerURL}/cli/batch; the
+// following pages of paginated environments are fetched one by one. Groups of
+// servers without the batch endpoint, and all configurations if the service
+// has a transport other than the HTTP one, are fetched with one request per
+// configuration, concurrently.
+//
+// A failed fetch doesn't fail the others: it is reported in the Err of its
+// result, and the returned error joins the errors of the failed results,
+// nil if every fetch succeeded.
+func (s *DefaultClientService) GetManyContext(ctx context.Context, configs []Config) ([]BatchResult, error) {
+	ctx, span := s.telemetry.tracer.Start(ctx, "stacksenv.fetch_many",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.Int(attributeBatchSize, len(configs))))
+	defer span.End()
+
+	results := make([]BatchResult, len(configs))
+	for i := range configs {
+		results[i].Config = configs[i]
+	}
+
+	// Configurations sharing a server and a token, in order
+	var groups [][]int
+	_, batching := s.transport.(*httpTransport)
+	index := make(map[string]int)
+	for i := range configs {
+		key := serverBaseURL(&configs[i]) + "\x00" + configs[i].Token
+		if configs[i].SignRequests {
+			// A batch is signed with the secret of its first environment
+			key += "\x00" + configs[i].Secret
+		}
+		g, ok := index[key]
+		if !batching || !ok || len(groups[g]) == maxBatchSize {
+			g = len(groups)
+			index[key] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var single []int // configurations fetched one by one
+	for _, group := range groups {
+		wg.Go(func() {
+			if len(group) > 1 && s.getBatch(ctx, results, group) {
+				return
+			}
+			mu.Lock()
+			single = append(single, group...)
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	for _, i := range single {
+		wg.Go(func() {
+			config := results[i].Config
+			results[i].Variables, results[i].Err = s.GetContextDecryptedDataContext(ctx, &config)
+		})
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+	if len(errs) > 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d of %d fetches failed", len(errs), len(configs)))
+	}
+	return results, errors.Join(errs...)
+}
+
+// getBatch fetches the configurations of results at indexes, all of the same
+// server and token, with a batch request, and fills in their results. It
+// returns false, with the results untouched, if the server doesn't support
+// batches.
+func (s *DefaultClientService) getBatch(ctx context.Context, results []BatchResult, indexes []int) bool {
+	requestID := NewRequestID()
+	first := &results[indexes[0]].Config
+	start := time.Now()
+
+	items := make([]batchItem, len(indexes))
+	for n, i := range indexes {
+		config := &results[i].Config
+		items[n] = batchItem{
+			Key:      strconv.Itoa(i),
+			ID:       config.ID,
+			Branch:   config.Branch,
+			Personal: config.Token != "" && !config.NoPersonal,
+			Deleted:  config.IncludeDeleted,
+			PageSize: config.PageSize,
+			KeyIDs:   config.KeyIDs(),
+		}
+	}
+
+	itemResults, err := s.sendBatch(ctx, first, requestID, items)
+	if errors.Is(err, errBatchUnsupported) {
+		s.logger.Debugf("The server at %s doesn't support batches, fetching %d environments one by one", first.ServerURL, len(indexes))
+		return false
+	}
+	if err != nil {
+		for _, i := range indexes {
+			s.telemetry.endFetch(ctx, nil, &results[i].Config, start, 0, err)
+			results[i].Err = &RequestError{RequestID: requestID, Err: err}
+		}
+		return true
+	}
+
+	var wg sync.WaitGroup
+	for _, i := range indexes {
+		wg.Go(func() {
+			config := &results[i].Config
+			variables, err := s.batchResult(ctx, config, requestID, itemResults[strconv.Itoa(i)])
+			s.telemetry.endFetch(ctx, nil, config, start, len(variables), err)
+			if err != nil {
+				results[i].Err = &RequestError{RequestID: requestID, Err: err}
+				return
+			}
+			results[i].Variables = variables
+		})
+	}
+	wg.Wait()
+	return true
+}
+
+// errBatchUnsupported is returned by sendBatch for servers without the batch
+// endpoint.
+var errBatchUnsupported = errors.New("the server doesn't support batches")
+
+// sendBatch sends the batch request of items to the server of config and
+// returns the results by key.
+func (s *DefaultClientService) sendBatch(ctx context.Context, config *Config, requestID string, items []batchItem) (map[string]*batchItemResult, error) {
+	body, err := json.Marshal(map[string][]batchItem{"requests": items})
+	if err != nil {
+		return nil, err
+	}
+	req, err := newRequest(ctx, http.MethodPost, serverBaseURL(config)+"/cli/batch", bytes.NewReader(body), requestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := setAuthorization(req, config); err != nil {
+		return nil, err
+	}
+	req.Header.Set(PayloadVersionHeader, strconv.Itoa(PayloadVersion))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, unreachableError(config, fmt.Errorf("failed to send batch request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, errBatchUnsupported
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		if err := revokedError(config, resp.StatusCode, body); err != nil {
+			return nil, err
+		}
+		var errorDetails string
+		if len(body) > 0 {
+			errorDetails = fmt.Sprintf(" - Server response: %s", string(body))
+		}
+		err := fmt.Errorf("server returned HTTP status %d (%s) for the batch of %d environments%s. Please verify your credentials and environment configuration",
+			resp.StatusCode, http.StatusText(resp.StatusCode), len(items), errorDetails)
+		return nil, classify(statusClass(resp.StatusCode), resp.StatusCode, err)
+	}
+
+	var response struct {
+		Results []batchItemResult `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("server response is invalid: %w", err)
+	}
+	results := make(map[string]*batchItemResult, len(response.Results))
+	for i := range response.Results {
+		results[response.Results[i].Key] = &response.Results[i]
+	}
+	return results, nil
+}
+
+// batchResult decrypts the result of config in a batch, and fetches and
+// decrypts the pages following it.
+func (s *DefaultClientService) batchResult(ctx context.Context, config *Config, requestID string, result *batchItemResult) ([]ContextData[any], error) {
+	if result == nil {
+		return nil, fmt.Errorf("server response is invalid: the batch holds no result for environment ID '%s' on branch '%s'", config.ID, config.Branch)
+	}
+	if result.Status != http.StatusOK {
+		body, _ := json.Marshal(revocationResponse{Error: result.Error, Revoked: result.Revoked})
+		if err := revokedError(config, result.Status, body); err != nil {
+			return nil, err
+		}
+		var errorDetails string
+		if result.Error != "" {
+			errorDetails = " - Server response: " + result.Error
+		}
+		err := fmt.Errorf("server returned HTTP status %d (%s) for environment ID '%s' on branch '%s'%s. Please verify your credentials and environment configuration",
+			result.Status, http.StatusText(result.Status), config.ID, config.Branch, errorDetails)
+		return nil, classify(statusClass(result.Status), result.Status, err)
+	}
+	if result.Data == "" {
+		return nil, errors.New("server response is missing the encrypted payload")
+	}
+	return s.decryptPages(ctx, config, requestID, result.Data, result.NextCursor)
+}
+
+// GetManyWithContext fetches and decrypts the environments of several
+// configurations with service: in batches if it implements
+// BatchClientService, see DefaultClientService.GetManyContext, one by one
+// otherwise. It returns the results in the order of configs and the joined
+// errors of the failed ones.
+func GetManyWithContext(ctx context.Context, service ClientService, configs []Config) ([]BatchResult, error) {
+	if s, ok := service.(BatchClientService); ok {
+		return s.GetManyContext(ctx, configs)
+	}
+	results := make([]BatchResult, len(configs))
+	var errs []error
+	for i, config := range configs {
+		results[i].Config = config
+		results[i].Variables, results[i].Err = FetchWithContext(ctx, service, &config)
+		if results[i].Err != nil {
+			errs = append(errs, results[i].Err)
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// MergeResults returns the variables of the successful results merged in
+// order: a variable overrides those with the same name of earlier results,
+// like within an environment (see NewEnvSet).
+func MergeResults(results []BatchResult) []ContextData[any] {
+	var merged []ContextData[any]
+	for _, result := range results {
+		if result.Err == nil {
+			merged = append(merged, result.Variables...)
+		}
+	}
+	return merged
+}
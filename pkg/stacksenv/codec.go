@@ -0,0 +1,112 @@
+package stacksenv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DefaultCodec is the name of the codec decoding the envelope of the
+// stacksenv server.
+const DefaultCodec = "stacksenv"
+
+// Codec decodes the body of a successful GET /cli response into the encrypted
+// payload, so servers wrapping the payload in a different envelope can be
+// supported by registering a small adapter with RegisterCodec.
+type Codec interface {
+	// Name returns the name used to select the codec, e.g. "stacksenv".
+	Name() string
+	// Decode returns the encrypted payload of a response body, or an error
+	// if the body reports one or holds no payload.
+	Decode(body []byte) (string, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = make(map[string]Codec)
+)
+
+func init() {
+	RegisterCodec(envelopeCodec{})
+	RegisterCodec(rawCodec{})
+}
+
+// RegisterCodec makes a codec available under its name. Registering a name
+// twice replaces the previous codec.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[strings.ToLower(c.Name())] = c
+}
+
+// GetCodec returns the codec registered under name, ignoring case. An empty
+// name selects DefaultCodec.
+func GetCodec(name string) (Codec, error) {
+	if name == "" {
+		name = DefaultCodec
+	}
+
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, ok := codecs[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported codec %q (supported: %s)", name, strings.Join(codecNames(), ", "))
+	}
+	return c, nil
+}
+
+// CodecNames returns the sorted names of the registered codecs.
+func CodecNames() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	return codecNames()
+}
+
+// codecNames returns the sorted names of the registered codecs. The caller
+// must hold codecsMu.
+func codecNames() []string {
+	list := make([]string, 0, len(codecs))
+	for name := range codecs {
+		list = append(list, name)
+	}
+	slices.Sort(list)
+	return list
+}
+
+// envelopeCodec decodes the ServerResponse envelope of the stacksenv server.
+type envelopeCodec struct{}
+
+func (envelopeCodec) Name() string { return DefaultCodec }
+
+func (envelopeCodec) Decode(body []byte) (string, error) {
+	var jsonData map[string]any
+	if err := json.Unmarshal(body, &jsonData); err != nil {
+		return "", fmt.Errorf("server returned invalid JSON response: %w. The server may be experiencing issues", err)
+	}
+	if errMsg, ok := jsonData["error"].(string); ok && errMsg != "" {
+		return "", fmt.Errorf("server reported an error: %s. Please check your environment ID, branch, and credentials", errMsg)
+	}
+	encryptedData, ok := jsonData["data"].(string)
+	if !ok || encryptedData == "" {
+		return "", errors.New("server response is missing encrypted data. The response may be incomplete or the environment may not exist")
+	}
+	return encryptedData, nil
+}
+
+// rawCodec passes the response body through as the encrypted payload, for
+// servers answering with the payload alone.
+type rawCodec struct{}
+
+func (rawCodec) Name() string { return "raw" }
+
+func (rawCodec) Decode(body []byte) (string, error) {
+	payload := strings.TrimSpace(string(body))
+	if payload == "" {
+		return "", errors.New("server response is empty. The environment may not exist")
+	}
+	return payload, nil
+}
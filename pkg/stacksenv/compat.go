@@ -0,0 +1,235 @@
+package stacksenv
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Feature is a server feature the CLI depends on.
+type Feature string
+
+// Features with their own server endpoint or server-side behavior.
+const (
+	FeatureLogin     Feature = "login"     // POST /cli/login
+	FeatureLogout    Feature = "logout"    // POST /cli/logout
+	FeatureWhoAmI    Feature = "whoami"    // GET /cli/whoami
+	FeaturePersonal  Feature = "personal"  // personal overlays on GET /cli
+	FeatureHeartbeat Feature = "heartbeat" // POST /cli/heartbeat
+	FeatureWrite     Feature = "write"     // PUT and DELETE /cli
+	FeaturePages     Feature = "pages"     // paginated GET /cli
+	FeatureGRPC      Feature = "grpc"      // gRPC API, see NewGRPCTransport; advertised in capabilities only
+	FeatureEvents    Feature = "events"    // GET /cli/events; advertised in capabilities only
+)
+
+// VersionEndpointVersion is the first server version serving GET /cli/version.
+// Servers without the endpoint are older.
+const VersionEndpointVersion = "1.3.0"
+
+// CompatibilityMatrix maps each feature to the first server version
+// supporting it.
+var CompatibilityMatrix = map[Feature]string{
+	FeatureLogin:     "1.2.0",
+	FeatureLogout:    "1.2.0",
+	FeatureWhoAmI:    "1.3.0",
+	FeaturePersonal:  "1.4.0",
+	FeatureHeartbeat: "1.5.0",
+	FeatureWrite:     "1.6.0",
+	FeaturePages:     "1.7.0",
+}
+
+// ServerInfo represents the response of the server's version endpoint.
+type ServerInfo struct {
+	Error        string   `json:"error"`        // Error message if the request failed
+	Version      string   `json:"version"`      // Server version, empty if the server predates the endpoint
+	Capabilities []string `json:"capabilities"` // Features the server supports, independently of its version
+}
+
+// Supports reports whether the server supports a feature: either it lists the
+// feature in its capabilities or its version is at least the one required by
+// CompatibilityMatrix.
+func (i *ServerInfo) Supports(feature Feature) bool {
+	if slices.Contains(i.Capabilities, string(feature)) {
+		return true
+	}
+	required, ok := CompatibilityMatrix[feature]
+	if !ok {
+		return false
+	}
+	return i.Version != "" && CompareVersions(i.Version, required) >= 0
+}
+
+// IncompatibleServerError is returned when the server is older than a feature
+// or the --min-server-version guard requires.
+type IncompatibleServerError struct {
+	ServerURL     string  // Server the CLI talked to
+	ServerVersion string  // Version reported by the server, empty if it predates the version endpoint
+	Feature       Feature // Feature that is unsupported, empty for a minimum version guard
+	Required      string  // Minimum server version required, empty for features advertised in capabilities only
+}
+
+// Error names the required and the actual server version.
+func (e *IncompatibleServerError) Error() string {
+	what := "this command"
+	if e.Feature != "" {
+		what = fmt.Sprintf("the %s feature", e.Feature)
+	}
+
+	actual := "version " + e.ServerVersion
+	if e.ServerVersion == "" {
+		actual = "a version older than " + VersionEndpointVersion
+	}
+	if e.Required == "" {
+		return fmt.Sprintf("%s is not supported by the stacksenv server at %s, which runs %s and doesn't advertise it in its capabilities",
+			what, e.ServerURL, actual)
+	}
+	return fmt.Sprintf("%s requires stacksenv server %s or newer, but the server at %s runs %s. Please upgrade the server",
+		what, e.Required, e.ServerURL, actual)
+}
+
+// GetServerInfo asks the server for its version and capabilities.
+//
+// It sends a GET request to {protocol}://{ServerURL}/cli/version. A server
+// without the endpoint (HTTP 404) is reported with an empty version.
+// Returns a *RequestError if the request fails.
+func GetServerInfo(ctx context.Context, config *Config, httpClient HTTPClient) (*ServerInfo, error) {
+	requestID := NewRequestID()
+
+	info, err := getServerInfo(ctx, config, httpClient, requestID)
+	if err != nil {
+		return nil, &RequestError{RequestID: requestID, Err: err}
+	}
+
+	return info, nil
+}
+
+// getServerInfo performs the version lookup for a single request ID.
+func getServerInfo(ctx context.Context, config *Config, httpClient HTTPClient, requestID string) (*ServerInfo, error) {
+	req, err := newRequest(ctx, http.MethodGet, serverBaseURL(config)+"/cli/version", nil, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if err := setAuthorization(req, config); err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, unreachableError(config, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return &ServerInfo{}, nil
+	}
+
+	var info ServerInfo
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxErrorBodySize)).Decode(&info); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("server returned invalid JSON response: %w. The server may be experiencing issues", err)
+	}
+
+	if info.Error != "" {
+		return nil, fmt.Errorf("server reported an error: %s", info.Error)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned HTTP status %d (%s) for its version",
+			resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	return &info, nil
+}
+
+// CheckMinServerVersion asks the server for its version and returns an
+// *IncompatibleServerError if it is older than minVersion. A server without
+// the version endpoint only fails the check if minVersion is at least
+// VersionEndpointVersion.
+func CheckMinServerVersion(ctx context.Context, config *Config, httpClient HTTPClient, minVersion string) error {
+	if _, ok := parseVersion(minVersion); !ok {
+		return fmt.Errorf("invalid minimum server version %q: expected MAJOR.MINOR.PATCH", minVersion)
+	}
+
+	info, err := GetServerInfo(ctx, config, httpClient)
+	if err != nil {
+		return err
+	}
+	tooOld := info.Version != "" && CompareVersions(info.Version, minVersion) < 0
+	if info.Version == "" {
+		// All we know is that the server is older than the version endpoint
+		tooOld = CompareVersions(minVersion, VersionEndpointVersion) >= 0
+	}
+	if tooOld {
+		return &IncompatibleServerError{ServerURL: config.ServerURL, ServerVersion: info.Version, Required: minVersion}
+	}
+	return nil
+}
+
+// unsupportedFeatureError explains an HTTP 404 returned for the endpoint of a
+// feature. If the server is too old for the feature, an
+// *IncompatibleServerError is returned; otherwise, or if the server version
+// can't be determined, notFound is returned unchanged.
+func unsupportedFeatureError(ctx context.Context, config *Config, httpClient HTTPClient, requestID string, feature Feature, notFound error) error {
+	info, err := getServerInfo(ctx, config, httpClient, requestID)
+	if err != nil || info.Supports(feature) {
+		return notFound
+	}
+	return &IncompatibleServerError{
+		ServerURL:     config.ServerURL,
+		ServerVersion: info.Version,
+		Feature:       feature,
+		Required:      CompatibilityMatrix[feature],
+	}
+}
+
+// CompareVersions compares two MAJOR.MINOR.PATCH versions, optionally
+// prefixed with "v" and followed by a pre-release or build suffix. It returns
+// -1, 0 or +1. A pre-release sorts before its release; versions that don't
+// parse sort before all others.
+func CompareVersions(a, b string) int {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	if !okA || !okB {
+		return cmp.Compare(boolToInt(okA), boolToInt(okB))
+	}
+	return slices.Compare(va, vb)
+}
+
+// parseVersion parses a version into its major, minor and patch numbers and a
+// fourth component that is 0 for pre-releases and 1 for releases.
+func parseVersion(version string) ([]int, bool) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	version, _, _ = strings.Cut(version, "+")
+	version, preRelease, isPreRelease := strings.Cut(version, "-")
+	if isPreRelease && preRelease == "" {
+		return nil, false
+	}
+
+	parts := strings.Split(version, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return nil, false
+	}
+	numbers := make([]int, 4)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		numbers[i] = n
+	}
+	if !isPreRelease {
+		numbers[3] = 1
+	}
+	return numbers, true
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
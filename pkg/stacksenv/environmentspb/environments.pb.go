@@ -0,0 +1,243 @@
+// The gRPC API of the stacksenv server, as called by NewGRPCTransport of
+// package stacksenv. Servers implementing it advertise the "grpc" capability
+// on GET /cli/version.
+//
+// The Go code of package environmentspb is generated from this file with
+// protoc-gen-go and protoc-gen-go-grpc; see generate.go.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: environments.proto
+
+package environmentspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type FetchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ID of the environment
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Branch of the environment
+	Branch string `protobuf:"bytes,2,opt,name=branch,proto3" json:"branch,omitempty"`
+	// Whether to overlay the personal variables of the token
+	Personal bool `protobuf:"varint,3,opt,name=personal,proto3" json:"personal,omitempty"`
+	// Whether to include the tombstones of soft-deleted variables
+	Deleted bool `protobuf:"varint,4,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	// Maximum number of variables of the page, 0 for the server default
+	PageSize int32 `protobuf:"varint,5,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// Cursor of the page, empty for the first one
+	Cursor        string `protobuf:"bytes,6,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FetchRequest) Reset() {
+	*x = FetchRequest{}
+	mi := &file_environments_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetchRequest) ProtoMessage() {}
+
+func (x *FetchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_environments_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetchRequest.ProtoReflect.Descriptor instead.
+func (*FetchRequest) Descriptor() ([]byte, []int) {
+	return file_environments_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *FetchRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *FetchRequest) GetBranch() string {
+	if x != nil {
+		return x.Branch
+	}
+	return ""
+}
+
+func (x *FetchRequest) GetPersonal() bool {
+	if x != nil {
+		return x.Personal
+	}
+	return false
+}
+
+func (x *FetchRequest) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+func (x *FetchRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *FetchRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+type FetchResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Encrypted page, with its payload header if any
+	Payload string `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
+	// Cursor of the next page, empty on the last one
+	NextCursor    string `protobuf:"bytes,2,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FetchResponse) Reset() {
+	*x = FetchResponse{}
+	mi := &file_environments_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetchResponse) ProtoMessage() {}
+
+func (x *FetchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_environments_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetchResponse.ProtoReflect.Descriptor instead.
+func (*FetchResponse) Descriptor() ([]byte, []int) {
+	return file_environments_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *FetchResponse) GetPayload() string {
+	if x != nil {
+		return x.Payload
+	}
+	return ""
+}
+
+func (x *FetchResponse) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+var File_environments_proto protoreflect.FileDescriptor
+
+const file_environments_proto_rawDesc = "" +
+	"\n" +
+	"\x12environments.proto\x12\fstacksenv.v1\"\xa1\x01\n" +
+	"\fFetchRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06branch\x18\x02 \x01(\tR\x06branch\x12\x1a\n" +
+	"\bpersonal\x18\x03 \x01(\bR\bpersonal\x12\x18\n" +
+	"\adeleted\x18\x04 \x01(\bR\adeleted\x12\x1b\n" +
+	"\tpage_size\x18\x05 \x01(\x05R\bpageSize\x12\x16\n" +
+	"\x06cursor\x18\x06 \x01(\tR\x06cursor\"J\n" +
+	"\rFetchResponse\x12\x18\n" +
+	"\apayload\x18\x01 \x01(\tR\apayload\x12\x1f\n" +
+	"\vnext_cursor\x18\x02 \x01(\tR\n" +
+	"nextCursor2P\n" +
+	"\fEnvironments\x12@\n" +
+	"\x05Fetch\x12\x1a.stacksenv.v1.FetchRequest\x1a\x1b.stacksenv.v1.FetchResponseB7Z5github.com/stacksenv/cli/pkg/stacksenv/environmentspbb\x06proto3"
+
+var (
+	file_environments_proto_rawDescOnce sync.Once
+	file_environments_proto_rawDescData []byte
+)
+
+func file_environments_proto_rawDescGZIP() []byte {
+	file_environments_proto_rawDescOnce.Do(func() {
+		file_environments_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_environments_proto_rawDesc), len(file_environments_proto_rawDesc)))
+	})
+	return file_environments_proto_rawDescData
+}
+
+var file_environments_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_environments_proto_goTypes = []any{
+	(*FetchRequest)(nil),  // 0: stacksenv.v1.FetchRequest
+	(*FetchResponse)(nil), // 1: stacksenv.v1.FetchResponse
+}
+var file_environments_proto_depIdxs = []int32{
+	0, // 0: stacksenv.v1.Environments.Fetch:input_type -> stacksenv.v1.FetchRequest
+	1, // 1: stacksenv.v1.Environments.Fetch:output_type -> stacksenv.v1.FetchResponse
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_environments_proto_init() }
+func file_environments_proto_init() {
+	if File_environments_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_environments_proto_rawDesc), len(file_environments_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_environments_proto_goTypes,
+		DependencyIndexes: file_environments_proto_depIdxs,
+		MessageInfos:      file_environments_proto_msgTypes,
+	}.Build()
+	File_environments_proto = out.File
+	file_environments_proto_goTypes = nil
+	file_environments_proto_depIdxs = nil
+}
@@ -0,0 +1,138 @@
+// The gRPC API of the stacksenv server, as called by NewGRPCTransport of
+// package stacksenv. Servers implementing it advertise the "grpc" capability
+// on GET /cli/version.
+//
+// The Go code of package environmentspb is generated from this file with
+// protoc-gen-go and protoc-gen-go-grpc; see generate.go.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: environments.proto
+
+package environmentspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Environments_Fetch_FullMethodName = "/stacksenv.v1.Environments/Fetch"
+)
+
+// EnvironmentsClient is the client API for Environments service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EnvironmentsClient interface {
+	// Fetch returns a page of the encrypted environment of a branch, like
+	// GET /cli. The credentials, request ID, payload version and key IDs are
+	// sent as metadata with the names of the headers of GET /cli. Revoked
+	// credentials fail with UNAUTHENTICATED or PERMISSION_DENIED and the
+	// "stacksenv-revoked: true" trailer.
+	Fetch(ctx context.Context, in *FetchRequest, opts ...grpc.CallOption) (*FetchResponse, error)
+}
+
+type environmentsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEnvironmentsClient(cc grpc.ClientConnInterface) EnvironmentsClient {
+	return &environmentsClient{cc}
+}
+
+func (c *environmentsClient) Fetch(ctx context.Context, in *FetchRequest, opts ...grpc.CallOption) (*FetchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FetchResponse)
+	err := c.cc.Invoke(ctx, Environments_Fetch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EnvironmentsServer is the server API for Environments service.
+// All implementations must embed UnimplementedEnvironmentsServer
+// for forward compatibility.
+type EnvironmentsServer interface {
+	// Fetch returns a page of the encrypted environment of a branch, like
+	// GET /cli. The credentials, request ID, payload version and key IDs are
+	// sent as metadata with the names of the headers of GET /cli. Revoked
+	// credentials fail with UNAUTHENTICATED or PERMISSION_DENIED and the
+	// "stacksenv-revoked: true" trailer.
+	Fetch(context.Context, *FetchRequest) (*FetchResponse, error)
+	mustEmbedUnimplementedEnvironmentsServer()
+}
+
+// UnimplementedEnvironmentsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEnvironmentsServer struct{}
+
+func (UnimplementedEnvironmentsServer) Fetch(context.Context, *FetchRequest) (*FetchResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Fetch not implemented")
+}
+func (UnimplementedEnvironmentsServer) mustEmbedUnimplementedEnvironmentsServer() {}
+func (UnimplementedEnvironmentsServer) testEmbeddedByValue()                      {}
+
+// UnsafeEnvironmentsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EnvironmentsServer will
+// result in compilation errors.
+type UnsafeEnvironmentsServer interface {
+	mustEmbedUnimplementedEnvironmentsServer()
+}
+
+func RegisterEnvironmentsServer(s grpc.ServiceRegistrar, srv EnvironmentsServer) {
+	// If the following call panics, it indicates UnimplementedEnvironmentsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Environments_ServiceDesc, srv)
+}
+
+func _Environments_Fetch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FetchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EnvironmentsServer).Fetch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Environments_Fetch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EnvironmentsServer).Fetch(ctx, req.(*FetchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Environments_ServiceDesc is the grpc.ServiceDesc for Environments service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Environments_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "stacksenv.v1.Environments",
+	HandlerType: (*EnvironmentsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Fetch",
+			Handler:    _Environments_Fetch_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "environments.proto",
+}
@@ -0,0 +1,5 @@
+// Package environmentspb holds the messages and the client of the gRPC API of
+// the stacksenv server, generated from environments.proto.
+package environmentspb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative environments.proto
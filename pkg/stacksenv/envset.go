@@ -0,0 +1,147 @@
+package stacksenv
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrVariableNotFound is returned by the accessors of EnvSet for variables
+// that are not in the set.
+var ErrVariableNotFound = errors.New("variable not found")
+
+// EnvSet is a set of variables indexed by name, with typed accessors to
+// their values, so callers don't need type assertions on ContextData values.
+// The zero value is an empty set.
+type EnvSet struct {
+	vars map[string]ContextData[any]
+}
+
+// NewEnvSet returns the set of the given variables. Later variables override
+// earlier ones with the same name, like in the environment of a process.
+// Tombstones of soft-deleted variables are skipped; platform restrictions are
+// not applied, use FilterCurrentPlatform first to apply them.
+func NewEnvSet(properties []ContextData[any]) EnvSet {
+	vars := make(map[string]ContextData[any], len(properties))
+	for _, contextData := range properties {
+		if !contextData.IsDeleted() {
+			vars[contextData.Property] = contextData
+		}
+	}
+	return EnvSet{vars: vars}
+}
+
+// Len returns the number of variables of the set.
+func (s EnvSet) Len() int {
+	return len(s.vars)
+}
+
+// Has reports whether the set holds a variable named name.
+func (s EnvSet) Has(name string) bool {
+	_, ok := s.vars[name]
+	return ok
+}
+
+// GetString returns the value of a variable as it is injected in the
+// environment: values that are not strings are formatted with fmt.
+func (s EnvSet) GetString(name string) (string, error) {
+	contextData, err := s.get(name)
+	if err != nil {
+		return "", err
+	}
+	return envValue(contextData.Value), nil
+}
+
+// GetInt returns the value of a variable as an integer. String values are
+// parsed in base 10; numbers must be integral.
+func (s EnvSet) GetInt(name string) (int, error) {
+	contextData, err := s.get(name)
+	if err != nil {
+		return 0, err
+	}
+	switch value := contextData.Value.(type) {
+	case int:
+		return value, nil
+	case int64:
+		if value >= math.MinInt && value <= math.MaxInt {
+			return int(value), nil
+		}
+	case float64:
+		// Numbers of JSON payloads are decoded as float64
+		if value == math.Trunc(value) && value >= math.MinInt && value < -math.MinInt {
+			return int(value), nil
+		}
+	case string:
+		if i, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("variable %s is not an integer", name)
+}
+
+// GetBool returns the value of a variable as a boolean. String values are
+// parsed with strconv.ParseBool, e.g. "true", "1", "false" or "0".
+func (s EnvSet) GetBool(name string) (bool, error) {
+	contextData, err := s.get(name)
+	if err != nil {
+		return false, err
+	}
+	switch value := contextData.Value.(type) {
+	case bool:
+		return value, nil
+	case string:
+		if b, err := strconv.ParseBool(strings.TrimSpace(value)); err == nil {
+			return b, nil
+		}
+	}
+	return false, fmt.Errorf("variable %s is not a boolean", name)
+}
+
+// GetDuration returns the value of a variable as a duration, parsed with
+// time.ParseDuration, e.g. "30s" or "1h30m".
+func (s EnvSet) GetDuration(name string) (time.Duration, error) {
+	contextData, err := s.get(name)
+	if err != nil {
+		return 0, err
+	}
+	if value, ok := contextData.Value.(string); ok {
+		if d, err := time.ParseDuration(strings.TrimSpace(value)); err == nil {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("variable %s is not a duration", name)
+}
+
+// Map returns the variables of the set as a map of names to values, formatted
+// like GetString does.
+func (s EnvSet) Map() map[string]string {
+	values := make(map[string]string, len(s.vars))
+	for name, contextData := range s.vars {
+		values[name] = envValue(contextData.Value)
+	}
+	return values
+}
+
+// Sorted returns the variables of the set sorted by name.
+func (s EnvSet) Sorted() []ContextData[any] {
+	properties := make([]ContextData[any], 0, len(s.vars))
+	for _, name := range slices.Sorted(maps.Keys(s.vars)) {
+		properties = append(properties, s.vars[name])
+	}
+	return properties
+}
+
+// get returns the variable named name, or an error wrapping
+// ErrVariableNotFound.
+func (s EnvSet) get(name string) (ContextData[any], error) {
+	contextData, ok := s.vars[name]
+	if !ok {
+		return ContextData[any]{}, fmt.Errorf("%s: %w", name, ErrVariableNotFound)
+	}
+	return contextData, nil
+}
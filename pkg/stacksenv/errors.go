@@ -0,0 +1,83 @@
+package stacksenv
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Failure classes of the errors returned by the package. Errors of a class
+// match it with errors.Is, whatever their message, e.g.
+// errors.Is(err, ErrServerUnreachable) to fall back to a cached environment.
+var (
+	// ErrAuthFailed is matched by errors of requests the server rejected
+	// with HTTP 401 or 403, including revoked credentials (ErrRevoked).
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrEnvironmentNotFound is matched by errors of requests for an
+	// environment or branch the server answered with HTTP 404.
+	ErrEnvironmentNotFound = errors.New("environment not found")
+	// ErrDecryptFailed is matched by errors of fetches whose response can't be
+	// decrypted with the secret and secret key of the configuration.
+	ErrDecryptFailed = errors.New("decryption failed")
+	// ErrServerUnreachable is matched by errors of requests that got no
+	// response: the server can't be resolved or connected to, or timed out.
+	ErrServerUnreachable = errors.New("server unreachable")
+	// ErrInvalidURL is matched by the errors of ParseURL.
+	ErrInvalidURL = errors.New("invalid stacksenv URL")
+)
+
+// ClassifiedError is an error of a failure class, such as ErrAuthFailed. It
+// keeps the message of the underlying error and matches both the class and
+// the underlying error with errors.Is and errors.As.
+type ClassifiedError struct {
+	Class      error // Failure class, one of the Err* variables above
+	StatusCode int   // HTTP status code of the server response, 0 without one
+	Err        error // Underlying error
+}
+
+// Error returns the message of the underlying error.
+func (e *ClassifiedError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the failure class and the underlying error.
+func (e *ClassifiedError) Unwrap() []error {
+	return []error{e.Class, e.Err}
+}
+
+// classify returns err as an error of class, with the HTTP status code of the
+// response it was built from, if any. A nil class leaves err unchanged.
+func classify(class error, statusCode int, err error) error {
+	if class == nil || err == nil {
+		return err
+	}
+	return &ClassifiedError{Class: class, StatusCode: statusCode, Err: err}
+}
+
+// statusClass returns the failure class of an HTTP error status of a request
+// for an environment, or nil if it has none.
+func statusClass(statusCode int) error {
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAuthFailed
+	case http.StatusNotFound:
+		return ErrEnvironmentNotFound
+	}
+	return nil
+}
+
+// authStatusClass returns ErrAuthFailed for HTTP 401 and 403, and nil for
+// other statuses, for endpoints whose 404 means a missing feature rather than
+// a missing environment.
+func authStatusClass(statusCode int) error {
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		return ErrAuthFailed
+	}
+	return nil
+}
+
+// unreachableError returns the error of a request to the server of config
+// that got no response.
+func unreachableError(config *Config, err error) error {
+	return classify(ErrServerUnreachable, 0, fmt.Errorf("unable to connect to stacksenv server at %s: %w. Please verify the server URL and network connectivity", config.ServerURL, err))
+}
@@ -0,0 +1,25 @@
+package stacksenv
+
+import "errors"
+
+// ErrExecUnsupported is returned by Exec on platforms that can't replace the
+// current process, like Windows.
+var ErrExecUnsupported = errors.New("replacing the process is not supported on this platform")
+
+// ExecCommandExecutor is a CommandExecutor replacing the current process with
+// the command through Exec, instead of running it as a child process. Execute
+// only returns if the command can't be started.
+type ExecCommandExecutor struct{}
+
+// NewExecCommandExecutor creates a CommandExecutor replacing the current
+// process with the command. Pass it to NewHandler to hand the process over to
+// the command once the environment is fetched.
+func NewExecCommandExecutor() CommandExecutor {
+	return &ExecCommandExecutor{}
+}
+
+// Execute replaces the current process with the command, with env applied over
+// the current environment. See Exec.
+func (e *ExecCommandExecutor) Execute(command string, args []string, env []string) error {
+	return Exec(command, args, env)
+}
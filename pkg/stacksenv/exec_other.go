@@ -0,0 +1,9 @@
+//go:build !unix
+
+package stacksenv
+
+// Exec returns ErrExecUnsupported: processes can't be replaced on this
+// platform. Use Execute to run the command as a child process instead.
+func Exec(string, []string, []string) error {
+	return ErrExecUnsupported
+}
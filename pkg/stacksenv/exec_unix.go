@@ -0,0 +1,50 @@
+//go:build unix
+
+package stacksenv
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// Exec replaces the current process with a system command with the given
+// arguments, like the exec builtin of shells. The command keeps the process
+// ID and the I/O streams of the current process, and receives its signals
+// directly; the environment is set up like Execute does.
+//
+// Commands without a path separator are looked up in PATH. Exec only returns
+// if the command can't be started.
+func Exec(command string, args []string, env []string) error {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return fmt.Errorf("failed to execute command '%s': %w", command, err)
+	}
+	argv := append([]string{command}, args...)
+	if err := syscall.Exec(path, argv, execEnv(env)); err != nil {
+		return fmt.Errorf("failed to execute command '%s': %w", command, err)
+	}
+	return nil
+}
+
+// execEnv returns the current process environment with the KEY=VALUE entries
+// of env applied over it. Each variable appears once, with its last value:
+// unlike exec.Cmd, the exec system call passes duplicate entries through, and
+// most programs read the first one.
+func execEnv(env []string) []string {
+	entries := append(os.Environ(), env...)
+	index := make(map[string]int, len(entries))
+	result := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		key, _, _ := strings.Cut(entry, "=")
+		if i, ok := index[key]; ok {
+			result[i] = entry
+			continue
+		}
+		index[key] = len(result)
+		result = append(result, entry)
+	}
+	return result
+}
@@ -0,0 +1,361 @@
+package stacksenv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stacksenv/cli/pkg/stacksenv/environmentspb"
+	"golang.org/x/net/proxy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+gRPC transport:
+| /stacksenv.v1.Environments/Fetch | protobuf |
+
+A unary call to the Environments service of environmentspb/environments.proto,
+made with grpc-go and the stubs generated from it. A server revoking the
+credentials adds the "stacksenv-revoked: true" trailer to an UNAUTHENTICATED
+or PERMISSION_DENIED status.
+
+Servers advertise the service with the FeatureGRPC capability; the others
+fail the calls with an UNIMPLEMENTED status.
+*/
+
+// GRPCService is the gRPC service of the server environments are fetched
+// from.
+const GRPCService = "stacksenv.v1.Environments"
+
+// maxGRPCMessageSize limits the size of a response message.
+const maxGRPCMessageSize = 64 << 20
+
+// grpcMaxAttempts is the maximum number of attempts of a call allowed by
+// gRPC retry policies.
+const grpcMaxAttempts = 5
+
+// grpcTransport is the Transport fetching environments from the gRPC API of
+// the server.
+type grpcTransport struct {
+	options HTTPOptions
+
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn // by address, prefixed with the scheme
+}
+
+// NewGRPCTransport returns the Transport fetching environments from the
+// Fetch method of the GRPCService of the server, as specified by
+// environments.proto of package environmentspb. The calls are made with
+// grpc-go, with the TLS settings, proxy, timeout and retries of options;
+// HTTPOptions.Timeout bounds each call, retries included, and only
+// UNAVAILABLE calls are retried. The credentials, request ID, payload header
+// version and key IDs are sent as the same metadata as the headers of
+// GET /cli, with the serialized FetchRequest as the signed body.
+//
+// The Transport keeps a connection per server; it implements io.Closer to
+// close them.
+func NewGRPCTransport(options HTTPOptions) Transport {
+	return &grpcTransport{options: options, conns: make(map[string]*grpc.ClientConn)}
+}
+
+// FetchPage calls the Fetch method for the page at cursor.
+func (t *grpcTransport) FetchPage(ctx context.Context, config *Config, requestID, cursor string) (string, string, error) {
+	conn, err := t.conn(config)
+	if err != nil {
+		return "", "", err
+	}
+	request := &environmentspb.FetchRequest{
+		Id:       config.ID,
+		Branch:   config.Branch,
+		Personal: config.Token != "" && !config.NoPersonal,
+		Deleted:  config.IncludeDeleted,
+		PageSize: int32(config.PageSize),
+		Cursor:   cursor,
+	}
+	md, err := grpcMetadata(ctx, config, request, requestID)
+	if err != nil {
+		return "", "", err
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+	if t.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.options.Timeout)
+		defer cancel()
+	}
+
+	var trailer metadata.MD
+	response, err := environmentspb.NewEnvironmentsClient(conn).Fetch(ctx, request, grpc.Trailer(&trailer))
+	if err != nil {
+		return "", "", grpcStatusError(ctx, config, err, trailer)
+	}
+	if response.GetPayload() == "" {
+		return "", "", errors.New("server response is missing the encrypted payload")
+	}
+	return response.GetPayload(), response.GetNextCursor(), nil
+}
+
+// Close closes the connections of the transport.
+func (t *grpcTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var errs []error
+	for address, conn := range t.conns {
+		errs = append(errs, conn.Close())
+		delete(t.conns, address)
+	}
+	return errors.Join(errs...)
+}
+
+// conn returns the connection to the server of config, creating it on first
+// use. The connection is established lazily, by the first call.
+func (t *grpcTransport) conn(config *Config) (*grpc.ClientConn, error) {
+	address, err := grpcAddress(config)
+	if err != nil {
+		return nil, err
+	}
+	key := "https://" + address
+	if config.DisableHTTPS {
+		key = "http://" + address
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if conn, ok := t.conns[key]; ok {
+		return conn, nil
+	}
+
+	transportCredentials := credentials.NewTLS(t.options.TLS)
+	if config.DisableHTTPS {
+		transportCredentials = insecure.NewCredentials()
+	}
+	dialOptions := []grpc.DialOption{
+		grpc.WithTransportCredentials(transportCredentials),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxGRPCMessageSize)),
+	}
+	if t.options.Retries > 0 {
+		dialOptions = append(dialOptions, grpc.WithDefaultServiceConfig(grpcServiceConfig(t.options)))
+	}
+	// Without a proxy of their own, the connections go through the proxy of
+	// the environment, like grpc-go does by default
+	if t.options.Proxy != nil {
+		dialOptions = append(dialOptions, grpc.WithNoProxy(), grpc.WithContextDialer(proxyDialer(t.options.Proxy, t.options.TLS)))
+	}
+	conn, err := grpc.NewClient("dns:///"+address, dialOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection: %w", err)
+	}
+	t.conns[key] = conn
+	return conn, nil
+}
+
+// grpcAddress returns the host and port of the gRPC API of the server of
+// config: the port is the one of the server URL, or the default port of
+// HTTPS or HTTP.
+func grpcAddress(config *Config) (string, error) {
+	u, err := url.Parse("//" + config.ServerURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid server URL %q", config.ServerURL)
+	}
+	if u.Path != "" {
+		return "", fmt.Errorf("the gRPC transport doesn't support server URLs with a path prefix: %s", config.ServerURL)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if config.DisableHTTPS {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// grpcServiceConfig returns the service config retrying the calls failing
+// with UNAVAILABLE as configured by options.
+func grpcServiceConfig(options HTTPOptions) string {
+	backoff := max(options.RetryBackoff, time.Millisecond)
+	config, _ := json.Marshal(map[string]any{
+		"methodConfig": []any{map[string]any{
+			"name": []any{map[string]string{"service": GRPCService}},
+			"retryPolicy": map[string]any{
+				"maxAttempts":          min(options.Retries+1, grpcMaxAttempts),
+				"initialBackoff":       strconv.FormatFloat(backoff.Seconds(), 'f', -1, 64) + "s",
+				"maxBackoff":           strconv.FormatFloat(maxRetryBackoff.Seconds(), 'f', -1, 64) + "s",
+				"backoffMultiplier":    2,
+				"retryableStatusCodes": []string{"UNAVAILABLE"},
+			},
+		}},
+	})
+	return string(config)
+}
+
+// grpcMetadata returns the metadata of a call sending request: the headers
+// GET /cli would have, with the serialized request signed as the body.
+func grpcMetadata(ctx context.Context, config *Config, request proto.Message, requestID string) (metadata.MD, error) {
+	body, err := proto.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := newRequest(ctx, http.MethodPost, serverBaseURL(config)+environmentspb.Environments_Fetch_FullMethodName, bytes.NewReader(body), requestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if err := setAuthorization(req, config); err != nil {
+		return nil, err
+	}
+	req.Header.Set(PayloadVersionHeader, strconv.Itoa(PayloadVersion))
+	if ids := config.KeyIDs(); len(ids) > 0 {
+		req.Header.Set(KeyIDsHeader, strings.Join(ids, ","))
+	}
+
+	md := make(metadata.MD, len(req.Header))
+	for name, values := range req.Header {
+		md.Set(name, values...)
+	}
+	return md, nil
+}
+
+// grpcStatusError returns the error of a failed call, classified like the
+// matching HTTP status, with the trailer of the call.
+func grpcStatusError(ctx context.Context, config *Config, err error, trailer metadata.MD) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return unreachableError(config, ctxErr)
+	}
+	st := status.Convert(err)
+
+	var statusCode int
+	switch st.Code() {
+	case codes.Unauthenticated:
+		statusCode = http.StatusUnauthorized
+	case codes.PermissionDenied:
+		statusCode = http.StatusForbidden
+	case codes.NotFound:
+		statusCode = http.StatusNotFound
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return unreachableError(config, fmt.Errorf("gRPC status %s: %s", st.Code(), st.Message()))
+	case codes.Unimplemented:
+		return fmt.Errorf("server returned gRPC status %s for environment ID '%s' on branch '%s'. Please verify that the server supports the gRPC transport",
+			st.Code(), config.ID, config.Branch)
+	}
+	if values := trailer.Get("stacksenv-revoked"); len(values) > 0 && values[0] == "true" {
+		body, _ := json.Marshal(revocationResponse{Error: st.Message(), Revoked: true})
+		if err := revokedError(config, statusCode, body); err != nil {
+			return err
+		}
+	}
+
+	var errorDetails string
+	if st.Message() != "" {
+		errorDetails = " - Server response: " + st.Message()
+	}
+	err = fmt.Errorf("server returned gRPC status %s for environment ID '%s' on branch '%s'%s. Please verify your credentials and environment configuration",
+		st.Code(), config.ID, config.Branch, errorDetails)
+	return classify(statusClass(statusCode), statusCode, err)
+}
+
+// proxyDialer returns the dialer of the gRPC connections going through
+// proxyURL, an HTTP, HTTPS or SOCKS5 proxy as accepted by ParseProxyURL.
+// HTTPS proxies are verified with tlsConfig.
+func proxyDialer(proxyURL *url.URL, tlsConfig *tls.Config) func(context.Context, string) (net.Conn, error) {
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		if strings.HasPrefix(proxyURL.Scheme, "socks5") {
+			dialer, err := proxy.FromURL(proxyURL, &net.Dialer{})
+			if err != nil {
+				return nil, err
+			}
+			return dialer.(proxy.ContextDialer).DialContext(ctx, "tcp", address)
+		}
+		return dialHTTPProxy(ctx, proxyURL, tlsConfig, address)
+	}
+}
+
+// dialHTTPProxy opens a tunnel to address through the HTTP or HTTPS proxy
+// at proxyURL with a CONNECT request.
+func dialHTTPProxy(ctx context.Context, proxyURL *url.URL, tlsConfig *tls.Config, address string) (net.Conn, error) {
+	proxyAddress := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddress = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+
+	var conn net.Conn
+	var err error
+	if proxyURL.Scheme == "https" {
+		config := &tls.Config{}
+		if tlsConfig != nil {
+			config = tlsConfig.Clone()
+		}
+		config.ServerName = proxyURL.Hostname()
+		conn, err = (&tls.Dialer{Config: config}).DialContext(ctx, "tcp", proxyAddress)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", proxyAddress)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect through proxy: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect through proxy: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused the connection to %s: %s", address, resp.Status)
+	}
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a connection whose first bytes were read into reader.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
@@ -0,0 +1,60 @@
+package stacksenv
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+)
+
+// hashHeader starts the canonical encoding hashed by Hash. It names the
+// encoding version, so a future encoding can never collide with this one.
+const hashHeader = "stacksenv-hash-v1\n"
+
+// Hash returns a deterministic hash of a set of variables, as 64 lowercase
+// hex digits. Two sets hash the same exactly when they hold the same
+// variables with the same values and platform restrictions, whatever their
+// order. Tombstones of soft-deleted variables are ignored.
+//
+// The hash is the SHA-256 of a canonical encoding: a header naming the
+// encoding version, then one line per variable, sorted bytewise, holding the
+// JSON array [property, value, os, arch]. Values are encoded as they are
+// injected into the environment, and the os and arch lists are sorted.
+// The encoding is stable: hashes can be compared across CLI and library
+// versions, and a change to it would come with a new function.
+func Hash[T any](properties []ContextData[T]) string {
+	lines := make([]string, 0, len(properties))
+	for _, contextData := range properties {
+		if contextData.IsDeleted() {
+			continue
+		}
+		record := []interface{}{
+			contextData.Property,
+			envValue(contextData.Value),
+			sortedOrEmpty(contextData.OS),
+			sortedOrEmpty(contextData.Arch),
+		}
+		// Strings and lists of strings always marshal
+		line, _ := json.Marshal(record)
+		lines = append(lines, string(line))
+	}
+	slices.Sort(lines)
+
+	hash := sha256.New()
+	hash.Write([]byte(hashHeader))
+	for _, line := range lines {
+		hash.Write([]byte(line))
+		hash.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// sortedOrEmpty returns a sorted copy of values, empty rather than nil.
+func sortedOrEmpty(values []string) []string {
+	sorted := slices.Clone(values)
+	if sorted == nil {
+		sorted = []string{}
+	}
+	slices.Sort(sorted)
+	return sorted
+}
@@ -0,0 +1,93 @@
+package stacksenv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+)
+
+// Heartbeat is the check-in a long-running CLI sends to the server so platform
+// teams can see which machines consume which environments. It never carries
+// variable names or values.
+type Heartbeat struct {
+	Hostname string   `json:"hostname"` // Name of the machine
+	Version  string   `json:"version"`  // Version of the CLI
+	OS       string   `json:"os"`       // GOOS of the CLI
+	Arch     string   `json:"arch"`     // GOARCH of the CLI
+	Branches []string `json:"branches"` // Branches in use
+}
+
+// NewHeartbeat returns a heartbeat for this machine, the given CLI version and
+// the branches in use.
+func NewHeartbeat(version string, branches ...string) *Heartbeat {
+	hostname, _ := os.Hostname()
+	return &Heartbeat{
+		Hostname: hostname,
+		Version:  version,
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		Branches: branches,
+	}
+}
+
+// SendHeartbeat checks in with the server of config.
+//
+// It sends a POST request to {protocol}://{ServerURL}/cli/heartbeat with the ID
+// as a query parameter, the access token, if any, as a bearer token and the
+// heartbeat as JSON. Returns a *RequestError if the request fails.
+func SendHeartbeat(ctx context.Context, config *Config, httpClient HTTPClient, heartbeat *Heartbeat) error {
+	requestID := NewRequestID()
+
+	if err := sendHeartbeat(ctx, config, httpClient, requestID, heartbeat); err != nil {
+		return &RequestError{RequestID: requestID, Err: err}
+	}
+
+	return nil
+}
+
+// sendHeartbeat performs the check-in for a single request ID.
+func sendHeartbeat(ctx context.Context, config *Config, httpClient HTTPClient, requestID string, heartbeat *Heartbeat) error {
+	payload, err := json.Marshal(heartbeat)
+	if err != nil {
+		return fmt.Errorf("failed to encode heartbeat: %w", err)
+	}
+
+	u, err := url.Parse(serverBaseURL(config) + "/cli/heartbeat")
+	if err != nil {
+		return fmt.Errorf("failed to parse URL: %w", err)
+	}
+	params := url.Values{}
+	params.Set("id", config.ID)
+	u.RawQuery = params.Encode()
+
+	req, err := newRequest(ctx, http.MethodPost, u.String(), bytes.NewReader(payload), requestID)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := setAuthorization(req, config); err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return unreachableError(config, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusAccepted {
+		err := fmt.Errorf("server returned HTTP status %d (%s) for the heartbeat of environment ID '%s'",
+			resp.StatusCode, http.StatusText(resp.StatusCode), config.ID)
+		if resp.StatusCode == http.StatusNotFound {
+			err = unsupportedFeatureError(ctx, config, httpClient, requestID, FeatureHeartbeat, err)
+		}
+		return err
+	}
+
+	return nil
+}
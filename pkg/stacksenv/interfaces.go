@@ -1,13 +1,17 @@
 package stacksenv
 
 import (
+	"context"
 	"net/http"
+	"os/exec"
 )
 
 // HTTPClient defines the interface for making HTTP requests.
 // This abstraction allows for easier testing and custom HTTP client implementations.
 type HTTPClient interface {
-	// Do sends an HTTP request and returns an HTTP response.
+	// Do sends an HTTP request and returns an HTTP response. Requests carry
+	// the context of the operation they belong to: implementations must
+	// abort them when req.Context() is done.
 	Do(req *http.Request) (*http.Response, error)
 }
 
@@ -19,6 +23,8 @@ type URLParser interface {
 }
 
 // CryptoService defines the interface for encryption and decryption operations.
+// Operations run in memory and are not cancellable; DefaultClientService checks
+// its context between decryption attempts.
 type CryptoService interface {
 	// Encrypt encrypts a slice of context data using the provided secret and AAD.
 	Encrypt(data []ContextData[any], sharedSecret, aad string) (string, error)
@@ -34,8 +40,89 @@ type CommandExecutor interface {
 	Execute(command string, args []string, env []string) error
 }
 
+// ContextCommandExecutor is implemented by command executors that can stop a
+// command when a context is done, so callers can cancel it or set a deadline.
+type ContextCommandExecutor interface {
+	CommandExecutor
+	// ExecuteContext is like Execute but stops the command when ctx is done.
+	ExecuteContext(ctx context.Context, command string, args []string, env []string) error
+}
+
+// ProcessStarter is implemented by command executors that can start a command
+// without waiting for it, which is required to supervise it in watch mode.
+type ProcessStarter interface {
+	// Start starts a command with the given arguments and environment variables.
+	// The caller is responsible for waiting on the returned command.
+	Start(command string, args []string, env []string) (*exec.Cmd, error)
+}
+
 // ClientService defines the interface for fetching context data from the server.
 type ClientService interface {
 	// GetContextDecryptedData fetches and decrypts context data from the server.
 	GetContextDecryptedData(config *Config) ([]ContextData[any], error)
 }
+
+// Transport carries the fetches of DefaultClientService to the server, e.g.
+// over HTTP (NewHTTPTransport) or gRPC (NewGRPCTransport). Decrypting the
+// payloads it returns is left to the CryptoService of the client service.
+type Transport interface {
+	// FetchPage fetches the encrypted page of the environment of config at
+	// cursor, or the first page if cursor is empty, tagged with requestID.
+	// It returns the payload of the page and the cursor of the next one,
+	// empty on the last page. Errors are classified like those of
+	// DefaultClientService, e.g. ErrAuthFailed or ErrServerUnreachable.
+	FetchPage(ctx context.Context, config *Config, requestID, cursor string) (payload, next string, err error)
+}
+
+// ContextClientService is implemented by client services that can bind a
+// fetch to a context, so callers can cancel it or set a deadline.
+type ContextClientService interface {
+	ClientService
+	// GetContextDecryptedDataContext is like GetContextDecryptedData but
+	// aborts the fetch when ctx is done.
+	GetContextDecryptedDataContext(ctx context.Context, config *Config) ([]ContextData[any], error)
+}
+
+// WriterClientService is implemented by client services that can write
+// environments to the server, in addition to fetching them.
+type WriterClientService interface {
+	ClientService
+	// PutContextEncryptedDataContext encrypts data and replaces the variables
+	// of the branch of config with it.
+	PutContextEncryptedDataContext(ctx context.Context, config *Config, data []ContextData[any]) error
+	// DeleteContextDataContext deletes the branch of config.
+	DeleteContextDataContext(ctx context.Context, config *Config) error
+}
+
+// VersionedClientService is implemented by client services that can write a
+// branch only if it wasn't changed since it was fetched, so concurrent
+// updates of a branch don't overwrite each other.
+type VersionedClientService interface {
+	WriterClientService
+	// GetVersionedContext is like GetContextDecryptedDataContext, and also
+	// returns the version of the branch, empty if the server doesn't report
+	// it.
+	GetVersionedContext(ctx context.Context, config *Config) ([]ContextData[any], string, error)
+	// PutIfMatchContext is like PutContextEncryptedDataContext, but fails
+	// with ErrConflict if the branch is no longer at version.
+	PutIfMatchContext(ctx context.Context, config *Config, data []ContextData[any], version string) error
+}
+
+// SubscribingClientService is implemented by client services that can stream
+// the changes of an environment, so callers react to them without polling.
+type SubscribingClientService interface {
+	ClientService
+	// Subscribe returns the channel of the events of the environment of
+	// config, closed when ctx is done or the subscription ends.
+	Subscribe(ctx context.Context, config *Config) (<-chan EnvironmentEvent, error)
+}
+
+// BatchClientService is implemented by client services that can fetch the
+// environments of several configurations at once.
+type BatchClientService interface {
+	ClientService
+	// GetManyContext fetches and decrypts the environments of configs and
+	// returns their results in order, with the joined errors of the failed
+	// ones.
+	GetManyContext(ctx context.Context, configs []Config) ([]BatchResult, error)
+}
@@ -0,0 +1,103 @@
+package stacksenv
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Logger receives the messages of the package, so it never writes to the
+// standard output of the process, which belongs to the executed command.
+type Logger interface {
+	// Debugf logs details useful to diagnose a problem, such as the
+	// variables fetched (without their values).
+	Debugf(format string, args ...any)
+	// Infof logs progress the user may want to see, such as a command being
+	// restarted in watch mode.
+	Infof(format string, args ...any)
+	// Warnf logs failures the package recovers from, such as a failed poll in
+	// watch mode.
+	Warnf(format string, args ...any)
+}
+
+// DiscardLogger is a Logger dropping all messages.
+var DiscardLogger Logger = discardLogger{}
+
+type discardLogger struct{}
+
+func (discardLogger) Debugf(string, ...any) {}
+func (discardLogger) Infof(string, ...any)  {}
+func (discardLogger) Warnf(string, ...any)  {}
+
+// writerLogger writes messages as "stacksenv: " lines to a writer.
+type writerLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	debug bool
+}
+
+// NewWriterLogger returns a Logger writing messages to w, one line each
+// prefixed with "stacksenv: ". Debug messages are dropped unless debug is set.
+func NewWriterLogger(w io.Writer, debug bool) Logger {
+	return &writerLogger{w: w, debug: debug}
+}
+
+// defaultLogger returns the Logger used when none is given: informational
+// messages and warnings go to standard error, debug messages are dropped.
+func defaultLogger() Logger {
+	return NewWriterLogger(os.Stderr, false)
+}
+
+func (l *writerLogger) Debugf(format string, args ...any) {
+	if l.debug {
+		l.printf(format, args...)
+	}
+}
+
+func (l *writerLogger) Infof(format string, args ...any) {
+	l.printf(format, args...)
+}
+
+func (l *writerLogger) Warnf(format string, args ...any) {
+	l.printf(format, args...)
+}
+
+func (l *writerLogger) printf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.w, "stacksenv: "+format+"\n", args...)
+}
+
+// slogLogger forwards messages to a slog.Handler.
+type slogLogger struct {
+	handler slog.Handler
+}
+
+// NewSlogLogger returns a Logger forwarding messages to handler at the debug,
+// info and warning levels, for applications logging with log/slog.
+func NewSlogLogger(handler slog.Handler) Logger {
+	return slogLogger{handler: handler}
+}
+
+func (l slogLogger) Debugf(format string, args ...any) {
+	l.log(slog.LevelDebug, format, args...)
+}
+
+func (l slogLogger) Infof(format string, args ...any) {
+	l.log(slog.LevelInfo, format, args...)
+}
+
+func (l slogLogger) Warnf(format string, args ...any) {
+	l.log(slog.LevelWarn, format, args...)
+}
+
+func (l slogLogger) log(level slog.Level, format string, args ...any) {
+	ctx := context.Background()
+	if !l.handler.Enabled(ctx, level) {
+		return
+	}
+	slog.New(l.handler).Log(ctx, level, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,193 @@
+package stacksenv
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/*
+Versioned payload format:
+| "se" | version | "." | key usage | "." | key ID ["!"] | "." | legacy payload (base64) |
+
+e.g. "se2.kp.2026-10.<base64>". The header tells which credential encrypted
+the payload and which authenticates it, so the client decrypts it once. The
+key ID names the secret key used, empty for the SecretKey of the URL, and is
+followed by "!" if the key is deprecated. Version 1 headers have no key ID.
+The separator never occurs in base64, so payloads without a header, sent by
+servers predating it, are told apart and still decrypted by trying the
+combinations servers used.
+*/
+
+// PayloadVersion is the latest payload header version the client understands.
+const PayloadVersion = 2
+
+// PayloadVersionHeader is the request header of GET /cli carrying
+// PayloadVersion, so the server only sends payload headers to clients
+// understanding them.
+const PayloadVersionHeader = "X-Payload-Version"
+
+// KeyIDsHeader is the request header of GET /cli listing the IDs of the
+// secret keys of the configuration, comma-separated, so the server encrypts
+// the environment with the newest one the client has during a rotation.
+const KeyIDsHeader = "X-Key-IDs"
+
+// payloadPrefix starts every payload header.
+const payloadPrefix = "se"
+
+// deprecatedKeyMark follows the key ID of deprecated keys in payload headers.
+const deprecatedKeyMark = "!"
+
+// KeyUsage tells which credential of the configuration is the shared secret
+// of a payload and which is its AAD. Its first letter is the shared secret,
+// "k" for the SecretKey and "s" for the Secret; its second one the AAD, "k"
+// or "s" likewise, "p" for the pair "Secret|SecretKey" and "n" for none.
+type KeyUsage string
+
+// Key usages servers encrypt payloads with.
+const (
+	KeyUsageSecretKeyPair   KeyUsage = "kp" // SecretKey as shared secret, Secret|SecretKey as AAD
+	KeyUsageSecretSecretKey KeyUsage = "sk" // Secret as shared secret, SecretKey as AAD
+	KeyUsageSecretKeySecret KeyUsage = "ks" // SecretKey as shared secret, Secret as AAD
+	KeyUsageSecretPair      KeyUsage = "sp" // Secret as shared secret, Secret|SecretKey as AAD
+	KeyUsageSecretKeyOnly   KeyUsage = "kn" // SecretKey as shared secret, empty AAD
+	KeyUsageSecretOnly      KeyUsage = "sn" // Secret as shared secret, empty AAD
+)
+
+// legacyKeyUsages are the key usages tried in turn, in order of likelihood,
+// for payloads without header.
+var legacyKeyUsages = []KeyUsage{
+	KeyUsageSecretKeyPair,
+	KeyUsageSecretSecretKey,
+	KeyUsageSecretKeySecret,
+	KeyUsageSecretPair,
+	KeyUsageSecretKeyOnly,
+	KeyUsageSecretOnly,
+}
+
+// Credentials returns the shared secret and the AAD of the key usage for
+// config. ok is false for an unknown key usage.
+func (u KeyUsage) Credentials(config *Config) (sharedSecret, aad string, ok bool) {
+	if len(u) != 2 {
+		return "", "", false
+	}
+	switch u[0] {
+	case 'k':
+		sharedSecret = config.SecretKey
+	case 's':
+		sharedSecret = config.Secret
+	default:
+		return "", "", false
+	}
+	switch u[1] {
+	case 'k':
+		aad = config.SecretKey
+	case 's':
+		aad = config.Secret
+	case 'p':
+		aad = config.Secret + "|" + config.SecretKey
+	case 'n':
+	default:
+		return "", "", false
+	}
+	return sharedSecret, aad, true
+}
+
+// PayloadHeader describes how a payload was encrypted.
+type PayloadHeader struct {
+	Version    int      // Version of the header, at most PayloadVersion
+	KeyUsage   KeyUsage // Credentials the payload was encrypted with
+	KeyID      string   // ID of the secret key, empty for the SecretKey of the URL; version 2 and later
+	Deprecated bool     // Whether the secret key is deprecated; version 2 and later
+}
+
+// FormatPayload prefixes a payload encrypted by a CryptoService with header.
+func FormatPayload(header PayloadHeader, encrypted string) string {
+	if header.Version < 2 {
+		return fmt.Sprintf("%s%d.%s.%s", payloadPrefix, header.Version, header.KeyUsage, encrypted)
+	}
+	keyID := header.KeyID
+	if header.Deprecated {
+		keyID += deprecatedKeyMark
+	}
+	return fmt.Sprintf("%s%d.%s.%s.%s", payloadPrefix, header.Version, header.KeyUsage, keyID, encrypted)
+}
+
+// ParsePayload splits a payload into its header and the payload encrypted by
+// a CryptoService. The header is nil for a payload without one. Returns an
+// error for a header of a version newer than PayloadVersion, with an unknown
+// key usage or an invalid key ID.
+func ParsePayload(payload string) (*PayloadHeader, string, error) {
+	rawHeader, encrypted, ok := strings.Cut(payload, ".")
+	if !ok {
+		return nil, payload, nil
+	}
+	rawUsage, encrypted, ok := strings.Cut(encrypted, ".")
+	rawVersion, isHeader := strings.CutPrefix(rawHeader, payloadPrefix)
+	version, err := strconv.Atoi(rawVersion)
+	if !ok || !isHeader || err != nil || version < 1 {
+		return nil, "", fmt.Errorf("invalid payload header %q: expected \"%s<version>.<key usage>.\"", rawHeader, payloadPrefix)
+	}
+	if version > PayloadVersion {
+		return nil, "", fmt.Errorf("unsupported payload version %d: this CLI understands up to version %d. Please upgrade the CLI", version, PayloadVersion)
+	}
+
+	usage := KeyUsage(rawUsage)
+	if _, _, ok := usage.Credentials(&Config{}); !ok {
+		return nil, "", fmt.Errorf("unknown key usage %q in payload header", rawUsage)
+	}
+	header := &PayloadHeader{Version: version, KeyUsage: usage}
+	if version < 2 {
+		return header, encrypted, nil
+	}
+
+	rawKeyID, encrypted, ok := strings.Cut(encrypted, ".")
+	if !ok {
+		return nil, "", fmt.Errorf("invalid payload header: the key ID of version %d is missing", version)
+	}
+	header.KeyID, header.Deprecated = strings.CutSuffix(rawKeyID, deprecatedKeyMark)
+	if header.KeyID != "" && !ValidKeyID(header.KeyID) {
+		return nil, "", fmt.Errorf("invalid key ID %q in payload header", header.KeyID)
+	}
+	return header, encrypted, nil
+}
+
+// ValidKeyID reports whether id is a valid secret key ID: letters, digits,
+// '-' and '_' only.
+func ValidKeyID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// KeyIDs returns the sorted IDs of the secret keys of the configuration:
+// KeyID, if set, and those of SecretKeys.
+func (c *Config) KeyIDs() []string {
+	ids := slices.Collect(maps.Keys(c.SecretKeys))
+	if c.KeyID != "" && !slices.Contains(ids, c.KeyID) {
+		ids = append(ids, c.KeyID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// secretKey returns the secret key of the configuration with the given ID.
+// The SecretKey is used for an empty ID, for KeyID and for any ID not in
+// SecretKeys when KeyID is unknown.
+func (c *Config) secretKey(id string) (string, bool) {
+	if id == "" || id == c.KeyID {
+		return c.SecretKey, true
+	}
+	if key, ok := c.SecretKeys[id]; ok {
+		return key, true
+	}
+	return c.SecretKey, c.KeyID == ""
+}
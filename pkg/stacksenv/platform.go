@@ -0,0 +1,43 @@
+package stacksenv
+
+import (
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// MatchesPlatform reports whether the variable applies to the given operating
+// system and architecture, using GOOS and GOARCH values such as "darwin" and
+// "arm64". Empty OS and Arch lists match every platform.
+func (c ContextData[T]) MatchesPlatform(goos, goarch string) bool {
+	return matchesCondition(c.OS, goos) && matchesCondition(c.Arch, goarch)
+}
+
+// FilterPlatform returns the variables that apply to the given operating system
+// and architecture, preserving their order.
+func FilterPlatform[T any](properties []ContextData[T], goos, goarch string) []ContextData[T] {
+	filtered := make([]ContextData[T], 0, len(properties))
+	for _, contextData := range properties {
+		if contextData.MatchesPlatform(goos, goarch) {
+			filtered = append(filtered, contextData)
+		}
+	}
+	return filtered
+}
+
+// FilterCurrentPlatform returns the variables that apply to the platform the
+// program is running on (runtime.GOOS and runtime.GOARCH).
+func FilterCurrentPlatform[T any](properties []ContextData[T]) []ContextData[T] {
+	return FilterPlatform(properties, runtime.GOOS, runtime.GOARCH)
+}
+
+// matchesCondition reports whether value is one of the allowed values,
+// compared case-insensitively. An empty list allows every value.
+func matchesCondition(allowed []string, value string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(allowed, func(a string) bool {
+		return strings.EqualFold(strings.TrimSpace(a), value)
+	})
+}
@@ -0,0 +1,72 @@
+package stacksenv
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	// RequestIDHeader is the header carrying the per-operation request ID.
+	// The server is expected to log it so client and server logs can be correlated.
+	RequestIDHeader = "X-Request-ID"
+
+	// IdempotencyKeyHeader is the header carrying the idempotency key for
+	// mutating requests. It reuses the request ID of the operation.
+	IdempotencyKeyHeader = "Idempotency-Key"
+)
+
+// RequestError wraps an error that occurred during a server operation together
+// with the request ID that was sent to the server.
+type RequestError struct {
+	RequestID string // Request ID sent in the X-Request-ID header
+	Err       error  // Underlying error
+}
+
+// Error returns the underlying error message followed by the request ID.
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%v (request ID: %s)", e.Err, e.RequestID)
+}
+
+// Unwrap returns the underlying error.
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// NewRequestID generates a random request ID in the UUID v4 format.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		// crypto/rand never fails on supported platforms, but keep the ID non-empty
+		return "00000000-0000-4000-8000-000000000000"
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+
+	s := hex.EncodeToString(b)
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
+
+// newRequest creates an HTTP request bound to ctx and tagged with the given request ID.
+//
+// Every request carries the X-Request-ID header. Mutating requests (anything
+// other than GET, HEAD and OPTIONS) additionally carry the request ID as their
+// Idempotency-Key so the server can safely deduplicate retried writes.
+func newRequest(ctx context.Context, method, url string, body io.Reader, requestID string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set(RequestIDHeader, requestID)
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		req.Header.Set(IdempotencyKeyHeader, requestID)
+	}
+
+	return req, nil
+}
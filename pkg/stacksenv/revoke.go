@@ -0,0 +1,40 @@
+package stacksenv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrRevoked is returned, wrapped, when the server reports that the
+// credentials or the access token of a request have been revoked. Clients
+// must stop using anything fetched with them, including cached environments.
+var ErrRevoked = errors.New("credentials revoked")
+
+// revocationResponse is the body of a revocation response: HTTP 401 or 403
+// with {"error": "...", "revoked": true}.
+type revocationResponse struct {
+	Error   string `json:"error"`
+	Revoked bool   `json:"revoked"`
+}
+
+// revokedError returns an error wrapping ErrRevoked, of class ErrAuthFailed,
+// if a response with the
+// with the given status code and body reports revoked credentials, or nil.
+func revokedError(config *Config, statusCode int, body []byte) error {
+	if statusCode != http.StatusUnauthorized && statusCode != http.StatusForbidden {
+		return nil
+	}
+
+	var revocation revocationResponse
+	if err := json.Unmarshal(body, &revocation); err != nil || !revocation.Revoked {
+		return nil
+	}
+
+	reason := ""
+	if revocation.Error != "" {
+		reason = ": " + revocation.Error
+	}
+	return classify(ErrAuthFailed, statusCode, fmt.Errorf("%w: the server revoked the credentials for environment ID '%s'%s. Please obtain new credentials", ErrRevoked, config.ID, reason))
+}
@@ -0,0 +1,153 @@
+package stacksenv
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Request signatures:
+| X-Stacksenv-Timestamp: <unix seconds>
+| X-Stacksenv-Signature: v1=<hex HMAC-SHA256>
+
+Requests of configurations with SignRequests set prove the possession of the
+environment secret without sending it: the signature is the HMAC-SHA256, keyed
+by the secret, of the canonical request, the lines
+
+	v1
+	<timestamp>
+	<METHOD>
+	<escaped path>
+	<query, with sorted parameters>
+	<hex SHA-256 of the body>
+
+The server recomputes it to reject forged requests, and rejects timestamps
+older than a few minutes to reject replayed ones, see VerifyRequestSignature.
+*/
+
+const (
+	// TimestampHeader is the header carrying the time a request was signed
+	// at, in Unix seconds.
+	TimestampHeader = "X-Stacksenv-Timestamp"
+	// SignatureHeader is the header carrying the signature of a request.
+	SignatureHeader = "X-Stacksenv-Signature"
+
+	// signatureVersion prefixes the signatures of the canonical request
+	// format above.
+	signatureVersion = "v1"
+
+	// DefaultSignatureMaxAge is how old, or how far in the future, the
+	// timestamp of a signed request can be by default for
+	// VerifyRequestSignature.
+	DefaultSignatureMaxAge = 5 * time.Minute
+)
+
+// ErrInvalidSignature is matched by the errors of VerifyRequestSignature.
+var ErrInvalidSignature = errors.New("invalid request signature")
+
+// signRequest signs req with the secret of config if config.SignRequests is
+// set. The body is read through req.GetBody, so the request can still be
+// sent.
+func signRequest(req *http.Request, config *Config) error {
+	if !config.SignRequests {
+		return nil
+	}
+	if config.Secret == "" {
+		return errors.New("signing requests requires the environment secret")
+	}
+	body, err := requestBody(req)
+	if err != nil {
+		return fmt.Errorf("failed to read the body of the request to sign: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, signatureVersion+"="+requestSignature(config.Secret, timestamp, req, body))
+	return nil
+}
+
+// requestBody returns a copy of the body of req, nil if it has none.
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("the body can't be read twice")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// requestSignature returns the hex HMAC-SHA256 of the canonical form of req,
+// signed at timestamp with the given body.
+func requestSignature(secret, timestamp string, req *http.Request, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	canonical := strings.Join([]string{
+		signatureVersion,
+		timestamp,
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyRequestSignature checks the signature of a request received by a
+// server, for servers and proxies written in Go: the signature must match
+// the request signed with secret, the secret of the environment it is for,
+// and its timestamp must be within maxAge of the current time
+// (DefaultSignatureMaxAge if 0). The body is read and replaced, so the
+// request can still be handled.
+//
+// The path checked is the one received: a reverse proxy serving the server
+// under a path prefix must keep it. Errors match ErrInvalidSignature.
+func VerifyRequestSignature(req *http.Request, secret string, maxAge time.Duration) error {
+	if maxAge <= 0 {
+		maxAge = DefaultSignatureMaxAge
+	}
+	timestamp := req.Header.Get(TimestampHeader)
+	signature, ok := strings.CutPrefix(req.Header.Get(SignatureHeader), signatureVersion+"=")
+	if timestamp == "" || !ok {
+		return fmt.Errorf("%w: the request isn't signed", ErrInvalidSignature)
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp %q", ErrInvalidSignature, timestamp)
+	}
+	switch age := time.Since(time.Unix(seconds, 0)); {
+	case age > maxAge:
+		return fmt.Errorf("%w: the request was signed %s ago, more than %s", ErrInvalidSignature, age.Round(time.Second), maxAge)
+	case age < -maxAge:
+		return fmt.Errorf("%w: the request is signed %s in the future, more than %s", ErrInvalidSignature, (-age).Round(time.Second), maxAge)
+	}
+
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return fmt.Errorf("failed to read the body of the request: %w", err)
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	expected := requestSignature(secret, timestamp, req, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return fmt.Errorf("%w: the signature doesn't match the request", ErrInvalidSignature)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package stacksenv
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -13,12 +14,34 @@ type Handler struct {
 	urlParser       URLParser
 	clientService   ClientService
 	commandExecutor CommandExecutor
+	logger          Logger
+
+	// ExtraEnv holds KEY=VALUE entries passed to executed commands in addition to
+	// the fetched variables. They are applied after the fetched variables and
+	// therefore take precedence over them.
+	ExtraEnv []string
+
+	// OnStart, if set, is called with the branch and the KEY=VALUE entries a
+	// command is about to be started with, including ExtraEnv. In watch mode
+	// it is called again before every restart.
+	OnStart func(branch string, env []string)
 }
 
 // NewHandler creates a new Handler with the provided dependencies.
 // If nil is passed for any dependency, a default implementation will be used.
+// Messages are written to standard error; see NewHandlerWithLogger.
 func NewHandler(urlParser URLParser, clientService ClientService, commandExecutor CommandExecutor) *Handler {
-	h := &Handler{}
+	return NewHandlerWithLogger(urlParser, clientService, commandExecutor, nil)
+}
+
+// NewHandlerWithLogger is like NewHandler but sends the messages of the
+// handler, and of the default client service, to logger. A nil logger writes
+// informational messages and warnings to standard error.
+func NewHandlerWithLogger(urlParser URLParser, clientService ClientService, commandExecutor CommandExecutor, logger Logger) *Handler {
+	if logger == nil {
+		logger = defaultLogger()
+	}
+	h := &Handler{logger: logger}
 
 	if urlParser == nil {
 		h.urlParser = NewURLParser()
@@ -29,7 +52,7 @@ func NewHandler(urlParser URLParser, clientService ClientService, commandExecuto
 	if clientService == nil {
 		httpClient := NewHTTPClient()
 		crypto := NewCryptoService()
-		h.clientService = NewClientService(httpClient, crypto)
+		h.clientService = NewClientServiceWithOptions(httpClient, crypto, ClientServiceOptions{Logger: logger})
 	} else {
 		h.clientService = clientService
 	}
@@ -49,7 +72,8 @@ func NewHandler(urlParser URLParser, clientService ClientService, commandExecuto
 // The process:
 //  1. Parses the stacksenv URL (if provided) to extract configuration
 //  2. Fetches and decrypts context data from the server
-//  3. Sets environment variables from the context data
+//  3. Sets environment variables from the context data, skipping variables
+//     restricted to other platforms
 //  4. Executes the provided command with those environment variables
 //
 // Parameters:
@@ -58,7 +82,16 @@ func NewHandler(urlParser URLParser, clientService ClientService, commandExecuto
 //
 // Returns an error if URL parsing, data fetching, or command execution fails.
 func (h *Handler) HandleStacksenvURLCLI(url string, args []string) error {
+	return h.HandleStacksenvURLCLIContext(context.Background(), url, args)
+}
+
+// HandleStacksenvURLCLIContext is like HandleStacksenvURLCLI but binds the fetch
+// and the command to ctx, if the client service and the command executor
+// support it (see FetchWithContext and ExecuteWithContext). When ctx is done,
+// the fetch is aborted or the command stopped.
+func (h *Handler) HandleStacksenvURLCLIContext(ctx context.Context, url string, args []string) error {
 	var properties []ContextData[any]
+	var branch string
 	originalURL := url
 
 	// Parse and process URL if provided
@@ -73,16 +106,18 @@ func (h *Handler) HandleStacksenvURLCLI(url string, args []string) error {
 				return fmt.Errorf("unable to parse stacksenv URL: %w. Please verify the URL format is correct: stacksenv://ID:SECRET:SECRET_KEY@SERVER_URL/BRANCH", err)
 			}
 
+			branch = config.Branch
+
 			// Fetch and decrypt context data
-			properties, err = h.clientService.GetContextDecryptedData(&config)
+			properties, err = FetchWithContext(ctx, h.clientService, &config)
 			if err != nil {
 				return fmt.Errorf("unable to retrieve environment context data: %w", err)
 			}
 
 			// Log properties (masking sensitive values)
-			fmt.Printf("Properties: %d\n", len(properties))
+			h.logger.Debugf("Properties: %d", len(properties))
 			for _, contextData := range properties {
-				fmt.Printf("%s = ***\n", contextData.Property)
+				h.logger.Debugf("%s = ***", contextData.Property)
 			}
 		}
 	}
@@ -98,20 +133,38 @@ func (h *Handler) HandleStacksenvURLCLI(url string, args []string) error {
 	// Prepare environment variables from properties
 	var envVars []string
 	if originalURL != "" && len(properties) > 0 {
-		envVars = make([]string, 0, len(properties))
-		for _, contextData := range properties {
-			// Convert value to string (assuming it's already a string or can be converted)
-			value, ok := contextData.Value.(string)
-			if !ok {
-				// Try to convert other types to string
-				value = fmt.Sprintf("%v", contextData.Value)
-			}
-			envVars = append(envVars, fmt.Sprintf("%s=%s", contextData.Property, value))
-		}
+		envVars = propertiesToEnv(properties)
+	}
+	envVars = append(envVars, h.ExtraEnv...)
+	if h.OnStart != nil {
+		h.OnStart(branch, envVars)
 	}
 
 	// Execute command with environment variables
-	return h.commandExecutor.Execute(command, commandArgs, envVars)
+	return ExecuteWithContext(ctx, h.commandExecutor, command, commandArgs, envVars)
+}
+
+// propertiesToEnv converts context data to KEY=VALUE environment entries.
+// Variables restricted to other platforms are skipped.
+func propertiesToEnv(properties []ContextData[any]) []string {
+	properties = FilterCurrentPlatform(properties)
+
+	envVars := make([]string, 0, len(properties))
+	for _, contextData := range properties {
+		envVars = append(envVars, fmt.Sprintf("%s=%s", contextData.Property, envValue(contextData.Value)))
+	}
+	return envVars
+}
+
+// envValue converts the value of a variable to the string it is injected as.
+func envValue(value any) string {
+	// Convert value to string (assuming it's already a string or can be converted)
+	s, ok := value.(string)
+	if !ok {
+		// Try to convert other types to string
+		s = fmt.Sprintf("%v", value)
+	}
+	return s
 }
 
 // DefaultCommandExecutor is the default implementation of CommandExecutor.
@@ -131,6 +184,46 @@ func NewCommandExecutor() CommandExecutor {
 //
 // Returns an error if the command execution fails.
 func (e *DefaultCommandExecutor) Execute(command string, args []string, env []string) error {
+	cmd, err := e.Start(command, args, env)
+	if err != nil {
+		return err
+	}
+
+	// Wait for the command to finish
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("failed to execute command '%s %s': %w", command, strings.Join(args, " "), err)
+	}
+
+	return nil
+}
+
+// ExecuteContext is like Execute but stops the command when ctx is done: the
+// command is interrupted, and killed if it doesn't exit within a grace
+// period. The result is the one of the command.
+func (e *DefaultCommandExecutor) ExecuteContext(ctx context.Context, command string, args []string, env []string) error {
+	cmd, err := e.Start(command, args, env)
+	if err != nil {
+		return err
+	}
+
+	proc := supervise(cmd)
+	select {
+	case <-proc.exited:
+	case <-ctx.Done():
+		proc.stop()
+	}
+	if proc.err != nil {
+		return fmt.Errorf("failed to execute command '%s %s': %w", command, strings.Join(args, " "), proc.err)
+	}
+
+	return nil
+}
+
+// Start starts a system command with the given arguments and environment
+// variables without waiting for it to finish. The I/O streams and environment
+// are set up exactly like Execute does. The caller must call Wait on the
+// returned command.
+func (e *DefaultCommandExecutor) Start(command string, args []string, env []string) (*exec.Cmd, error) {
 	cmd := exec.Command(command, args...)
 
 	// Set up I/O streams
@@ -146,12 +239,25 @@ func (e *DefaultCommandExecutor) Execute(command string, args []string, env []st
 		cmd.Env = append(cmd.Env, env...)
 	}
 
-	// Execute command
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to execute command '%s %s': %w", command, strings.Join(args, " "), err)
+	// Start command
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to execute command '%s %s': %w", command, strings.Join(args, " "), err)
 	}
 
-	return nil
+	return cmd, nil
+}
+
+// ExecuteWithContext runs a command with executor, stopping it when ctx is
+// done if executor implements ContextCommandExecutor. Other executors can't be
+// cancelled: ctx is only checked before starting the command.
+func ExecuteWithContext(ctx context.Context, executor CommandExecutor, command string, args []string, env []string) error {
+	if e, ok := executor.(ContextCommandExecutor); ok {
+		return e.ExecuteContext(ctx, command, args, env)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return executor.Execute(command, args, env)
 }
 
 // HandleStacksenvURLCLI is a convenience function that uses default implementations.
@@ -166,7 +272,8 @@ func HandleStacksenvURLCLI(url string, args []string) error {
 // It supports two modes:
 //  1. URL mode: If URL is provided, it parses the URL and fetches properties
 //  2. Config mode: If URL is empty, it validates required config properties and fetches properties
-//  3. If SetOSEnv is true, it will set the environment variables in the OS environment
+//  3. If SetOSEnv is true, it will set the environment variables in the OS environment,
+//     skipping variables restricted to other platforms
 //
 // Required properties for config mode:
 //   - ID: Unique identifier for the environment
@@ -177,6 +284,11 @@ func HandleStacksenvURLCLI(url string, args []string) error {
 //
 // Returns the context data (properties) or an error if URL parsing, validation, or data fetching fails.
 func HandleStacksENV(cnf *RequestConfig) ([]ContextData[any], error) {
+	return HandleStacksENVContext(context.Background(), cnf)
+}
+
+// HandleStacksENVContext is like HandleStacksENV but binds the fetch to ctx.
+func HandleStacksENVContext(ctx context.Context, cnf *RequestConfig) ([]ContextData[any], error) {
 	// Create default implementations
 	httpClient := NewHTTPClient()
 	crypto := NewCryptoService()
@@ -222,12 +334,12 @@ func HandleStacksENV(cnf *RequestConfig) ([]ContextData[any], error) {
 	}
 
 	// Fetch and decrypt context data
-	properties, err := clientService.GetContextDecryptedData(config)
+	properties, err := FetchWithContext(ctx, clientService, config)
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve environment context data: %w", err)
 	}
 	if cnf.SetOSEnv {
-		for _, contextData := range properties {
+		for _, contextData := range FilterCurrentPlatform(properties) {
 			os.Setenv(contextData.Property, contextData.Value.(string))
 		}
 	}
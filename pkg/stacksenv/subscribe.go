@@ -0,0 +1,295 @@
+package stacksenv
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Server-sent events of GET /cli/events:
+| event: change | id: <event ID> | data: <anything> |
+
+The server streams an event named "change" whenever the branch of the
+request changes, and "revoked", with the body of a revocation response as
+data, when the credentials are revoked. Other events and comments, e.g. keep
+alives, are ignored. The events don't carry variables: the client fetches
+the environment on every change, so it is decrypted like any other fetch.
+*/
+
+// eventsContentType is the content type of server-sent event streams.
+const eventsContentType = "text/event-stream"
+
+// Reconnection delays of subscriptions: the first one, unless the server
+// sets another with a "retry" field, doubles for every failed reconnection
+// up to the maximum.
+const (
+	defaultReconnectDelay = time.Second
+	maxReconnectDelay     = 30 * time.Second
+)
+
+// maxEventLineSize limits the size of a line of an event stream.
+const maxEventLineSize = 64 << 10
+
+// EnvironmentEvent is an event of a subscription: the environment of the
+// branch after a change, or the error of the subscription.
+type EnvironmentEvent struct {
+	// Variables are the variables of the branch; nil if Err is set
+	Variables []ContextData[any]
+	// Err is set if the changed environment couldn't be fetched or the
+	// server couldn't be reconnected to. The subscription goes on, unless
+	// it wraps ErrRevoked.
+	Err error
+}
+
+// serverEvent is an event of a server-sent event stream.
+type serverEvent struct {
+	ID    string
+	Name  string
+	Data  string
+	Retry time.Duration
+}
+
+// Subscribe streams the changes of the environment of config from the
+// server, so callers react to them without polling.
+//
+// It sends a GET request to {protocol}://{ServerURL}/cli/events with the ID
+// and branch as query parameters, and reads the server-sent events of the
+// response. The first event holds the environment at the time of the
+// subscription; every following one the environment after a change, fetched
+// and decrypted like by GetContextDecryptedDataContext. A dropped stream is
+// reconnected, with the ID of the last event in the Last-Event-ID header,
+// and the environment fetched again so no change is missed.
+//
+// The channel is closed when ctx is done, or once the credentials are
+// revoked or the server stops streaming events, after an event with the
+// error. The stream is read with the StreamClient of the service, as streams
+// outlast the timeout of ordinary requests.
+//
+// Returns a *RequestError if the server can't be subscribed to, e.g. an
+// *IncompatibleServerError for servers without the events feature, in
+// which case callers fall back to polling.
+func (s *DefaultClientService) Subscribe(ctx context.Context, config *Config) (<-chan EnvironmentEvent, error) {
+	requestID := NewRequestID()
+	stream, err := s.openEvents(ctx, config, requestID, "")
+	if err != nil {
+		return nil, &RequestError{RequestID: requestID, Err: err}
+	}
+
+	events := make(chan EnvironmentEvent)
+	go s.subscription(ctx, config, stream, events)
+	return events, nil
+}
+
+// subscription delivers the events of a subscription until ctx is done or
+// it ends, reconnecting the stream when it drops.
+func (s *DefaultClientService) subscription(ctx context.Context, config *Config, stream io.ReadCloser, events chan<- EnvironmentEvent) {
+	defer close(events)
+
+	emit := func(event EnvironmentEvent) bool {
+		select {
+		case events <- event:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	// refresh fetches the environment and emits it if it changed. It reports
+	// whether the subscription goes on.
+	lastHash := ""
+	refresh := func() bool {
+		variables, err := s.GetContextDecryptedDataContext(ctx, config)
+		if ctx.Err() != nil {
+			return false
+		}
+		if err != nil {
+			return emit(EnvironmentEvent{Err: err}) && !errors.Is(err, ErrRevoked)
+		}
+		if hash := Hash(variables); hash != lastHash {
+			lastHash = hash
+			return emit(EnvironmentEvent{Variables: variables})
+		}
+		return true
+	}
+
+	lastEventID := ""
+	delay := defaultReconnectDelay
+	for {
+		// The first refresh is the initial event, the others catch up with
+		// the changes made while the stream was down
+		if !refresh() {
+			stream.Close()
+			return
+		}
+
+		err := readEvents(stream, func(event serverEvent) bool {
+			if event.ID != "" {
+				lastEventID = event.ID
+			}
+			if event.Retry > 0 {
+				delay = event.Retry
+			}
+			switch event.Name {
+			case "change":
+				return refresh()
+			case "revoked":
+				err := revokedError(config, http.StatusUnauthorized, []byte(event.Data))
+				if err == nil {
+					err = classify(ErrAuthFailed, http.StatusUnauthorized, fmt.Errorf("%w: the server revoked the credentials for environment ID '%s'", ErrRevoked, config.ID))
+				}
+				emit(EnvironmentEvent{Err: err})
+				return false
+			}
+			return true
+		})
+		stream.Close()
+		if ctx.Err() != nil || errors.Is(err, errSubscriptionEnded) {
+			return
+		}
+		s.logger.Debugf("Lost the event stream of environment '%s' on branch '%s': %v", config.ID, config.Branch, err)
+
+		// Reconnect, doubling the wait after every failed attempt
+		wait := min(delay, maxReconnectDelay)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			wait = min(wait*2, maxReconnectDelay)
+			requestID := NewRequestID()
+			stream, err = s.openEvents(ctx, config, requestID, lastEventID)
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			err = &RequestError{RequestID: requestID, Err: err}
+			var incompatible *IncompatibleServerError
+			if !emit(EnvironmentEvent{Err: err}) || errors.Is(err, ErrRevoked) || errors.As(err, &incompatible) {
+				return
+			}
+		}
+	}
+}
+
+// errSubscriptionEnded is returned by readEvents when the handler ends the
+// subscription.
+var errSubscriptionEnded = errors.New("subscription ended")
+
+// openEvents sends the GET /cli/events request, resuming after the event
+// lastEventID if set, and returns the event stream.
+func (s *DefaultClientService) openEvents(ctx context.Context, config *Config, requestID, lastEventID string) (io.ReadCloser, error) {
+	u, err := url.Parse(serverBaseURL(config) + "/cli/events")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+	params := url.Values{}
+	params.Set("id", config.ID)
+	params.Set("branch", config.Branch)
+	if config.Token != "" && !config.NoPersonal {
+		params.Set("personal", "true")
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := newRequest(ctx, http.MethodGet, u.String(), nil, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", eventsContentType)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	if err := setAuthorization(req, config); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.streamClient.Do(req)
+	if err != nil {
+		return nil, unreachableError(config, err)
+	}
+	if resp.StatusCode == http.StatusOK && strings.HasPrefix(resp.Header.Get("Content-Type"), eventsContentType) {
+		return resp.Body, nil
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err := revokedError(config, resp.StatusCode, body); err != nil {
+		return nil, err
+	}
+	err = fmt.Errorf("server returned HTTP status %d (%s) with content type %q for the events of environment ID '%s' on branch '%s'",
+		resp.StatusCode, http.StatusText(resp.StatusCode), resp.Header.Get("Content-Type"), config.ID, config.Branch)
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusOK {
+		return nil, unsupportedFeatureError(ctx, config, s.httpClient, requestID, FeatureEvents, err)
+	}
+	return nil, classify(authStatusClass(resp.StatusCode), resp.StatusCode, err)
+}
+
+// readEvents reads the server-sent events of stream and passes them to
+// handle until it returns false, which ends the subscription, or the stream
+// ends. It returns errSubscriptionEnded, or the error ending the stream.
+func readEvents(stream io.Reader, handle func(serverEvent) bool) error {
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 4096), maxEventLineSize)
+
+	var event serverEvent
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// A blank line dispatches the event
+			if event.Name != "" || len(data) > 0 {
+				if event.Name == "" {
+					event.Name = "message"
+				}
+				event.Data = strings.Join(data, "\n")
+				if !handle(event) {
+					return errSubscriptionEnded
+				}
+			}
+			event, data = serverEvent{ID: event.ID}, nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// Comment, e.g. a keep alive
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event.Name = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			event.ID = value
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms > 0 {
+				event.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// SubscribeWithContext subscribes to the changes of the environment of config
+// if service implements SubscribingClientService, see
+// DefaultClientService.Subscribe. It returns an error for other services, so
+// callers fall back to polling.
+func SubscribeWithContext(ctx context.Context, service ClientService, config *Config) (<-chan EnvironmentEvent, error) {
+	if subscriber, ok := service.(SubscribingClientService); ok {
+		return subscriber.Subscribe(ctx, config)
+	}
+	return nil, errors.New("the client service does not support subscriptions")
+}
@@ -0,0 +1,193 @@
+package stacksenv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// testSecret and testSecretKey are the credentials of the environments
+// served by newTestServer.
+const (
+	testSecret    = "secret"
+	testSecretKey = "key"
+)
+
+// testServer serves the environment of a branch on GET /cli and its changes
+// on GET /cli/events.
+type testServer struct {
+	*httptest.Server
+	value  atomic.Value // value of the variable X
+	events http.HandlerFunc
+}
+
+// newTestServer starts a server for the tests; its GET /cli/events handler
+// is events, or a stream of keep alives if nil.
+func newTestServer(t *testing.T, events http.HandlerFunc) *testServer {
+	t.Helper()
+	s := &testServer{events: events}
+	s.value.Store("1")
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /cli", func(w http.ResponseWriter, r *http.Request) {
+		payload, err := Encrypt([]ContextData[any]{{Property: "X", Value: s.value.Load().(string)}}, testSecretKey, testSecret+"|"+testSecretKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, `{"data": %q}`, payload)
+	})
+	mux.HandleFunc("GET /cli/events", func(w http.ResponseWriter, r *http.Request) {
+		if s.events != nil {
+			s.events(w, r)
+			return
+		}
+		streamEvents(w, r, nil)
+	})
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// config returns the configuration of the environment served by s.
+func (s *testServer) config() *Config {
+	return &Config{
+		ID:           "env",
+		Secret:       testSecret,
+		SecretKey:    testSecretKey,
+		ServerURL:    strings.TrimPrefix(s.URL, "http://"),
+		Branch:       "main",
+		DisableHTTPS: true,
+	}
+}
+
+// streamEvents writes a keep alive every 10ms, and the events sent on
+// events, until the request is done.
+func streamEvents(w http.ResponseWriter, r *http.Request, events <-chan string) {
+	w.Header().Set("Content-Type", eventsContentType)
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			fmt.Fprint(w, event)
+		case <-time.After(10 * time.Millisecond):
+			fmt.Fprint(w, ": keepalive\n\n")
+		}
+		w.(http.Flusher).Flush()
+	}
+}
+
+// newTestClientService returns a client service without keep-alive
+// connections, so no connection goroutine outlives a test.
+func newTestClientService() *DefaultClientService {
+	httpClient := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	return NewClientService(httpClient, NewCryptoService()).(*DefaultClientService)
+}
+
+// receive returns the next event of events, failing the test if none comes
+// within a second.
+func receive(t *testing.T, events <-chan EnvironmentEvent) (EnvironmentEvent, bool) {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		return event, ok
+	case <-time.After(time.Second):
+		t.Fatal("no event within a second")
+		return EnvironmentEvent{}, false
+	}
+}
+
+func TestGetContextDecryptedDataContextAbortsOnCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// The server hangs until the request is done
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	config := &Config{ID: "env", Secret: testSecret, SecretKey: testSecretKey, ServerURL: strings.TrimPrefix(server.URL, "http://"), Branch: "main", DisableHTTPS: true}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := newTestClientService().GetContextDecryptedDataContext(ctx, config)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("the fetch returned %s after the cancellation", elapsed)
+	}
+}
+
+func TestSubscribeClosesOnCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	changes := make(chan string)
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		streamEvents(w, r, changes)
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := newTestClientService().Subscribe(ctx, server.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, _ := receive(t, events)
+	if event.Err != nil || len(event.Variables) != 1 || event.Variables[0].Value != "1" {
+		t.Fatalf("got initial event %+v, want X=1", event)
+	}
+	server.value.Store("2")
+	changes <- "event: change\nid: 1\ndata: {}\n\n"
+	event, _ = receive(t, events)
+	if event.Err != nil || len(event.Variables) != 1 || event.Variables[0].Value != "2" {
+		t.Fatalf("got change event %+v, want X=2", event)
+	}
+
+	cancel()
+	if _, ok := receive(t, events); ok {
+		t.Fatal("the subscription went on after the cancellation")
+	}
+}
+
+func TestSubscribeClosesOnCancelWhileReconnecting(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// The stream ends at once: the subscription waits to reconnect
+	var connections atomic.Int32
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		connections.Add(1)
+		w.Header().Set("Content-Type", eventsContentType)
+		w.WriteHeader(http.StatusOK)
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := newTestClientService().Subscribe(ctx, server.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event, _ := receive(t, events); event.Err != nil {
+		t.Fatalf("got initial event error %v", event.Err)
+	}
+
+	cancel()
+	if _, ok := receive(t, events); ok {
+		t.Fatal("the subscription went on after the cancellation")
+	}
+	if n := connections.Load(); n != 1 {
+		t.Fatalf("the subscription connected %d times, want 1", n)
+	}
+}
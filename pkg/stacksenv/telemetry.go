@@ -0,0 +1,150 @@
+package stacksenv
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// InstrumentationName is the name of the OpenTelemetry tracer and meter of
+// the package.
+const InstrumentationName = "github.com/stacksenv/cli/pkg/stacksenv"
+
+// Attributes of the spans and metrics of the package, besides the
+// server.address and error.type of the semantic conventions.
+const (
+	attributeEnvironment = "stacksenv.environment.id"
+	attributeBranch      = "stacksenv.branch"
+	attributeRequestID   = "stacksenv.request_id"
+	attributeVariables   = "stacksenv.variables"
+	attributeBatchSize   = "stacksenv.batch.size"
+)
+
+// telemetry holds the OpenTelemetry instruments of a client service. Without
+// providers, they are no-ops.
+type telemetry struct {
+	tracer          trace.Tracer
+	fetchDuration   metric.Float64Histogram
+	decryptDuration metric.Float64Histogram
+	fetchErrors     metric.Int64Counter
+}
+
+// newTelemetry creates the instruments of a client service with the given
+// providers, no-op ones if nil. Instruments that can't be created are
+// reported to the OpenTelemetry error handler and left out.
+func newTelemetry(tracerProvider trace.TracerProvider, meterProvider metric.MeterProvider) *telemetry {
+	if tracerProvider == nil {
+		tracerProvider = tracenoop.NewTracerProvider()
+	}
+	if meterProvider == nil {
+		meterProvider = metricnoop.NewMeterProvider()
+	}
+	meter := meterProvider.Meter(InstrumentationName)
+	noop := metricnoop.NewMeterProvider().Meter(InstrumentationName)
+
+	t := &telemetry{tracer: tracerProvider.Tracer(InstrumentationName)}
+	var err error
+	if t.fetchDuration, err = meter.Float64Histogram("stacksenv.client.fetch.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of the fetches of environments, decryption included")); err != nil {
+		otel.Handle(err)
+		t.fetchDuration, _ = noop.Float64Histogram("stacksenv.client.fetch.duration")
+	}
+	if t.decryptDuration, err = meter.Float64Histogram("stacksenv.client.decrypt.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of the decryption of the pages of environments")); err != nil {
+		otel.Handle(err)
+		t.decryptDuration, _ = noop.Float64Histogram("stacksenv.client.decrypt.duration")
+	}
+	if t.fetchErrors, err = meter.Int64Counter("stacksenv.client.fetch.errors",
+		metric.WithUnit("{error}"),
+		metric.WithDescription("Failed fetches of environments, by error.type")); err != nil {
+		otel.Handle(err)
+		t.fetchErrors, _ = noop.Int64Counter("stacksenv.client.fetch.errors")
+	}
+	return t
+}
+
+// startFetch starts the span of the fetch of the environment of config.
+func (t *telemetry) startFetch(ctx context.Context, config *Config, requestID string) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, "stacksenv.fetch",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(configAttributes(config),
+			attribute.String(attributeBranch, config.Branch),
+			attribute.String(attributeRequestID, requestID))...))
+}
+
+// endFetch records the outcome of the fetch of the environment of config
+// started at start, and ends its span if any.
+func (t *telemetry) endFetch(ctx context.Context, span trace.Span, config *Config, start time.Time, variables int, err error) {
+	attributes := configAttributes(config)
+	if err != nil {
+		attributes = append(attributes, attribute.String("error.type", errorType(err)))
+		t.fetchErrors.Add(ctx, 1, metric.WithAttributes(attributes...))
+	}
+	t.fetchDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attributes...))
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(attribute.String("error.type", errorType(err)))
+	} else {
+		span.SetAttributes(attribute.Int(attributeVariables, variables))
+	}
+	span.End()
+}
+
+// recordDecrypt records the decryption of a page of the environment of
+// config started at start.
+func (t *telemetry) recordDecrypt(ctx context.Context, config *Config, start time.Time) {
+	t.decryptDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(configAttributes(config)...))
+}
+
+// configAttributes returns the attributes identifying the environment of
+// config in spans and metrics.
+func configAttributes(config *Config) []attribute.KeyValue {
+	host := config.ServerURL
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return []attribute.KeyValue{
+		attribute.String("server.address", host),
+		attribute.String(attributeEnvironment, config.ID),
+	}
+}
+
+// errorType returns the error.type of a failed fetch: its failure class, or
+// "_OTHER".
+func errorType(err error) string {
+	var incompatible *IncompatibleServerError
+	switch {
+	case errors.Is(err, ErrRevoked):
+		return "revoked"
+	case errors.Is(err, ErrAuthFailed):
+		return "auth_failed"
+	case errors.Is(err, ErrEnvironmentNotFound):
+		return "environment_not_found"
+	case errors.Is(err, ErrDecryptFailed):
+		return "decrypt_failed"
+	case errors.Is(err, ErrServerUnreachable):
+		return "server_unreachable"
+	case errors.As(err, &incompatible):
+		return "incompatible_server"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return "_OTHER"
+}
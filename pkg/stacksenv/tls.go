@@ -0,0 +1,71 @@
+package stacksenv
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLSOptions configures the TLS connections to servers using an internal
+// certificate authority or requiring client certificates (mutual TLS).
+type TLSOptions struct {
+	// CACert is the path of a PEM bundle of certificate authorities trusted
+	// in addition to the system roots.
+	CACert string
+	// ClientCert and ClientKey are the paths of the PEM certificate and
+	// private key presented to servers requiring mutual TLS. ClientKey may be
+	// empty if ClientCert holds the key as well.
+	ClientCert string
+	ClientKey  string
+	// InsecureSkipVerify disables the verification of the certificate of the
+	// server. It makes connections vulnerable to interception and should
+	// only be used for testing.
+	InsecureSkipVerify bool
+}
+
+// LoadTLSConfig returns the TLS configuration of options, to be set as
+// HTTPOptions.TLS. It returns nil if options are empty, for the default
+// configuration.
+func LoadTLSConfig(options TLSOptions) (*tls.Config, error) {
+	if options == (TLSOptions{}) {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: options.InsecureSkipVerify, //nolint:gosec // explicitly requested
+	}
+
+	if options.CACert != "" {
+		bundle, err := os.ReadFile(options.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no PEM certificate found in %s", options.CACert)
+		}
+		config.RootCAs = pool
+	}
+
+	if options.ClientCert != "" || options.ClientKey != "" {
+		if options.ClientCert == "" {
+			return nil, errors.New("a client key requires a client certificate")
+		}
+		keyFile := options.ClientKey
+		if keyFile == "" {
+			keyFile = options.ClientCert
+		}
+		cert, err := tls.LoadX509KeyPair(options.ClientCert, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,32 @@
+package stacksenv
+
+// IsDeleted reports whether the variable is the tombstone of a soft-deleted
+// variable. The server keeps tombstones until their PurgeAt time so the
+// variable can be restored.
+func (c ContextData[T]) IsDeleted() bool {
+	return c.DeletedAt != ""
+}
+
+// FilterDeleted returns the variables that are not tombstones, preserving
+// their order.
+func FilterDeleted[T any](properties []ContextData[T]) []ContextData[T] {
+	filtered := make([]ContextData[T], 0, len(properties))
+	for _, contextData := range properties {
+		if !contextData.IsDeleted() {
+			filtered = append(filtered, contextData)
+		}
+	}
+	return filtered
+}
+
+// Tombstones returns the tombstones of soft-deleted variables, preserving
+// their order. Only fetches with Config.IncludeDeleted return tombstones.
+func Tombstones[T any](properties []ContextData[T]) []ContextData[T] {
+	tombstones := make([]ContextData[T], 0)
+	for _, contextData := range properties {
+		if contextData.IsDeleted() {
+			tombstones = append(tombstones, contextData)
+		}
+	}
+	return tombstones
+}
@@ -9,13 +9,29 @@ type Config struct {
 	ServerURL    string `json:"serverurl"`     // Server hostname or IP address
 	Branch       string `json:"branch"`        // Branch name (e.g., "dev", "prod")
 	DisableHTTPS bool   `json:"disable_https"` // Whether to use HTTP instead of HTTPS
+	Token        string `json:"token"`         // Optional access token sent as a bearer token
+	NoPersonal   bool   `json:"no_personal"`   // Whether to skip the personal overlay of the authenticated user
+	SignRequests bool   `json:"sign_requests"` // Whether to sign requests with Secret, see VerifyRequestSignature
+
+	IncludeDeleted bool `json:"include_deleted"` // Whether to also fetch the tombstones of soft-deleted variables
+	PageSize       int  `json:"page_size"`       // Number of variables per page asked of the server, 0 to let it decide
+
+	KeyID      string            `json:"key_id"`      // ID of SecretKey in payload headers, empty if unknown
+	SecretKeys map[string]string `json:"secret_keys"` // Other secret keys by ID, e.g. the next or previous one during a rotation
 }
 
 // ContextData represents a key-value pair for environment context data.
 // It uses generics to support different value types.
+//
+// OS and Arch optionally restrict the variable to some platforms; see MatchesPlatform.
+// DeletedAt is only set on the tombstones of soft-deleted variables; see IsDeleted.
 type ContextData[T any] struct {
-	Property string `json:"property"` // The property name (environment variable name)
-	Value    T      `json:"value"`    // The property value
+	Property  string   `json:"property"`             // The property name (environment variable name)
+	Value     T        `json:"value"`                // The property value
+	OS        []string `json:"os,omitempty"`         // Operating systems (GOOS values) the variable applies to, all if empty
+	Arch      []string `json:"arch,omitempty"`       // Architectures (GOARCH values) the variable applies to, all if empty
+	DeletedAt string   `json:"deleted_at,omitempty"` // RFC 3339 time the variable was soft-deleted
+	PurgeAt   string   `json:"purge_at,omitempty"`   // RFC 3339 time the server purges the tombstone
 }
 
 // ServerResponse represents the response structure from the stacksenv server.
@@ -24,6 +40,20 @@ type ServerResponse struct {
 	EncryptedData string `json:"data"`  // Encrypted data payload
 }
 
+// LoginResponse represents the response of the server's login endpoint.
+type LoginResponse struct {
+	Error string `json:"error"` // Error message if login failed
+	Token string `json:"token"` // Access token issued for the credentials
+}
+
+// Identity represents the response of the server's whoami endpoint.
+type Identity struct {
+	Error    string   `json:"error"`    // Error message if the request failed
+	Subject  string   `json:"identity"` // Authenticated user or service account
+	ID       string   `json:"id"`       // Environment ID the credentials belong to
+	Branches []string `json:"branches"` // Branches the credentials grant access to
+}
+
 // RequestConfig represents the configuration for a stacksenv request.
 // It can contain either a URL to parse or a pre-configured Config struct.
 type RequestConfig struct {
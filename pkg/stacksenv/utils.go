@@ -2,6 +2,10 @@ package stacksenv
 
 import (
 	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -17,26 +21,60 @@ func NewURLParser() URLParser {
 //
 // URL format: stacksenv://ID:SECRET:SECRET_KEY@SERVER_URL/BRANCH?disable_https=true
 //
-// Example: stacksenv://abc123:secret:key@example.com/dev?disable_https=false
+// The "stacksenv://" prefix is optional. SERVER_URL is a host name, an IPv4 address or an IPv6 address in brackets,
+// with an optional port and path prefix, e.g. "[::1]:9443" or
+// "example.com/stacks" for a server behind a reverse proxy. The branch is the
+// last segment of the path; a branch containing '/' is escaped as "%2F". The
+// credentials are percent-decoded, so ':', '@', '/' and '%' in them are
+// escaped as "%3A", "%40", "%2F" and "%25", as FormatURL does.
 //
-// Returns an error if the URL format is invalid.
+// Supported query parameters:
+//   - disable_https: use HTTP instead of HTTPS ("true" or "false")
+//   - token: URL-encoded access token obtained from the login endpoint
+//   - personal: "false" to skip the personal overlay of the authenticated user
+//   - page_size: number of variables per page asked of the server
+//   - sign: "true" to sign the requests with SECRET
+//   - key_id: ID of SECRET_KEY in payload headers
+//   - key.<ID>: URL-encoded other secret key with that ID, e.g. the next or
+//     previous one during a key rotation
+//
+// Examples:
+//
+//	stacksenv://abc123:secret:key@example.com/dev?disable_https=false
+//	stacksenv://abc123:secret:key@[2001:db8::1]:9443/stacks/dev
+//
+// Returns an error of class ErrInvalidURL if the URL format is invalid.
 func (p *DefaultURLParser) ParseURL(urlStr string) (Config, error) {
+	config, err := parseURL(urlStr)
+	return config, classify(ErrInvalidURL, 0, err)
+}
+
+// parseURL parses a stacksenv URL string, with or without the "stacksenv://"
+// prefix.
+func parseURL(urlStr string) (Config, error) {
 	config := Config{}
+	urlStr = strings.TrimPrefix(urlStr, "stacksenv://")
 
-	// Split URL into credentials and server parts
-	parts := strings.Split(urlStr, "@")
-	if len(parts) != 2 {
+	// Split URL into credentials and server parts. The credentials may hold
+	// any character once escaped, so they are split off before the rest is
+	// parsed as a URL.
+	credentials, location, ok := strings.Cut(urlStr, "@")
+	if !ok {
 		return config, fmt.Errorf("invalid stacksenv URL format: missing '@' separator. Expected format: 'stacksenv://ID:SECRET:SECRET_KEY@SERVER_URL/BRANCH', but got: %s", urlStr)
 	}
 
 	// Parse credentials: ID:SECRET:SECRET_KEY
-	credParts := strings.Split(parts[0], ":")
+	credParts := strings.Split(credentials, ":")
 	if len(credParts) != 3 {
-		return config, fmt.Errorf("invalid credentials format in URL: expected 'ID:SECRET:SECRET_KEY' (three colon-separated values), but got: %s. Please verify your credentials are correctly formatted", parts[0])
+		return config, fmt.Errorf("invalid credentials format in URL: expected 'ID:SECRET:SECRET_KEY' (three colon-separated values), but got: %s. Please verify your credentials are correctly formatted", credentials)
+	}
+	for i, credential := range []*string{&config.ID, &config.Secret, &config.SecretKey} {
+		value, err := url.PathUnescape(credParts[i])
+		if err != nil {
+			return config, fmt.Errorf("invalid percent-encoding in URL credentials: escape '%%' as %%25. Expected format: 'ID:SECRET:SECRET_KEY'")
+		}
+		*credential = value
 	}
-	config.ID = credParts[0]
-	config.Secret = credParts[1]
-	config.SecretKey = credParts[2]
 
 	// Validate that credentials are not empty
 	if config.ID == "" {
@@ -49,47 +87,147 @@ func (p *DefaultURLParser) ParseURL(urlStr string) (Config, error) {
 		return config, fmt.Errorf("secret key (second key) is missing in URL credentials. Expected format: 'ID:SECRET:SECRET_KEY'")
 	}
 
-	// Parse server and branch: SERVER_URL/BRANCH
-	serverParts := strings.Split(parts[1], "/")
-	if len(serverParts) != 2 {
-		return config, fmt.Errorf("invalid server URL format: expected 'SERVER_URL/BRANCH' (server and branch separated by '/'), but got: %s", parts[1])
+	// Parse server and branch: HOST[:PORT][/PREFIX]/BRANCH
+	u, err := url.Parse("stacksenv://" + location)
+	if err != nil {
+		return config, fmt.Errorf("invalid server URL format: %w. Expected format: 'SERVER_URL/BRANCH'", err)
 	}
-	config.ServerURL = serverParts[0]
-
-	// Validate server URL is not empty
-	if config.ServerURL == "" {
+	if u.User != nil {
+		return config, fmt.Errorf("invalid stacksenv URL format: more than one '@' separator in: %s", urlStr)
+	}
+	if u.Hostname() == "" {
 		return config, fmt.Errorf("server URL is missing. Expected format: 'SERVER_URL/BRANCH'")
 	}
-
-	// Parse branch and query parameters: BRANCH?disable_https=true
-	branchAndOptions := strings.Split(serverParts[1], "?")
-	if len(branchAndOptions) == 0 {
-		return config, fmt.Errorf("invalid branch format: branch name is missing. Expected format: 'SERVER_URL/BRANCH' or 'SERVER_URL/BRANCH?disable_https=true'")
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return config, fmt.Errorf("invalid server port %q: expected a number between 1 and 65535", port)
+		}
+	}
+	if u.Fragment != "" {
+		return config, fmt.Errorf("invalid stacksenv URL format: unexpected fragment '#%s'", u.Fragment)
 	}
-	config.Branch = branchAndOptions[0]
 
-	// Validate branch is not empty
-	if config.Branch == "" {
+	// The branch is the last segment of the path, what precedes it is the
+	// path prefix of the server
+	path, ok := strings.CutPrefix(u.EscapedPath(), "/")
+	if !ok {
+		return config, fmt.Errorf("invalid server URL format: expected 'SERVER_URL/BRANCH' (server and branch separated by '/'), but got: %s", location)
+	}
+	prefix, rawBranch := "", path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		prefix, rawBranch = path[:i], path[i+1:]
+	}
+	if rawBranch == "" {
 		return config, fmt.Errorf("branch name is missing. Expected format: 'SERVER_URL/BRANCH'")
 	}
+	if config.Branch, err = url.PathUnescape(rawBranch); err != nil {
+		return config, fmt.Errorf("invalid branch %q: %w", rawBranch, err)
+	}
+	config.ServerURL = u.Host
+	if prefix != "" {
+		config.ServerURL += "/" + prefix
+	}
 
-	// Parse query parameters
-	if len(branchAndOptions) > 1 {
-		options := strings.Split(branchAndOptions[1], "&")
-		for _, option := range options {
-			optionParts := strings.Split(option, "=")
-			if len(optionParts) != 2 {
+	// Parse query parameters; a parameter given twice takes its last value
+	if u.RawQuery != "" {
+		for _, option := range strings.Split(u.RawQuery, "&") {
+			if !strings.Contains(option, "=") {
 				return config, fmt.Errorf("invalid query parameter format: '%s'. Expected format: 'KEY=VALUE' (e.g., 'disable_https=true')", option)
 			}
-			if optionParts[0] == "disable_https" {
-				config.DisableHTTPS = optionParts[1] == "true"
+		}
+	}
+	options, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return config, fmt.Errorf("invalid query parameters: %w", err)
+	}
+	for name, values := range options {
+		value := values[len(values)-1]
+		switch name {
+		case "disable_https":
+			config.DisableHTTPS = value == "true"
+		case "personal":
+			config.NoPersonal = value == "false"
+		case "sign":
+			config.SignRequests = value == "true"
+		case "page_size":
+			pageSize, err := strconv.Atoi(value)
+			if err != nil || pageSize <= 0 {
+				return config, fmt.Errorf("invalid page_size query parameter %q: expected a positive number of variables", value)
 			}
+			config.PageSize = pageSize
+		case "token":
+			config.Token = value
+		case "key_id":
+			if !ValidKeyID(value) {
+				return config, fmt.Errorf("invalid key_id query parameter %q: expected letters, digits, '-' and '_'", value)
+			}
+			config.KeyID = value
+		default:
+			keyID, ok := strings.CutPrefix(name, "key.")
+			if !ok {
+				continue
+			}
+			if !ValidKeyID(keyID) {
+				return config, fmt.Errorf("invalid secret key ID %q: expected letters, digits, '-' and '_'", keyID)
+			}
+			if value == "" {
+				return config, fmt.Errorf("invalid secret key %q query parameter", name)
+			}
+			if config.SecretKeys == nil {
+				config.SecretKeys = make(map[string]string)
+			}
+			config.SecretKeys[keyID] = value
 		}
 	}
 
 	return config, nil
 }
 
+// FormatURL returns the stacksenv URL of config, the inverse of ParseURL: the
+// credentials and the branch are percent-encoded, so they may hold any
+// character, and the options differing from their defaults are added as query
+// parameters.
+func FormatURL(config Config) string {
+	var b strings.Builder
+	b.WriteString("stacksenv://")
+	b.WriteString(EscapeCredential(config.ID) + ":" + EscapeCredential(config.Secret) + ":" + EscapeCredential(config.SecretKey))
+	b.WriteString("@" + config.ServerURL + "/" + url.PathEscape(config.Branch))
+
+	// Built by hand rather than with url.Values, which sorts the parameters
+	var query []string
+	if config.DisableHTTPS {
+		query = append(query, "disable_https=true")
+	}
+	if config.NoPersonal {
+		query = append(query, "personal=false")
+	}
+	if config.SignRequests {
+		query = append(query, "sign=true")
+	}
+	if config.PageSize > 0 {
+		query = append(query, "page_size="+strconv.Itoa(config.PageSize))
+	}
+	if config.KeyID != "" {
+		query = append(query, "key_id="+config.KeyID)
+	}
+	for _, id := range slices.Sorted(maps.Keys(config.SecretKeys)) {
+		query = append(query, "key."+id+"="+url.QueryEscape(config.SecretKeys[id]))
+	}
+	if config.Token != "" {
+		query = append(query, "token="+url.QueryEscape(config.Token))
+	}
+	if len(query) > 0 {
+		b.WriteString("?" + strings.Join(query, "&"))
+	}
+	return b.String()
+}
+
+// EscapeCredential percent-encodes an ID, secret or secret key for the
+// credentials of a stacksenv URL, escaping ':', '@', '/' and '%' among others.
+func EscapeCredential(credential string) string {
+	return strings.NewReplacer(":", "%3A", "@", "%40").Replace(url.PathEscape(credential))
+}
+
 // ParseURL is a convenience function that uses the default parser.
 // It's maintained for backward compatibility.
 func ParseURL(urlStr string) (Config, error) {
@@ -0,0 +1,223 @@
+package stacksenv
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultWatchInterval is the default interval between environment polls in watch mode.
+const DefaultWatchInterval = 30 * time.Second
+
+// stopGracePeriod is how long a supervised command is given to exit after
+// being interrupted before it is killed.
+const stopGracePeriod = 10 * time.Second
+
+// WatchStacksenvURLCLI runs the provided command with the environment fetched
+// from the stacksenv URL, then follows the changes of the environment and
+// restarts the command whenever it changes.
+//
+// The supervision loop:
+//  1. Fetches the environment and starts the command with it
+//  2. Subscribes to the changes of the environment if the client service
+//     supports it (SubscribingClientService), or polls the server every
+//     interval otherwise, and fingerprints the returned variables
+//  3. On change, interrupts the command (killing it after a grace period) and
+//     starts it again with the fresh variables
+//  4. If the command exits on its own, waits for the next change to restart it
+//
+// Servers without subscriptions, and subscriptions that end, are polled every
+// interval instead. Failed polls and subscription errors are reported and the
+// running command is left untouched. If the server reports revoked credentials
+// (ErrRevoked), the command is stopped and the error returned. Only the fetched
+// variables are compared; ExtraEnv is applied on every start. The loop stops,
+// and the command is stopped, when ctx is done.
+func (h *Handler) WatchStacksenvURLCLI(ctx context.Context, url string, args []string, interval time.Duration) error {
+	if len(args) == 0 {
+		return errors.New("watch mode requires a command to run")
+	}
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	starter, ok := h.commandExecutor.(ProcessStarter)
+	if !ok {
+		return errors.New("the configured command executor does not support watch mode")
+	}
+
+	config, err := h.urlParser.ParseURL(strings.TrimPrefix(url, "stacksenv://"))
+	if err != nil {
+		return fmt.Errorf("unable to parse stacksenv URL: %w. Please verify the URL format is correct: stacksenv://ID:SECRET:SECRET_KEY@SERVER_URL/BRANCH", err)
+	}
+
+	properties, err := FetchWithContext(ctx, h.clientService, &config)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve environment context data: %w", err)
+	}
+	env := propertiesToEnv(properties)
+	fingerprint := envFingerprint(env)
+
+	proc, err := h.startSupervised(starter, config.Branch, args, append(env, h.ExtraEnv...))
+	if err != nil {
+		return err
+	}
+	defer func() { proc.stop() }()
+
+	// The subscription ends with the loop
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var ticks <-chan time.Time
+	startPolling := func() {
+		ticker := time.NewTicker(interval)
+		context.AfterFunc(ctx, func() { ticker.Stop() })
+		ticks = ticker.C
+	}
+	events, err := SubscribeWithContext(ctx, h.clientService, &config)
+	if err != nil {
+		h.logger.Debugf("Polling for environment changes every %s: %v", interval, err)
+		startPolling()
+	}
+
+	// update restarts the command if the fetched environment changed
+	exited := proc.exited
+	update := func(properties []ContextData[any], err error) error {
+		if errors.Is(err, ErrRevoked) {
+			// Revocation is a kill switch: don't keep serving the old environment
+			h.logger.Warnf("credentials revoked - stopping command")
+			return err
+		}
+		if err != nil {
+			h.logger.Warnf("failed to check for environment changes: %v", err)
+			return nil
+		}
+
+		newEnv := propertiesToEnv(properties)
+		newFingerprint := envFingerprint(newEnv)
+		if newFingerprint == fingerprint {
+			return nil
+		}
+
+		h.logger.Infof("environment changed - restarting command")
+		proc.stop()
+
+		proc, err = h.startSupervised(starter, config.Branch, args, append(newEnv, h.ExtraEnv...))
+		if err != nil {
+			return err
+		}
+		exited = proc.exited
+		fingerprint = newFingerprint
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-exited:
+			if proc.err != nil {
+				h.logger.Warnf("command exited: %v - waiting for environment changes", proc.err)
+			} else {
+				h.logger.Infof("command exited - waiting for environment changes")
+			}
+			// Don't report the same exit twice
+			exited = nil
+
+		case event, ok := <-events:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil
+				}
+				h.logger.Warnf("subscription to environment changes ended - polling every %s", interval)
+				events = nil
+				startPolling()
+				continue
+			}
+			if err := update(event.Variables, event.Err); err != nil {
+				return err
+			}
+
+		case <-ticks:
+			properties, err := FetchWithContext(ctx, h.clientService, &config)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err := update(properties, err); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// supervisedProcess is a command started by the watch loop or ExecuteContext.
+type supervisedProcess struct {
+	cmd    *exec.Cmd
+	exited chan struct{} // closed once the command has exited
+	err    error         // exit error, valid once exited is closed
+}
+
+// startSupervised calls OnStart, starts the command and waits for it in the
+// background.
+func (h *Handler) startSupervised(starter ProcessStarter, branch string, args []string, env []string) (*supervisedProcess, error) {
+	if h.OnStart != nil {
+		h.OnStart(branch, env)
+	}
+	cmd, err := starter.Start(args[0], args[1:], env)
+	if err != nil {
+		return nil, err
+	}
+	return supervise(cmd), nil
+}
+
+// supervise waits for a started command in the background.
+func supervise(cmd *exec.Cmd) *supervisedProcess {
+	p := &supervisedProcess{cmd: cmd, exited: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.exited)
+	}()
+	return p
+}
+
+// stop interrupts the command and kills it if it doesn't exit within the grace period.
+func (p *supervisedProcess) stop() {
+	select {
+	case <-p.exited:
+		return
+	default:
+	}
+
+	// Interrupt is not implemented on Windows, kill right away there
+	if runtime.GOOS == "windows" || p.cmd.Process.Signal(os.Interrupt) != nil {
+		_ = p.cmd.Process.Kill()
+	}
+
+	select {
+	case <-p.exited:
+	case <-time.After(stopGracePeriod):
+		_ = p.cmd.Process.Kill()
+		<-p.exited
+	}
+}
+
+// envFingerprint returns a stable fingerprint of the given environment entries.
+func envFingerprint(env []string) string {
+	sorted := slices.Clone(env)
+	slices.Sort(sorted)
+
+	hash := sha256.New()
+	for _, entry := range sorted {
+		hash.Write([]byte(entry))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,76 @@
+//go:build unix
+
+package stacksenv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// watchUntilCancel runs a command in watch mode against server, cancels the
+// watch once the command started, and checks that the watch returns and
+// stops the command.
+func watchUntilCancel(t *testing.T, server *testServer, interval time.Duration) {
+	t.Helper()
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	handler := NewHandlerWithLogger(NewURLParser(), newTestClientService(), NewCommandExecutor(), DiscardLogger)
+	url := FormatURL(*server.config())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- handler.WatchStacksenvURLCLI(ctx, url, []string{"sh", "-c", `echo $$ > "$0"; exec sleep 30`, pidFile}, interval)
+	}()
+
+	var pid int
+	for deadline := time.Now().Add(5 * time.Second); pid == 0; {
+		if data, err := os.ReadFile(pidFile); err == nil && strings.HasSuffix(string(data), "\n") {
+			pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the command didn't start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("the watch returned %v after the cancellation, want nil", err)
+		}
+	case <-time.After(stopGracePeriod / 2):
+		t.Fatal("the watch didn't return after the cancellation")
+	}
+	if err := syscall.Kill(pid, 0); !errors.Is(err, syscall.ESRCH) {
+		t.Fatalf("the command is still running after the watch returned: %v", err)
+	}
+}
+
+func TestWatchStacksenvURLCLIStopsOnCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	server := newTestServer(t, nil)
+	defer server.Close()
+	watchUntilCancel(t, server, time.Hour)
+}
+
+func TestWatchStacksenvURLCLIStopsOnCancelWhilePolling(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// Without subscriptions, the watch polls the server
+	server := newTestServer(t, http.NotFound)
+	defer server.Close()
+	watchUntilCancel(t, server, 10*time.Millisecond)
+}
@@ -0,0 +1,216 @@
+package stacksenv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// ErrWriteUnsupported is returned by PutWithContext and DeleteWithContext for
+// client services that can't write environments.
+var ErrWriteUnsupported = errors.New("the client service can't write environments")
+
+// ErrConflict is returned by PutIfMatchWithContext when the branch was changed
+// since the version it was fetched at.
+var ErrConflict = errors.New("the branch was changed concurrently")
+
+// PutContextEncryptedData encrypts data and replaces the variables of the
+// branch of config with it.
+//
+// The variables are encrypted with the CryptoService of the service like the
+// server encrypts them, with SecretKey as the shared secret and
+// "Secret|SecretKey" as the AAD, so the SecretKey never leaves the machine.
+// They are sent in a PUT request to {protocol}://{ServerURL}/cli with the ID
+// and branch as query parameters, the access token, if any, as a bearer token
+// and the payload in the envelope of the stacksenv server,
+// {"data": "<encrypted>"}, whatever the codec of the service.
+//
+// The branch is replaced as a whole: to change some variables, fetch the
+// branch with Config.IncludeDeleted and Config.NoPersonal set, so tombstones
+// are kept and personal overlays aren't written to the shared branch, and put
+// the updated variables back. Returns a *RequestError if the request fails.
+func (s *DefaultClientService) PutContextEncryptedData(config *Config, data []ContextData[any]) error {
+	return s.PutContextEncryptedDataContext(context.Background(), config, data)
+}
+
+// PutContextEncryptedDataContext is like PutContextEncryptedData but binds the
+// request to ctx.
+func (s *DefaultClientService) PutContextEncryptedDataContext(ctx context.Context, config *Config, data []ContextData[any]) error {
+	requestID := NewRequestID()
+
+	if err := s.putContextEncryptedData(ctx, config, data, "", requestID); err != nil {
+		return &RequestError{RequestID: requestID, Err: err}
+	}
+
+	s.logger.Debugf("Wrote %d variables of environment '%s' on branch '%s' (request %s)", len(data), config.ID, config.Branch, requestID)
+	return nil
+}
+
+// PutIfMatchContext is like PutContextEncryptedDataContext, but sends version,
+// as returned by GetVersionedContext, in an If-Match header, so the server
+// only replaces the branch if it is still at that version. It fails with
+// ErrConflict otherwise. An empty version writes unconditionally.
+func (s *DefaultClientService) PutIfMatchContext(ctx context.Context, config *Config, data []ContextData[any], version string) error {
+	requestID := NewRequestID()
+
+	if err := s.putContextEncryptedData(ctx, config, data, version, requestID); err != nil {
+		return &RequestError{RequestID: requestID, Err: err}
+	}
+
+	s.logger.Debugf("Wrote %d variables of environment '%s' on branch '%s' (request %s)", len(data), config.ID, config.Branch, requestID)
+	return nil
+}
+
+// putContextEncryptedData performs the write for a single request ID, if the
+// branch is at version when it isn't empty.
+func (s *DefaultClientService) putContextEncryptedData(ctx context.Context, config *Config, data []ContextData[any], version, requestID string) error {
+	if config.Secret == "" || config.SecretKey == "" {
+		return errors.New("writing an environment requires its secret and secret key")
+	}
+	if data == nil {
+		data = []ContextData[any]{}
+	}
+
+	encrypted, err := s.crypto.Encrypt(data, config.SecretKey, fmt.Sprintf("%s|%s", config.Secret, config.SecretKey))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt the variables: %w", err)
+	}
+	payload, err := json.Marshal(map[string]string{"data": encrypted})
+	if err != nil {
+		return fmt.Errorf("failed to encode the variables: %w", err)
+	}
+
+	return sendWriteRequest(ctx, config, s.httpClient, http.MethodPut, bytes.NewReader(payload), version, requestID)
+}
+
+// DeleteContextData deletes the branch of config, with its tombstones.
+//
+// It sends a DELETE request to {protocol}://{ServerURL}/cli with the ID and
+// branch as query parameters and the access token, if any, as a bearer token.
+// Returns a *RequestError if the request fails.
+func (s *DefaultClientService) DeleteContextData(config *Config) error {
+	return s.DeleteContextDataContext(context.Background(), config)
+}
+
+// DeleteContextDataContext is like DeleteContextData but binds the request to
+// ctx.
+func (s *DefaultClientService) DeleteContextDataContext(ctx context.Context, config *Config) error {
+	requestID := NewRequestID()
+
+	if err := sendWriteRequest(ctx, config, s.httpClient, http.MethodDelete, nil, "", requestID); err != nil {
+		return &RequestError{RequestID: requestID, Err: err}
+	}
+
+	s.logger.Debugf("Deleted environment '%s' on branch '%s' (request %s)", config.ID, config.Branch, requestID)
+	return nil
+}
+
+// sendWriteRequest sends a PUT or DELETE /cli request with the given body and
+// checks its response. A non-empty version is sent in an If-Match header.
+func sendWriteRequest(ctx context.Context, config *Config, httpClient HTTPClient, method string, body io.Reader, version, requestID string) error {
+	u, err := url.Parse(serverBaseURL(config) + "/cli")
+	if err != nil {
+		return fmt.Errorf("failed to parse URL: %w", err)
+	}
+	params := url.Values{}
+	params.Set("id", config.ID)
+	params.Set("branch", config.Branch)
+	u.RawQuery = params.Encode()
+
+	req, err := newRequest(ctx, method, u.String(), body, requestID)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if version != "" {
+		req.Header.Set("If-Match", version)
+	}
+	if err := setAuthorization(req, config); err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return unreachableError(config, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	}
+
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		err := fmt.Errorf("environment ID '%s' on branch '%s' was changed since it was fetched", config.ID, config.Branch)
+		return classify(ErrConflict, resp.StatusCode, err)
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err := revokedError(config, resp.StatusCode, respBody); err != nil {
+		return err
+	}
+	var errorDetails string
+	if len(respBody) > 0 {
+		errorDetails = fmt.Sprintf(" - Server response: %s", string(respBody))
+	}
+	err = fmt.Errorf("server returned HTTP status %d (%s) writing environment ID '%s' on branch '%s'%s",
+		resp.StatusCode, http.StatusText(resp.StatusCode), config.ID, config.Branch, errorDetails)
+	err = classify(statusClass(resp.StatusCode), resp.StatusCode, err)
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+		err = unsupportedFeatureError(ctx, config, httpClient, requestID, FeatureWrite, err)
+	}
+	return err
+}
+
+// PutWithContext replaces the variables of the branch of config with data
+// through service, if it implements WriterClientService, and returns
+// ErrWriteUnsupported otherwise.
+func PutWithContext(ctx context.Context, service ClientService, config *Config, data []ContextData[any]) error {
+	writer, ok := service.(WriterClientService)
+	if !ok {
+		return ErrWriteUnsupported
+	}
+	return writer.PutContextEncryptedDataContext(ctx, config, data)
+}
+
+// FetchVersionedWithContext fetches the variables of the branch of config
+// through service with their version, if it implements
+// VersionedClientService. Otherwise it fetches them with FetchWithContext and
+// returns an empty version.
+func FetchVersionedWithContext(ctx context.Context, service ClientService, config *Config) ([]ContextData[any], string, error) {
+	versioned, ok := service.(VersionedClientService)
+	if !ok {
+		data, err := FetchWithContext(ctx, service, config)
+		return data, "", err
+	}
+	return versioned.GetVersionedContext(ctx, config)
+}
+
+// PutIfMatchWithContext replaces the variables of the branch of config with
+// data through service if the branch is still at version, as returned by
+// FetchVersionedWithContext, and returns ErrConflict otherwise. Without a
+// version, or for services that don't implement VersionedClientService, it
+// writes unconditionally like PutWithContext.
+func PutIfMatchWithContext(ctx context.Context, service ClientService, config *Config, data []ContextData[any], version string) error {
+	versioned, ok := service.(VersionedClientService)
+	if !ok || version == "" {
+		return PutWithContext(ctx, service, config, data)
+	}
+	return versioned.PutIfMatchContext(ctx, config, data, version)
+}
+
+// DeleteWithContext deletes the branch of config through service, if it
+// implements WriterClientService, and returns ErrWriteUnsupported otherwise.
+func DeleteWithContext(ctx context.Context, service ClientService, config *Config) error {
+	writer, ok := service.(WriterClientService)
+	if !ok {
+		return ErrWriteUnsupported
+	}
+	return writer.DeleteContextDataContext(ctx, config)
+}
@@ -0,0 +1,121 @@
+package table
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// DefaultBufferRows is the number of rows a Writer buffers in text format to
+// compute the column widths before it starts streaming.
+const DefaultBufferRows = 100
+
+// Writer streams rows in one of the supported formats as they are produced,
+// so very large outputs don't have to be held in memory.
+//
+// CSV and TSV rows are written immediately. In text format, the first
+// BufferRows rows are buffered to compute the column widths; later rows are
+// aligned (and truncated) to those widths.
+type Writer struct {
+	w       io.Writer
+	format  Format
+	headers []string
+	csv     *csv.Writer
+
+	buffered [][]string
+	widths   []int // nil until the column widths are fixed
+
+	// MaxWidth is the maximum width of text output in columns.
+	// Zero disables truncation.
+	MaxWidth int
+
+	// BufferRows is the number of rows buffered before the text layout is fixed.
+	BufferRows int
+}
+
+// NewWriter creates a streaming writer with the given column headers.
+func NewWriter(w io.Writer, format Format, headers ...string) *Writer {
+	sw := &Writer{
+		w:          w,
+		format:     format,
+		headers:    headers,
+		BufferRows: DefaultBufferRows,
+	}
+
+	switch format {
+	case FormatCSV, FormatTSV:
+		sw.csv = csv.NewWriter(w)
+		if format == FormatTSV {
+			sw.csv.Comma = '\t'
+		}
+	}
+
+	return sw
+}
+
+// Write adds a row. Missing cells are rendered empty and extra cells are ignored.
+func (sw *Writer) Write(cells ...string) error {
+	row := make([]string, len(sw.headers))
+	copy(row, cells)
+
+	if sw.csv != nil {
+		if sw.widths == nil {
+			// Use a non-nil widths slice to remember the header was written
+			sw.widths = []int{}
+			if err := sw.csv.Write(sw.headers); err != nil {
+				return err
+			}
+		}
+		if err := sw.csv.Write(row); err != nil {
+			return err
+		}
+		sw.csv.Flush()
+		return sw.csv.Error()
+	}
+
+	if sw.widths != nil {
+		_, err := io.WriteString(sw.w, formatLine(row, sw.widths))
+		return err
+	}
+
+	sw.buffered = append(sw.buffered, row)
+	if len(sw.buffered) >= sw.BufferRows {
+		return sw.flushBuffered()
+	}
+	return nil
+}
+
+// Flush writes any buffered rows. It must be called once all rows are written.
+func (sw *Writer) Flush() error {
+	if sw.csv != nil {
+		if sw.widths == nil {
+			sw.widths = []int{}
+			if err := sw.csv.Write(sw.headers); err != nil {
+				return err
+			}
+		}
+		sw.csv.Flush()
+		return sw.csv.Error()
+	}
+
+	if sw.widths == nil {
+		return sw.flushBuffered()
+	}
+	return nil
+}
+
+// flushBuffered fixes the column widths from the buffered rows and writes them.
+func (sw *Writer) flushBuffered() error {
+	sw.widths = columnWidths(sw.headers, sw.buffered, sw.MaxWidth)
+
+	if _, err := io.WriteString(sw.w, formatLine(sw.headers, sw.widths)); err != nil {
+		return err
+	}
+	for _, row := range sw.buffered {
+		if _, err := io.WriteString(sw.w, formatLine(row, sw.widths)); err != nil {
+			return err
+		}
+	}
+
+	sw.buffered = nil
+	return nil
+}
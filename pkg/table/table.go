@@ -0,0 +1,207 @@
+// Package table renders tabular CLI output as aligned text, CSV or TSV.
+//
+// Text output is width-aware: East Asian wide and fullwidth characters count as
+// two columns, and when the table does not fit into the available width the
+// widest columns are truncated with an ellipsis.
+package table
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/text/width"
+)
+
+// Format is an output format supported by Table.
+type Format string
+
+const (
+	// FormatTable renders aligned, width-aware columns.
+	FormatTable Format = "table"
+	// FormatCSV renders comma-separated values (RFC 4180).
+	FormatCSV Format = "csv"
+	// FormatTSV renders tab-separated values.
+	FormatTSV Format = "tsv"
+)
+
+// Formats lists all supported output formats.
+var Formats = []Format{FormatTable, FormatCSV, FormatTSV}
+
+const (
+	// columnGap is the number of spaces between two columns.
+	columnGap = 2
+	// minColumnWidth is the width below which columns are never truncated.
+	minColumnWidth = 6
+	// ellipsis marks truncated cells.
+	ellipsis = "…"
+)
+
+// ParseFormat parses an output format name.
+func ParseFormat(s string) (Format, error) {
+	for _, format := range Formats {
+		if strings.EqualFold(s, string(format)) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported output format %q (supported: table, csv, tsv)", s)
+}
+
+// Table accumulates rows and renders them in one of the supported formats.
+type Table struct {
+	headers []string
+	rows    [][]string
+
+	// MaxWidth is the maximum width of text output in columns.
+	// Zero disables truncation.
+	MaxWidth int
+}
+
+// New creates a table with the given column headers.
+func New(headers ...string) *Table {
+	return &Table{headers: headers}
+}
+
+// Append adds a row. Missing cells are rendered empty and extra cells are ignored.
+func (t *Table) Append(cells ...string) {
+	row := make([]string, len(t.headers))
+	copy(row, cells)
+	t.rows = append(t.rows, row)
+}
+
+// Len returns the number of rows in the table.
+func (t *Table) Len() int {
+	return len(t.rows)
+}
+
+// Render writes the table to w in the given format.
+func (t *Table) Render(w io.Writer, format Format) error {
+	sw := NewWriter(w, format, t.headers...)
+	sw.MaxWidth = t.MaxWidth
+	// Lay out the text columns using every row
+	sw.BufferRows = len(t.rows) + 1
+
+	for _, row := range t.rows {
+		if err := sw.Write(row...); err != nil {
+			return err
+		}
+	}
+
+	return sw.Flush()
+}
+
+// formatLine formats a single line of aligned text output.
+func formatLine(line []string, widths []int) string {
+	var b strings.Builder
+	for i, cell := range line {
+		cell = Truncate(sanitize(cell), widths[i])
+		b.WriteString(cell)
+
+		// Don't pad the last column to avoid trailing whitespace
+		if i < len(line)-1 {
+			b.WriteString(strings.Repeat(" ", widths[i]-StringWidth(cell)+columnGap))
+		}
+	}
+	b.WriteByte('\n')
+
+	return b.String()
+}
+
+// columnWidths computes the display width of each column, shrinking the
+// widest columns until the table fits into maxWidth.
+func columnWidths(headers []string, rows [][]string, maxWidth int) []int {
+	widths := make([]int, len(headers))
+	for i, header := range headers {
+		widths[i] = StringWidth(header)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], StringWidth(sanitize(cell)))
+		}
+	}
+
+	if maxWidth <= 0 || len(widths) == 0 {
+		return widths
+	}
+
+	available := maxWidth - columnGap*(len(widths)-1)
+	for total(widths) > available {
+		widest := 0
+		for i := range widths {
+			if widths[i] > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= minColumnWidth {
+			break
+		}
+		widths[widest]--
+	}
+
+	return widths
+}
+
+// total returns the sum of the column widths.
+func total(widths []int) int {
+	sum := 0
+	for _, w := range widths {
+		sum += w
+	}
+	return sum
+}
+
+// sanitize replaces characters that would break the column layout.
+func sanitize(s string) string {
+	return strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ").Replace(s)
+}
+
+// RuneWidth returns the number of columns the rune occupies in a terminal.
+func RuneWidth(r rune) int {
+	switch {
+	case r == 0 || r < 32 || (r >= 0x7f && r < 0xa0):
+		return 0
+	case r >= 0x300 && r <= 0x36f:
+		// Combining diacritical marks
+		return 0
+	}
+
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// StringWidth returns the number of columns the string occupies in a terminal.
+func StringWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += RuneWidth(r)
+	}
+	return n
+}
+
+// Truncate shortens s to at most maxWidth columns, marking the cut with an ellipsis.
+func Truncate(s string, maxWidth int) string {
+	if StringWidth(s) <= maxWidth {
+		return s
+	}
+	if maxWidth <= 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	used := 0
+	for _, r := range s {
+		rw := RuneWidth(r)
+		if used+rw > maxWidth-1 {
+			break
+		}
+		b.WriteRune(r)
+		used += rw
+	}
+	b.WriteString(ellipsis)
+
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package term
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ColorMode selects when output is colored.
+type ColorMode string
+
+// Supported color modes.
+const (
+	// ColorAuto colors output written to a terminal, unless the NO_COLOR
+	// environment variable is set or TERM is "dumb".
+	ColorAuto   ColorMode = "auto"
+	ColorAlways ColorMode = "always"
+	ColorNever  ColorMode = "never"
+)
+
+// ParseColorMode parses a color mode name, ignoring case. An empty name
+// selects ColorAuto.
+func ParseColorMode(name string) (ColorMode, error) {
+	switch mode := ColorMode(strings.ToLower(name)); mode {
+	case "":
+		return ColorAuto, nil
+	case ColorAuto, ColorAlways, ColorNever:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unsupported color mode %q (supported: auto, always, never)", name)
+}
+
+// Color is an ANSI SGR color or style.
+type Color string
+
+// Colors and styles used by the CLI.
+const (
+	Red    Color = "31"
+	Green  Color = "32"
+	Yellow Color = "33"
+	Bold   Color = "1"
+	Dim    Color = "2"
+)
+
+// ColorEnabled reports whether output written to f is colored in the given
+// mode. See https://no-color.org for NO_COLOR.
+func ColorEnabled(mode ColorMode, f *os.File) bool {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return IsTerminal(f)
+}
+
+// Writer writes output to a file, coloring it if colors are enabled for the
+// file. Code producing colored output writes through a Writer, so colors are
+// controlled in one place.
+type Writer struct {
+	io.Writer
+	color bool
+}
+
+// NewWriter returns a Writer on f, coloring output as selected by mode.
+func NewWriter(f *os.File, mode ColorMode) *Writer {
+	return &Writer{Writer: f, color: ColorEnabled(mode, f)}
+}
+
+// Color reports whether the output is colored.
+func (w *Writer) Color() bool {
+	return w.color
+}
+
+// Paint returns s in the given colors, or unchanged if the output isn't
+// colored.
+func (w *Writer) Paint(s string, colors ...Color) string {
+	if !w.color || len(colors) == 0 {
+		return s
+	}
+	codes := make([]string, len(colors))
+	for i, c := range colors {
+		codes[i] = string(c)
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m" + s + "\x1b[0m"
+}
+
+// Printf formats and writes to the output.
+func (w *Writer) Printf(format string, args ...any) {
+	fmt.Fprintf(w.Writer, format, args...)
+}
+
+// Println writes its arguments, separated by spaces, and a newline to the
+// output.
+func (w *Writer) Println(args ...any) {
+	fmt.Fprintln(w.Writer, args...)
+}
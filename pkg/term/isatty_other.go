@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package term
+
+import "os"
+
+// hasTermios can't query terminal attributes on this platform and assumes
+// every character device is a terminal.
+func hasTermios(_ *os.File) bool {
+	return true
+}
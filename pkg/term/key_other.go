@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package term
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// waitForKey cannot read single keypresses on this platform and only waits
+// for the timeout or ctx.
+func waitForKey(ctx context.Context, _ *os.File, timeout time.Duration) (bool, error) {
+	waitForTimeout(ctx, timeout)
+	return false, nil
+}
@@ -0,0 +1,50 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package term
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// waitForKey switches the terminal to non-canonical mode without echo and
+// polls for a single byte, so the wait can end on timeout or ctx without a
+// pending read consuming later input.
+func waitForKey(ctx context.Context, f *os.File, timeout time.Duration) (bool, error) {
+	fd := int(f.Fd())
+
+	state, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return false, err
+	}
+
+	raw := *state
+	raw.Lflag &^= unix.ECHO | unix.ICANON
+	raw.Lflag |= unix.ISIG
+	// Reads return after at most 100ms, with or without input
+	raw.Cc[unix.VMIN] = 0
+	raw.Cc[unix.VTIME] = 1
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, &raw); err != nil {
+		return false, err
+	}
+	defer unix.IoctlSetTermios(fd, ioctlWriteTermios, state) //nolint:errcheck
+
+	deadline := time.Now().Add(timeout)
+	buf := make([]byte, 1)
+	for time.Now().Before(deadline) {
+		if ctx.Err() != nil {
+			return false, nil
+		}
+		n, err := f.Read(buf)
+		if n > 0 {
+			return true, nil
+		}
+		if err != nil && err != unix.EINTR && err != unix.EAGAIN {
+			return false, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows
+
+package term
+
+import "os"
+
+// readPassword cannot disable echo on this platform and reads the line as-is.
+func readPassword(f *os.File) (string, error) {
+	return ReadLine(f)
+}
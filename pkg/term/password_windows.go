@@ -0,0 +1,28 @@
+//go:build windows
+
+package term
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// readPassword disables console echo while reading a line from f.
+func readPassword(f *os.File) (string, error) {
+	handle := windows.Handle(f.Fd())
+
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return "", err
+	}
+
+	noEcho := mode &^ windows.ENABLE_ECHO_INPUT
+	noEcho |= windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_LINE_INPUT
+	if err := windows.SetConsoleMode(handle, noEcho); err != nil {
+		return "", err
+	}
+	defer windows.SetConsoleMode(handle, mode) //nolint:errcheck
+
+	return ReadLine(f)
+}
@@ -0,0 +1,155 @@
+package term
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// spinnerFrames are the animation frames of the spinner.
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// spinnerInterval is the delay between two spinner frames.
+const spinnerInterval = 100 * time.Millisecond
+
+// Spinner shows an animated indicator with a message while an operation runs.
+//
+// A disabled spinner does nothing, so callers don't need to check whether the
+// output is a terminal themselves.
+type Spinner struct {
+	out     io.Writer
+	message string
+	enabled bool
+
+	mu      sync.Mutex
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewSpinner creates a spinner writing to f. It is disabled if quiet is set
+// or f is not a terminal.
+func NewSpinner(f *os.File, message string, quiet bool) *Spinner {
+	return &Spinner{
+		out:     f,
+		message: message,
+		enabled: !quiet && IsTerminal(f),
+	}
+}
+
+// Start starts the animation. It is a no-op if the spinner is disabled or already running.
+func (s *Spinner) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.enabled || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.stopped = make(chan struct{})
+
+	go func(stop, stopped chan struct{}) {
+		defer close(stopped)
+
+		ticker := time.NewTicker(spinnerInterval)
+		defer ticker.Stop()
+
+		for frame := 0; ; frame++ {
+			fmt.Fprintf(s.out, "\r%s %s", spinnerFrames[frame%len(spinnerFrames)], s.message)
+			select {
+			case <-stop:
+				// Clear the spinner line
+				fmt.Fprintf(s.out, "\r%s\r", strings.Repeat(" ", utf8.RuneCountInString(s.message)+2))
+				return
+			case <-ticker.C:
+			}
+		}
+	}(s.stop, s.stopped)
+}
+
+// Stop stops the animation and clears its line. It is safe to call Stop on a
+// spinner that is disabled or not running.
+func (s *Spinner) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop == nil {
+		return
+	}
+
+	close(s.stop)
+	<-s.stopped
+	s.stop = nil
+}
+
+// ProgressWriter counts the bytes written through it and reports the progress
+// of a transfer of known size on a terminal.
+type ProgressWriter struct {
+	out     io.Writer
+	message string
+	total   int64
+	written int64
+	enabled bool
+	last    time.Time
+}
+
+// NewProgressWriter creates a progress indicator writing to f for a transfer of
+// total bytes. A total of zero or less means the size is unknown. It is disabled
+// if quiet is set or f is not a terminal.
+func NewProgressWriter(f *os.File, message string, total int64, quiet bool) *ProgressWriter {
+	return &ProgressWriter{
+		out:     f,
+		message: message,
+		total:   total,
+		enabled: !quiet && IsTerminal(f),
+	}
+}
+
+// Write records the progress of len(p) bytes. It never fails, so it can be used
+// with io.TeeReader or io.MultiWriter.
+func (p *ProgressWriter) Write(b []byte) (int, error) {
+	p.written += int64(len(b))
+
+	if p.enabled && time.Since(p.last) >= spinnerInterval {
+		p.last = time.Now()
+		p.render()
+	}
+	return len(b), nil
+}
+
+// Done prints the final progress and ends the progress line.
+func (p *ProgressWriter) Done() {
+	if !p.enabled {
+		return
+	}
+	p.render()
+	fmt.Fprintln(p.out)
+}
+
+// render prints the current progress on the progress line.
+func (p *ProgressWriter) render() {
+	if p.total > 0 {
+		fmt.Fprintf(p.out, "\r%s %3d%% (%s / %s)", p.message, p.written*100/p.total, formatBytes(p.written), formatBytes(p.total))
+		return
+	}
+	fmt.Fprintf(p.out, "\r%s %s", p.message, formatBytes(p.written))
+}
+
+// formatBytes formats a byte count with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
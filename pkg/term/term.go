@@ -0,0 +1,97 @@
+// Package term provides helpers to inspect the terminal the CLI runs in.
+package term
+
+import (
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultWidth is the width assumed when the terminal width cannot be detected.
+const DefaultWidth = 80
+
+// IsTerminal reports whether the file is connected to a terminal.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0 && hasTermios(f)
+}
+
+// Width returns the width in columns of the terminal connected to f.
+//
+// The COLUMNS environment variable takes precedence. If f is not a terminal
+// and COLUMNS is not set, DefaultWidth is returned.
+func Width(f *os.File) int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	if width := terminalWidth(f); width > 0 {
+		return width
+	}
+	return DefaultWidth
+}
+
+// ReadPassword reads a line from f without echoing the typed characters.
+// If f is not a terminal, the line is read as-is. The trailing newline is not
+// included in the result, and since the user's Enter key is not echoed either,
+// callers usually print a newline afterwards.
+func ReadPassword(f *os.File) (string, error) {
+	if !IsTerminal(f) {
+		return ReadLine(f)
+	}
+	return readPassword(f)
+}
+
+// WaitForKey waits until a key is pressed on the terminal f, timeout elapses
+// or ctx is done, and reports whether a key was pressed. The key is neither
+// echoed nor left in the input. If f is not a terminal, or single keypresses
+// can't be read on this platform, it only waits for the timeout or ctx.
+func WaitForKey(ctx context.Context, f *os.File, timeout time.Duration) (bool, error) {
+	if !IsTerminal(f) {
+		waitForTimeout(ctx, timeout)
+		return false, nil
+	}
+	return waitForKey(ctx, f, timeout)
+}
+
+// waitForTimeout waits until timeout elapses or ctx is done.
+func waitForTimeout(ctx context.Context, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// ReadLine reads a single line from f, one byte at a time so that no input
+// beyond the line is consumed. The trailing newline is not included.
+func ReadLine(f *os.File) (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				break
+			}
+			line = append(line, buf[0])
+		}
+		if err == io.EOF {
+			if len(line) == 0 {
+				return "", err
+			}
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSuffix(string(line), "\r"), nil
+}
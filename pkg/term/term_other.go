@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package term
+
+import "os"
+
+// terminalWidth is not supported on this platform.
+func terminalWidth(_ *os.File) int {
+	return 0
+}